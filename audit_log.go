@@ -0,0 +1,521 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Audited actions: what operators do from the web UI or the REST API that
+// changes the node or transmits.
+const (
+	auditNodeExec          = "node_exec"
+	auditBBSSend           = "bbs_send"
+	auditBBSDelete         = "bbs_delete"
+	auditChatSend          = "chat_send"
+	auditChatCommand       = "chat_command"
+	auditChatSetName       = "chat_set_name"
+	auditChatSetTopic      = "chat_set_topic"
+	auditFeatureConnect    = "feature_connect"
+	auditFeatureDisconnect = "feature_disconnect"
+	auditUpdateSettings    = "update_settings"
+)
+
+// Audit outcomes.
+const (
+	auditOK     = "ok"
+	auditFailed = "failed"
+	auditDenied = "denied" // the user's role may not do it
+)
+
+// auditTimeLayout stores times at a fixed width, so that they sort and
+// compare as text.
+const auditTimeLayout = "2006-01-02T15:04:05.000Z"
+
+// AuditEntry is one recorded operator action.
+type AuditEntry struct {
+	ID       int64     `json:"id"`
+	Time     time.Time `json:"time"`
+	User     string    `json:"user,omitempty"` // web user, once logins are on
+	Remote   string    `json:"remote"`         // client address
+	Via      string    `json:"via"`            // the endpoint: /ws, /ws/node, /api/v1/node/exec, ...
+	Action   string    `json:"action"`
+	Detail   string    `json:"detail,omitempty"` // the command or message, as sent
+	Transmit bool      `json:"transmit"`         // sends as the station: node commands, chat, BBS mail
+	Outcome  string    `json:"outcome"`          // ok, failed or denied
+	Error    string    `json:"error,omitempty"`
+}
+
+// AuditStore is the append-only SQLite audit log. Entries cannot be
+// changed, and rotation only drops entries from before coveredSince,
+// which it moves forward first, so a report always says how far back the
+// log is complete. Periods in which entries could not be recorded are
+// kept as gaps, which no report over them calls complete.
+type AuditStore struct {
+	db *sql.DB
+	mu sync.Mutex
+	// gapSince is when recording started failing, if it has; the gap is
+	// written with the next entry that can be.
+	gapSince time.Time
+}
+
+// auditStoreRef is set in main, which will not start without it; actions
+// are only logged while it is nil, as in tests.
+var auditStoreRef *AuditStore
+
+// NewAuditStore opens or creates the audit log database.
+func NewAuditStore(dbPath string) (*AuditStore, error) {
+	db, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit database: %w", err)
+	}
+	if _, err := db.Exec("PRAGMA journal_mode=WAL"); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to enable WAL: %w", err)
+	}
+
+	schema := `
+	CREATE TABLE IF NOT EXISTS audit_log (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		time TEXT NOT NULL,
+		username TEXT NOT NULL DEFAULT '',
+		remote TEXT NOT NULL DEFAULT '',
+		via TEXT NOT NULL DEFAULT '',
+		action TEXT NOT NULL,
+		detail TEXT NOT NULL DEFAULT '',
+		transmit INTEGER NOT NULL DEFAULT 0,
+		outcome TEXT NOT NULL,
+		error TEXT NOT NULL DEFAULT ''
+	);
+	CREATE INDEX IF NOT EXISTS idx_audit_log_time ON audit_log(time);
+	CREATE TABLE IF NOT EXISTS audit_gaps (
+		gap_start TEXT NOT NULL,
+		gap_end TEXT NOT NULL
+	);
+	CREATE TABLE IF NOT EXISTS audit_meta (
+		key TEXT PRIMARY KEY,
+		value TEXT NOT NULL
+	);
+	CREATE TRIGGER IF NOT EXISTS audit_log_no_update BEFORE UPDATE ON audit_log
+	BEGIN
+		SELECT RAISE(ABORT, 'the audit log is append-only');
+	END;
+	CREATE TRIGGER IF NOT EXISTS audit_log_rotate_only BEFORE DELETE ON audit_log
+	WHEN OLD.time >= (SELECT value FROM audit_meta WHERE key = 'covered_since')
+	BEGIN
+		SELECT RAISE(ABORT, 'only rotated audit entries can be deleted');
+	END;
+	CREATE TRIGGER IF NOT EXISTS audit_gaps_no_update BEFORE UPDATE ON audit_gaps
+	BEGIN
+		SELECT RAISE(ABORT, 'the audit log is append-only');
+	END;
+	CREATE TRIGGER IF NOT EXISTS audit_gaps_rotate_only BEFORE DELETE ON audit_gaps
+	WHEN OLD.gap_end >= (SELECT value FROM audit_meta WHERE key = 'covered_since')
+	BEGIN
+		SELECT RAISE(ABORT, 'only rotated audit gaps can be deleted');
+	END;
+	CREATE TRIGGER IF NOT EXISTS audit_meta_no_rewind BEFORE UPDATE ON audit_meta
+	WHEN NEW.key = 'covered_since' AND NEW.value < OLD.value
+	BEGIN
+		SELECT RAISE(ABORT, 'audit coverage cannot move back');
+	END;
+	`
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create audit tables: %w", err)
+	}
+	// A new log covers from its creation
+	if _, err := db.Exec(`INSERT OR IGNORE INTO audit_meta (key, value) VALUES ('covered_since', ?)`,
+		time.Now().UTC().Format(auditTimeLayout)); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialise audit coverage: %w", err)
+	}
+	return &AuditStore{db: db}, nil
+}
+
+// Record appends an entry, setting its ID. If it cannot, the log has a
+// gap from then until an entry can be recorded again.
+func (s *AuditStore) Record(e *AuditEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.record(e); err != nil {
+		if s.gapSince.IsZero() {
+			s.gapSince = e.Time
+		}
+		return err
+	}
+	s.gapSince = time.Time{}
+	return nil
+}
+
+// record writes an entry, and the open gap if there is one, in one
+// transaction. The caller holds s.mu.
+func (s *AuditStore) record(e *AuditEntry) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to record audit entry: %w", err)
+	}
+	defer tx.Rollback()
+
+	if !s.gapSince.IsZero() {
+		if _, err := tx.Exec(`INSERT INTO audit_gaps (gap_start, gap_end) VALUES (?, ?)`,
+			s.gapSince.UTC().Format(auditTimeLayout), e.Time.UTC().Format(auditTimeLayout)); err != nil {
+			return fmt.Errorf("failed to record audit gap: %w", err)
+		}
+	}
+	transmit := 0
+	if e.Transmit {
+		transmit = 1
+	}
+	res, err := tx.Exec(`
+		INSERT INTO audit_log (time, username, remote, via, action, detail, transmit, outcome, error)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		e.Time.UTC().Format(auditTimeLayout), e.User, e.Remote, e.Via, e.Action, e.Detail, transmit, e.Outcome, e.Error)
+	if err != nil {
+		return fmt.Errorf("failed to record audit entry: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to record audit entry: %w", err)
+	}
+	e.ID, _ = res.LastInsertId()
+	return nil
+}
+
+// CoveredSince returns the time from which the log is complete: its
+// creation, or the last rotation's cutoff.
+func (s *AuditStore) CoveredSince() (time.Time, error) {
+	var v string
+	if err := s.db.QueryRow(`SELECT value FROM audit_meta WHERE key = 'covered_since'`).Scan(&v); err != nil {
+		return time.Time{}, fmt.Errorf("failed to read audit coverage: %w", err)
+	}
+	return time.Parse(auditTimeLayout, v)
+}
+
+// Purge drops entries older than retention, first moving coveredSince up
+// to the cutoff.
+func (s *AuditStore) Purge(retention time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cutoff := time.Now().UTC().Add(-retention).Format(auditTimeLayout)
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to purge audit log: %w", err)
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(`UPDATE audit_meta SET value = ? WHERE key = 'covered_since' AND value < ?`, cutoff, cutoff); err != nil {
+		return fmt.Errorf("failed to move audit coverage: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM audit_log WHERE time < ?`, cutoff); err != nil {
+		return fmt.Errorf("failed to purge audit log: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM audit_gaps WHERE gap_end < ?`, cutoff); err != nil {
+		return fmt.Errorf("failed to purge audit gaps: %w", err)
+	}
+	return tx.Commit()
+}
+
+// runAuditPurge drops audit entries older than retention once a day until
+// ctx is done.
+func runAuditPurge(ctx context.Context, store *AuditStore, retention time.Duration) {
+	ticker := time.NewTicker(24 * time.Hour)
+	defer ticker.Stop()
+
+	for {
+		if err := store.Purge(retention); err != nil {
+			auditLog.Errorw("Audit log purge failed", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Close closes the database, first writing the open gap, if there is one
+// and it can.
+func (s *AuditStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.gapSince.IsZero() {
+		if _, err := s.db.Exec(`INSERT INTO audit_gaps (gap_start, gap_end) VALUES (?, ?)`,
+			s.gapSince.UTC().Format(auditTimeLayout), time.Now().UTC().Format(auditTimeLayout)); err != nil {
+			auditLog.Errorw("Failed to record audit gap", "since", s.gapSince, "error", err)
+		}
+	}
+	return s.db.Close()
+}
+
+// AuditFilter selects audit entries. Zero times leave the period open.
+type AuditFilter struct {
+	Since    time.Time
+	Until    time.Time
+	Action   string
+	User     string
+	Transmit bool // only actions that transmit
+	Limit    int
+}
+
+// AuditReport is the audit log over a period.
+type AuditReport struct {
+	Type         string     `json:"type"` // "audit_log"
+	Since        *time.Time `json:"since,omitempty"`
+	Until        time.Time  `json:"until"`
+	CoveredSince time.Time  `json:"coveredSince"` // the log is complete from here on
+	// Complete is whether the log covers the whole period, so that an
+	// empty one shows nothing was done.
+	Complete bool `json:"complete"`
+	// Gaps are the parts of the period in which entries could not be
+	// recorded.
+	Gaps []AuditGap `json:"gaps,omitempty"`
+	// Transmissions counts the period's actions that transmitted and
+	// succeeded, whoever did them, whatever the other filters.
+	Transmissions int          `json:"transmissions"`
+	Entries       []AuditEntry `json:"entries"`             // newest first
+	Truncated     bool         `json:"truncated,omitempty"` // there were more than the limit
+}
+
+// AuditGap is a period in which the audit log could not record entries.
+// An open gap has no end yet.
+type AuditGap struct {
+	Start time.Time  `json:"start"`
+	End   *time.Time `json:"end,omitempty"`
+}
+
+// Report returns the entries f selects and what the log can say about
+// f's period.
+func (s *AuditStore) Report(f AuditFilter) (*AuditReport, error) {
+	if f.Until.IsZero() {
+		f.Until = time.Now()
+	}
+	if f.Limit <= 0 || f.Limit > 10000 {
+		f.Limit = 1000
+	}
+	covered, err := s.CoveredSince()
+	if err != nil {
+		return nil, err
+	}
+	report := &AuditReport{
+		Type:         "audit_log",
+		Until:        f.Until.UTC(),
+		CoveredSince: covered,
+		Complete:     !f.Since.IsZero() && !f.Since.Before(covered),
+		Entries:      []AuditEntry{},
+	}
+	if !f.Since.IsZero() {
+		since := f.Since.UTC()
+		report.Since = &since
+	}
+
+	period := ` WHERE time >= ? AND time <= ?`
+	args := []interface{}{f.Since.UTC().Format(auditTimeLayout), f.Until.UTC().Format(auditTimeLayout)}
+	if f.Since.IsZero() {
+		args[0] = ""
+	}
+
+	if report.Gaps, err = s.gaps(args[0].(string), args[1].(string), f.Until); err != nil {
+		return nil, err
+	}
+	if len(report.Gaps) > 0 {
+		report.Complete = false
+	}
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM audit_log`+period+` AND transmit = 1 AND outcome = ?`,
+		append(args, auditOK)...).Scan(&report.Transmissions); err != nil {
+		return nil, fmt.Errorf("failed to count transmissions: %w", err)
+	}
+
+	where := period
+	if f.Action != "" {
+		where += ` AND action = ?`
+		args = append(args, f.Action)
+	}
+	if f.User != "" {
+		where += ` AND username = ?`
+		args = append(args, f.User)
+	}
+	if f.Transmit {
+		where += ` AND transmit = 1`
+	}
+	rows, err := s.db.Query(`
+		SELECT id, time, username, remote, via, action, detail, transmit, outcome, error
+		FROM audit_log`+where+` ORDER BY id DESC LIMIT ?`, append(args, f.Limit+1)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query audit log: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var e AuditEntry
+		var t string
+		if err := rows.Scan(&e.ID, &t, &e.User, &e.Remote, &e.Via, &e.Action, &e.Detail, &e.Transmit, &e.Outcome, &e.Error); err != nil {
+			return nil, fmt.Errorf("failed to read audit entry: %w", err)
+		}
+		e.Time, _ = time.Parse(auditTimeLayout, t)
+		if len(report.Entries) == f.Limit {
+			report.Truncated = true
+			break
+		}
+		report.Entries = append(report.Entries, e)
+	}
+	return report, rows.Err()
+}
+
+// gaps returns the recorded gaps overlapping [since, until], and the open
+// one if it started by until.
+func (s *AuditStore) gaps(since, until string, untilTime time.Time) ([]AuditGap, error) {
+	rows, err := s.db.Query(`SELECT gap_start, gap_end FROM audit_gaps WHERE gap_end >= ? AND gap_start <= ? ORDER BY gap_start`, since, until)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query audit gaps: %w", err)
+	}
+	defer rows.Close()
+	var gaps []AuditGap
+	for rows.Next() {
+		var start, end string
+		if err := rows.Scan(&start, &end); err != nil {
+			return nil, fmt.Errorf("failed to read audit gap: %w", err)
+		}
+		g := AuditGap{}
+		g.Start, _ = time.Parse(auditTimeLayout, start)
+		t, _ := time.Parse(auditTimeLayout, end)
+		g.End = &t
+		gaps = append(gaps, g)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query audit gaps: %w", err)
+	}
+
+	s.mu.Lock()
+	open := s.gapSince
+	s.mu.Unlock()
+	if !open.IsZero() && !open.After(untilTime) {
+		gaps = append(gaps, AuditGap{Start: open.UTC()})
+	}
+	return gaps, nil
+}
+
+// auditActor is who an action is recorded against.
+type auditActor struct {
+	user   string
+	remote string
+	via    string
+}
+
+// requestActor returns the user and client behind a request.
+func requestActor(r *http.Request) auditActor {
+	a := auditActor{remote: r.RemoteAddr, via: r.URL.Path}
+	if u := requestUser(r); u != nil {
+		a.user = u.Username
+	}
+	return a
+}
+
+// record adds an action to the audit log. err is why it failed, if it
+// did; a permission-denied error records it as denied.
+func (a auditActor) record(action, detail string, transmit bool, err error) {
+	e := AuditEntry{
+		Time:     time.Now().UTC(),
+		User:     a.user,
+		Remote:   a.remote,
+		Via:      a.via,
+		Action:   action,
+		Detail:   detail,
+		Transmit: transmit,
+		Outcome:  auditOK,
+	}
+	if err != nil {
+		e.Outcome = auditFailed
+		e.Error = err.Error()
+		var werr *wsError
+		if errors.As(err, &werr) && werr.code == wsErrPermissionDenied {
+			e.Outcome = auditDenied
+		}
+	}
+	auditLog.Infow("Operator action", "action", action, "outcome", e.Outcome, "user", a.user, "remote", a.remote, "via", a.via, "detail", detail)
+	if auditStoreRef == nil {
+		return
+	}
+	if err := auditStoreRef.Record(&e); err != nil {
+		auditLog.Errorw("Failed to record operator action", "action", action, "error", err)
+	}
+}
+
+// errAuditDenied records an attempt the user's role did not allow.
+var errAuditDenied = wsErrorf(wsErrPermissionDenied, "permission denied")
+
+// bbsSendDetail is a BBS message's audit detail: the command, subject and
+// body as sent.
+func bbsSendDetail(to, subject, body string, bulletin bool) string {
+	cmd := "SP "
+	if bulletin {
+		cmd = "SB "
+	}
+	return cmd + to + "\n" + subject + "\n" + body
+}
+
+// settingsAuditDetail describes a settings change, without the password.
+func settingsAuditDetail(feature string, fs *FeatureSettings, passwordChanged, passwordCleared bool) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s enabled=%t host=%s port=%d callsign=%s", feature, fs.Enabled, fs.Host, fs.Port, fs.Callsign)
+	if len(fs.Options) > 0 {
+		fmt.Fprintf(&b, " options=%v", fs.Options)
+	}
+	switch {
+	case passwordCleared:
+		b.WriteString(" password=cleared")
+	case passwordChanged:
+		b.WriteString(" password=changed")
+	}
+	return b.String()
+}
+
+// AuditParams selects audit entries for /api/v1/audit.
+type AuditParams struct {
+	Since    string `json:"since,omitempty"` // RFC 3339 time or YYYY-MM-DD
+	Until    string `json:"until,omitempty"`
+	Action   string `json:"action,omitempty"`
+	User     string `json:"user,omitempty"`
+	Transmit bool   `json:"transmit,omitempty"` // only actions that transmit
+	Limit    int    `json:"limit,omitempty"`    // default 1000, at most 10000
+}
+
+// restAudit serves /api/v1/audit.
+func restAudit(w http.ResponseWriter, r *http.Request) {
+	var p AuditParams
+	if err := decodeRESTParams(r, &p); err != nil {
+		writeRESTError(w, "audit", err)
+		return
+	}
+	if auditStoreRef == nil {
+		writeRESTError(w, "audit", wsErrorf(wsErrUnavailable, "the audit log is not open"))
+		return
+	}
+	f := AuditFilter{Action: p.Action, User: p.User, Transmit: p.Transmit, Limit: p.Limit}
+	for name, v := range map[string]string{"since": p.Since, "until": p.Until} {
+		if v == "" {
+			continue
+		}
+		t, err := parseTimeParam(name, v)
+		if err != nil {
+			writeRESTError(w, "audit", wsErrorf(wsErrInvalidParams, "%v", err))
+			return
+		}
+		if name == "since" {
+			f.Since = t
+		} else {
+			f.Until = t
+		}
+	}
+	report, err := auditStoreRef.Report(f)
+	if err != nil {
+		writeRESTError(w, "audit", err)
+		return
+	}
+	writeJSONStatus(w, http.StatusOK, report)
+}
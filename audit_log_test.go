@@ -0,0 +1,159 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestAuditStore(t *testing.T) *AuditStore {
+	t.Helper()
+	s, err := NewAuditStore(filepath.Join(t.TempDir(), "audit.db"))
+	if err != nil {
+		t.Fatalf("NewAuditStore: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+// Recorded actions come back newest first, and the report counts what
+// transmitted and says whether the log covers the period.
+func TestAuditReport(t *testing.T) {
+	s := newTestAuditStore(t)
+	old := auditStoreRef
+	auditStoreRef = s
+	t.Cleanup(func() { auditStoreRef = old })
+
+	start := time.Now().Add(-time.Second)
+	actor := auditActor{user: "sysop", remote: "192.0.2.1:5000", via: "/ws/node"}
+	actor.record(auditNodeExec, "ROUTES", true, nil)
+	actor.record(auditChatSend, "hello", true, errNoChat)
+	auditActor{user: "club", remote: "192.0.2.2:5000", via: "/ws/bbs"}.record(auditBBSSend, bbsSendDetail("ALL", "Net", "Tonight", true), true, errAuditDenied)
+	actor.record(auditUpdateSettings, "chat enabled=true", false, nil)
+
+	r, err := s.Report(AuditFilter{Since: start})
+	if err != nil {
+		t.Fatalf("Report: %v", err)
+	}
+	if len(r.Entries) != 4 || r.Entries[0].Action != auditUpdateSettings || r.Entries[3].Detail != "ROUTES" {
+		t.Fatalf("entries = %+v", r.Entries)
+	}
+	if got := []string{r.Entries[1].Outcome, r.Entries[2].Outcome}; got[0] != auditDenied || got[1] != auditFailed {
+		t.Errorf("outcomes = %v, want denied, failed", got)
+	}
+	if r.Transmissions != 1 {
+		t.Errorf("transmissions = %d, want 1: only the node command went out", r.Transmissions)
+	}
+	// The log was created just now, so it cannot vouch for the hour before
+	if r.Complete {
+		t.Errorf("complete from %v, but covered only since %v", start, r.CoveredSince)
+	}
+	r, _ = s.Report(AuditFilter{Since: r.CoveredSince, User: "club", Limit: 1})
+	if !r.Complete || len(r.Entries) != 1 || r.Entries[0].User != "club" || r.Transmissions != 1 {
+		t.Errorf("club's report = %+v", r)
+	}
+	r, _ = s.Report(AuditFilter{Transmit: true, Limit: 2})
+	if len(r.Entries) != 2 || !r.Truncated {
+		t.Errorf("transmit report with limit 2 = %d entries, truncated %v", len(r.Entries), r.Truncated)
+	}
+}
+
+// Entries cannot be changed, and can only be deleted by rotation, which
+// moves the coverage forward first.
+func TestAuditAppendOnly(t *testing.T) {
+	s := newTestAuditStore(t)
+	past := &AuditEntry{Time: time.Now().Add(-48 * time.Hour), Remote: "192.0.2.1:5000", Action: auditNodeExec, Detail: "C 2 KA2DEW", Transmit: true, Outcome: auditOK}
+	recent := &AuditEntry{Time: time.Now(), Remote: "192.0.2.1:5000", Action: auditChatSend, Detail: "hi", Transmit: true, Outcome: auditOK}
+	for _, e := range []*AuditEntry{past, recent} {
+		if err := s.Record(e); err != nil {
+			t.Fatalf("Record: %v", err)
+		}
+	}
+
+	if _, err := s.db.Exec(`UPDATE audit_log SET outcome = 'failed' WHERE id = ?`, recent.ID); err == nil {
+		t.Error("an entry was changed")
+	}
+	if _, err := s.db.Exec(`DELETE FROM audit_log WHERE id = ?`, recent.ID); err == nil {
+		t.Error("an entry inside the covered period was deleted")
+	}
+	if _, err := s.db.Exec(`UPDATE audit_meta SET value = '2000-01-01T00:00:00.000Z' WHERE key = 'covered_since'`); err == nil {
+		t.Error("the coverage moved back")
+	}
+
+	created, _ := s.CoveredSince()
+	if err := s.Purge(24 * time.Hour); err != nil {
+		t.Fatalf("Purge: %v", err)
+	}
+	r, err := s.Report(AuditFilter{})
+	if err != nil {
+		t.Fatalf("Report: %v", err)
+	}
+	if len(r.Entries) != 1 || r.Entries[0].ID != recent.ID {
+		t.Errorf("after purge: %+v", r.Entries)
+	}
+	// The cutoff is before the log was created, which it still covers from
+	if !r.CoveredSince.Equal(created) {
+		t.Errorf("covered since %v, want %v", r.CoveredSince, created)
+	}
+	if r.Complete {
+		t.Error("a report with no start is never complete")
+	}
+
+	if err := s.Purge(0); err != nil {
+		t.Fatalf("Purge: %v", err)
+	}
+	r, _ = s.Report(AuditFilter{})
+	if len(r.Entries) != 0 || r.CoveredSince.Before(recent.Time.Truncate(time.Millisecond)) {
+		t.Errorf("after purging everything: covered since %v, %d entries", r.CoveredSince, len(r.Entries))
+	}
+}
+
+// While entries cannot be written the log has a gap, and no report over it
+// is complete, even once recording works again.
+func TestAuditGaps(t *testing.T) {
+	s := newTestAuditStore(t)
+	created, _ := s.CoveredSince()
+	e := func() *AuditEntry {
+		return &AuditEntry{Time: time.Now(), Remote: "192.0.2.1:5000", Action: auditChatSend, Detail: "hi", Transmit: true, Outcome: auditOK}
+	}
+
+	if _, err := s.db.Exec(`CREATE TRIGGER audit_log_broken BEFORE INSERT ON audit_log
+		BEGIN SELECT RAISE(ABORT, 'disk full'); END`); err != nil {
+		t.Fatalf("create trigger: %v", err)
+	}
+	failed := e()
+	if err := s.Record(failed); err == nil {
+		t.Fatal("Record succeeded with inserts failing")
+	}
+	r, err := s.Report(AuditFilter{Since: created})
+	if err != nil {
+		t.Fatalf("Report: %v", err)
+	}
+	if r.Complete || len(r.Gaps) != 1 || r.Gaps[0].End != nil {
+		t.Errorf("while failing: complete %v, gaps %+v; want one open gap", r.Complete, r.Gaps)
+	}
+
+	if _, err := s.db.Exec(`DROP TRIGGER audit_log_broken`); err != nil {
+		t.Fatalf("drop trigger: %v", err)
+	}
+	time.Sleep(2 * time.Millisecond)
+	recorded := e()
+	if err := s.Record(recorded); err != nil {
+		t.Fatalf("Record: %v", err)
+	}
+	r, _ = s.Report(AuditFilter{Since: created})
+	if r.Complete || len(r.Gaps) != 1 || r.Gaps[0].End == nil || len(r.Entries) != 1 {
+		t.Fatalf("after recovering: complete %v, gaps %+v, %d entries", r.Complete, r.Gaps, len(r.Entries))
+	}
+	if !r.Gaps[0].Start.Equal(failed.Time.UTC().Truncate(time.Millisecond)) {
+		t.Errorf("gap starts %v, want %v", r.Gaps[0].Start, failed.Time)
+	}
+	// After the gap the log covers the period again
+	r, _ = s.Report(AuditFilter{Since: r.Gaps[0].End.Add(time.Millisecond)})
+	if !r.Complete || len(r.Gaps) != 0 {
+		t.Errorf("after the gap: complete %v, gaps %+v", r.Complete, r.Gaps)
+	}
+	if _, err := s.db.Exec(`DELETE FROM audit_gaps`); err == nil {
+		t.Error("a gap inside the covered period was deleted")
+	}
+}
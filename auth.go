@@ -0,0 +1,685 @@
+package main
+
+import (
+	"context"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Role is what a web user may do. Each role can do everything the ones
+// below it can.
+type Role string
+
+const (
+	// RoleViewer can watch the monitor, sessions, stats and chat.
+	RoleViewer Role = "viewer"
+	// RoleOperator can also act as the station: run node commands, send
+	// chat and BBS mail, and connect or disconnect features.
+	RoleOperator Role = "operator"
+	// RoleAdmin can also change feature settings and manage web users.
+	RoleAdmin Role = "admin"
+)
+
+var roleRank = map[Role]int{RoleViewer: 1, RoleOperator: 2, RoleAdmin: 3}
+
+// Valid reports whether r is a known role.
+func (r Role) Valid() bool {
+	return roleRank[r] > 0
+}
+
+// Allows reports whether r may do what need may.
+func (r Role) Allows(need Role) bool {
+	return roleRank[r] >= roleRank[need]
+}
+
+const (
+	// authCookieName holds the session token for browsers.
+	authCookieName = "tarpn_mon_session"
+
+	// authSessionTTL is how long a session lasts without being used.
+	authSessionTTL = 7 * 24 * time.Hour
+
+	// passwordSaltLen and passwordKeyLen size the PBKDF2 salt and output.
+	passwordSaltLen = 16
+	passwordKeyLen  = 32
+	minPasswordLen  = 8
+)
+
+// passwordIterations is the PBKDF2-SHA256 work factor for new hashes. It is
+// stored in each hash, so raising it does not invalidate existing ones.
+var passwordIterations = 600000
+
+var usernameRe = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,31}$`)
+
+// hashPassword returns password hashed with a new random salt, as
+// "pbkdf2-sha256$iterations$salt$key".
+func hashPassword(password string) (string, error) {
+	salt := make([]byte, passwordSaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("failed to generate salt: %w", err)
+	}
+	key, err := pbkdf2.Key(sha256.New, password, salt, passwordIterations, passwordKeyLen)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash password: %w", err)
+	}
+	return fmt.Sprintf("pbkdf2-sha256$%d$%s$%s", passwordIterations,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// checkPassword reports whether password matches a hash from hashPassword.
+func checkPassword(hash, password string) bool {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 4 || parts[0] != "pbkdf2-sha256" {
+		return false
+	}
+	iter, err := strconv.Atoi(parts[1])
+	if err != nil || iter <= 0 {
+		return false
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return false
+	}
+	want, err := base64.RawStdEncoding.DecodeString(parts[3])
+	if err != nil {
+		return false
+	}
+	got, err := pbkdf2.Key(sha256.New, password, salt, iter, len(want))
+	if err != nil {
+		return false
+	}
+	return subtle.ConstantTimeCompare(got, want) == 1
+}
+
+// WebUser is a local account for the web UI and APIs.
+type WebUser struct {
+	Username     string    `json:"username"`
+	Role         Role      `json:"role"`
+	PasswordHash string    `json:"passwordHash,omitempty"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+// UserStore keeps web users in a JSON file readable only by its owner.
+type UserStore struct {
+	mu    sync.RWMutex
+	path  string
+	users map[string]*WebUser
+}
+
+// NewUserStore returns a store backed by path. Call Load to read it.
+func NewUserStore(path string) *UserStore {
+	return &UserStore{path: path, users: make(map[string]*WebUser)}
+}
+
+// Load reads the users file. A missing file is not an error and leaves the
+// store empty.
+func (s *UserStore) Load() error {
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read users file: %w", err)
+	}
+	if err := enforcePrivateMode(s.path); err != nil {
+		return err
+	}
+	var file struct {
+		Users []*WebUser `json:"users"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("failed to parse users file: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.users = make(map[string]*WebUser)
+	for _, u := range file.Users {
+		if u != nil && u.Username != "" {
+			s.users[strings.ToLower(u.Username)] = u
+		}
+	}
+	return nil
+}
+
+// saveLocked writes the users file with mode 0600, replacing it only once
+// the new one is complete.
+func (s *UserStore) saveLocked() error {
+	file := struct {
+		Users []*WebUser `json:"users"`
+	}{Users: s.listLocked()}
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode users: %w", err)
+	}
+	if err := writePrivateFile(s.path, append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write users file: %w", err)
+	}
+	return nil
+}
+
+func (s *UserStore) listLocked() []*WebUser {
+	list := make([]*WebUser, 0, len(s.users))
+	for _, u := range s.users {
+		list = append(list, u)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Username < list[j].Username })
+	return list
+}
+
+// Count returns the number of users. With none, authentication is off.
+func (s *UserStore) Count() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.users)
+}
+
+// Get returns a copy of a user, or nil.
+func (s *UserStore) Get(username string) *WebUser {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	u, ok := s.users[strings.ToLower(username)]
+	if !ok {
+		return nil
+	}
+	cp := *u
+	return &cp
+}
+
+// List returns copies of all users without their password hashes.
+func (s *UserStore) List() []WebUser {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	list := make([]WebUser, 0, len(s.users))
+	for _, u := range s.listLocked() {
+		cp := *u
+		cp.PasswordHash = ""
+		list = append(list, cp)
+	}
+	return list
+}
+
+// SetUser creates a user or updates an existing one's role and, if
+// password is not empty, password, and saves the file.
+func (s *UserStore) SetUser(username, password string, role Role) error {
+	if !usernameRe.MatchString(username) {
+		return fmt.Errorf("invalid username %q", username)
+	}
+	if !role.Valid() {
+		return fmt.Errorf("invalid role %q", role)
+	}
+	if password != "" && len(password) < minPasswordLen {
+		return fmt.Errorf("password must be at least %d characters", minPasswordLen)
+	}
+	var hash string
+	if password != "" {
+		var err error
+		if hash, err = hashPassword(password); err != nil {
+			return err
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := strings.ToLower(username)
+	u, ok := s.users[key]
+	if !ok {
+		if hash == "" {
+			return fmt.Errorf("a password is required for a new user")
+		}
+		u = &WebUser{Username: username, CreatedAt: time.Now().UTC()}
+		s.users[key] = u
+	} else if u.Role == RoleAdmin && role != RoleAdmin && s.adminCountLocked() == 1 {
+		return fmt.Errorf("cannot demote the last admin")
+	}
+	u.Role = role
+	if hash != "" {
+		u.PasswordHash = hash
+	}
+	return s.saveLocked()
+}
+
+// DeleteUser removes a user and saves the file. The last admin cannot be
+// removed, as nobody could then manage the others; to turn authentication
+// off, delete the users file.
+func (s *UserStore) DeleteUser(username string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := strings.ToLower(username)
+	u, ok := s.users[key]
+	if !ok {
+		return fmt.Errorf("no user %q", username)
+	}
+	if u.Role == RoleAdmin && s.adminCountLocked() == 1 {
+		return fmt.Errorf("cannot delete the last admin")
+	}
+	delete(s.users, key)
+	return s.saveLocked()
+}
+
+func (s *UserStore) adminCountLocked() int {
+	n := 0
+	for _, u := range s.users {
+		if u.Role == RoleAdmin {
+			n++
+		}
+	}
+	return n
+}
+
+// Authenticate returns the user if password is theirs.
+func (s *UserStore) Authenticate(username, password string) *WebUser {
+	u := s.Get(username)
+	if u == nil || !checkPassword(u.PasswordHash, password) {
+		return nil
+	}
+	return u
+}
+
+// authSession is a logged-in browser or API client.
+type authSession struct {
+	username string
+	expires  time.Time
+}
+
+// WebAuth authenticates HTTP and WebSocket requests against a UserStore and
+// enforces the role each route needs. It is off (everything allowed) while
+// the store has no users, so that an existing install keeps working until
+// an admin is created with -add-user.
+type WebAuth struct {
+	users *UserStore
+
+	mu       sync.Mutex
+	sessions map[string]*authSession
+
+	allowAllOrigins bool
+	allowedOrigins  map[string]bool
+}
+
+// NewWebAuth returns a WebAuth for users. origins lists the extra origins
+// (scheme://host[:port]) WebSockets may be opened from besides the page's
+// own; "*" allows any.
+func NewWebAuth(users *UserStore, origins []string) *WebAuth {
+	a := &WebAuth{
+		users:          users,
+		sessions:       make(map[string]*authSession),
+		allowedOrigins: make(map[string]bool),
+	}
+	for _, o := range origins {
+		o = strings.TrimRight(strings.ToLower(strings.TrimSpace(o)), "/")
+		switch o {
+		case "":
+		case "*":
+			a.allowAllOrigins = true
+		default:
+			a.allowedOrigins[o] = true
+		}
+	}
+	return a
+}
+
+// webAuthRef is set in main for the handlers.
+var webAuthRef *WebAuth
+
+// Enabled reports whether requests need to be authenticated.
+func (a *WebAuth) Enabled() bool {
+	return a.users.Count() > 0
+}
+
+// Login checks a username and password and starts a session, returning its
+// token.
+func (a *WebAuth) Login(username, password string) (string, *WebUser, error) {
+	u := a.users.Authenticate(username, password)
+	if u == nil {
+		return "", nil, fmt.Errorf("invalid username or password")
+	}
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", nil, fmt.Errorf("failed to generate session token: %w", err)
+	}
+	token := hex.EncodeToString(buf)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.sessions[token] = &authSession{username: u.Username, expires: time.Now().Add(authSessionTTL)}
+	return token, u, nil
+}
+
+// Logout ends the session for token.
+func (a *WebAuth) Logout(token string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.sessions, token)
+}
+
+// lookup returns the user for a session token, extending the session. The
+// user is read from the store each time, so a changed role or a deleted
+// user takes effect at once.
+func (a *WebAuth) lookup(token string) *WebUser {
+	if token == "" {
+		return nil
+	}
+	now := time.Now()
+
+	a.mu.Lock()
+	s, ok := a.sessions[token]
+	if ok && now.After(s.expires) {
+		delete(a.sessions, token)
+		ok = false
+	}
+	if ok {
+		s.expires = now.Add(authSessionTTL)
+	}
+	for t, other := range a.sessions {
+		if now.After(other.expires) {
+			delete(a.sessions, t)
+		}
+	}
+	a.mu.Unlock()
+
+	if !ok {
+		return nil
+	}
+	u := a.users.Get(s.username)
+	if u == nil {
+		a.Logout(token)
+	}
+	return u
+}
+
+// requestToken returns the bearer token or session cookie sent with r.
+func requestToken(r *http.Request) string {
+	if h := r.Header.Get("Authorization"); len(h) > 7 && strings.EqualFold(h[:7], "Bearer ") {
+		return strings.TrimSpace(h[7:])
+	}
+	if c, err := r.Cookie(authCookieName); err == nil {
+		return c.Value
+	}
+	return ""
+}
+
+// CheckOrigin reports whether a WebSocket may be opened from r's Origin:
+// clients that send none (not browsers), the page's own origin, and the
+// allow-list.
+func (a *WebAuth) CheckOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" || a.allowAllOrigins {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	if strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	return a.allowedOrigins[strings.ToLower(u.Scheme+"://"+u.Host)]
+}
+
+// routeRole returns the role a path needs, or "" if it is public. The page
+// and its assets, the login endpoints and /metrics are public; every
+// WebSocket, /api/ and the reports need a login.
+func routeRole(path string) Role {
+	switch {
+	case path == "/login", path == "/api/login", path == "/api/logout":
+		return ""
+	case path == "/api/users", path == "/api/websockets", path == "/api/v1/audit":
+		return RoleAdmin
+	case path == "/ws/node", path == "/api/v1/node", strings.HasPrefix(path, "/api/v1/node/"):
+		return RoleOperator
+	case path == "/ws", strings.HasPrefix(path, "/ws/"), strings.HasPrefix(path, "/api/"), strings.HasPrefix(path, "/reports/"):
+		return RoleViewer
+	}
+	return ""
+}
+
+type webUserKey struct{}
+
+// Middleware authenticates requests to protected routes, rejecting those
+// without a valid session (401) or with too low a role (403), and passes
+// the user on in the request context.
+func (a *WebAuth) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !a.Enabled() {
+			next.ServeHTTP(w, r)
+			return
+		}
+		u := a.lookup(requestToken(r))
+		if u != nil {
+			r = r.WithContext(context.WithValue(r.Context(), webUserKey{}, u))
+		}
+
+		need := routeRole(r.URL.Path)
+		if need == "" {
+			if u == nil && r.URL.Path == "/" && r.Method == http.MethodGet {
+				http.Redirect(w, r, "login", http.StatusSeeOther)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+		if u == nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="tarpn-mon"`)
+			http.Error(w, "authentication required", http.StatusUnauthorized)
+			return
+		}
+		if !u.Role.Allows(need) {
+			http.Error(w, "permission denied", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requestUser returns the user a request was authenticated as, or nil.
+func requestUser(r *http.Request) *WebUser {
+	u, _ := r.Context().Value(webUserKey{}).(*WebUser)
+	return u
+}
+
+// requestRole returns the role to apply to r: the user's, or admin when
+// authentication is off.
+func requestRole(r *http.Request) Role {
+	if u := requestUser(r); u != nil {
+		return u.Role
+	}
+	if webAuthRef == nil || !webAuthRef.Enabled() {
+		return RoleAdmin
+	}
+	return ""
+}
+
+// checkWebSocketOrigin is the upgrader's origin check.
+func checkWebSocketOrigin(r *http.Request) bool {
+	if webAuthRef == nil {
+		return true
+	}
+	if !webAuthRef.CheckOrigin(r) {
+		authLog.Warnw("Rejected WebSocket from disallowed origin", "origin", r.Header.Get("Origin"), "path", r.URL.Path)
+		return false
+	}
+	return true
+}
+
+// loginHandler serves /api/login. A JSON body gets a JSON reply with the
+// token for use as a bearer token; a form post (from /login) gets the
+// session cookie and a redirect to the UI.
+func loginHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if webAuthRef == nil {
+		http.Error(w, "authentication not configured", http.StatusServiceUnavailable)
+		return
+	}
+	isForm := !strings.HasPrefix(r.Header.Get("Content-Type"), "application/json")
+	var creds struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+	if isForm {
+		creds.Username, creds.Password = r.PostFormValue("username"), r.PostFormValue("password")
+	} else if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&creds); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	token, u, err := webAuthRef.Login(creds.Username, creds.Password)
+	if err != nil {
+		authLog.Warnw("Failed login", "username", creds.Username, "remote", r.RemoteAddr)
+		if isForm {
+			http.Redirect(w, r, "../login?failed=1", http.StatusSeeOther)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	authLog.Infow("Login", "username", u.Username, "role", u.Role, "remote", r.RemoteAddr)
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     authCookieName,
+		Value:    token,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteStrictMode,
+		MaxAge:   int(authSessionTTL / time.Second),
+	})
+	if isForm {
+		http.Redirect(w, r, "../", http.StatusSeeOther)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"token":    token,
+		"username": u.Username,
+		"role":     u.Role,
+	})
+}
+
+// logoutHandler serves /api/logout.
+func logoutHandler(w http.ResponseWriter, r *http.Request) {
+	if webAuthRef != nil {
+		webAuthRef.Logout(requestToken(r))
+	}
+	http.SetCookie(w, &http.Cookie{Name: authCookieName, Value: "", Path: "/", MaxAge: -1})
+	if r.Method == http.MethodGet {
+		http.Redirect(w, r, "../login", http.StatusSeeOther)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// meHandler serves /api/me: who the request is authenticated as.
+func meHandler(w http.ResponseWriter, r *http.Request) {
+	resp := map[string]interface{}{
+		"authEnabled": webAuthRef != nil && webAuthRef.Enabled(),
+		"role":        requestRole(r),
+	}
+	if u := requestUser(r); u != nil {
+		resp["username"] = u.Username
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// usersHandler serves /api/users for admins: GET lists users, POST creates
+// or updates one from {"username","password","role"} (an empty password
+// keeps the current one), DELETE ?username= removes one.
+func usersHandler(w http.ResponseWriter, r *http.Request) {
+	if webAuthRef == nil {
+		http.Error(w, "authentication not configured", http.StatusServiceUnavailable)
+		return
+	}
+	if !webAuthRef.Enabled() {
+		http.Error(w, "create the first admin with tarpn-mon -add-user", http.StatusForbidden)
+		return
+	}
+	store := webAuthRef.users
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var req struct {
+			Username string `json:"username"`
+			Password string `json:"password"`
+			Role     Role   `json:"role"`
+		}
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&req); err != nil {
+			http.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+		if err := store.SetUser(req.Username, req.Password, req.Role); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		authLog.Infow("User saved", "username", req.Username, "role", req.Role)
+	case http.MethodDelete:
+		username := r.URL.Query().Get("username")
+		if err := store.DeleteUser(username); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		authLog.Infow("User deleted", "username", username)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(store.List())
+}
+
+// loginPage is the sign-in form. It posts to api/login relative to itself,
+// so it works wherever the UI is mounted.
+const loginPage = `<!DOCTYPE html>
+<html><head><meta charset="utf-8"><meta name="viewport" content="width=device-width, initial-scale=1">
+<title>tarpn-mon sign in</title>
+<style>
+body{font-family:sans-serif;background:#1e1e1e;color:#ddd;display:flex;justify-content:center;margin-top:15vh}
+form{display:flex;flex-direction:column;gap:.6em;width:16em}
+input,button{font-size:1em;padding:.4em}
+.err{color:#f77}
+</style></head>
+<body><form method="post" action="api/login">
+<h2>tarpn-mon</h2>
+%s
+<input name="username" placeholder="Username" autocomplete="username" autofocus required>
+<input name="password" type="password" placeholder="Password" autocomplete="current-password" required>
+<button type="submit">Sign in</button>
+</form></body></html>
+`
+
+// loginPageHandler serves /login.
+func loginPageHandler(w http.ResponseWriter, r *http.Request) {
+	msg := ""
+	if r.URL.Query().Get("failed") != "" {
+		msg = `<div class="err">Invalid username or password</div>`
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprintf(w, loginPage, msg)
+}
+
+// setupAuthRoutes adds the login page and the login, logout, me and users
+// APIs
+func setupAuthRoutes() {
+	http.HandleFunc("/login", loginPageHandler)
+	http.HandleFunc("/api/login", loginHandler)
+	http.HandleFunc("/api/logout", logoutHandler)
+	http.HandleFunc("/api/me", meHandler)
+	http.HandleFunc("/api/users", usersHandler)
+}
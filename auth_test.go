@@ -0,0 +1,197 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// fastPasswordHashing lowers the PBKDF2 work factor for the rest of the test.
+func fastPasswordHashing(t *testing.T) {
+	t.Helper()
+	old := passwordIterations
+	passwordIterations = 1000
+	t.Cleanup(func() { passwordIterations = old })
+}
+
+func TestPasswordHash(t *testing.T) {
+	fastPasswordHashing(t)
+	hash, err := hashPassword("correct horse")
+	if err != nil {
+		t.Fatalf("hashPassword: %v", err)
+	}
+	if !checkPassword(hash, "correct horse") {
+		t.Error("right password rejected")
+	}
+	if checkPassword(hash, "correct horsE") || checkPassword("", "") || checkPassword("plain$1$x$y", "x") {
+		t.Error("wrong password or malformed hash accepted")
+	}
+	if other, _ := hashPassword("correct horse"); other == hash {
+		t.Error("two hashes of one password are equal; salt not random")
+	}
+}
+
+func TestUserStore(t *testing.T) {
+	fastPasswordHashing(t)
+	path := filepath.Join(t.TempDir(), "users.json")
+	store := NewUserStore(path)
+	if err := store.SetUser("sysop", "secret-pw", RoleAdmin); err != nil {
+		t.Fatalf("SetUser: %v", err)
+	}
+	if err := store.SetUser("club", "short", RoleViewer); err == nil {
+		t.Error("short password accepted")
+	}
+	if err := store.SetUser("club", "club-member", RoleViewer); err != nil {
+		t.Fatalf("SetUser: %v", err)
+	}
+	if err := store.SetUser("bad user", "long-enough", RoleViewer); err == nil {
+		t.Error("username with a space accepted")
+	}
+	if err := store.SetUser("x", "long-enough", "root"); err == nil {
+		t.Error("unknown role accepted")
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("users file mode = %v, %v, want 0600", info.Mode().Perm(), err)
+	}
+
+	loaded := NewUserStore(path)
+	if err := loaded.Load(); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if loaded.Count() != 2 || loaded.Authenticate("SYSOP", "secret-pw") == nil || loaded.Authenticate("club", "secret-pw") != nil {
+		t.Error("reloaded store does not authenticate as saved")
+	}
+	for _, u := range loaded.List() {
+		if u.PasswordHash != "" {
+			t.Errorf("List returned the hash for %s", u.Username)
+		}
+	}
+
+	// Role change keeps the password when none is given
+	if err := loaded.SetUser("club", "", RoleOperator); err != nil || loaded.Authenticate("club", "club-member").Role != RoleOperator {
+		t.Errorf("role update: %v", err)
+	}
+	if err := loaded.SetUser("sysop", "", RoleViewer); err == nil {
+		t.Error("last admin demoted")
+	}
+	if err := loaded.DeleteUser("sysop"); err == nil {
+		t.Error("last admin deleted")
+	}
+	if err := loaded.DeleteUser("club"); err != nil || loaded.Count() != 1 {
+		t.Errorf("DeleteUser: %v", err)
+	}
+}
+
+func TestWebAuthMiddleware(t *testing.T) {
+	fastPasswordHashing(t)
+	store := NewUserStore(filepath.Join(t.TempDir(), "users.json"))
+	auth := NewWebAuth(store, nil)
+	old := webAuthRef
+	webAuthRef = auth
+	t.Cleanup(func() { webAuthRef = old })
+
+	mux := http.NewServeMux()
+	ok := func(w http.ResponseWriter, r *http.Request) { w.Write([]byte(requestRole(r))) }
+	mux.HandleFunc("/", ok)
+	mux.HandleFunc("/api/status", ok)
+	mux.HandleFunc("/ws/node", ok)
+	handler := auth.Middleware(mux)
+
+	get := func(path, token string, cookie bool) (int, string) {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if token != "" {
+			if cookie {
+				req.AddCookie(&http.Cookie{Name: authCookieName, Value: token})
+			} else {
+				req.Header.Set("Authorization", "Bearer "+token)
+			}
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code, rec.Body.String()
+	}
+
+	// With no users everything is open, as before
+	if code, body := get("/ws/node", "", false); code != http.StatusOK || body != string(RoleAdmin) {
+		t.Errorf("no users: %d %q", code, body)
+	}
+
+	store.SetUser("sysop", "secret-pw", RoleAdmin)
+	store.SetUser("club", "club-member", RoleViewer)
+	if _, _, err := auth.Login("club", "wrong-pw"); err == nil {
+		t.Error("login with the wrong password succeeded")
+	}
+	viewer, _, err := auth.Login("club", "club-member")
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	admin, _, _ := auth.Login("sysop", "secret-pw")
+
+	tests := []struct {
+		path   string
+		token  string
+		cookie bool
+		want   int
+	}{
+		{"/api/status", "", false, http.StatusUnauthorized},
+		{"/api/status", "not-a-session", false, http.StatusUnauthorized},
+		{"/api/status", viewer, false, http.StatusOK},
+		{"/api/status", viewer, true, http.StatusOK},
+		{"/ws/node", viewer, true, http.StatusForbidden},
+		{"/ws/node", admin, true, http.StatusOK},
+		{"/api/v1/node/events", viewer, false, http.StatusForbidden},
+		{"/api/v1/audit", viewer, false, http.StatusForbidden},
+		{"/", "", false, http.StatusSeeOther},
+		{"/", viewer, true, http.StatusOK},
+	}
+	for _, tt := range tests {
+		if code, _ := get(tt.path, tt.token, tt.cookie); code != tt.want {
+			t.Errorf("GET %s (token %t, cookie %t) = %d, want %d", tt.path, tt.token != "", tt.cookie, code, tt.want)
+		}
+	}
+
+	// A demoted user's existing session gets the new role straight away
+	store.SetUser("club", "", RoleOperator)
+	if code, body := get("/ws/node", viewer, false); code != http.StatusOK || body != string(RoleOperator) {
+		t.Errorf("after promotion: %d %q", code, body)
+	}
+	store.DeleteUser("club")
+	if code, _ := get("/api/status", viewer, false); code != http.StatusUnauthorized {
+		t.Errorf("deleted user's session still works: %d", code)
+	}
+	auth.Logout(admin)
+	if code, _ := get("/api/status", admin, false); code != http.StatusUnauthorized {
+		t.Errorf("session still works after logout: %d", code)
+	}
+}
+
+func TestWebAuthCheckOrigin(t *testing.T) {
+	auth := NewWebAuth(NewUserStore(filepath.Join(t.TempDir(), "users.json")), []string{"https://tarpn.example.org/"})
+	tests := []struct {
+		origin string
+		want   bool
+	}{
+		{"", true},
+		{"http://pi.local:8212", true},
+		{"https://tarpn.example.org", true},
+		{"https://evil.example.com", false},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "http://pi.local:8212/ws", nil)
+		if tt.origin != "" {
+			req.Header.Set("Origin", tt.origin)
+		}
+		if got := auth.CheckOrigin(req); got != tt.want {
+			t.Errorf("origin %q: %t, want %t", tt.origin, got, tt.want)
+		}
+	}
+	if !NewWebAuth(auth.users, []string{"*"}).CheckOrigin(func() *http.Request {
+		req := httptest.NewRequest(http.MethodGet, "http://pi.local:8212/ws", nil)
+		req.Header.Set("Origin", "https://evil.example.com")
+		return req
+	}()) {
+		t.Error("* did not allow any origin")
+	}
+}
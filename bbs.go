@@ -51,7 +51,8 @@ type BBSClient struct {
 	callsign  string
 	password  string
 
-	conn      net.Conn
+	session   *PoolSession
+	conn      net.Conn // session.Conn()
 	reader    *bufio.Reader
 	state     FeatureState
 	inBBSMode bool
@@ -129,9 +130,19 @@ func (b *BBSClient) Connect() error {
 	b.broadcastStatus()
 	BroadcastFeatureStatus(b.GetStatus())
 
-	conn, err := net.DialTimeout("tcp", addr, 30*time.Second)
+	// The BBS client is interactive, so its session is never handed back
+	// to the pool for reuse; it is discarded on disconnect.
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	session, err := telnetPool.Acquire(ctx, SessionTarget{
+		Hostname: b.hostname,
+		Port:     b.port,
+		Callsign: b.callsign,
+		Password: b.password,
+		Mode:     SessionBBS,
+	})
+	cancel()
 	if err != nil {
-		bbsLog.Errorf("TCP connection failed to %s: %v", addr, err)
+		bbsLog.Errorf("Connection failed to %s: %v", addr, err)
 		b.mu.Lock()
 		b.state = StateError
 		b.lastError = fmt.Sprintf("failed to connect to BBS server: %v", err)
@@ -140,27 +151,15 @@ func (b *BBSClient) Connect() error {
 		BroadcastFeatureStatus(b.GetStatus())
 		return fmt.Errorf("failed to connect to BBS server: %w", err)
 	}
-	bbsLog.Debugf("TCP connection established to %s", addr)
+	bbsLog.Debugf("Logged in to %s", addr)
 
 	b.mu.Lock()
-	b.conn = conn
-	b.reader = bufio.NewReader(conn)
+	b.session = session
+	b.conn = session.Conn()
+	b.reader = session.Reader()
 	b.mu.Unlock()
 
-	// Initialize the connection (authenticate)
-	bbsLog.Debugf("Starting authentication sequence")
-	if err := b.initConnection(); err != nil {
-		bbsLog.Errorf("Authentication/init failed: %v", err)
-		conn.Close()
-		b.mu.Lock()
-		b.state = StateError
-		b.lastError = err.Error()
-		b.conn = nil
-		b.mu.Unlock()
-		b.broadcastStatus()
-		BroadcastFeatureStatus(b.GetStatus())
-		return err
-	}
+	b.initConnection()
 	bbsLog.Infof("Connected to node successfully")
 
 	now := time.Now()
@@ -189,64 +188,14 @@ func (b *BBSClient) ConnectWithConfig(config FeatureConfig) error {
 	return b.Connect()
 }
 
-// initConnection sends the initial authentication and enters BBS mode
-// Flow: telnet negotiation -> auth -> CTEXT -> send BBS command -> BBS mode
-func (b *BBSClient) initConnection() error {
-	// Create telnet connection wrapper - handles IAC negotiation
-	tc, err := NewTelnetConn(b.conn, 2*time.Second, bbsLog)
-	if err != nil {
-		return fmt.Errorf("telnet negotiation failed: %w", err)
-	}
-
-	// Use the telnet connection's reader
-	b.reader = tc.Reader()
-
-	// Authenticate using standard telnet protocol (waits for prompts)
-	bbsLog.Debugf("Starting authentication")
-	_, err = tc.Authenticate(b.callsign, b.password, 5*time.Second)
-	if err != nil {
-		return fmt.Errorf("authentication failed: %w", err)
-	}
-
-	// Now automatically enter BBS mode
-	bbsLog.Debugf("Auth successful, sending BBS command")
-	if err := tc.WriteCommand("BBS"); err != nil {
-		return fmt.Errorf("failed to send BBS command: %w", err)
-	}
-
-	// Wait for BBS prompt/SID
-	bbsLog.Debugf("Waiting for BBS prompt (15s timeout)")
-	_, found, err := tc.ReadUntil(func(line string) bool {
-		// Check for BBS SID like [LinBPQ-6.0.24.1-B2FHIM$]
-		if strings.HasPrefix(line, "[") && strings.Contains(line, "BPQ") {
-			bbsLog.Debugf("BBS SID detected: %q", line)
-			return true
-		}
-		// Check for BBS prompt (CALL:NODENAME>)
-		if strings.Contains(line, ":") && strings.HasSuffix(line, ">") {
-			bbsLog.Debugf("BBS prompt detected: %q", line)
-			return true
-		}
-		return false
-	}, 15*time.Second)
-
-	if err != nil {
-		return fmt.Errorf("error waiting for BBS prompt: %w", err)
-	}
-
-	// Even if no prompt found, if we sent BBS command, try to continue
+// initConnection takes over a session the pool has already taken into
+// the BBS: it sent the BBS command and waited for the SID and prompt.
+func (b *BBSClient) initConnection() {
 	b.mu.Lock()
 	b.inBBSMode = true
 	b.mu.Unlock()
 	b.conn.SetReadDeadline(time.Time{})
-
-	if found {
-		bbsLog.Infof("Entered BBS mode successfully")
-	} else {
-		bbsLog.Debugf("BBS prompt timeout, continuing anyway")
-	}
-
-	return nil
+	bbsLog.Infof("Entered BBS mode successfully")
 }
 
 // EnterBBS enters BBS mode from the node prompt
@@ -606,7 +555,8 @@ func (b *BBSClient) Close() {
 			b.conn.Write([]byte("B\r\n"))
 			time.Sleep(100 * time.Millisecond)
 		}
-		b.conn.Close()
+		b.session.Discard()
+		b.session = nil
 		b.conn = nil
 	}
 	b.state = StateDisconnected
@@ -625,7 +575,8 @@ func (b *BBSClient) broadcastStatus() {
 	b.broadcastMessage(msg)
 }
 
-// broadcastMessage sends a message to all connected BBS WebSocket clients
+// broadcastMessage sends a message to all connected BBS WebSocket clients,
+// and messages with mail in them only to those who may read it
 func (b *BBSClient) broadcastMessage(msg *BBSClientMessage) {
 	jsonData, err := json.Marshal(msg)
 	if err != nil {
@@ -634,15 +585,19 @@ func (b *BBSClient) broadcastMessage(msg *BBSClientMessage) {
 	}
 
 	msgStr := string(jsonData)
+	bbsFeed.Publish(msgStr)
+
+	// Message bodies are the station's mail, which viewers may not read
+	private := msg.Type == "bbs_message" || msg.Type == "bbs_output"
 
 	bbsClientsMu.RLock()
 	defer bbsClientsMu.RUnlock()
 
 	for client := range bbsClients {
-		if err := client.write(msgStr); err != nil {
-			bbsLog.Errorf("BBS websocket error: %v", err)
-			go client.kill()
+		if private && !client.role.Allows(bbsCommandRoles["read"]) {
+			continue
 		}
+		client.write(msgStr)
 	}
 }
 
@@ -654,8 +609,8 @@ func (b *BBSClient) Run() {
 		b.mu.Lock()
 		b.state = StateDisconnected
 		b.inBBSMode = false
-		if b.conn != nil {
-			b.conn.Close()
+		if b.session != nil {
+			b.session.Discard()
 		}
 		b.mu.Unlock()
 		b.broadcastStatus()
@@ -848,7 +803,12 @@ func (b *BBSClient) broadcastMessageSent(msgNum int) {
 }
 
 // broadcastMessageList sends a message list to all connected WebSocket clients
+// and keeps it as the latest listing
 func (b *BBSClient) broadcastMessageList(messages []BBSMessage) {
+	b.messagesMu.Lock()
+	b.messages = append([]BBSMessage(nil), messages...)
+	b.messagesMu.Unlock()
+
 	msg := &BBSClientMessage{
 		Seq:      atomic.AddInt64(&b.messageSeq, 1),
 		Type:     "bbs_list",
@@ -857,6 +817,13 @@ func (b *BBSClient) broadcastMessageList(messages []BBSMessage) {
 	b.broadcastMessage(msg)
 }
 
+// Messages returns the most recent message listing
+func (b *BBSClient) Messages() []BBSMessage {
+	b.messagesMu.RLock()
+	defer b.messagesMu.RUnlock()
+	return append([]BBSMessage(nil), b.messages...)
+}
+
 // initBBSClient initializes the global BBS client (called from main)
 func initBBSClient(cfg BBSClientConfig) {
 	bbsClient = NewBBSClient(cfg)
@@ -3,6 +3,7 @@ package main
 import (
 	"encoding/json"
 	"net/http"
+	"strconv"
 )
 
 // BBSClientCommand represents a command from a WebSocket client
@@ -16,6 +17,17 @@ type BBSClientCommand struct {
 	Bulletin  bool   `json:"bulletin"`  // for "send" command - true for bulletin
 }
 
+// bbsCommandRoles are the BBS commands that need more than the viewer
+// role. Viewers can see the status and listing but not read, post or
+// delete the station's mail.
+var bbsCommandRoles = map[string]Role{
+	"enter":  RoleOperator,
+	"exit":   RoleOperator,
+	"read":   RoleOperator,
+	"send":   RoleOperator,
+	"delete": RoleOperator,
+}
+
 // bbsWebsocketHandler handles WebSocket connections for BBS
 func bbsWebsocketHandler(w http.ResponseWriter, r *http.Request) {
 	conn, err := upgrader.Upgrade(w, r, nil)
@@ -24,10 +36,10 @@ func bbsWebsocketHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	wc := &websocketConn{
-		wc: conn,
-	}
+	wc := newWebsocketConn(conn, "bbs", r)
 	defer wc.kill()
+	role := requestRole(r)
+	actor := requestActor(r)
 
 	// Register this client for BBS broadcasts
 	bbsClientsMu.Lock()
@@ -68,6 +80,23 @@ func bbsWebsocketHandler(w http.ResponseWriter, r *http.Request) {
 			continue
 		}
 
+		if need, ok := bbsCommandRoles[cmd.Cmd]; ok && !role.Allows(need) {
+			switch cmd.Cmd {
+			case "send":
+				actor.record(auditBBSSend, bbsSendDetail(cmd.To, cmd.Subject, cmd.Body, cmd.Bulletin), true, errAuditDenied)
+			case "delete":
+				actor.record(auditBBSDelete, strconv.Itoa(cmd.Number), false, errAuditDenied)
+			}
+			errMsg := &BBSClientMessage{
+				Type:  "bbs_error",
+				Error: "Permission denied",
+			}
+			if jsonData, err := json.Marshal(errMsg); err == nil {
+				wc.write(string(jsonData))
+			}
+			continue
+		}
+
 		// Handle commands
 		switch cmd.Cmd {
 		case "status":
@@ -146,6 +175,7 @@ func bbsWebsocketHandler(w http.ResponseWriter, r *http.Request) {
 			// Send a message
 			if bbsClient != nil && cmd.To != "" && cmd.Subject != "" {
 				msgNum, err := bbsClient.SendMessage(cmd.To, cmd.Subject, cmd.Body, cmd.Bulletin)
+				actor.record(auditBBSSend, bbsSendDetail(cmd.To, cmd.Subject, cmd.Body, cmd.Bulletin), true, err)
 				if err != nil {
 					errMsg := &BBSClientMessage{
 						Type:  "bbs_error",
@@ -169,6 +199,7 @@ func bbsWebsocketHandler(w http.ResponseWriter, r *http.Request) {
 			// Delete a message
 			if bbsClient != nil && cmd.Number > 0 {
 				err := bbsClient.DeleteMessage(cmd.Number)
+				actor.record(auditBBSDelete, strconv.Itoa(cmd.Number), false, err)
 				if err != nil {
 					errMsg := &BBSClientMessage{
 						Type:  "bbs_error",
@@ -0,0 +1,426 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Bulletin queue states
+const (
+	BulletinPending   = "pending"   // waiting to be sent (or re-sent)
+	BulletinSent      = "sent"      // handed to the BBS, not yet seen in a listing
+	BulletinConfirmed = "confirmed" // seen in the BBS message list
+	BulletinFailed    = "failed"    // gave up; see LastError
+)
+
+const (
+	// bulletinMaxAttempts is how many send attempts a message gets before
+	// it is marked failed. With the backoff below that is roughly a day.
+	bulletinMaxAttempts = 12
+	// bulletinConfirmDelay is how long after sending before the first look
+	// at the BBS listing, and the interval between later looks.
+	bulletinConfirmDelay = 2 * time.Minute
+	// bulletinConfirmWindow is how long a sent message may go unlisted
+	// before it is treated as lost.
+	bulletinConfirmWindow = 30 * time.Minute
+	// bulletinListCount is how many recent messages "LL" is asked for.
+	bulletinListCount = 50
+)
+
+// QueuedBulletin is one outbound BBS message and its delivery state.
+type QueuedBulletin struct {
+	ID            int64      `json:"id"`
+	CreatedAt     time.Time  `json:"createdAt"`
+	SendCmd       string     `json:"sendCmd"` // e.g. "SB LS1H @" or "SP N0CALL"
+	Subject       string     `json:"subject"`
+	Body          string     `json:"-"`
+	BodyBytes     int        `json:"bodyBytes"`
+	State         string     `json:"state"`
+	Attempts      int        `json:"attempts"`
+	NextAttemptAt time.Time  `json:"nextAttemptAt"`
+	LastError     string     `json:"lastError,omitempty"`
+	BBSMsgNum     int        `json:"bbsMsgNum,omitempty"`
+	SentAt        *time.Time `json:"sentAt,omitempty"`
+	ConfirmedAt   *time.Time `json:"confirmedAt,omitempty"`
+}
+
+// bulletinBackoff returns the delay before retry number attempts+1:
+// 1, 2, 4 ... minutes, capped at four hours.
+func bulletinBackoff(attempts int) time.Duration {
+	d := time.Minute
+	for i := 1; i < attempts && d < 4*time.Hour; i++ {
+		d *= 2
+	}
+	if d > 4*time.Hour {
+		d = 4 * time.Hour
+	}
+	return d
+}
+
+// EnqueueBulletin adds a message to the outbound queue, due immediately.
+func (s *LinkStatsStorage) EnqueueBulletin(sendCmd, subject, body string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	result, err := s.db.Exec(`
+		INSERT INTO bulletin_queue (created_at, send_cmd, subject, body, state, next_attempt_at)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		now, sendCmd, subject, body, BulletinPending, now)
+	if err != nil {
+		return 0, fmt.Errorf("failed to enqueue bulletin: %w", err)
+	}
+	return result.LastInsertId()
+}
+
+const bulletinColumns = `id, created_at, send_cmd, subject, body, state, attempts,
+	next_attempt_at, last_error, bbs_msg_num, sent_at, confirmed_at`
+
+func scanBulletins(rows *sql.Rows) ([]QueuedBulletin, error) {
+	var result []QueuedBulletin
+	for rows.Next() {
+		var b QueuedBulletin
+		var created, next string
+		var sent, confirmed sql.NullString
+		if err := rows.Scan(&b.ID, &created, &b.SendCmd, &b.Subject, &b.Body, &b.State,
+			&b.Attempts, &next, &b.LastError, &b.BBSMsgNum, &sent, &confirmed); err != nil {
+			return nil, fmt.Errorf("failed to scan bulletin: %w", err)
+		}
+		b.CreatedAt, _ = time.Parse(time.RFC3339, created)
+		b.NextAttemptAt, _ = time.Parse(time.RFC3339, next)
+		if sent.Valid {
+			t, _ := time.Parse(time.RFC3339, sent.String)
+			b.SentAt = &t
+		}
+		if confirmed.Valid {
+			t, _ := time.Parse(time.RFC3339, confirmed.String)
+			b.ConfirmedAt = &t
+		}
+		b.BodyBytes = len(b.Body)
+		result = append(result, b)
+	}
+	return result, rows.Err()
+}
+
+// GetDueBulletins returns queued messages in state whose next attempt is
+// at or before now, oldest first.
+func (s *LinkStatsStorage) GetDueBulletins(state string, now time.Time) ([]QueuedBulletin, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rows, err := s.db.Query(`SELECT `+bulletinColumns+` FROM bulletin_queue
+		WHERE state = ? AND next_attempt_at <= ?
+		ORDER BY id ASC`,
+		state, now.UTC().Format(time.RFC3339))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query due bulletins: %w", err)
+	}
+	defer rows.Close()
+	return scanBulletins(rows)
+}
+
+// ListBulletinQueue returns the most recent queue entries, newest first.
+func (s *LinkStatsStorage) ListBulletinQueue(limit int) ([]QueuedBulletin, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rows, err := s.db.Query(`SELECT `+bulletinColumns+` FROM bulletin_queue
+		ORDER BY id DESC LIMIT ?`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query bulletin queue: %w", err)
+	}
+	defer rows.Close()
+	return scanBulletins(rows)
+}
+
+// UpdateBulletin writes back the delivery state of a queued message.
+func (s *LinkStatsStorage) UpdateBulletin(b *QueuedBulletin) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	formatOpt := func(t *time.Time) interface{} {
+		if t == nil {
+			return nil
+		}
+		return t.UTC().Format(time.RFC3339)
+	}
+	_, err := s.db.Exec(`
+		UPDATE bulletin_queue
+		SET state = ?, attempts = ?, next_attempt_at = ?, last_error = ?,
+		    bbs_msg_num = ?, sent_at = ?, confirmed_at = ?
+		WHERE id = ?`,
+		b.State, b.Attempts, b.NextAttemptAt.UTC().Format(time.RFC3339), b.LastError,
+		b.BBSMsgNum, formatOpt(b.SentAt), formatOpt(b.ConfirmedAt), b.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update bulletin %d: %w", b.ID, err)
+	}
+	return nil
+}
+
+// PurgeOldBulletins drops confirmed and failed entries older than retention.
+// Pending and sent entries are kept however old they are.
+func (s *LinkStatsStorage) PurgeOldBulletins(retention time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cutoff := time.Now().UTC().Add(-retention).Format(time.RFC3339)
+	_, err := s.db.Exec(`DELETE FROM bulletin_queue
+		WHERE state IN (?, ?) AND created_at < ?`,
+		BulletinConfirmed, BulletinFailed, cutoff)
+	if err != nil {
+		return fmt.Errorf("failed to purge old bulletins: %w", err)
+	}
+	return nil
+}
+
+// recordSendResult moves a message on after a send attempt.
+func recordSendResult(b *QueuedBulletin, now time.Time, msgNum int, err error) {
+	b.Attempts++
+	if err != nil {
+		b.LastError = err.Error()
+		if b.Attempts >= bulletinMaxAttempts {
+			b.State = BulletinFailed
+		} else {
+			b.NextAttemptAt = now.Add(bulletinBackoff(b.Attempts))
+		}
+		return
+	}
+	sent := now
+	b.State = BulletinSent
+	b.SentAt = &sent
+	b.BBSMsgNum = msgNum
+	b.LastError = ""
+	b.NextAttemptAt = now.Add(bulletinConfirmDelay)
+}
+
+// recordListingResult moves a sent message on after looking for it in the
+// BBS listing. A message the BBS acknowledged with a number but that never
+// shows up was most likely forwarded on or killed, and sending it again
+// would only duplicate it, so it is marked failed. One that was never
+// acknowledged goes back to pending, and processBulletinQueue looks for it
+// in the listing again before sending it.
+func recordListingResult(b *QueuedBulletin, now time.Time, listed bool) {
+	if listed {
+		b.State = BulletinConfirmed
+		b.ConfirmedAt = &now
+		b.LastError = ""
+		return
+	}
+	if b.SentAt != nil && now.Sub(*b.SentAt) < bulletinConfirmWindow {
+		b.NextAttemptAt = now.Add(bulletinConfirmDelay)
+		return
+	}
+	b.LastError = "not found in BBS listing"
+	if b.BBSMsgNum > 0 || b.Attempts >= bulletinMaxAttempts {
+		b.State = BulletinFailed
+		return
+	}
+	b.State = BulletinPending
+	b.SentAt = nil
+	b.NextAttemptAt = now.Add(bulletinBackoff(b.Attempts))
+}
+
+// bbsListingContains reports whether a BBS "LL" listing shows the message.
+// LinBPQ lines look like
+//
+//	1234   18-Oct B$     245 LS1H   @WW    N0CALL  LS1H N0CALL 2025-10-17
+//
+// and the subject is cut to fit the line, so it is matched on a prefix.
+// When the BBS gave us a message number it must match too.
+func bbsListingContains(lines []string, msgNum int, subject string) bool {
+	prefix := subject
+	if len(prefix) > 20 {
+		prefix = prefix[:20]
+	}
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		num, err := strconv.Atoi(fields[0])
+		if err != nil {
+			continue
+		}
+		if msgNum > 0 && num != msgNum {
+			continue
+		}
+		if strings.Contains(line, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+var bbsSavedRe = regexp.MustCompile(`#\s*(\d+)`)
+
+// parseSavedMsgNum extracts N from LinBPQ's "Message: N Bid: ... Saved" or
+// "Message #N Saved" confirmation, or 0 if there is none.
+func parseSavedMsgNum(line string) int {
+	if m := bbsSavedRe.FindStringSubmatch(line); m != nil {
+		n, _ := strconv.Atoi(m[1])
+		return n
+	}
+	fields := strings.Fields(line)
+	for i, f := range fields {
+		if strings.HasPrefix(strings.ToLower(f), "message") && i+1 < len(fields) {
+			if n, err := strconv.Atoi(strings.TrimSuffix(fields[i+1], ",")); err == nil {
+				return n
+			}
+		}
+	}
+	return 0
+}
+
+// runBulletinQueue delivers queued BBS messages and confirms them against
+// the BBS listing. It runs once at startup, so that anything left over from
+// before a restart goes out straight away, and then every minute.
+func (c *LinkStatsCollector) runBulletinQueue(ctx context.Context) {
+	if c.storage == nil {
+		return
+	}
+
+	ticker := time.NewTicker(1 * time.Minute)
+	defer ticker.Stop()
+
+	for {
+		c.processBulletinQueue()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// processBulletinQueue makes one pass over the queue: sends due pending
+// messages, then looks for due sent messages in the BBS listing.
+func (c *LinkStatsCollector) processBulletinQueue() {
+	changed := false
+
+	pending, err := c.storage.GetDueBulletins(BulletinPending, time.Now())
+	if err != nil {
+		statsLog.Errorw("Bulletin queue: failed to load pending", "error", err)
+		return
+	}
+	// A message that was sent before without the BBS saying it saved it
+	// may still have arrived, just later than the listing checks looked.
+	// It is looked for once more before it goes out again, and not resent
+	// while the listing cannot be read.
+	var listing []string
+	var listErr error
+	listed := false
+	for i := range pending {
+		b := &pending[i]
+		if b.Attempts > 0 {
+			if !listed {
+				listing, listErr = c.listBBSMessages()
+				listed = true
+			}
+			if listErr != nil {
+				statsLog.Warnw("Bulletin queue: failed to list BBS, not resending", "subject", b.Subject, "error", listErr)
+				continue
+			}
+			if bbsListingContains(listing, b.BBSMsgNum, b.Subject) {
+				recordListingResult(b, time.Now(), true)
+				statsLog.Infow("Bulletin found before resending", "subject", b.Subject)
+				if err := c.storage.UpdateBulletin(b); err != nil {
+					statsLog.Errorw("Bulletin queue: failed to update", "error", err)
+				}
+				changed = true
+				continue
+			}
+		}
+		msgNum, err := c.trySendBBSMessage(b.SendCmd, b.Subject, b.Body)
+		recordSendResult(b, time.Now(), msgNum, err)
+		if err != nil {
+			statsLog.Warnw("Bulletin: send failed",
+				"subject", b.Subject, "attempt", b.Attempts, "state", b.State, "error", err)
+		}
+		if err := c.storage.UpdateBulletin(b); err != nil {
+			statsLog.Errorw("Bulletin queue: failed to update", "error", err)
+		}
+		changed = true
+	}
+
+	sent, err := c.storage.GetDueBulletins(BulletinSent, time.Now())
+	if err != nil {
+		statsLog.Errorw("Bulletin queue: failed to load sent", "error", err)
+	} else if len(sent) > 0 {
+		lines, err := c.listBBSMessages()
+		if err != nil {
+			statsLog.Warnw("Bulletin queue: failed to list BBS", "error", err)
+		} else {
+			for i := range sent {
+				b := &sent[i]
+				recordListingResult(b, time.Now(), bbsListingContains(lines, b.BBSMsgNum, b.Subject))
+				if b.State == BulletinConfirmed {
+					statsLog.Infow("Bulletin confirmed", "subject", b.Subject, "msgNum", b.BBSMsgNum)
+				} else if b.State != BulletinSent {
+					statsLog.Warnw("Bulletin not confirmed", "subject", b.Subject, "state", b.State)
+				}
+				if err := c.storage.UpdateBulletin(b); err != nil {
+					statsLog.Errorw("Bulletin queue: failed to update", "error", err)
+				}
+			}
+			changed = true
+		}
+	}
+
+	if changed {
+		BroadcastBulletinQueue(c.storage)
+	}
+}
+
+// listBBSMessages returns the BBS listing of the most recent messages.
+func (c *LinkStatsCollector) listBBSMessages() ([]string, error) {
+	s, err := c.session(context.Background(), SessionBBS)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.WriteString(fmt.Sprintf("LL %d", bulletinListCount)); err != nil {
+		s.Discard()
+		return nil, fmt.Errorf("failed to send list command: %w", err)
+	}
+	lines, found, err := s.ReadUntil(promptPredicate, 15*time.Second)
+	if err != nil {
+		s.Discard()
+		return nil, fmt.Errorf("failed to read listing: %w", err)
+	}
+	if found {
+		s.Release()
+	} else {
+		s.Discard()
+	}
+	return lines, nil
+}
+
+// BroadcastBulletinQueue sends the current queue to all WebSocket clients.
+func BroadcastBulletinQueue(storage *LinkStatsStorage) {
+	msg, err := newBulletinQueueMessage(storage)
+	if err != nil {
+		statsLog.Errorw("Failed to build bulletin queue message", "error", err)
+		return
+	}
+	if data, err := json.Marshal(msg); err == nil {
+		broadcastDirect(string(data))
+	}
+}
+
+// newBulletinQueueMessage builds the "bulletin_queue" WebSocket message.
+func newBulletinQueueMessage(storage *LinkStatsStorage) (*BulletinQueueMessage, error) {
+	items, err := storage.ListBulletinQueue(100)
+	if err != nil {
+		return nil, err
+	}
+	if items == nil {
+		items = []QueuedBulletin{}
+	}
+	return &BulletinQueueMessage{Type: "bulletin_queue", Items: items}, nil
+}
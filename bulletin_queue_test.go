@@ -0,0 +1,119 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// A message that cannot be sent stays in the queue with a growing delay, and
+// survives a restart because it lives in SQLite.
+func TestBulletinQueueRetryAndPersist(t *testing.T) {
+	s := newTestStorage(t)
+
+	id, err := s.EnqueueBulletin("SB LS1H @", "LS1H N0CALL 2025-03-10", "body\nline2")
+	if err != nil {
+		t.Fatalf("EnqueueBulletin: %v", err)
+	}
+
+	now := time.Now()
+	due, err := s.GetDueBulletins(BulletinPending, now)
+	if err != nil || len(due) != 1 || due[0].ID != id {
+		t.Fatalf("GetDueBulletins = %+v, %v; want the new bulletin", due, err)
+	}
+
+	b := due[0]
+	recordSendResult(&b, now, 0, errors.New("connect failed: connection refused"))
+	if err := s.UpdateBulletin(&b); err != nil {
+		t.Fatalf("UpdateBulletin: %v", err)
+	}
+	if b.State != BulletinPending || b.Attempts != 1 {
+		t.Errorf("after failure: state %s attempts %d", b.State, b.Attempts)
+	}
+
+	if due, _ := s.GetDueBulletins(BulletinPending, now.Add(30*time.Second)); len(due) != 0 {
+		t.Error("failed bulletin retried before its backoff")
+	}
+	due, _ = s.GetDueBulletins(BulletinPending, now.Add(2*time.Minute))
+	if len(due) != 1 || due[0].LastError == "" || due[0].Body != "body\nline2" {
+		t.Fatalf("after backoff: %+v", due)
+	}
+
+	b = due[0]
+	recordSendResult(&b, now.Add(2*time.Minute), 1234, nil)
+	s.UpdateBulletin(&b)
+	list, err := s.ListBulletinQueue(10)
+	if err != nil || len(list) != 1 {
+		t.Fatalf("ListBulletinQueue = %+v, %v", list, err)
+	}
+	if list[0].State != BulletinSent || list[0].BBSMsgNum != 1234 || list[0].SentAt == nil || list[0].LastError != "" {
+		t.Errorf("after send: %+v", list[0])
+	}
+}
+
+func TestBulletinGivesUp(t *testing.T) {
+	b := QueuedBulletin{State: BulletinPending}
+	now := time.Now()
+	for i := 0; i < bulletinMaxAttempts; i++ {
+		recordSendResult(&b, now, 0, errors.New("down"))
+	}
+	if b.State != BulletinFailed {
+		t.Errorf("state after %d failures = %s, want failed", bulletinMaxAttempts, b.State)
+	}
+	if d := bulletinBackoff(20); d != 4*time.Hour {
+		t.Errorf("backoff cap = %v, want 4h", d)
+	}
+}
+
+func TestRecordListingResult(t *testing.T) {
+	sentAt := time.Now()
+	listing := []string{
+		"de N0CALL>",
+		"1233   18-Oct BN     812 LS5M   @WW    N0CALL  LS5M N0CALL 2025-10-17",
+		"1234   18-Oct BN     245 LS1H   @WW    N0CALL  LS1H N0CALL 2025-10-17",
+	}
+
+	// Found by number and subject prefix
+	b := QueuedBulletin{State: BulletinSent, SentAt: &sentAt, BBSMsgNum: 1234, Subject: "LS1H N0CALL 2025-10-17 00:00"}
+	recordListingResult(&b, sentAt.Add(time.Minute), bbsListingContains(listing, b.BBSMsgNum, b.Subject))
+	if b.State != BulletinConfirmed || b.ConfirmedAt == nil {
+		t.Errorf("listed bulletin: %+v", b)
+	}
+
+	// Subject matches but the number does not: not ours
+	if bbsListingContains(listing, 999, "LS1H N0CALL 2025-10-17") {
+		t.Error("matched a listing line with a different message number")
+	}
+
+	// Not listed yet, inside the window: check again later
+	b = QueuedBulletin{State: BulletinSent, SentAt: &sentAt, Subject: "LS15M N0CALL 2025-10-17"}
+	recordListingResult(&b, sentAt.Add(5*time.Minute), false)
+	if b.State != BulletinSent {
+		t.Errorf("inside window: state %s, want sent", b.State)
+	}
+
+	// Never acknowledged and never listed: send again
+	recordListingResult(&b, sentAt.Add(bulletinConfirmWindow+time.Minute), false)
+	if b.State != BulletinPending || b.SentAt != nil {
+		t.Errorf("unacknowledged and unlisted: %+v, want pending", b)
+	}
+
+	// Acknowledged but never listed: do not duplicate it
+	b = QueuedBulletin{State: BulletinSent, SentAt: &sentAt, BBSMsgNum: 1240, Subject: "LS15M N0CALL 2025-10-17"}
+	recordListingResult(&b, sentAt.Add(bulletinConfirmWindow+time.Minute), false)
+	if b.State != BulletinFailed {
+		t.Errorf("acknowledged and unlisted: state %s, want failed", b.State)
+	}
+}
+
+func TestParseSavedMsgNum(t *testing.T) {
+	for line, want := range map[string]int{
+		"Message #1234 Saved":                   1234,
+		"Message: 57 Bid:  57_N0CALL Size: 245": 57,
+		"Bulletin accepted":                     0,
+	} {
+		if got := parseSavedMsgNum(line); got != want {
+			t.Errorf("parseSavedMsgNum(%q) = %d, want %d", line, got, want)
+		}
+	}
+}
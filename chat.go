@@ -919,14 +919,19 @@ func (c *ChatClient) broadcastMessage(msg *ChatMessage) {
 	if chatBuffer != nil {
 		chatBuffer.AddMessage(msg)
 	}
+	chatFeed.Publish(msgStr)
 
 	chatClientsMu.RLock()
 	defer chatClientsMu.RUnlock()
 
+	// Stored messages can be recovered with sync, so may be dropped for a
+	// slow client
+	droppable := chatMessageStored(msg)
 	for client := range chatClients {
-		if err := client.write(msgStr); err != nil {
-			chatLog.Errorf("Chat websocket error: %v", err)
-			go client.kill()
+		if droppable {
+			client.writeDroppable(msgStr)
+		} else {
+			client.write(msgStr)
 		}
 	}
 }
@@ -956,15 +961,13 @@ func (c *ChatClient) broadcastUserList() {
 	}
 
 	msgStr := string(jsonData)
+	chatFeed.Publish(msgStr)
 
 	chatClientsMu.RLock()
 	defer chatClientsMu.RUnlock()
 
 	for client := range chatClients {
-		if err := client.write(msgStr); err != nil {
-			chatLog.Errorf("Chat websocket error: %v", err)
-			go client.kill()
-		}
+		client.write(msgStr)
 	}
 }
 
@@ -34,6 +34,12 @@ type ChatStorage interface {
 	Close() error
 }
 
+// chatMessageStored reports whether storage keeps a message. User lists and
+// typing indicators are ephemeral.
+func chatMessageStored(msg *ChatMessage) bool {
+	return msg.Type != "chat_users" && msg.Type != "chat_th"
+}
+
 // SQLiteChatStorage implements ChatStorage using SQLite
 type SQLiteChatStorage struct {
 	db       *sql.DB
@@ -89,8 +95,7 @@ func (s *SQLiteChatStorage) AddMessage(msg *ChatMessage) {
 	callsign := s.callsign
 	s.mu.RUnlock()
 
-	// Skip ephemeral message types
-	if msg.Type == "chat_users" || msg.Type == "chat_th" {
+	if !chatMessageStored(msg) {
 		return
 	}
 
@@ -272,8 +277,7 @@ func (m *MemoryChatStorage) SetCallsign(callsign string) {
 }
 
 func (m *MemoryChatStorage) AddMessage(msg *ChatMessage) {
-	// Skip ephemeral message types
-	if msg.Type == "chat_users" || msg.Type == "chat_th" {
+	if !chatMessageStored(msg) {
 		return
 	}
 
@@ -17,6 +17,29 @@ type ChatClientCommand struct {
 	Topic     string `json:"topic"`      // for "set_topic" command
 }
 
+// chatCommandRoles are the chat commands that need more than the viewer
+// role: anything that speaks as the station.
+var chatCommandRoles = map[string]Role{
+	"send":      RoleOperator,
+	"command":   RoleOperator,
+	"set_name":  RoleOperator,
+	"set_topic": RoleOperator,
+}
+
+// auditChat records one of those commands in the audit log.
+func auditChat(actor auditActor, cmd ChatClientCommand, err error) {
+	switch cmd.Cmd {
+	case "send":
+		actor.record(auditChatSend, cmd.Message, true, err)
+	case "command":
+		actor.record(auditChatCommand, cmd.Message, true, err)
+	case "set_name":
+		actor.record(auditChatSetName, cmd.Name+" "+cmd.QTH, true, err)
+	case "set_topic":
+		actor.record(auditChatSetTopic, cmd.Topic, true, err)
+	}
+}
+
 // ChatInitMessage is sent to clients on connection
 type ChatInitMessage struct {
 	Type   string         `json:"type"`
@@ -31,10 +54,10 @@ func chatWebsocketHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	wc := &websocketConn{
-		wc: conn,
-	}
+	wc := newWebsocketConn(conn, "chat", r)
 	defer wc.kill()
+	role := requestRole(r)
+	actor := requestActor(r)
 
 	// Register this client for chat broadcasts
 	chatClientsMu.Lock()
@@ -87,6 +110,18 @@ func chatWebsocketHandler(w http.ResponseWriter, r *http.Request) {
 
 		chatLog.Debugw("Chat WS command", "cmd", cmd.Cmd)
 
+		if need, ok := chatCommandRoles[cmd.Cmd]; ok && !role.Allows(need) {
+			auditChat(actor, cmd, errAuditDenied)
+			errMsg := &ChatMessage{
+				Type:    "chat_error",
+				Message: "Permission denied",
+			}
+			if jsonData, err := json.Marshal(errMsg); err == nil {
+				wc.write(string(jsonData))
+			}
+			continue
+		}
+
 		switch cmd.Cmd {
 		case "latest":
 			// Initial load - get latest N messages
@@ -99,7 +134,7 @@ func chatWebsocketHandler(w http.ResponseWriter, r *http.Request) {
 				for _, msg := range messages {
 					jsonStr := chatMessageToJSON(msg)
 					if jsonStr != "" {
-						if err := wc.write(jsonStr); err != nil {
+						if err := wc.writeWait(jsonStr); err != nil {
 							return
 						}
 					}
@@ -117,7 +152,7 @@ func chatWebsocketHandler(w http.ResponseWriter, r *http.Request) {
 				for _, msg := range messages {
 					jsonStr := chatMessageToJSON(msg)
 					if jsonStr != "" {
-						if err := wc.write(jsonStr); err != nil {
+						if err := wc.writeWait(jsonStr); err != nil {
 							return
 						}
 					}
@@ -149,7 +184,7 @@ func chatWebsocketHandler(w http.ResponseWriter, r *http.Request) {
 				for _, msg := range messages {
 					jsonStr := chatMessageToJSON(msg)
 					if jsonStr != "" {
-						if err := wc.write(jsonStr); err != nil {
+						if err := wc.writeWait(jsonStr); err != nil {
 							return
 						}
 					}
@@ -159,7 +194,9 @@ func chatWebsocketHandler(w http.ResponseWriter, r *http.Request) {
 		case "send":
 			// Send a chat message
 			if chatClient != nil && cmd.Message != "" {
-				if err := chatClient.SendMessage(cmd.Message); err != nil {
+				err := chatClient.SendMessage(cmd.Message)
+				auditChat(actor, cmd, err)
+				if err != nil {
 					chatLog.Warnw("Failed to send chat message", "error", err)
 					// Send error back to client
 					errMsg := &ChatMessage{
@@ -175,7 +212,9 @@ func chatWebsocketHandler(w http.ResponseWriter, r *http.Request) {
 		case "command":
 			// Send a chat command (e.g., /topic, /users)
 			if chatClient != nil && cmd.Message != "" {
-				if err := chatClient.SendCommand(cmd.Message); err != nil {
+				err := chatClient.SendCommand(cmd.Message)
+				auditChat(actor, cmd, err)
+				if err != nil {
 					chatLog.Warnw("Failed to send chat command", "error", err, "command", cmd.Message)
 				}
 			}
@@ -208,7 +247,9 @@ func chatWebsocketHandler(w http.ResponseWriter, r *http.Request) {
 		case "set_name":
 			// Update name and QTH
 			if chatClient != nil {
-				if err := chatClient.SetNameAndQTH(cmd.Name, cmd.QTH); err != nil {
+				err := chatClient.SetNameAndQTH(cmd.Name, cmd.QTH)
+				auditChat(actor, cmd, err)
+				if err != nil {
 					chatLog.Warnw("Failed to set name/QTH", "error", err, "name", cmd.Name, "qth", cmd.QTH)
 					errMsg := &ChatMessage{
 						Type:    "chat_error",
@@ -226,7 +267,9 @@ func chatWebsocketHandler(w http.ResponseWriter, r *http.Request) {
 		case "set_topic":
 			// Change topic
 			if chatClient != nil && cmd.Topic != "" {
-				if err := chatClient.SetTopic(cmd.Topic); err != nil {
+				err := chatClient.SetTopic(cmd.Topic)
+				auditChat(actor, cmd, err)
+				if err != nil {
 					chatLog.Warnw("Failed to set topic", "error", err, "topic", cmd.Topic)
 					errMsg := &ChatMessage{
 						Type:    "chat_error",
@@ -0,0 +1,382 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// circuitPairWindow is how far apart an inbound and an outbound circuit
+	// may come up and still be paired. LinBPQ opens the outbound circuit as
+	// soon as the user's connect command reaches it, so seconds is typical;
+	// the margin covers a slow route lookup and a retried CONN REQ.
+	circuitPairWindow = 2 * time.Minute
+	// userSessionKeep is how many finished user sessions are kept.
+	userSessionKeep = 100
+	// circuitLegIdle is how long an open circuit's L2 link, or the circuit
+	// itself if it has none, may be quiet before the circuit is taken to
+	// have closed with its CircuitDown lost.
+	circuitLegIdle = 2 * time.Hour
+)
+
+// netromAddr is a NetROM L4 endpoint as LinBPQ reports it in circuit events:
+// "user@node:cct" or "call:cct".
+type netromAddr struct {
+	User    string // originating user, if given
+	Node    string
+	Circuit string
+}
+
+func parseNetROMAddr(s string) netromAddr {
+	var a netromAddr
+	rest := strings.ToUpper(strings.TrimSpace(s))
+	if i := strings.LastIndex(rest, ":"); i >= 0 {
+		a.Circuit = rest[i+1:]
+		rest = rest[:i]
+	}
+	if i := strings.Index(rest, "@"); i >= 0 {
+		a.User, a.Node = rest[:i], rest[i+1:]
+	} else {
+		a.Node = rest
+	}
+	return a
+}
+
+// UserSessionHop is one circuit of a user session, with the L2 link it runs
+// over.
+type UserSessionHop struct {
+	CircuitID  int    `json:"circuitId"`
+	Direction  string `json:"direction"` // "incoming" or "outgoing"
+	Node       string `json:"node"`      // the node at the far end of this hop
+	Remote     string `json:"remote"`
+	Local      string `json:"local"`
+	State      string `json:"state"`
+	SegsSent   int64  `json:"segsSent"`
+	SegsRcvd   int64  `json:"segsRcvd"`
+	SegsResent int64  `json:"segsResent"`
+	// The L2 session the circuit was attached to, and its retry counters.
+	// These cover all traffic on the link, not just this circuit.
+	SessionID   string  `json:"sessionId,omitempty"`
+	Port        int     `json:"port,omitempty"`
+	L2Retries   int     `json:"l2Retries"`
+	L2RetryRate float64 `json:"l2RetryRate"`
+}
+
+// resendPct is L4 segments resent as a percentage of segments sent.
+func (h UserSessionHop) resendPct() float64 {
+	if h.SegsSent == 0 {
+		return 0
+	}
+	return float64(h.SegsResent) / float64(h.SegsSent) * 100
+}
+
+// UserSession is an end-to-end NetROM connection seen at this node: one
+// circuit if it ends here, or an inbound and an outbound circuit paired up
+// if it passes through.
+type UserSession struct {
+	ID           string           `json:"id"`
+	User         string           `json:"user,omitempty"`
+	Path         []string         `json:"path"`
+	Transit      bool             `json:"transit"`
+	State        string           `json:"state"`
+	StartedAt    time.Time        `json:"startedAt"`
+	EndedAt      *time.Time       `json:"endedAt,omitempty"`
+	DurationSecs float64          `json:"durationSecs"`
+	Hops         []UserSessionHop `json:"hops"`
+	// WorstHop is the index in Hops with the highest retry rate, L2 or L4,
+	// or -1 if no hop has retried.
+	WorstHop int `json:"worstHop"`
+}
+
+// circuitLeg is an open circuit the correlator is tracking.
+type circuitLeg struct {
+	id        int
+	direction string
+	users     []string
+	up        time.Time
+	sessionID string
+	user      *UserSession
+}
+
+// CircuitCorrelator pairs the inbound and outbound circuits of users passing
+// through this node, matching the originating user in the NetROM addresses
+// of circuits that come up close together. It is not safe for concurrent
+// use; SessionTracker calls it with its lock held.
+type CircuitCorrelator struct {
+	open     map[int]*circuitLeg
+	sessions []*UserSession // oldest first
+}
+
+// NewCircuitCorrelator creates an empty correlator.
+func NewCircuitCorrelator() *CircuitCorrelator {
+	return &CircuitCorrelator{open: make(map[int]*circuitLeg)}
+}
+
+// circuitUsers returns the originating users named in a circuit's
+// addresses.
+func circuitUsers(c *Circuit) []string {
+	var users []string
+	for _, addr := range []string{c.Remote, c.Local} {
+		if a := parseNetROMAddr(addr); a.User != "" {
+			users = append(users, a.User)
+		}
+	}
+	return users
+}
+
+func sharesUser(a, b []string) bool {
+	for _, x := range a {
+		for _, y := range b {
+			if x == y {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// CircuitUp records a new circuit, attached to L2 session sessionID (empty
+// if none), and returns the user session it now belongs to. A circuit
+// still open under the same ID is closed first; callers that want its user
+// session should Close it themselves.
+func (cc *CircuitCorrelator) CircuitUp(c *Circuit, sessionID string, port int, now time.Time) *UserSession {
+	cc.Close(c.ID, now)
+	leg := &circuitLeg{id: c.ID, direction: c.Direction, users: circuitUsers(c), up: now, sessionID: sessionID}
+	cc.open[c.ID] = leg
+
+	hop := UserSessionHop{
+		CircuitID: c.ID,
+		Direction: c.Direction,
+		Node:      parseNetROMAddr(c.Remote).Node,
+		Remote:    c.Remote,
+		Local:     c.Local,
+		State:     "connected",
+		SessionID: sessionID,
+		Port:      port,
+	}
+
+	// Look for the other half: an open, unpaired circuit in the opposite
+	// direction for the same user, the most recent within the window.
+	var partner *circuitLeg
+	for _, other := range cc.open {
+		if other == leg || other.direction == c.Direction || len(other.user.Hops) != 1 ||
+			other.user.State != "connected" || now.Sub(other.up) > circuitPairWindow ||
+			!sharesUser(leg.users, other.users) {
+			continue
+		}
+		if partner == nil || other.up.After(partner.up) {
+			partner = other
+		}
+	}
+
+	if partner != nil {
+		us := partner.user
+		if c.Direction == "incoming" {
+			us.Hops = append([]UserSessionHop{hop}, us.Hops...)
+			// The session started with whichever leg came up first
+			if now.Before(us.StartedAt) {
+				us.StartedAt = now
+			}
+		} else {
+			us.Hops = append(us.Hops, hop)
+		}
+		us.Transit = true
+		us.ID = fmt.Sprintf("%d>%d", us.Hops[0].CircuitID, us.Hops[1].CircuitID)
+		us.Path = userSessionPath(us)
+		leg.user = us
+		return us
+	}
+
+	us := &UserSession{
+		ID:        fmt.Sprintf("%d", c.ID),
+		State:     "connected",
+		StartedAt: now,
+		Hops:      []UserSessionHop{hop},
+		WorstHop:  -1,
+	}
+	if len(leg.users) > 0 {
+		us.User = leg.users[0]
+	}
+	us.Path = userSessionPath(us)
+	leg.user = us
+	cc.sessions = append(cc.sessions, us)
+	cc.prune()
+	return us
+}
+
+// CircuitDown records a circuit closing and returns its user session, or nil
+// if the circuit was not being tracked.
+func (cc *CircuitCorrelator) CircuitDown(id int, segsSent, segsRcvd, segsResent int64, now time.Time) *UserSession {
+	leg, ok := cc.open[id]
+	if !ok {
+		return nil
+	}
+	for i := range leg.user.Hops {
+		if h := &leg.user.Hops[i]; h.CircuitID == id {
+			h.SegsSent, h.SegsRcvd, h.SegsResent = segsSent, segsRcvd, segsResent
+		}
+	}
+	return cc.Close(id, now)
+}
+
+// Close records a circuit closing without its final counters, as when its
+// CircuitDown was lost, and returns its user session, or nil if the
+// circuit was not open.
+func (cc *CircuitCorrelator) Close(id int, now time.Time) *UserSession {
+	leg, ok := cc.open[id]
+	if !ok {
+		return nil
+	}
+	delete(cc.open, id)
+
+	us := leg.user
+	allDown := true
+	for i := range us.Hops {
+		h := &us.Hops[i]
+		if h.CircuitID == id {
+			h.State = "disconnected"
+		}
+		if h.State != "disconnected" {
+			allDown = false
+		}
+	}
+	if allDown {
+		t := now
+		us.EndedAt = &t
+		us.State = "disconnected"
+		us.DurationSecs = now.Sub(us.StartedAt).Seconds()
+	}
+	return us
+}
+
+// Expire closes the circuits whose L2 link, or the circuit itself if it
+// has none, has been quiet for circuitLegIdle, and returns their user
+// sessions.
+func (cc *CircuitCorrelator) Expire(sessions map[string]*Session, now time.Time) []*UserSession {
+	var expired []*UserSession
+	for id, leg := range cc.open {
+		last := leg.up
+		if sess, ok := sessions[leg.sessionID]; ok && sess.LastActivity.After(last) {
+			last = sess.LastActivity
+		}
+		if now.Sub(last) > circuitLegIdle {
+			expired = append(expired, cc.Close(id, now))
+		}
+	}
+	cc.prune()
+	return expired
+}
+
+// UpdateL2 copies the retry counters of each hop's L2 session, if it is
+// still known, into the user session.
+func (cc *CircuitCorrelator) UpdateL2(us *UserSession, sessions map[string]*Session) {
+	for i := range us.Hops {
+		if sess, ok := sessions[us.Hops[i].SessionID]; ok {
+			us.Hops[i].L2Retries = sess.RetryCount
+			us.Hops[i].L2RetryRate = sess.RetryRate
+		}
+	}
+	us.WorstHop = worstHop(us.Hops)
+}
+
+// Sessions returns copies of the user sessions, most recently started
+// first, with durations of open sessions measured to now.
+func (cc *CircuitCorrelator) Sessions(now time.Time) []UserSession {
+	result := make([]UserSession, 0, len(cc.sessions))
+	for _, us := range cc.sessions {
+		cp := *us
+		cp.Hops = append([]UserSessionHop(nil), us.Hops...)
+		cp.Path = append([]string(nil), us.Path...)
+		if cp.EndedAt == nil {
+			cp.DurationSecs = now.Sub(cp.StartedAt).Seconds()
+		}
+		result = append(result, cp)
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].StartedAt.After(result[j].StartedAt)
+	})
+	return result
+}
+
+// prune drops the oldest finished user sessions beyond userSessionKeep.
+func (cc *CircuitCorrelator) prune() {
+	excess := len(cc.sessions) - userSessionKeep
+	if excess <= 0 {
+		return
+	}
+	kept := cc.sessions[:0]
+	for _, us := range cc.sessions {
+		if excess > 0 && us.State == "disconnected" {
+			excess--
+			continue
+		}
+		kept = append(kept, us)
+	}
+	cc.sessions = kept
+}
+
+// userSessionPath lists the stations a user session passes through, from
+// the user to the far end: the user, the node they came in from, this node,
+// and the node the outbound circuit goes to.
+func userSessionPath(us *UserSession) []string {
+	var path []string
+	add := func(call string) {
+		if call != "" && (len(path) == 0 || path[len(path)-1] != call) {
+			path = append(path, call)
+		}
+	}
+	add(us.User)
+	for _, h := range us.Hops {
+		if h.Direction == "incoming" {
+			add(h.Node)
+		}
+	}
+	add(parseNetROMAddr(us.Hops[0].Local).Node)
+	for _, h := range us.Hops {
+		if h.Direction != "incoming" {
+			add(h.Node)
+		}
+	}
+	return path
+}
+
+// worstHop returns the index of the hop with the highest L2 retry rate or
+// L4 resend percentage, or -1 if none has retried.
+func worstHop(hops []UserSessionHop) int {
+	worst, worstScore := -1, 0.0
+	for i, h := range hops {
+		score := h.L2RetryRate
+		if pct := h.resendPct(); pct > score {
+			score = pct
+		}
+		if score > worstScore {
+			worst, worstScore = i, score
+		}
+	}
+	return worst
+}
+
+// userSessionsHandler serves the correlated user sessions. With
+// ?transit=true only sessions passing through this node are returned.
+func userSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	if sessionTrackerRef == nil {
+		http.Error(w, "session tracker not available", http.StatusServiceUnavailable)
+		return
+	}
+	sessions := sessionTrackerRef.GetUserSessions()
+	if r.URL.Query().Get("transit") == "true" {
+		transit := sessions[:0]
+		for _, us := range sessions {
+			if us.Transit {
+				transit = append(transit, us)
+			}
+		}
+		sessions = transit
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sessions)
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseNetROMAddr(t *testing.T) {
+	tests := []struct {
+		in   string
+		want netromAddr
+	}{
+		{"G8PZT@G8PZT:14c0", netromAddr{User: "G8PZT", Node: "G8PZT", Circuit: "14C0"}},
+		{"n0usr-7@K1ABC-4:0a01", netromAddr{User: "N0USR-7", Node: "K1ABC-4", Circuit: "0A01"}},
+		{"WA2M-4:0001", netromAddr{Node: "WA2M-4", Circuit: "0001"}},
+		{"N3LLO", netromAddr{Node: "N3LLO"}},
+	}
+	for _, tt := range tests {
+		if got := parseNetROMAddr(tt.in); got != tt.want {
+			t.Errorf("parseNetROMAddr(%q) = %+v, want %+v", tt.in, got, tt.want)
+		}
+	}
+}
+
+// A user coming in from K1ABC and connecting on to N3LLO is one user
+// session with both hops, the path through this node, and the lossy hop
+// picked out.
+func TestCircuitCorrelatorPairsTransit(t *testing.T) {
+	cc := NewCircuitCorrelator()
+	t0 := time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)
+
+	in := cc.CircuitUp(&Circuit{ID: 1, Direction: "incoming", Remote: "N0USR@K1ABC-4:0a01", Local: "WA2M-4:0001"}, "1-K1ABC-2-WA2M-2", 1, t0)
+	// Another user's circuit at the same time must not be paired
+	cc.CircuitUp(&Circuit{ID: 2, Direction: "outgoing", Remote: "N3LLO-4:0102", Local: "K9XYZ@WA2M-4:0002"}, "2-N3LLO-2-WA2M-2", 2, t0.Add(time.Second))
+	out := cc.CircuitUp(&Circuit{ID: 3, Direction: "outgoing", Remote: "N3LLO-4:0103", Local: "N0USR@WA2M-4:0003"}, "2-N3LLO-2-WA2M-2", 2, t0.Add(3*time.Second))
+
+	if in != out {
+		t.Fatalf("outbound circuit was not paired with the inbound one")
+	}
+	if !out.Transit || out.ID != "1>3" || out.User != "N0USR" {
+		t.Errorf("user session = %+v, want transit 1>3 for N0USR", out)
+	}
+	if want := []string{"N0USR", "K1ABC-4", "WA2M-4", "N3LLO-4"}; !reflect.DeepEqual(out.Path, want) {
+		t.Errorf("Path = %v, want %v", out.Path, want)
+	}
+
+	cc.UpdateL2(out, map[string]*Session{
+		"1-K1ABC-2-WA2M-2": {RetryCount: 1, RetryRate: 2},
+		"2-N3LLO-2-WA2M-2": {RetryCount: 3, RetryRate: 4},
+	})
+	cc.CircuitDown(1, 100, 90, 1, t0.Add(time.Minute))
+	if out.State != "connected" {
+		t.Errorf("State = %q after one hop closed, want connected", out.State)
+	}
+	cc.CircuitDown(3, 100, 90, 25, t0.Add(2*time.Minute))
+	cc.UpdateL2(out, nil)
+	if out.State != "disconnected" || out.DurationSecs != 120 {
+		t.Errorf("State = %q, DurationSecs = %v, want disconnected after 120s", out.State, out.DurationSecs)
+	}
+	if out.WorstHop != 1 || out.Hops[1].L2Retries != 3 || out.Hops[1].SegsResent != 25 {
+		t.Errorf("WorstHop = %d, hops = %+v, want the N3LLO hop", out.WorstHop, out.Hops)
+	}
+
+	sessions := cc.Sessions(t0.Add(3 * time.Minute))
+	if len(sessions) != 2 || sessions[0].ID != "2" || sessions[1].ID != "1>3" {
+		t.Errorf("Sessions = %+v, want the unpaired circuit then the transit session", sessions)
+	}
+}
+
+// When the outgoing leg comes up first, the session still starts with it.
+func TestCircuitCorrelatorOutgoingFirst(t *testing.T) {
+	cc := NewCircuitCorrelator()
+	t0 := time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)
+	out := cc.CircuitUp(&Circuit{ID: 1, Direction: "outgoing", Remote: "N3LLO-4:0103", Local: "N0USR@WA2M-4:0003"}, "", 0, t0)
+	in := cc.CircuitUp(&Circuit{ID: 2, Direction: "incoming", Remote: "N0USR@K1ABC-4:0a01", Local: "WA2M-4:0001"}, "", 0, t0.Add(5*time.Second))
+	if in != out || in.ID != "2>1" {
+		t.Fatalf("circuits were not paired: %+v", in)
+	}
+	if !in.StartedAt.Equal(t0) {
+		t.Errorf("StartedAt = %v, want the outgoing leg's %v", in.StartedAt, t0)
+	}
+	cc.CircuitDown(1, 0, 0, 0, t0.Add(time.Minute))
+	cc.CircuitDown(2, 0, 0, 0, t0.Add(time.Minute))
+	cc.UpdateL2(in, nil)
+	if in.DurationSecs != 60 {
+		t.Errorf("DurationSecs = %v, want 60", in.DurationSecs)
+	}
+}
+
+// Circuits too far apart in time stay separate user sessions.
+func TestCircuitCorrelatorWindow(t *testing.T) {
+	cc := NewCircuitCorrelator()
+	t0 := time.Now()
+	in := cc.CircuitUp(&Circuit{ID: 1, Direction: "incoming", Remote: "N0USR@K1ABC-4:0a01", Local: "WA2M-4:0001"}, "", 0, t0)
+	out := cc.CircuitUp(&Circuit{ID: 2, Direction: "outgoing", Remote: "N3LLO-4:0102", Local: "N0USR@WA2M-4:0002"}, "", 0, t0.Add(circuitPairWindow+time.Second))
+	if in == out || in.Transit || out.Transit {
+		t.Errorf("circuits %v apart were paired", circuitPairWindow+time.Second)
+	}
+	if cc.CircuitDown(99, 0, 0, 0, t0) != nil {
+		t.Error("CircuitDown for an unknown circuit returned a session")
+	}
+}
+
+// A circuit whose down event was lost is closed when its ID comes up
+// again, or once its link has been quiet for circuitLegIdle.
+func TestCircuitCorrelatorLostDown(t *testing.T) {
+	cc := NewCircuitCorrelator()
+	t0 := time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)
+	first := cc.CircuitUp(&Circuit{ID: 1, Direction: "incoming", Remote: "N0USR@K1ABC-4:0a01", Local: "WA2M-4:0001"}, "", 0, t0)
+	second := cc.CircuitUp(&Circuit{ID: 1, Direction: "incoming", Remote: "K9XYZ@K1ABC-4:0a02", Local: "WA2M-4:0001"}, "", 0, t0.Add(time.Hour))
+	if first == second || first.State != "disconnected" || first.DurationSecs != 3600 {
+		t.Errorf("reused ID left the first session %+v", first)
+	}
+	if second.State != "connected" || len(cc.open) != 1 {
+		t.Errorf("second session %+v, %d open legs", second, len(cc.open))
+	}
+
+	busy := cc.CircuitUp(&Circuit{ID: 2, Direction: "incoming", Remote: "N3LLO@K1ABC-4:0a03", Local: "WA2M-4:0002"}, "1-K1ABC-2-WA2M-2", 1, t0.Add(time.Hour))
+	sessions := map[string]*Session{"1-K1ABC-2-WA2M-2": {LastActivity: t0.Add(3 * time.Hour)}}
+	expired := cc.Expire(sessions, t0.Add(time.Hour+circuitLegIdle+time.Second))
+	if len(expired) != 1 || expired[0] != second || second.State != "disconnected" {
+		t.Errorf("expired %+v, want only the quiet circuit's session", expired)
+	}
+	if busy.State != "connected" {
+		t.Error("a circuit on a busy link was expired")
+	}
+}
+
+// The tracker feeds circuits to the correlator and reports user sessions
+// through its callback.
+func TestSessionTrackerUserSessions(t *testing.T) {
+	tracker := NewSessionTracker(200, nil, testLogger())
+	var updates []*UserSession
+	tracker.SetUserSessionFunc(func(us *UserSession) { updates = append(updates, us) })
+
+	tracker.HandleCircuitUp(&CircuitUpEvent{ID: 7, Direction: "incoming", Remote: "N0USR@K1ABC-4:0a01", Local: "WA2M-4:0001"})
+	tracker.HandleCircuitUp(&CircuitUpEvent{ID: 8, Direction: "outgoing", Remote: "N3LLO-4:0102", Local: "N0USR@WA2M-4:0002"})
+	tracker.HandleCircuitDown(&CircuitDownEvent{ID: 7, SegsSent: 10})
+	tracker.HandleCircuitDown(&CircuitDownEvent{ID: 8, SegsSent: 10})
+
+	if len(updates) != 4 {
+		t.Fatalf("got %d updates, want 4", len(updates))
+	}
+	if last := updates[3]; last.ID != "7>8" || last.State != "disconnected" {
+		t.Errorf("last update = %+v, want 7>8 disconnected", last)
+	}
+	if got := tracker.GetUserSessions(); len(got) != 1 || !got[0].Transit {
+		t.Errorf("GetUserSessions = %+v, want one transit session", got)
+	}
+}
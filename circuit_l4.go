@@ -0,0 +1,176 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultL4Window is the NetROM transport window assumed until a CONN REQ or
+// CONN ACK for the circuit is seen. It is LinBPQ's default L4WINDOW.
+const defaultL4Window = 4
+
+// l4State is the sequence tracking for one open circuit, matched to NetROM
+// frames in L2Trace by circuit index/ID and far-end node.
+type l4State struct {
+	localCct   int // our circuit index/ID: ToCct of frames we receive
+	remoteCct  int // theirs: ToCct of frames we send
+	remoteNode string
+	started    time.Time
+
+	nextTx   int // TxSeq after the highest INFO we have sent
+	nextRx   int // TxSeq after the highest INFO we have received
+	peerAck  int // RxSeq last received: the next INFO the far end expects
+	txSeen   bool
+	rxSeen   bool
+	samples  int
+	totalOut int
+}
+
+// seqBehind reports whether sequence number seq (mod 256) falls within the
+// half-space before next, i.e. has already been used.
+func seqBehind(seq, next int) bool {
+	d := (next - seq) & 0xFF
+	return d > 0 && d < 128
+}
+
+// parseCct parses the hex circuit index/ID from a NetROM address.
+func parseCct(addr string) (int, bool) {
+	cct := parseNetROMAddr(addr).Circuit
+	if cct == "" {
+		return 0, false
+	}
+	n, err := strconv.ParseUint(cct, 16, 16)
+	if err != nil {
+		return 0, false
+	}
+	return int(n), true
+}
+
+// newL4State sets up sequence tracking for a circuit from its addresses.
+// Circuits whose addresses carry no circuit number cannot be matched to
+// frames and get no state.
+func newL4State(c *Circuit, now time.Time) *l4State {
+	local, ok := parseCct(c.Local)
+	if !ok {
+		return nil
+	}
+	remote, ok := parseCct(c.Remote)
+	if !ok {
+		return nil
+	}
+	return &l4State{
+		localCct:   local,
+		remoteCct:  remote,
+		remoteNode: baseCallsign(parseNetROMAddr(c.Remote).Node),
+		started:    now,
+	}
+}
+
+// findL4Locked returns the circuit a NetROM L4 frame belongs to, or nil if
+// it is not for one of our open circuits (e.g. L3 traffic routed through).
+func (st *SessionTracker) findL4Locked(event *L2TraceEvent) (*Circuit, *l4State) {
+	cct, node := event.ToCct, event.L3Src
+	if event.Direction == "sent" {
+		node = event.L3Dst
+	}
+	node = baseCallsign(node)
+	for id, state := range st.l4 {
+		want := state.localCct
+		if event.Direction == "sent" {
+			want = state.remoteCct
+		}
+		if cct != want || (node != "" && state.remoteNode != "" && node != state.remoteNode) {
+			continue
+		}
+		if c, ok := st.circuits[id]; ok && c.State == "connected" {
+			return c, state
+		}
+	}
+	return nil, nil
+}
+
+// trackL4Locked updates a circuit's transport counters from a NetROM frame.
+// l2Retry is set when the frame is an L2 retransmission, so that an INFO
+// resent by AX.25 on this hop is not also counted as an L4 resend.
+func (st *SessionTracker) trackL4Locked(event *L2TraceEvent, l2Retry bool, now time.Time) {
+	c, state := st.findL4Locked(event)
+	if c == nil {
+		return
+	}
+	l4Type := strings.ToUpper(event.L4Type)
+	sent := event.Direction == "sent"
+
+	// LinBPQ appends the opcode flags to the type ("INFO ACK CHOKE")
+	if strings.Contains(l4Type, "CHOKE") {
+		c.Chokes++
+	}
+	if strings.Contains(l4Type, "NAK") {
+		c.NAKs++
+	}
+
+	switch {
+	case strings.HasPrefix(l4Type, "CONN REQ"), strings.HasPrefix(l4Type, "CONN ACK"):
+		if event.Window > 0 {
+			c.Window = event.Window
+		}
+	case strings.HasPrefix(l4Type, "INFO ACK"):
+		if !sent {
+			state.peerAck = event.RxSeq & 0xFF
+		}
+	case strings.HasPrefix(l4Type, "INFO"):
+		if sent {
+			if l2Retry {
+				break
+			}
+			c.InfoSent++
+			c.PayloadSent += int64(event.PayLen)
+			if state.txSeen && seqBehind(event.TxSeq, state.nextTx) {
+				c.L4Resends++
+			} else {
+				state.nextTx = (event.TxSeq + 1) & 0xFF
+				state.txSeen = true
+			}
+			outstanding := (state.nextTx - state.peerAck) & 0xFF
+			if outstanding > c.MaxOutstanding {
+				c.MaxOutstanding = outstanding
+			}
+			state.samples++
+			state.totalOut += outstanding
+		} else {
+			c.InfoRcvd++
+			c.PayloadRcvd += int64(event.PayLen)
+			state.peerAck = event.RxSeq & 0xFF
+			if state.rxSeen && seqBehind(event.TxSeq, state.nextRx) {
+				c.L4DupsRcvd++
+			} else {
+				state.nextRx = (event.TxSeq + 1) & 0xFF
+				state.rxSeen = true
+			}
+		}
+	}
+
+	window := c.Window
+	if window == 0 {
+		window = defaultL4Window
+	}
+	if state.samples > 0 {
+		c.WindowUtilPct = float64(state.totalOut) / float64(state.samples) / float64(window) * 100
+	}
+	if elapsed := now.Sub(state.started).Seconds(); elapsed >= 1 {
+		c.ThroughputBps = float64(c.PayloadSent+c.PayloadRcvd) / elapsed
+	}
+
+	// Sessions hold copies of their circuits
+	if sessID, ok := st.circuitSession[c.ID]; ok {
+		if sess, ok := st.sessions[sessID]; ok {
+			for i := range sess.Circuits {
+				if sess.Circuits[i].ID == c.ID {
+					sess.Circuits[i] = *c
+					break
+				}
+			}
+			st.notifyChangeLocked(sess, false)
+		}
+	}
+}
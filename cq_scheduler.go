@@ -0,0 +1,314 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CQFormat identifies one kind of link-status CQ broadcast.
+type CQFormat string
+
+const (
+	// CQFormatLS1 is tarpn-mon's own [LS1] port counters broadcast.
+	CQFormatLS1 CQFormat = "ls1"
+	// CQFormatTARPNStat is the [TARPNstat V2] route broadcast that
+	// send-routes-via-cq sends from a systemd timer on stock TARPN nodes.
+	CQFormatTARPNStat CQFormat = "tarpnstat"
+)
+
+// CQPortSchedule overrides the schedule of a format on a single port.
+type CQPortSchedule struct {
+	Disabled bool
+	// Interval replaces the format's default interval when non-zero.
+	Interval time.Duration
+}
+
+// cqOnInterval is the interval of a format turned on for a port without
+// one of its own, when the format is off by default.
+const cqOnInterval = 10 * time.Minute
+
+// CQScheduleConfig controls when link-status CQs go out. Every node in a
+// TARPN network used to send on the same fixed ticker, so on a shared
+// channel they collided; the jitter, quiet hours and busy-channel rules are
+// there to spread them out and keep them off a channel that is in use.
+type CQScheduleConfig struct {
+	// LS1Interval and TARPNStatInterval are the default interval for each
+	// format. Zero disables that format.
+	LS1Interval       time.Duration
+	TARPNStatInterval time.Duration
+	// Jitter is the maximum random offset, in either direction, added to
+	// each interval.
+	Jitter time.Duration
+	// Ports holds per-port overrides by format. An override for a format
+	// turns it on for the port even if it is off by default; one under
+	// the empty format applies to whichever formats are on by default.
+	// Ports not listed use the defaults.
+	Ports map[int]map[CQFormat]CQPortSchedule
+	// QuietStart and QuietEnd bound a daily window, in minutes after local
+	// midnight, in which nothing is sent. The window may wrap midnight.
+	// Equal values mean no quiet hours.
+	QuietStart, QuietEnd int
+	// BusyPct skips a port whose latest S-command ActiveBusyPct is at or
+	// above this value. Zero disables the check.
+	BusyPct int
+	// HeardWithin skips a port on which a frame was heard this recently.
+	// Zero disables the check.
+	HeardWithin time.Duration
+	// RetryDelay is how long a skipped broadcast waits before being tried
+	// again.
+	RetryDelay time.Duration
+}
+
+// DefaultCQScheduleConfig matches the behaviour before the scheduler
+// existed (LS1 every 10 minutes, no TARPNstat) plus modest jitter and
+// busy-channel rules.
+func DefaultCQScheduleConfig() CQScheduleConfig {
+	return CQScheduleConfig{
+		LS1Interval: 10 * time.Minute,
+		Jitter:      2 * time.Minute,
+		BusyPct:     50,
+		HeardWithin: 30 * time.Second,
+		RetryDelay:  time.Minute,
+	}
+}
+
+// CQBroadcast is one CQ the scheduler has decided to send now.
+type CQBroadcast struct {
+	PortNum int
+	Format  CQFormat
+}
+
+type cqKey struct {
+	port   int
+	format CQFormat
+}
+
+// CQScheduler decides which port/format pairs are due for a CQ. It keeps
+// only the next-due time per pair; sending is left to the caller.
+type CQScheduler struct {
+	config CQScheduleConfig
+	next   map[cqKey]time.Time
+	rng    *rand.Rand
+
+	// lastHeard returns when a frame was last heard on a port (zero if
+	// never). Set to PortLastHeard in production.
+	lastHeard func(port int) time.Time
+}
+
+// NewCQScheduler creates a scheduler. lastHeard may be nil, which disables
+// the recently-heard rule.
+func NewCQScheduler(config CQScheduleConfig, lastHeard func(port int) time.Time) *CQScheduler {
+	return &CQScheduler{
+		config:    config,
+		next:      make(map[cqKey]time.Time),
+		rng:       rand.New(rand.NewSource(time.Now().UnixNano())),
+		lastHeard: lastHeard,
+	}
+}
+
+// interval returns the configured interval for a port and format, or zero
+// if that broadcast is disabled.
+func (s *CQScheduler) interval(port int, format CQFormat) time.Duration {
+	var d time.Duration
+	switch format {
+	case CQFormatLS1:
+		d = s.config.LS1Interval
+	case CQFormatTARPNStat:
+		d = s.config.TARPNStatInterval
+	}
+	overrides := s.config.Ports[port]
+	if ps, ok := overrides[format]; ok {
+		switch {
+		case ps.Disabled:
+			return 0
+		case ps.Interval > 0:
+			return ps.Interval
+		case d > 0:
+			return d
+		}
+		return cqOnInterval
+	}
+	if ps, ok := overrides[""]; ok && d > 0 {
+		if ps.Disabled {
+			return 0
+		}
+		if ps.Interval > 0 {
+			d = ps.Interval
+		}
+	}
+	return d
+}
+
+// jittered returns d offset by a random amount in [-Jitter, +Jitter],
+// never less than half of d.
+func (s *CQScheduler) jittered(d time.Duration) time.Duration {
+	j := d
+	if s.config.Jitter > 0 {
+		j += time.Duration(s.rng.Int63n(int64(2*s.config.Jitter)+1)) - s.config.Jitter
+	}
+	if j < d/2 {
+		j = d / 2
+	}
+	return j
+}
+
+// inQuietHours reports whether now falls in the configured quiet window.
+func (s *CQScheduler) inQuietHours(now time.Time) bool {
+	start, end := s.config.QuietStart, s.config.QuietEnd
+	if start == end {
+		return false
+	}
+	m := now.Hour()*60 + now.Minute()
+	if start < end {
+		return m >= start && m < end
+	}
+	return m >= start || m < end
+}
+
+// Due returns the broadcasts to send now, given the RF ports currently known
+// and their latest busy percentages, and reschedules them. A port seen for
+// the first time is given a random start offset within its interval so that
+// nodes restarted together do not stay in step.
+func (s *CQScheduler) Due(now time.Time, ports []int, busyPct map[int]int) []CQBroadcast {
+	if s.inQuietHours(now) {
+		return nil
+	}
+
+	var due []CQBroadcast
+	for _, port := range ports {
+		for _, format := range []CQFormat{CQFormatLS1, CQFormatTARPNStat} {
+			interval := s.interval(port, format)
+			if interval == 0 {
+				continue
+			}
+			key := cqKey{port, format}
+			next, scheduled := s.next[key]
+			if !scheduled {
+				s.next[key] = now.Add(time.Duration(s.rng.Int63n(int64(interval)) + 1))
+				continue
+			}
+			if now.Before(next) {
+				continue
+			}
+
+			if reason := s.skipReason(now, port, busyPct); reason != "" {
+				statsLog.Debugw("CQ deferred", "port", port, "format", format, "reason", reason)
+				s.next[key] = now.Add(s.jittered(s.config.RetryDelay))
+				continue
+			}
+
+			due = append(due, CQBroadcast{PortNum: port, Format: format})
+			s.next[key] = now.Add(s.jittered(interval))
+		}
+	}
+	return due
+}
+
+// skipReason returns why a port should not be transmitted on right now, or
+// "" if it is clear.
+func (s *CQScheduler) skipReason(now time.Time, port int, busyPct map[int]int) string {
+	if s.config.BusyPct > 0 && busyPct[port] >= s.config.BusyPct {
+		return fmt.Sprintf("channel busy %d%%", busyPct[port])
+	}
+	if s.config.HeardWithin > 0 && s.lastHeard != nil {
+		if t := s.lastHeard(port); !t.IsZero() && now.Sub(t) < s.config.HeardWithin {
+			return "frame heard " + now.Sub(t).Round(time.Second).String() + " ago"
+		}
+	}
+	return ""
+}
+
+// parseCQPorts parses the -stats-cq-ports value: a comma-separated list of
+// <port>=[<format>:]<off|on|interval>, e.g. "3=off,4=20m,5=ls1:on,5=tarpnstat:30m".
+// Without a format, an entry applies to the formats on by default; with
+// one, it can also turn that format on for the port.
+func parseCQPorts(spec string) (map[int]map[CQFormat]CQPortSchedule, error) {
+	ports := make(map[int]map[CQFormat]CQPortSchedule)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		portStr, value, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid CQ port entry %q: want <port>=[<format>:]<off|on|interval>", entry)
+		}
+		port, err := strconv.Atoi(strings.TrimSpace(portStr))
+		if err != nil {
+			return nil, fmt.Errorf("invalid port in %q: %w", entry, err)
+		}
+		var format CQFormat
+		if f, v, ok := strings.Cut(value, ":"); ok {
+			format = CQFormat(strings.ToLower(strings.TrimSpace(f)))
+			if format != CQFormatLS1 && format != CQFormatTARPNStat {
+				return nil, fmt.Errorf("invalid format in %q: want ls1 or tarpnstat", entry)
+			}
+			value = v
+		}
+		var ps CQPortSchedule
+		value = strings.TrimSpace(value)
+		switch strings.ToLower(value) {
+		case "off", "no", "false":
+			ps.Disabled = true
+		case "on", "yes", "true":
+		default:
+			d, err := time.ParseDuration(value)
+			if err != nil || d <= 0 {
+				return nil, fmt.Errorf("invalid interval in %q", entry)
+			}
+			ps.Interval = d
+		}
+		if ports[port] == nil {
+			ports[port] = make(map[CQFormat]CQPortSchedule)
+		}
+		ports[port][format] = ps
+	}
+	return ports, nil
+}
+
+// parseQuietHours parses the -stats-cq-quiet value, "HH:MM-HH:MM" in local
+// time, into minutes after midnight. An empty string means no quiet hours.
+func parseQuietHours(spec string) (int, int, error) {
+	if strings.TrimSpace(spec) == "" {
+		return 0, 0, nil
+	}
+	startStr, endStr, ok := strings.Cut(spec, "-")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid quiet hours %q: want HH:MM-HH:MM", spec)
+	}
+	start, err := time.Parse("15:04", strings.TrimSpace(startStr))
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid quiet hours start %q: %w", startStr, err)
+	}
+	end, err := time.Parse("15:04", strings.TrimSpace(endStr))
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid quiet hours end %q: %w", endStr, err)
+	}
+	return start.Hour()*60 + start.Minute(), end.Hour()*60 + end.Minute(), nil
+}
+
+// portHeard records when a frame was last received on each port, from the
+// monitor stream. The CQ scheduler uses it to avoid keying up on a channel
+// that is in use.
+var portHeard = struct {
+	mu   sync.RWMutex
+	last map[int]time.Time
+}{last: make(map[int]time.Time)}
+
+// RecordPortHeard notes that a frame was just heard on port.
+func RecordPortHeard(port int) {
+	portHeard.mu.Lock()
+	portHeard.last[port] = time.Now()
+	portHeard.mu.Unlock()
+}
+
+// PortLastHeard returns when a frame was last heard on port.
+func PortLastHeard(port int) time.Time {
+	portHeard.mu.RLock()
+	defer portHeard.mu.RUnlock()
+	return portHeard.last[port]
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// runSchedule ticks the scheduler every 15 seconds, as the collector does,
+// and returns each broadcast with the time it became due.
+func runSchedule(s *CQScheduler, start time.Time, d time.Duration, ports []int, busy map[int]int) map[CQBroadcast][]time.Time {
+	sent := make(map[CQBroadcast][]time.Time)
+	for now := start; now.Before(start.Add(d)); now = now.Add(15 * time.Second) {
+		for _, b := range s.Due(now, ports, busy) {
+			sent[b] = append(sent[b], now)
+		}
+	}
+	return sent
+}
+
+func TestCQSchedulerIntervalsAndOverrides(t *testing.T) {
+	cfg := CQScheduleConfig{
+		LS1Interval:       10 * time.Minute,
+		TARPNStatInterval: 15 * time.Minute,
+		Jitter:            time.Minute,
+		Ports: map[int]map[CQFormat]CQPortSchedule{
+			2: {"": {Disabled: true}},
+			3: {"": {Interval: 30 * time.Minute}},
+		},
+	}
+	s := NewCQScheduler(cfg, nil)
+	start := time.Date(2025, 6, 1, 12, 0, 0, 0, time.Local)
+	sent := runSchedule(s, start, 2*time.Hour, []int{1, 2, 3}, nil)
+
+	if n := len(sent[CQBroadcast{2, CQFormatLS1}]) + len(sent[CQBroadcast{2, CQFormatTARPNStat}]); n != 0 {
+		t.Errorf("port 2 is disabled but sent %d CQs", n)
+	}
+	// 10 +/- 1 minute over two hours, with a random first offset: 10-13.
+	if n := len(sent[CQBroadcast{1, CQFormatLS1}]); n < 10 || n > 13 {
+		t.Errorf("port 1 LS1 sent %d times in 2h, want about 12", n)
+	}
+	if n := len(sent[CQBroadcast{1, CQFormatTARPNStat}]); n < 7 || n > 9 {
+		t.Errorf("port 1 TARPNstat sent %d times in 2h, want about 8", n)
+	}
+	if n := len(sent[CQBroadcast{3, CQFormatLS1}]); n < 3 || n > 5 {
+		t.Errorf("port 3 LS1 sent %d times in 2h, want about 4", n)
+	}
+
+	times := sent[CQBroadcast{1, CQFormatLS1}]
+	for i := 1; i < len(times); i++ {
+		gap := times[i].Sub(times[i-1])
+		if gap < 9*time.Minute || gap > 11*time.Minute+15*time.Second {
+			t.Errorf("gap %d = %v, want 10m +/- 1m jitter", i, gap)
+		}
+	}
+}
+
+func TestCQSchedulerQuietHoursWrapMidnight(t *testing.T) {
+	start, end, err := parseQuietHours("22:00-07:00")
+	if err != nil {
+		t.Fatalf("parseQuietHours: %v", err)
+	}
+	s := NewCQScheduler(CQScheduleConfig{LS1Interval: 10 * time.Minute, QuietStart: start, QuietEnd: end}, nil)
+
+	sent := runSchedule(s, time.Date(2025, 6, 1, 20, 0, 0, 0, time.Local), 12*time.Hour, []int{1}, nil)
+	for _, ts := range sent[CQBroadcast{1, CQFormatLS1}] {
+		if ts.Hour() >= 22 || ts.Hour() < 7 {
+			t.Errorf("CQ sent at %s, inside quiet hours", ts.Format("15:04"))
+		}
+	}
+	if len(sent[CQBroadcast{1, CQFormatLS1}]) == 0 {
+		t.Error("no CQs sent outside quiet hours")
+	}
+}
+
+// A busy or recently active port is deferred by RetryDelay, not dropped
+// until the next full interval.
+func TestCQSchedulerDefersBusyPort(t *testing.T) {
+	start := time.Date(2025, 6, 1, 12, 0, 0, 0, time.Local)
+	var heard time.Time
+	s := NewCQScheduler(CQScheduleConfig{
+		LS1Interval: 10 * time.Minute,
+		BusyPct:     50,
+		HeardWithin: 30 * time.Second,
+		RetryDelay:  time.Minute,
+	}, func(int) time.Time { return heard })
+
+	busy := map[int]int{1: 80}
+	s.Due(start, []int{1}, busy) // schedules the first CQ
+	due := start.Add(11 * time.Minute)
+	if got := s.Due(due, []int{1}, busy); len(got) != 0 {
+		t.Fatalf("sent on a busy channel: %v", got)
+	}
+
+	busy[1] = 10
+	heard = due.Add(50 * time.Second)
+	if got := s.Due(due.Add(time.Minute), []int{1}, busy); len(got) != 0 {
+		t.Fatalf("sent 10s after a frame was heard: %v", got)
+	}
+	if got := s.Due(due.Add(2*time.Minute), []int{1}, busy); len(got) != 1 {
+		t.Fatalf("clear channel one retry later: got %v, want one CQ", got)
+	}
+}
+
+// A port can turn on a format that is off by default, and set one format's
+// interval without touching the other's.
+func TestCQSchedulerPortFormats(t *testing.T) {
+	cfg := CQScheduleConfig{
+		TARPNStatInterval: 15 * time.Minute,
+		Ports: map[int]map[CQFormat]CQPortSchedule{
+			1: {CQFormatLS1: {}},
+			2: {CQFormatLS1: {Interval: 30 * time.Minute}, CQFormatTARPNStat: {Disabled: true}},
+			3: {"": {Interval: 5 * time.Minute}},
+		},
+	}
+	s := NewCQScheduler(cfg, nil)
+	tests := []struct {
+		port   int
+		format CQFormat
+		want   time.Duration
+	}{
+		{1, CQFormatLS1, cqOnInterval},
+		{1, CQFormatTARPNStat, 15 * time.Minute},
+		{2, CQFormatLS1, 30 * time.Minute},
+		{2, CQFormatTARPNStat, 0},
+		{3, CQFormatLS1, 0}, // off by default, and not named for the port
+		{3, CQFormatTARPNStat, 5 * time.Minute},
+		{4, CQFormatLS1, 0},
+	}
+	for _, tt := range tests {
+		if got := s.interval(tt.port, tt.format); got != tt.want {
+			t.Errorf("interval(%d, %s) = %v, want %v", tt.port, tt.format, got, tt.want)
+		}
+	}
+}
+
+func TestParseCQPorts(t *testing.T) {
+	ports, err := parseCQPorts("3=off, 4=20m,5=on,6=ls1:10m,6=TARPNstat:off")
+	if err != nil {
+		t.Fatalf("parseCQPorts: %v", err)
+	}
+	if !ports[3][""].Disabled || ports[4][""].Interval != 20*time.Minute || ports[5][""].Disabled {
+		t.Errorf("parseCQPorts = %+v", ports)
+	}
+	if ports[6][CQFormatLS1].Interval != 10*time.Minute || !ports[6][CQFormatTARPNStat].Disabled || len(ports[6]) != 2 {
+		t.Errorf("port 6 = %+v, want an LS1 interval and TARPNstat off", ports[6])
+	}
+	for _, bad := range []string{"3", "x=off", "4=soon", "4=-1m", "4=ls2:10m", "4=ls1:"} {
+		if _, err := parseCQPorts(bad); err == nil {
+			t.Errorf("parseCQPorts(%q) accepted", bad)
+		}
+	}
+}
@@ -27,7 +27,8 @@ type FeatureConfig struct {
 
 // FeatureStatus represents the current status of a feature connection
 type FeatureStatus struct {
-	Type        string       `json:"type"` // Always "feature_status"
+	Type string `json:"type"` // Always "feature_status"
+	wsReply
 	Feature     string       `json:"feature"`
 	State       FeatureState `json:"state"`
 	Callsign    string       `json:"callsign,omitempty"`
@@ -58,16 +59,7 @@ func BroadcastFeatureStatus(status FeatureStatus) {
 		return
 	}
 
-	// Broadcast to all connected clients
-	clientsMu.RLock()
-	defer clientsMu.RUnlock()
-
-	for client := range clients {
-		if err := client.write(string(data)); err != nil {
-			wsLog.Debugw("Feature status broadcast failed", "error", err, "feature", status.Feature)
-			go client.kill()
-		}
-	}
+	broadcastDirect(string(data))
 }
 
 // GetAllFeatureStatuses returns the current status of all features
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Server timeouts. WebSockets are unaffected, as the upgrader clears the
+// connection deadlines, and the long-lived OARC stream clears its own.
+const (
+	httpReadHeaderTimeout = 10 * time.Second
+	httpReadTimeout       = 30 * time.Second
+	httpWriteTimeout      = 60 * time.Second
+	httpIdleTimeout       = 120 * time.Second
+)
+
+// webAssetRoots are the paths the embedded frontend loads its assets from.
+// Under a base path they are rewritten in index.html and the JS bundles.
+var webAssetRoots = []string{"/_expo/", "/assets/", "/favicon.ico", "/canvaskit.wasm"}
+
+// httpBasePath is the prefix tarpn-mon is served under behind a reverse
+// proxy, such as "/tarpn", or "" when it is served at the root.
+var httpBasePath string
+
+// HTTPServerConfig says where and how to serve the web UI and APIs.
+type HTTPServerConfig struct {
+	// Listen holds "host:port" addresses (IPv6 as "[::1]:8212") and
+	// "unix:/path" sockets.
+	Listen []string
+	// TLSCert and TLSKey, if set, serve TCP addresses over TLS. The files
+	// are re-read when they change, so a renewed certificate is picked up
+	// without a restart.
+	TLSCert string
+	TLSKey  string
+	// BasePath is stripped from requests that carry it; see httpBasePath.
+	BasePath string
+}
+
+// normalizeBasePath turns "tarpn", "/tarpn/" and so on into "/tarpn", and
+// "" or "/" into "".
+func normalizeBasePath(p string) string {
+	p = strings.Trim(strings.TrimSpace(p), "/")
+	if p == "" {
+		return ""
+	}
+	return path.Clean("/" + p)
+}
+
+// basePathHandler strips base from request paths before passing them on,
+// so routes stay registered at "/". Requests without the prefix are served
+// as they are, which keeps direct access working and allows a proxy that
+// strips the prefix itself.
+func basePathHandler(base string, next http.Handler) http.Handler {
+	if base == "" {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == base {
+			http.Redirect(w, r, base+"/", http.StatusMovedPermanently)
+			return
+		}
+		if rest, ok := strings.CutPrefix(r.URL.Path, base+"/"); ok {
+			r2 := r.Clone(r.Context())
+			r2.URL.Path = "/" + rest
+			r2.URL.RawPath = ""
+			r = r2
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// rewriteForBasePath points the frontend's absolute asset URLs in an HTML
+// or JS file at the base path, and in HTML tells the app the base path so
+// that it can build its WebSocket URLs.
+func rewriteForBasePath(content []byte, html bool) []byte {
+	if httpBasePath == "" {
+		return content
+	}
+	for _, root := range webAssetRoots {
+		for _, q := range []string{`"`, `'`} {
+			content = bytes.ReplaceAll(content, []byte(q+root), []byte(q+httpBasePath+root))
+		}
+	}
+	if html {
+		script := fmt.Sprintf("<script>window.__TARPN_BASE_PATH__=%q</script>", httpBasePath)
+		if i := bytes.Index(content, []byte("</head>")); i >= 0 {
+			content = append(content[:i:i], append([]byte(script), content[i:]...)...)
+		}
+	}
+	return content
+}
+
+// certReloader serves a certificate from files, reloading them when their
+// modification times change.
+type certReloader struct {
+	certFile string
+	keyFile  string
+
+	mu       sync.Mutex
+	cert     *tls.Certificate
+	certTime time.Time
+	keyTime  time.Time
+}
+
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	c := &certReloader{certFile: certFile, keyFile: keyFile}
+	if err := c.reloadIfChanged(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// reloadIfChanged loads the files if they are newer than the loaded
+// certificate. On failure the loaded certificate is kept.
+func (c *certReloader) reloadIfChanged() error {
+	certInfo, err := os.Stat(c.certFile)
+	if err != nil {
+		return fmt.Errorf("failed to stat TLS certificate: %w", err)
+	}
+	keyInfo, err := os.Stat(c.keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to stat TLS key: %w", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.cert != nil && certInfo.ModTime().Equal(c.certTime) && keyInfo.ModTime().Equal(c.keyTime) {
+		return nil
+	}
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+	if c.cert != nil {
+		mainLog.Infow("Reloaded TLS certificate", "cert", c.certFile)
+	}
+	c.cert = &cert
+	c.certTime = certInfo.ModTime()
+	c.keyTime = keyInfo.ModTime()
+	return nil
+}
+
+// GetCertificate is the tls.Config hook. A renewal is noticed on the next
+// handshake after the files change.
+func (c *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	if err := c.reloadIfChanged(); err != nil {
+		mainLog.Warnw("Keeping the current TLS certificate", "error", err)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.cert, nil
+}
+
+// listenHTTP opens one listen address from HTTPServerConfig.Listen.
+func listenHTTP(addr string) (net.Listener, error) {
+	sock, ok := strings.CutPrefix(addr, "unix:")
+	if !ok {
+		return net.Listen("tcp", addr)
+	}
+	// A socket left by an unclean exit would make the listen fail
+	if info, err := os.Stat(sock); err == nil && info.Mode()&os.ModeSocket != 0 {
+		os.Remove(sock)
+	}
+	ln, err := net.Listen("unix", sock)
+	if err != nil {
+		return nil, err
+	}
+	// Anyone on the host can reach a TCP port, so the socket is no tighter
+	// and the proxy can connect whichever user it runs as
+	if err := os.Chmod(sock, 0666); err != nil {
+		ln.Close()
+		return nil, fmt.Errorf("failed to set socket permissions: %w", err)
+	}
+	return ln, nil
+}
+
+// StartHTTPServer listens on every configured address and serves handler
+// on each in the background until the returned server is closed. It fails
+// if any address cannot be opened or the TLS files cannot be loaded; errors
+// once serving are fatal.
+func StartHTTPServer(cfg HTTPServerConfig, handler http.Handler) (*http.Server, error) {
+	if len(cfg.Listen) == 0 {
+		return nil, fmt.Errorf("no listen addresses")
+	}
+	var tlsConfig *tls.Config
+	if cfg.TLSCert != "" || cfg.TLSKey != "" {
+		if cfg.TLSCert == "" || cfg.TLSKey == "" {
+			return nil, fmt.Errorf("TLS needs both a certificate and a key")
+		}
+		certs, err := newCertReloader(cfg.TLSCert, cfg.TLSKey)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig = &tls.Config{MinVersion: tls.VersionTLS12, GetCertificate: certs.GetCertificate}
+	}
+
+	srv := &http.Server{
+		Handler:           basePathHandler(cfg.BasePath, handler),
+		ReadHeaderTimeout: httpReadHeaderTimeout,
+		ReadTimeout:       httpReadTimeout,
+		WriteTimeout:      httpWriteTimeout,
+		IdleTimeout:       httpIdleTimeout,
+	}
+
+	listeners := make([]net.Listener, 0, len(cfg.Listen))
+	for _, addr := range cfg.Listen {
+		ln, err := listenHTTP(addr)
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return nil, fmt.Errorf("failed to listen on %s: %w", addr, err)
+		}
+		scheme := "http"
+		if tlsConfig != nil && ln.Addr().Network() == "tcp" {
+			ln = tls.NewListener(ln, tlsConfig)
+			scheme = "https"
+		}
+		listeners = append(listeners, ln)
+		mainLog.Infow("Starting HTTP server", "addr", addr, "scheme", scheme, "basePath", cfg.BasePath)
+	}
+	for _, ln := range listeners {
+		go func(ln net.Listener) {
+			if err := srv.Serve(ln); err != nil && err != http.ErrServerClosed {
+				mainLog.Fatalw("HTTP server failed", "addr", ln.Addr().String(), "error", err)
+			}
+		}(ln)
+	}
+	return srv, nil
+}
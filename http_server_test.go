@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBasePath(t *testing.T) {
+	for in, want := range map[string]string{"": "", "/": "", "tarpn": "/tarpn", "/tarpn/": "/tarpn", "/a//b/": "/a/b"} {
+		if got := normalizeBasePath(in); got != want {
+			t.Errorf("normalizeBasePath(%q) = %q, want %q", in, got, want)
+		}
+	}
+
+	handler := basePathHandler("/tarpn", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.URL.Path))
+	}))
+	tests := []struct {
+		path string
+		code int
+		body string
+	}{
+		{"/tarpn/ws/node", http.StatusOK, "/ws/node"},
+		{"/tarpn/", http.StatusOK, "/"},
+		{"/tarpn", http.StatusMovedPermanently, ""},
+		{"/api/status", http.StatusOK, "/api/status"}, // proxy stripped it already
+		{"/tarpnx/api", http.StatusOK, "/tarpnx/api"},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if rec.Code != tt.code || (tt.body != "" && rec.Body.String() != tt.body) {
+			t.Errorf("GET %s = %d %q, want %d %q", tt.path, rec.Code, rec.Body.String(), tt.code, tt.body)
+		}
+	}
+}
+
+func TestRewriteForBasePath(t *testing.T) {
+	old := httpBasePath
+	t.Cleanup(func() { httpBasePath = old })
+
+	page := `<html><head><link rel="icon" href="/favicon.ico"></head><body><script src="/_expo/static/js/web/entry.js"></script></body></html>`
+	httpBasePath = ""
+	if got := string(rewriteForBasePath([]byte(page), true)); got != page {
+		t.Errorf("rewritten without a base path: %s", got)
+	}
+
+	httpBasePath = "/tarpn"
+	got := string(rewriteForBasePath([]byte(page), true))
+	for _, want := range []string{`href="/tarpn/favicon.ico"`, `src="/tarpn/_expo/static/js/web/entry.js"`, `window.__TARPN_BASE_PATH__="/tarpn"</script></head>`} {
+		if !strings.Contains(got, want) {
+			t.Errorf("rewritten page lacks %s:\n%s", want, got)
+		}
+	}
+	js := string(rewriteForBasePath([]byte(`e.exports={uri:'/assets/icon.png',u:"/assets/x"}`), false))
+	if js != `e.exports={uri:'/tarpn/assets/icon.png',u:"/tarpn/assets/x"}` {
+		t.Errorf("rewritten bundle = %s", js)
+	}
+}
+
+// writeTestCert writes a self-signed certificate for commonName.
+func writeTestCert(t *testing.T, certFile, keyFile, commonName string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+}
+
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	writeTestCert(t, certFile, keyFile, "first")
+	certs, err := newCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("newCertReloader: %v", err)
+	}
+	commonName := func() string {
+		cert, _ := certs.GetCertificate(nil)
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return leaf.Subject.CommonName
+	}
+	if got := commonName(); got != "first" {
+		t.Fatalf("certificate = %s", got)
+	}
+
+	// A renewal, stamped later than the first in case the filesystem's
+	// clock is coarse
+	writeTestCert(t, certFile, keyFile, "renewed")
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(certFile, later, later)
+	os.Chtimes(keyFile, later, later)
+	if got := commonName(); got != "renewed" {
+		t.Errorf("certificate after renewal = %s", got)
+	}
+
+	// A half-written renewal keeps the last good certificate
+	os.WriteFile(keyFile, []byte("not a key"), 0600)
+	os.Chtimes(keyFile, later.Add(time.Minute), later.Add(time.Minute))
+	if got := commonName(); got != "renewed" {
+		t.Errorf("certificate after a bad renewal = %s", got)
+	}
+}
+
+func TestStartHTTPServerUnixSocket(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "tarpn-mon.sock")
+	// A socket left behind by an earlier run
+	stale, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Skipf("unix sockets unavailable: %v", err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.Write([]byte(r.URL.Path)) })
+	cfg := HTTPServerConfig{Listen: []string{"unix:" + sock, "127.0.0.1:0"}, BasePath: "/tarpn"}
+	srv, err := StartHTTPServer(cfg, handler)
+	if err != nil {
+		t.Fatalf("StartHTTPServer: %v", err)
+	}
+	t.Cleanup(func() { srv.Close() })
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", sock)
+		},
+	}}
+	resp, err := client.Get("http://tarpn-mon/tarpn/api/status")
+	if err != nil {
+		t.Fatalf("GET over the socket: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if got := string(body); got != "/api/status" {
+		t.Errorf("body = %q", got)
+	}
+
+	if _, err := StartHTTPServer(HTTPServerConfig{Listen: []string{"127.0.0.1:0"}, TLSCert: "cert.pem"}, handler); err == nil {
+		t.Error("started with a certificate but no key")
+	}
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Kinds of pathological L2 behaviour the tracker recognises.
+const (
+	AnomalySABMLoop    = "sabm_loop"    // SABM after SABM with no UA
+	AnomalySABMRefused = "sabm_refused" // SABMs answered with DM
+	AnomalyRNRStorm    = "rnr_storm"    // a station sending RNR after RNR
+	AnomalyStuckBusy   = "stuck_busy"   // a station busy (RNR) and never clearing
+	AnomalyFRMRLoop    = "frmr_loop"    // repeated frame rejects
+)
+
+const (
+	// A failed connect is N2 (usually 10) SABMs, so a loop is more than
+	// one attempt's worth without a UA.
+	anomalySABMCount  = 20
+	anomalySABMWindow = 15 * time.Minute
+
+	// A DM within anomalyDMReplyWithin of a SABM is a refused connect.
+	anomalyDMCount       = 3
+	anomalyDMWindow      = 15 * time.Minute
+	anomalyDMReplyWithin = 30 * time.Second
+
+	anomalyRNRCount  = 20
+	anomalyRNRWindow = 5 * time.Minute
+
+	// anomalyStuckBusy is how long a station may stay busy before it is
+	// reported; RR or REJ from it clears the condition.
+	anomalyStuckBusy = 2 * time.Minute
+
+	anomalyFRMRCount  = 3
+	anomalyFRMRWindow = 10 * time.Minute
+
+	// anomalyCooldown stops one condition being reported on every frame
+	// while it lasts.
+	anomalyCooldown = 15 * time.Minute
+
+	// anomalyEvidenceFrames is how many of a session's latest frames are
+	// attached to an anomaly.
+	anomalyEvidenceFrames = 10
+
+	// anomalyRecentKeep bounds the list returned by GetLinkAnomalies.
+	anomalyRecentKeep = 100
+)
+
+// AnomalyFrame is one frame attached to a LinkAnomaly as evidence.
+type AnomalyFrame struct {
+	At        time.Time `json:"at"`
+	Direction string    `json:"dirn"`
+	Source    string    `json:"srce"`
+	Dest      string    `json:"dest"`
+	L2Type    string    `json:"l2Type"`
+	CR        string    `json:"cr,omitempty"`
+	PF        string    `json:"pf,omitempty"`
+	RSeq      int       `json:"rseq"`
+	TSeq      int       `json:"tseq"`
+}
+
+// LinkAnomaly is a pathological pattern seen on one link, with the frames
+// leading up to it. Station is the end at fault as far as the frames show.
+type LinkAnomaly struct {
+	Kind       string         `json:"kind"`
+	SessionID  string         `json:"sessionId"`
+	Port       int            `json:"port"`
+	Station    string         `json:"station"`
+	Count      int            `json:"count"`
+	Detail     string         `json:"detail"`
+	DetectedAt time.Time      `json:"detectedAt"`
+	Evidence   []AnomalyFrame `json:"evidence"`
+}
+
+// anomalyWindow holds the times of one kind of frame over a sliding window.
+type anomalyWindow []time.Time
+
+// add records t and drops times more than window before it, returning how
+// many remain.
+func (w *anomalyWindow) add(t time.Time, window time.Duration) int {
+	kept := (*w)[:0]
+	for _, x := range *w {
+		if t.Sub(x) < window {
+			kept = append(kept, x)
+		}
+	}
+	*w = append(kept, t)
+	return len(*w)
+}
+
+// anomalyStation is the detector state for one end of a link.
+type anomalyStation struct {
+	sabm      anomalyWindow
+	refused   anomalyWindow
+	rnr       anomalyWindow
+	frmr      anomalyWindow
+	lastSABM  time.Time
+	busySince time.Time
+}
+
+// anomalyState is the detector state for one session.
+type anomalyState struct {
+	stations map[string]*anomalyStation
+	evidence []AnomalyFrame
+	reported map[string]time.Time // kind + station -> last reported
+}
+
+func (a *anomalyState) station(call string) *anomalyStation {
+	s, ok := a.stations[call]
+	if !ok {
+		s = &anomalyStation{}
+		a.stations[call] = s
+	}
+	return s
+}
+
+// SetAnomalyFunc sets a callback for link anomalies. Like onChange it is
+// called with the tracker's lock held.
+func (st *SessionTracker) SetAnomalyFunc(fn func(*LinkAnomaly)) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.onAnomaly = fn
+}
+
+// GetLinkAnomalies returns recently detected anomalies, newest first.
+func (st *SessionTracker) GetLinkAnomalies(limit int) []LinkAnomaly {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+
+	n := len(st.anomalyLog)
+	if limit > 0 && limit < n {
+		n = limit
+	}
+	result := make([]LinkAnomaly, 0, n)
+	for i := len(st.anomalyLog) - 1; i >= 0 && len(result) < n; i-- {
+		result = append(result, st.anomalyLog[i])
+	}
+	return result
+}
+
+// trackAnomaliesLocked feeds a frame to the session's anomaly detectors.
+// SABM loops and refusals are charged to the station sending the SABMs,
+// RNR and FRMR to the station sending them.
+func (st *SessionTracker) trackAnomaliesLocked(sess *Session, event *L2TraceEvent, now time.Time) {
+	a, ok := st.anomalies[sess.ID]
+	if !ok {
+		a = &anomalyState{stations: make(map[string]*anomalyStation), reported: make(map[string]time.Time)}
+		st.anomalies[sess.ID] = a
+	}
+
+	t := traceTime(event, now)
+	src := strings.ToUpper(event.Source)
+	dst := strings.ToUpper(event.Dest)
+	a.evidence = append(a.evidence, AnomalyFrame{
+		At:        t,
+		Direction: event.Direction,
+		Source:    src,
+		Dest:      dst,
+		L2Type:    event.L2Type,
+		CR:        event.CR,
+		PF:        event.PF,
+		RSeq:      event.RSeq,
+		TSeq:      event.TSeq,
+	})
+	if len(a.evidence) > anomalyEvidenceFrames {
+		a.evidence = a.evidence[len(a.evidence)-anomalyEvidenceFrames:]
+	}
+
+	switch event.L2Type {
+	case "C", "SABME":
+		s := a.station(src)
+		s.lastSABM = t
+		s.busySince = time.Time{}
+		if n := s.sabm.add(t, anomalySABMWindow); n >= anomalySABMCount {
+			st.reportAnomalyLocked(sess, a, AnomalySABMLoop, src, n, t,
+				fmt.Sprintf("%d SABMs to %s with no UA in %s", n, dst, anomalySABMWindow))
+		}
+	case "UA":
+		// Answers dst's SABM (or DISC)
+		s := a.station(dst)
+		s.sabm = s.sabm[:0]
+		s.lastSABM = time.Time{}
+	case "DM":
+		s := a.station(dst)
+		if !s.lastSABM.IsZero() && t.Sub(s.lastSABM) <= anomalyDMReplyWithin {
+			s.lastSABM = time.Time{}
+			if n := s.refused.add(t, anomalyDMWindow); n >= anomalyDMCount {
+				st.reportAnomalyLocked(sess, a, AnomalySABMRefused, dst, n, t,
+					fmt.Sprintf("%d connects refused with DM by %s in %s", n, src, anomalyDMWindow))
+			}
+		}
+	case "RNR":
+		s := a.station(src)
+		if s.busySince.IsZero() {
+			s.busySince = t
+		}
+		if n := s.rnr.add(t, anomalyRNRWindow); n >= anomalyRNRCount {
+			st.reportAnomalyLocked(sess, a, AnomalyRNRStorm, src, n, t,
+				fmt.Sprintf("%d RNRs in %s", n, anomalyRNRWindow))
+		}
+		if busy := t.Sub(s.busySince); busy >= anomalyStuckBusy {
+			st.reportAnomalyLocked(sess, a, AnomalyStuckBusy, src, len(s.rnr), t,
+				fmt.Sprintf("busy (RNR) for %s", busy.Round(time.Second)))
+		}
+	case "RR", "REJ":
+		a.station(src).busySince = time.Time{}
+	case "FRMR":
+		if n := a.station(src).frmr.add(t, anomalyFRMRWindow); n >= anomalyFRMRCount {
+			st.reportAnomalyLocked(sess, a, AnomalyFRMRLoop, src, n, t,
+				fmt.Sprintf("%d FRMRs in %s", n, anomalyFRMRWindow))
+		}
+	}
+}
+
+// reportAnomalyLocked records an anomaly, counts it and passes it to
+// onAnomaly, unless the same one was reported within anomalyCooldown.
+func (st *SessionTracker) reportAnomalyLocked(sess *Session, a *anomalyState, kind, station string, count int, t time.Time, detail string) {
+	rk := kind + "-" + station
+	if last, ok := a.reported[rk]; ok && t.Sub(last) < anomalyCooldown {
+		return
+	}
+	a.reported[rk] = t
+
+	anomaly := LinkAnomaly{
+		Kind:       kind,
+		SessionID:  sess.ID,
+		Port:       sess.Port,
+		Station:    station,
+		Count:      count,
+		Detail:     detail,
+		DetectedAt: t,
+		Evidence:   append([]AnomalyFrame(nil), a.evidence...),
+	}
+	st.anomalyLog = append(st.anomalyLog, anomaly)
+	if len(st.anomalyLog) > anomalyRecentKeep {
+		st.anomalyLog = st.anomalyLog[len(st.anomalyLog)-anomalyRecentKeep:]
+	}
+	linkAnomaliesTotal.WithLabelValues(fmt.Sprint(sess.Port), station, kind).Inc()
+	st.logger.Infow("Link anomaly", "kind", kind, "session", sess.ID, "station", station, "detail", detail)
+
+	if st.onAnomaly != nil {
+		cp := anomaly
+		st.onAnomaly(&cp)
+	}
+}
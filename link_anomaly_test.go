@@ -0,0 +1,96 @@
+package main
+
+import (
+	"testing"
+)
+
+// anomalyFrame builds a trace on port 1 stamped at secs past an arbitrary
+// epoch, so windows can be tested without waiting.
+func anomalyFrame(secs float64, src, dst, l2Type string) *L2TraceEvent {
+	dirn := "rcvd"
+	if src == "WA2M-2" {
+		dirn = "sent"
+	}
+	return &L2TraceEvent{Time: 1787067400 + secs, Direction: dirn, Port: "1", Source: src, Dest: dst, L2Type: l2Type}
+}
+
+func TestLinkAnomalySABMLoop(t *testing.T) {
+	tracker := NewSessionTracker(200, nil, testLogger())
+	var got []*LinkAnomaly
+	tracker.SetAnomalyFunc(func(a *LinkAnomaly) { got = append(got, a) })
+
+	// A neighbour SABMing every 10s, with one UA part way through that
+	// restarts the count
+	for i := 0; i < 10; i++ {
+		tracker.HandleL2Trace(anomalyFrame(float64(i*10), "N3LLO-2", "WA2M-2", "C"))
+	}
+	tracker.HandleL2Trace(anomalyFrame(101, "WA2M-2", "N3LLO-2", "UA"))
+	for i := 0; i < anomalySABMCount-1; i++ {
+		tracker.HandleL2Trace(anomalyFrame(float64(110+i*10), "N3LLO-2", "WA2M-2", "C"))
+	}
+	if len(got) != 0 {
+		t.Fatalf("reported %+v before %d SABMs", got[0], anomalySABMCount)
+	}
+	for i := 0; i < 5; i++ {
+		tracker.HandleL2Trace(anomalyFrame(float64(400+i*10), "N3LLO-2", "WA2M-2", "C"))
+	}
+	if len(got) != 1 {
+		t.Fatalf("got %d anomalies, want 1 (later ones held back by the cooldown)", len(got))
+	}
+	a := got[0]
+	if a.Kind != AnomalySABMLoop || a.Station != "N3LLO-2" || a.Count != anomalySABMCount || a.Port != 1 {
+		t.Errorf("anomaly = %+v", a)
+	}
+	if len(a.Evidence) != anomalyEvidenceFrames || a.Evidence[len(a.Evidence)-1].L2Type != "C" {
+		t.Errorf("evidence = %+v", a.Evidence)
+	}
+	if list := tracker.GetLinkAnomalies(0); len(list) != 1 || list[0].Kind != AnomalySABMLoop {
+		t.Errorf("GetLinkAnomalies = %+v", list)
+	}
+}
+
+func TestLinkAnomalySABMRefused(t *testing.T) {
+	tracker := NewSessionTracker(200, nil, testLogger())
+	var got []*LinkAnomaly
+	tracker.SetAnomalyFunc(func(a *LinkAnomaly) { got = append(got, a) })
+
+	for i := 0; i < anomalyDMCount; i++ {
+		at := float64(i * 60)
+		tracker.HandleL2Trace(anomalyFrame(at, "WA2M-2", "N3LLO-2", "C"))
+		tracker.HandleL2Trace(anomalyFrame(at+1, "N3LLO-2", "WA2M-2", "DM"))
+	}
+	// A DM long after any SABM is not a refusal
+	tracker.HandleL2Trace(anomalyFrame(1000, "N3LLO-2", "WA2M-2", "DM"))
+	if len(got) != 1 || got[0].Kind != AnomalySABMRefused || got[0].Station != "WA2M-2" || got[0].Count != anomalyDMCount {
+		t.Errorf("anomalies = %+v", got)
+	}
+}
+
+func TestLinkAnomalyBusyAndFRMR(t *testing.T) {
+	tracker := NewSessionTracker(200, nil, testLogger())
+	var kinds []string
+	tracker.SetAnomalyFunc(func(a *LinkAnomaly) { kinds = append(kinds, a.Kind+" "+a.Station) })
+
+	// RNR cleared by RR is not stuck
+	tracker.HandleL2Trace(anomalyFrame(0, "N3LLO-2", "WA2M-2", "RNR"))
+	tracker.HandleL2Trace(anomalyFrame(100, "N3LLO-2", "WA2M-2", "RR"))
+	tracker.HandleL2Trace(anomalyFrame(200, "N3LLO-2", "WA2M-2", "RNR"))
+	if len(kinds) != 0 {
+		t.Fatalf("anomalies = %v after a cleared busy", kinds)
+	}
+	// Polled every 6s while staying busy: a storm first, then stuck
+	for i := 1; i <= 25; i++ {
+		tracker.HandleL2Trace(anomalyFrame(float64(200+i*6), "N3LLO-2", "WA2M-2", "RNR"))
+	}
+	if len(kinds) != 2 || kinds[0] != AnomalyRNRStorm+" N3LLO-2" || kinds[1] != AnomalyStuckBusy+" N3LLO-2" {
+		t.Errorf("anomalies = %v, want an RNR storm then stuck busy", kinds)
+	}
+
+	kinds = nil
+	for i := 0; i < anomalyFRMRCount; i++ {
+		tracker.HandleL2Trace(anomalyFrame(float64(400+i), "WA2M-2", "N3LLO-2", "FRMR"))
+	}
+	if len(kinds) != 1 || kinds[0] != AnomalyFRMRLoop+" WA2M-2" {
+		t.Errorf("anomalies = %v, want one FRMR loop", kinds)
+	}
+}
@@ -0,0 +1,413 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// rttWindowSize is how many recent samples the min/median/p95 cover.
+	rttWindowSize = 64
+	// rttRecordInterval is how often neighbour RTT is written to the
+	// link_rtt table and to Prometheus.
+	rttRecordInterval = 5 * time.Minute
+	// rttRetention is how long the link_rtt time series is kept.
+	rttRetention = 90 * 24 * time.Hour
+)
+
+// RTTStats summarises round-trip time samples in milliseconds.
+type RTTStats struct {
+	Samples  int     `json:"samples"`
+	MinMs    float64 `json:"minMs"`
+	MedianMs float64 `json:"medianMs"`
+	P95Ms    float64 `json:"p95Ms"`
+}
+
+// rttStats computes RTTStats over samples. It returns nil if there are none.
+func rttStats(samples []time.Duration) *RTTStats {
+	if len(samples) == 0 {
+		return nil
+	}
+	sorted := append([]time.Duration(nil), samples...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	ms := func(d time.Duration) float64 { return float64(d) / float64(time.Millisecond) }
+	pct := func(p float64) time.Duration {
+		return sorted[int(math.Ceil(p*float64(len(sorted))))-1]
+	}
+	return &RTTStats{
+		Samples:  len(sorted),
+		MinMs:    ms(sorted[0]),
+		MedianMs: ms(pct(0.5)),
+		P95Ms:    ms(pct(0.95)),
+	}
+}
+
+// rttWindow is a sliding window of the most recent RTT samples.
+type rttWindow struct {
+	samples []time.Duration
+	next    int
+}
+
+func (w *rttWindow) add(d time.Duration) {
+	if len(w.samples) < rttWindowSize {
+		w.samples = append(w.samples, d)
+		return
+	}
+	w.samples[w.next] = d
+	w.next = (w.next + 1) % rttWindowSize
+}
+
+func (w *rttWindow) stats() *RTTStats {
+	return rttStats(w.samples)
+}
+
+// rttPending is the RTT state of one L2 session: when each I-frame we have
+// sent and not yet seen acknowledged first went out, and the session's
+// sample window.
+type rttPending struct {
+	sent    map[int]time.Time
+	retried map[int]bool // N(S) sent more than once; no sample (Karn)
+	window  rttWindow
+}
+
+// rttNeighbour is the RTT state of one neighbour on one port, across its
+// sessions.
+type rttNeighbour struct {
+	port     int
+	callsign string
+	window   rttWindow
+	interval []time.Duration // samples since the last record
+}
+
+// NeighbourRTT is a neighbour's current RTT over the sliding window.
+type NeighbourRTT struct {
+	Port     int    `json:"port"`
+	Callsign string `json:"callsign"`
+	RTTStats
+}
+
+// traceTime returns the time LinBPQ stamped on a frame report, or now if it
+// has none. Send and ack times both come from the node's clock, so the
+// difference is not skewed by UDP delivery. The float64 epoch only holds
+// about a microsecond of precision, so it is rounded to that.
+func traceTime(event *L2TraceEvent, now time.Time) time.Time {
+	if event.Time <= 0 {
+		return now
+	}
+	return time.UnixMicro(int64(math.Round(event.Time * 1e6)))
+}
+
+// trackRTTLocked times I-frames we send against the peer's N(R) coming
+// back. Only the newest frame an ack covers gives a sample, as the older
+// ones were waiting in the window, and retransmitted frames give none as
+// the ack could be for either copy.
+func (st *SessionTracker) trackRTTLocked(sess *Session, event *L2TraceEvent, l2Retry bool, now time.Time) {
+	p, ok := st.rttPending[sess.ID]
+	if !ok {
+		p = &rttPending{sent: make(map[int]time.Time), retried: make(map[int]bool)}
+		st.rttPending[sess.ID] = p
+	}
+	at := traceTime(event, now)
+
+	if event.Direction == "sent" {
+		if event.L2Type != "I" {
+			return
+		}
+		if l2Retry {
+			p.retried[event.TSeq] = true
+		} else {
+			p.sent[event.TSeq] = at
+			delete(p.retried, event.TSeq)
+		}
+		return
+	}
+
+	switch event.L2Type {
+	case "I", "RR", "RNR", "REJ", "SREJ":
+	default:
+		return
+	}
+	modulo := event.Modulo
+	if modulo != 128 {
+		modulo = 8
+	}
+	// N(R) acknowledges the frames from the oldest outstanding one up to,
+	// not including, N(R); frames sent after N(R) are still in flight.
+	// The acknowledged frame nearest N(R) gives the sample
+	oldest := -1
+	for ns, t := range p.sent {
+		if oldest < 0 || t.Before(p.sent[oldest]) {
+			oldest = ns
+		}
+	}
+	if oldest < 0 {
+		return
+	}
+	offset := func(ns int) int { return ((ns-oldest)%modulo + modulo) % modulo }
+	acked := offset(event.RSeq)
+	best := -1
+	for ns := range p.sent {
+		if offset(ns) < acked && (best < 0 || offset(ns) > offset(best)) {
+			best = ns
+		}
+	}
+	if best < 0 {
+		return
+	}
+	sample := at.Sub(p.sent[best])
+	valid := !p.retried[best]
+	for ns := range p.sent {
+		if offset(ns) < acked {
+			delete(p.sent, ns)
+			delete(p.retried, ns)
+		}
+	}
+	if !valid || sample <= 0 {
+		return
+	}
+
+	p.window.add(sample)
+	sess.RTT = p.window.stats()
+
+	key := fmt.Sprintf("%d-%s", sess.Port, strings.ToUpper(event.Source))
+	n, ok := st.rttNeighbours[key]
+	if !ok {
+		n = &rttNeighbour{port: sess.Port, callsign: strings.ToUpper(event.Source)}
+		st.rttNeighbours[key] = n
+	}
+	n.window.add(sample)
+	n.interval = append(n.interval, sample)
+}
+
+// GetNeighbourRTT returns each neighbour's RTT over the sliding window,
+// ordered by port and callsign.
+func (st *SessionTracker) GetNeighbourRTT() []NeighbourRTT {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+
+	result := make([]NeighbourRTT, 0, len(st.rttNeighbours))
+	for _, n := range st.rttNeighbours {
+		if s := n.window.stats(); s != nil {
+			result = append(result, NeighbourRTT{Port: n.port, Callsign: n.callsign, RTTStats: *s})
+		}
+	}
+	sortNeighbourRTT(result)
+	return result
+}
+
+// takeRTTIntervals returns stats over the samples gathered for each
+// neighbour since the last call, and resets them.
+func (st *SessionTracker) takeRTTIntervals() []NeighbourRTT {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	var result []NeighbourRTT
+	for _, n := range st.rttNeighbours {
+		if s := rttStats(n.interval); s != nil {
+			result = append(result, NeighbourRTT{Port: n.port, Callsign: n.callsign, RTTStats: *s})
+		}
+		n.interval = nil
+	}
+	sortNeighbourRTT(result)
+	return result
+}
+
+func sortNeighbourRTT(r []NeighbourRTT) {
+	sort.Slice(r, func(i, j int) bool {
+		if r[i].Port != r[j].Port {
+			return r[i].Port < r[j].Port
+		}
+		return r[i].Callsign < r[j].Callsign
+	})
+}
+
+// RTTPoint is one interval of the link_rtt time series.
+type RTTPoint struct {
+	Timestamp time.Time `json:"timestamp"`
+	Port      int       `json:"port"`
+	Callsign  string    `json:"callsign"`
+	RTTStats
+}
+
+// SaveLinkRTT stores one interval's RTT stats per neighbour.
+func (s *LinkStatsStorage) SaveLinkRTT(ts time.Time, points []NeighbourRTT) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stamp := ts.UTC().Format(time.RFC3339)
+	for _, p := range points {
+		if _, err := s.db.Exec(`
+			INSERT INTO link_rtt (timestamp, port_num, callsign, samples, min_ms, median_ms, p95_ms)
+			VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			stamp, p.Port, p.Callsign, p.Samples, p.MinMs, p.MedianMs, p.P95Ms); err != nil {
+			return fmt.Errorf("failed to save link rtt: %w", err)
+		}
+	}
+	return nil
+}
+
+// GetLinkRTT returns the RTT time series since the given time, oldest
+// first. An empty callsign matches every neighbour, and port 0 every port.
+func (s *LinkStatsStorage) GetLinkRTT(callsign string, port int, since time.Time) ([]RTTPoint, error) {
+	query := `SELECT timestamp, port_num, callsign, samples, min_ms, median_ms, p95_ms
+		FROM link_rtt WHERE timestamp >= ?`
+	args := []interface{}{since.UTC().Format(time.RFC3339)}
+	if callsign != "" {
+		query += " AND callsign = ?"
+		args = append(args, strings.ToUpper(callsign))
+	}
+	if port != 0 {
+		query += " AND port_num = ?"
+		args = append(args, port)
+	}
+	query += " ORDER BY timestamp, port_num, callsign"
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query link rtt: %w", err)
+	}
+	defer rows.Close()
+
+	var result []RTTPoint
+	for rows.Next() {
+		var p RTTPoint
+		var ts string
+		if err := rows.Scan(&ts, &p.Port, &p.Callsign, &p.Samples, &p.MinMs, &p.MedianMs, &p.P95Ms); err != nil {
+			return nil, fmt.Errorf("failed to scan link rtt: %w", err)
+		}
+		p.Timestamp, _ = time.Parse(time.RFC3339, ts)
+		result = append(result, p)
+	}
+	return result, rows.Err()
+}
+
+// PurgeOldLinkRTT drops RTT points older than retention.
+func (s *LinkStatsStorage) PurgeOldLinkRTT(retention time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cutoff := time.Now().UTC().Add(-retention).Format(time.RFC3339)
+	if _, err := s.db.Exec(`DELETE FROM link_rtt WHERE timestamp < ?`, cutoff); err != nil {
+		return fmt.Errorf("failed to purge old link rtt: %w", err)
+	}
+	return nil
+}
+
+// runRTTRecorder publishes neighbour RTT to Prometheus every
+// rttRecordInterval and, if storage is set, appends it to the time series.
+func runRTTRecorder(ctx context.Context, tracker *SessionTracker, storage *LinkStatsStorage) {
+	ticker := time.NewTicker(rttRecordInterval)
+	defer ticker.Stop()
+	lastPurge := time.Time{}
+	var published map[rttLabels]bool
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			published = publishRTTMetrics(tracker.GetNeighbourRTT(), published)
+			points := tracker.takeRTTIntervals()
+			if storage == nil {
+				continue
+			}
+			if err := storage.SaveLinkRTT(now, points); err != nil {
+				sessionLog.Warnw("Failed to save link rtt", "error", err)
+			}
+			if now.Sub(lastPurge) >= 24*time.Hour {
+				if err := storage.PurgeOldLinkRTT(rttRetention); err != nil {
+					sessionLog.Warnw("Failed to purge link rtt", "error", err)
+				}
+				lastPurge = now
+			}
+		}
+	}
+}
+
+// linkRTTResponse is the payload of /api/rtt.
+type linkRTTResponse struct {
+	Current []NeighbourRTT `json:"current"`
+	History []RTTPoint     `json:"history,omitempty"`
+}
+
+// linkRTTHandler serves current RTT per neighbour and, with storage, the
+// time series over ?hours= (default 24), optionally for one ?callsign= and
+// ?port=.
+func linkRTTHandler(w http.ResponseWriter, r *http.Request) {
+	if sessionTrackerRef == nil {
+		http.Error(w, "session tracker not available", http.StatusServiceUnavailable)
+		return
+	}
+	q := r.URL.Query()
+	hours := 24
+	if v := q.Get("hours"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			http.Error(w, "invalid hours", http.StatusBadRequest)
+			return
+		}
+		hours = n
+	}
+	port := 0
+	if v := q.Get("port"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			http.Error(w, "invalid port", http.StatusBadRequest)
+			return
+		}
+		port = n
+	}
+
+	resp := linkRTTResponse{Current: sessionTrackerRef.GetNeighbourRTT()}
+	if neighborStorageRef != nil {
+		history, err := neighborStorageRef.GetLinkRTT(q.Get("callsign"), port, time.Now().Add(-time.Duration(hours)*time.Hour))
+		if err != nil {
+			wsLog.Warnw("Failed to query link rtt", "error", err)
+			http.Error(w, "failed to query link rtt", http.StatusInternalServerError)
+			return
+		}
+		resp.History = history
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// rttLabels is the port and callsign of a neighbour's linkRTTSeconds series.
+type rttLabels struct {
+	port     string
+	callsign string
+}
+
+// publishRTTMetrics sets linkRTTSeconds for each neighbour and deletes the
+// series of neighbours in previous that are no longer listed, so a gone
+// neighbour does not keep reporting its last RTT. It returns the labels it
+// published, to pass as previous on the next call.
+func publishRTTMetrics(neighbours []NeighbourRTT, previous map[rttLabels]bool) map[rttLabels]bool {
+	current := make(map[rttLabels]bool, len(neighbours))
+	for _, n := range neighbours {
+		l := rttLabels{port: strconv.Itoa(n.Port), callsign: n.Callsign}
+		current[l] = true
+		linkRTTSeconds.WithLabelValues(l.port, l.callsign, "min").Set(n.MinMs / 1000)
+		linkRTTSeconds.WithLabelValues(l.port, l.callsign, "median").Set(n.MedianMs / 1000)
+		linkRTTSeconds.WithLabelValues(l.port, l.callsign, "p95").Set(n.P95Ms / 1000)
+	}
+	for l := range previous {
+		if current[l] {
+			continue
+		}
+		for _, stat := range []string{"min", "median", "p95"} {
+			linkRTTSeconds.DeleteLabelValues(l.port, l.callsign, stat)
+		}
+	}
+	return current
+}
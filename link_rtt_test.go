@@ -0,0 +1,146 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestRTTStats(t *testing.T) {
+	var samples []time.Duration
+	for i := 1; i <= 20; i++ {
+		samples = append(samples, time.Duration(i)*100*time.Millisecond)
+	}
+	got := rttStats(samples)
+	if got.Samples != 20 || got.MinMs != 100 || got.MedianMs != 1000 || got.P95Ms != 1900 {
+		t.Errorf("rttStats = %+v, want min 100, median 1000, p95 1900", got)
+	}
+	if rttStats(nil) != nil {
+		t.Error("rttStats(nil) should be nil")
+	}
+
+	var w rttWindow
+	for i := 0; i < rttWindowSize+10; i++ {
+		w.add(time.Duration(i) * time.Millisecond)
+	}
+	if s := w.stats(); s.Samples != rttWindowSize || s.MinMs != 10 {
+		t.Errorf("window stats = %+v, want the last %d samples", s, rttWindowSize)
+	}
+}
+
+// I-frames are timed against the peer's N(R), using the node's timestamps,
+// across a modulo-128 wrap; frames AX.25 had to resend give no sample.
+func TestSessionTrackerRTT(t *testing.T) {
+	tracker := NewSessionTracker(200, nil, testLogger())
+	tracker.HandleLinkUp(&LinkUpEvent{Direction: "outgoing", Port: "1", Remote: "N3LLO-2", Local: "WA2M-2"})
+
+	base := 1787067400.0
+	send := func(at float64, ns int) {
+		tracker.HandleL2Trace(&L2TraceEvent{Time: base + at, Direction: "sent", Port: "1",
+			Source: "WA2M-2", Dest: "N3LLO-2", L2Type: "I", Modulo: 128, TSeq: ns})
+	}
+	ack := func(at float64, l2Type string, nr int) {
+		tracker.HandleL2Trace(&L2TraceEvent{Time: base + at, Direction: "rcvd", Port: "1",
+			Source: "N3LLO-2", Dest: "WA2M-2", L2Type: l2Type, Modulo: 128, RSeq: nr})
+	}
+
+	send(0, 126)
+	send(0.5, 127)
+	send(1, 0)
+	ack(1.5, "RR", 1) // acks all three; the sample is from N(S)=0
+	send(2, 1)
+	send(5, 1) // T1 expired, resent
+	ack(5.2, "RR", 2)
+	send(6, 2)
+	ack(6.8, "I", 3)
+
+	sess := tracker.FindSessionForFrame(1, "WA2M-2", "N3LLO-2")
+	if sess.RTT == nil || sess.RTT.Samples != 2 || sess.RTT.MinMs != 500 || sess.RTT.P95Ms != 800 {
+		t.Fatalf("RTT = %+v, want two samples of 500ms and 800ms", sess.RTT)
+	}
+
+	n := tracker.GetNeighbourRTT()
+	if len(n) != 1 || n[0].Callsign != "N3LLO-2" || n[0].Port != 1 || n[0].Samples != 2 {
+		t.Errorf("GetNeighbourRTT = %+v", n)
+	}
+	if got := tracker.takeRTTIntervals(); len(got) != 1 || got[0].Samples != 2 {
+		t.Errorf("takeRTTIntervals = %+v, want the two samples", got)
+	}
+	if got := tracker.takeRTTIntervals(); len(got) != 0 {
+		t.Errorf("second takeRTTIntervals = %+v, want nothing new", got)
+	}
+
+	// With a full window an ack covers only the frames before N(R); the
+	// ones after it are timed by the next ack
+	tracker.HandleLinkUp(&LinkUpEvent{Direction: "outgoing", Port: "2", Remote: "K1ABC-2", Local: "WA2M-2"})
+	for i := 0; i < 4; i++ {
+		tracker.HandleL2Trace(&L2TraceEvent{Time: base + 10 + 0.1*float64(i), Direction: "sent", Port: "2",
+			Source: "WA2M-2", Dest: "K1ABC-2", L2Type: "I", Modulo: 8, TSeq: i})
+	}
+	for _, a := range []struct {
+		at float64
+		nr int
+	}{{11.1, 2}, {11.3, 4}} {
+		tracker.HandleL2Trace(&L2TraceEvent{Time: base + a.at, Direction: "rcvd", Port: "2",
+			Source: "K1ABC-2", Dest: "WA2M-2", L2Type: "RR", Modulo: 8, RSeq: a.nr})
+	}
+	sess = tracker.FindSessionForFrame(2, "WA2M-2", "K1ABC-2")
+	if sess.RTT == nil || sess.RTT.Samples != 2 || sess.RTT.MinMs != 1000 || sess.RTT.P95Ms != 1000 {
+		t.Errorf("RTT = %+v, want two samples of 1000ms", sess.RTT)
+	}
+}
+
+func TestLinkRTTStorage(t *testing.T) {
+	s := newTestStorage(t)
+	now := time.Now().UTC().Truncate(time.Second)
+	points := []NeighbourRTT{
+		{Port: 1, Callsign: "N3LLO-2", RTTStats: RTTStats{Samples: 5, MinMs: 400, MedianMs: 600, P95Ms: 900}},
+		{Port: 2, Callsign: "K1ABC-2", RTTStats: RTTStats{Samples: 3, MinMs: 1200, MedianMs: 1500, P95Ms: 2100}},
+	}
+	if err := s.SaveLinkRTT(now.Add(-time.Hour), points[:1]); err != nil {
+		t.Fatalf("SaveLinkRTT: %v", err)
+	}
+	if err := s.SaveLinkRTT(now, points); err != nil {
+		t.Fatalf("SaveLinkRTT: %v", err)
+	}
+
+	all, err := s.GetLinkRTT("", 0, now.Add(-2*time.Hour))
+	if err != nil {
+		t.Fatalf("GetLinkRTT: %v", err)
+	}
+	if len(all) != 3 || !all[0].Timestamp.Equal(now.Add(-time.Hour)) || all[0].MedianMs != 600 {
+		t.Errorf("GetLinkRTT = %+v", all)
+	}
+	one, err := s.GetLinkRTT("n3llo-2", 1, now.Add(-30*time.Minute))
+	if err != nil {
+		t.Fatalf("GetLinkRTT: %v", err)
+	}
+	if len(one) != 1 || one[0].Callsign != "N3LLO-2" {
+		t.Errorf("filtered GetLinkRTT = %+v", one)
+	}
+}
+
+// A neighbour that drops out of the RTT list loses its gauge series.
+func TestPublishRTTMetrics(t *testing.T) {
+	linkRTTSeconds.Reset()
+	defer linkRTTSeconds.Reset()
+
+	published := publishRTTMetrics([]NeighbourRTT{
+		{Port: 1, Callsign: "K1AAA-2", RTTStats: RTTStats{MinMs: 100, MedianMs: 200, P95Ms: 300}},
+		{Port: 2, Callsign: "K2BBB-2", RTTStats: RTTStats{MinMs: 400, MedianMs: 500, P95Ms: 600}},
+	}, nil)
+	if got := testutil.CollectAndCount(linkRTTSeconds); got != 6 {
+		t.Fatalf("series = %d, want 6", got)
+	}
+
+	publishRTTMetrics([]NeighbourRTT{
+		{Port: 2, Callsign: "K2BBB-2", RTTStats: RTTStats{MinMs: 450, MedianMs: 550, P95Ms: 650}},
+	}, published)
+	if got := testutil.CollectAndCount(linkRTTSeconds); got != 3 {
+		t.Errorf("series = %d, want 3", got)
+	}
+	if got := testutil.ToFloat64(linkRTTSeconds.WithLabelValues("2", "K2BBB-2", "median")); got != 0.55 {
+		t.Errorf("median = %v, want 0.55", got)
+	}
+}
@@ -4,8 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"net"
-	"strconv"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -24,13 +23,26 @@ type LinkStatsCollectorConfig struct {
 	// can be turned off independently, so that enabling stats collection on
 	// a node does not oblige it to start transmitting.
 	//
-	// DisableCQ suppresses the [LS1] link-stats CQ broadcast, sent on every
-	// RF port every 10 minutes.
+	// DisableCQ suppresses the [LS1] link-stats CQ broadcast. When and where
+	// it is sent otherwise is up to CQSchedule.
 	DisableCQ bool
 	// DisableBulletin suppresses the daily BBS bulletins. Whether those go any
 	// further than the local BBS is up to that BBS's forwarding rules; TARPN
 	// setups generally forward only specific @<tag> designators.
 	DisableBulletin bool
+
+	// ReportTo, if set, is the callsign (normally the sysop's) that receives
+	// the human-readable network report as a personal BBS message each day,
+	// plus the weekly report on Mondays. Unlike the bulletins this stays on
+	// the local BBS unless the recipient is at another node.
+	ReportTo string
+
+	// CQSchedule controls the [LS1] and [TARPNstat V2] CQ broadcasts.
+	CQSchedule CQScheduleConfig
+
+	// Pool supplies the telnet sessions for polling, CQs and bulletins.
+	// Nil means the shared telnetPool.
+	Pool *TelnetPool
 }
 
 // LinkStatsCollector manages a telnet connection to LinBPQ for periodic S command polling
@@ -47,13 +59,45 @@ type LinkStatsCollector struct {
 
 	// Metrics update function
 	metricsUpdateFn func(snap *LinkStatsSnapshot)
+
+	cq   *CQScheduler
+	pool *TelnetPool
+
+	// lastBulletinDay is the day of year the daily bulletins were last
+	// queued. It lives here rather than in connectAndPoll so that a
+	// reconnect does not reset it. It starts at today so that startup does
+	// not post immediately; the bulletin fires on the first tick after
+	// midnight.
+	lastBulletinDay int
 }
 
 // NewLinkStatsCollector creates a new stats collector
 func NewLinkStatsCollector(config LinkStatsCollectorConfig, storage *LinkStatsStorage) *LinkStatsCollector {
+	if config.DisableCQ {
+		config.CQSchedule.LS1Interval = 0
+		// Nor may a port override turn it back on
+		ports := make(map[int]map[CQFormat]CQPortSchedule)
+		for port, overrides := range config.CQSchedule.Ports {
+			ports[port] = make(map[CQFormat]CQPortSchedule)
+			for format, ps := range overrides {
+				if format != CQFormatLS1 {
+					ports[port][format] = ps
+				}
+			}
+		}
+		config.CQSchedule.Ports = ports
+	}
+	pool := config.Pool
+	if pool == nil {
+		pool = telnetPool
+	}
 	return &LinkStatsCollector{
 		config:  config,
 		storage: storage,
+		cq:      NewCQScheduler(config.CQSchedule, PortLastHeard),
+		pool:    pool,
+
+		lastBulletinDay: time.Now().YearDay(),
 	}
 }
 
@@ -74,8 +118,9 @@ func (c *LinkStatsCollector) GetLatestSnapshot() *LinkStatsSnapshot {
 	return c.latestSnap
 }
 
-// Run starts the collector loop. It connects to LinBPQ, authenticates, and
-// periodically runs the S command. Reconnects on failure with exponential backoff.
+// Run starts the collector loop. It periodically runs the S command on a
+// pooled node session, and backs off exponentially while LinBPQ cannot be
+// reached.
 func (c *LinkStatsCollector) Run(ctx context.Context) {
 	statsLog.Infow("Starting link stats collector",
 		"host", c.config.Hostname,
@@ -85,6 +130,10 @@ func (c *LinkStatsCollector) Run(ctx context.Context) {
 	// Start compaction goroutine
 	go c.runCompaction(ctx)
 
+	// Start outbound bulletin delivery
+	go c.runBulletinQueue(ctx)
+
+	backoff := initialBackoff
 	for {
 		select {
 		case <-ctx.Done():
@@ -92,125 +141,131 @@ func (c *LinkStatsCollector) Run(ctx context.Context) {
 		default:
 		}
 
-		err := c.connectAndPoll(ctx)
-		if err != nil {
-			if ctx.Err() != nil {
-				return // Context cancelled, exit cleanly
-			}
-			statsLog.Warnw("Stats connection lost, will reconnect", "error", err)
+		polled, err := c.pollLoop(ctx)
+		if ctx.Err() != nil {
+			return // Context cancelled, exit cleanly
 		}
+		if polled {
+			backoff = initialBackoff
+		}
+		statsLog.Warnw("Stats polling failed, will retry", "error", err, "backoff", backoff)
 
-		// Backoff before reconnecting
 		select {
 		case <-ctx.Done():
 			return
-		case <-time.After(5 * time.Second):
+		case <-time.After(backoff):
 		}
-	}
-}
-
-// connectAndPoll establishes a connection and polls until an error occurs
-func (c *LinkStatsCollector) connectAndPoll(ctx context.Context) error {
-	// Connect with retry
-	conn, err := c.connectWithRetry(ctx)
-	if err != nil {
-		return err
-	}
-	defer conn.Close()
 
-	// Create telnet wrapper
-	tc, err := NewTelnetConn(conn, 2*time.Second, statsLog)
-	if err != nil {
-		return fmt.Errorf("telnet negotiation failed: %w", err)
-	}
-
-	// Authenticate using standard telnet auth (port 8010 uses prompted auth)
-	_, err = tc.Authenticate(c.config.Callsign, c.config.Password, 10*time.Second)
-	if err != nil {
-		return fmt.Errorf("authentication failed: %w", err)
+		backoff *= 2
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
 	}
+}
 
-	statsLog.Infow("Stats collector connected and authenticated")
-
-	// No CR or drain needed here — the S command itself produces output
-	// ending with the node prompt. Sending a CR would create a stale prompt
-	// that interferes with the first S poll.
+// session checks a session of the given mode out of the pool, waiting at
+// most 30 seconds for a free slot and login.
+func (c *LinkStatsCollector) session(ctx context.Context, mode SessionMode) (*PoolSession, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	return c.pool.Acquire(ctx, SessionTarget{
+		Hostname: c.config.Hostname,
+		Port:     c.config.Port,
+		Callsign: c.config.Callsign,
+		Password: c.config.Password,
+		Mode:     mode,
+	})
+}
 
+// pollLoop polls until a poll fails, and reports whether any poll
+// succeeded.
+func (c *LinkStatsCollector) pollLoop(ctx context.Context) (bool, error) {
 	// Poll loop
 	ticker := time.NewTicker(c.config.PollInterval)
 	defer ticker.Stop()
 
-	// CQ broadcast ticker (every 10 minutes)
-	cqTicker := time.NewTicker(10 * time.Minute)
+	// CQ scheduler tick. The intervals themselves are per port and
+	// jittered; this only sets how finely they are honoured.
+	cqTicker := time.NewTicker(15 * time.Second)
 	defer cqTicker.Stop()
 
 	// Daily bulletin ticker (check every hour, send once per day).
 	// Posts within ~1 hour after local midnight when the previous day's
-	// data bucket is complete. Initialize to today so we don't immediately
-	// post on startup — the bulletin fires on the first tick after midnight.
+	// data bucket is complete. The bulletins only go into the outbound
+	// queue here; runBulletinQueue delivers them.
 	bulletinTicker := time.NewTicker(1 * time.Hour)
 	defer bulletinTicker.Stop()
-	lastBulletinDay := time.Now().YearDay()
 
 	// Do an immediate first poll
-	if err := c.poll(tc); err != nil {
-		return fmt.Errorf("initial poll failed: %w", err)
+	if err := c.pollOnce(ctx); err != nil {
+		return false, fmt.Errorf("initial poll failed: %w", err)
 	}
 
 	for {
 		select {
 		case <-ctx.Done():
-			return ctx.Err()
+			return true, ctx.Err()
 		case <-ticker.C:
-			if err := c.poll(tc); err != nil {
-				return fmt.Errorf("poll failed: %w", err)
+			if err := c.pollOnce(ctx); err != nil {
+				return true, fmt.Errorf("poll failed: %w", err)
 			}
 		case <-cqTicker.C:
-			if !c.config.DisableCQ {
-				c.sendCQBroadcasts()
-			}
+			c.runCQSchedule(ctx)
 		case <-bulletinTicker.C:
 			today := time.Now().YearDay()
-			if today != lastBulletinDay {
+			if today != c.lastBulletinDay {
 				if !c.config.DisableBulletin {
 					c.sendDailyBulletin()
 				}
-				lastBulletinDay = today
+				if c.config.ReportTo != "" {
+					c.sendDailyReport()
+				}
+				c.lastBulletinDay = today
 			}
 		}
 	}
 }
 
-// connectWithRetry connects to LinBPQ with exponential backoff
-func (c *LinkStatsCollector) connectWithRetry(ctx context.Context) (net.Conn, error) {
-	backoff := initialBackoff
-	addr := net.JoinHostPort(c.config.Hostname, strconv.Itoa(c.config.Port))
-
-	for {
-		select {
-		case <-ctx.Done():
-			return nil, ctx.Err()
-		default:
-		}
+// pollOnce runs one S poll on a pooled node session. A session that fails
+// mid-poll is discarded rather than returned, since it may still have
+// output in flight.
+func (c *LinkStatsCollector) pollOnce(ctx context.Context) error {
+	s, err := c.session(ctx, SessionNode)
+	if err != nil {
+		return err
+	}
+	// No CR or drain needed here — the S command itself produces output
+	// ending with the node prompt. Sending a CR would create a stale prompt
+	// that interferes with the next S poll.
+	if err := c.poll(s.TelnetConn); err != nil {
+		s.Discard()
+		return err
+	}
+	s.Release()
+	return nil
+}
 
-		conn, err := net.DialTimeout("tcp", addr, 10*time.Second)
+// NodeCommand runs a node console command on a pooled session and returns
+// its output without the trailing prompt.
+func (c *LinkStatsCollector) NodeCommand(ctx context.Context, cmd string) ([]string, error) {
+	s, err := c.session(ctx, SessionNode)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.WriteString(cmd); err != nil {
+		s.Discard()
+		return nil, fmt.Errorf("failed to send %s command: %w", cmd, err)
+	}
+	lines, found, err := s.ReadUntil(promptPredicate, 30*time.Second)
+	if err != nil || !found {
+		s.Discard()
 		if err == nil {
-			statsLog.Infow("Connected to stats port", "addr", addr)
-			return conn, nil
-		}
-
-		statsLog.Warnw("Stats connection failed, retrying", "error", err, "backoff", backoff)
-		select {
-		case <-ctx.Done():
-			return nil, ctx.Err()
-		case <-time.After(backoff):
-		}
-
-		backoff *= 2
-		if backoff > maxBackoff {
-			backoff = maxBackoff
+			err = fmt.Errorf("timeout waiting for %s command response", cmd)
 		}
+		return nil, err
 	}
+	s.Release()
+	return lines[:len(lines)-1], nil
 }
 
 // promptPredicate detects the LinBPQ node prompt.
@@ -295,75 +350,130 @@ func (c *LinkStatsCollector) poll(tc *TelnetConn) error {
 	return nil
 }
 
-// sendCQBroadcasts opens a short-lived telnet connection and sends CQ link stats
-// for each RF port, targeting each port with "listen <port>" before the CQ command.
-// This matches the behavior of TARPN's send-routes-via-cq.c.
-func (c *LinkStatsCollector) sendCQBroadcasts() {
-	c.latestMu.RLock()
-	snap := c.latestSnap
-	c.latestMu.RUnlock()
-
+// runCQSchedule asks the CQ scheduler what is due on the RF ports in the
+// latest snapshot and sends it.
+func (c *LinkStatsCollector) runCQSchedule(ctx context.Context) {
+	snap := c.GetLatestSnapshot()
 	if snap == nil {
-		statsLog.Debugw("No stats snapshot yet, skipping CQ broadcast")
 		return
 	}
 
-	// Collect RF ports (skip port 32 = NetROM virtual port)
-	var rfPorts []*PortStats
+	// RF ports only (skip port 32 = NetROM virtual port)
+	var ports []int
+	busy := make(map[int]int)
 	for _, ps := range snap.Ports {
 		if ps.PortNum != 32 {
-			rfPorts = append(rfPorts, ps)
+			ports = append(ports, ps.PortNum)
+			busy[ps.PortNum] = ps.ActiveBusyPct
 		}
 	}
-	if len(rfPorts) == 0 {
-		return
+
+	if due := c.cq.Due(time.Now(), ports, busy); len(due) > 0 {
+		c.sendCQBroadcasts(ctx, snap, due)
 	}
+}
 
-	// Open a separate short-lived telnet connection for CQ sending
-	addr := net.JoinHostPort(c.config.Hostname, strconv.Itoa(c.config.Port))
-	conn, err := net.DialTimeout("tcp", addr, 10*time.Second)
-	if err != nil {
-		statsLog.Warnw("CQ broadcast: failed to connect", "error", err)
-		return
+// sendCQBroadcasts sends each due CQ on a pooled node session, targeting
+// its port with "listen <port>" before the CQ command, then closes the
+// session rather than return it listening.
+// This matches the behavior of TARPN's send-routes-via-cq.c.
+func (c *LinkStatsCollector) sendCQBroadcasts(ctx context.Context, snap *LinkStatsSnapshot, due []CQBroadcast) {
+	portStats := make(map[int]*PortStats)
+	for _, ps := range snap.Ports {
+		portStats[ps.PortNum] = ps
 	}
-	defer conn.Close()
 
-	tc, err := NewTelnetConn(conn, 2*time.Second, statsLog)
+	tc, err := c.session(ctx, SessionNode)
 	if err != nil {
-		statsLog.Warnw("CQ broadcast: telnet negotiation failed", "error", err)
+		statsLog.Warnw("CQ broadcast: no telnet session", "error", err)
 		return
 	}
 
-	_, err = tc.Authenticate(c.config.Callsign, c.config.Password, 10*time.Second)
-	if err != nil {
-		statsLog.Warnw("CQ broadcast: auth failed", "error", err)
-		return
+	// TARPNstat reports the routes table rather than the S counters, so
+	// fetch it once if any TARPNstat is due.
+	var nodeCall string
+	var routes []RouteEntry
+	for _, b := range due {
+		if b.Format == CQFormatTARPNStat {
+			nodeCall, routes, err = c.readRoutes(tc.TelnetConn)
+			if err != nil {
+				statsLog.Warnw("CQ broadcast: failed to read routes", "error", err)
+			}
+			break
+		}
 	}
 
-	// For each RF port: listen <port>, then CQ <message>
-	for _, ps := range rfPorts {
+	sent := 0
+	for _, b := range due {
+		var msg string
+		switch b.Format {
+		case CQFormatLS1:
+			ps, ok := portStats[b.PortNum]
+			if !ok {
+				continue
+			}
+			msg = EncodeCQ(c.config.Callsign, ps)
+		case CQFormatTARPNStat:
+			route, ok := tarpnStatRoute(routes, b.PortNum)
+			if !ok {
+				statsLog.Debugw("CQ broadcast: no locked route for TARPNstat", "port", b.PortNum)
+				continue
+			}
+			msg = formatTARPNStat(nodeCall, route)
+		}
+
 		// Target this specific port
-		listenCmd := fmt.Sprintf("listen %d", ps.PortNum)
+		listenCmd := fmt.Sprintf("listen %d", b.PortNum)
 		if err := tc.WriteString(listenCmd); err != nil {
-			statsLog.Warnw("CQ broadcast: failed to send listen", "port", ps.PortNum, "error", err)
+			statsLog.Warnw("CQ broadcast: failed to send listen", "port", b.PortNum, "error", err)
+			tc.Discard()
 			return
 		}
 		// Drain listen response
-		tc.ReadUntil(promptPredicate, 5*time.Second)
+		if _, found, err := tc.ReadUntil(promptPredicate, 5*time.Second); err != nil || !found {
+			statsLog.Warnw("CQ broadcast: no prompt after listen", "port", b.PortNum, "error", err)
+			tc.Discard()
+			return
+		}
 
-		// Send CQ with encoded stats
-		msg := EncodeCQ(c.config.Callsign, ps)
 		if err := tc.WriteString("CQ " + msg); err != nil {
-			statsLog.Warnw("CQ broadcast: failed to send CQ", "port", ps.PortNum, "error", err)
+			statsLog.Warnw("CQ broadcast: failed to send CQ", "port", b.PortNum, "error", err)
+			tc.Discard()
 			return
 		}
 		// Drain CQ response
-		tc.ReadUntil(promptPredicate, 5*time.Second)
+		if _, found, err := tc.ReadUntil(promptPredicate, 5*time.Second); err != nil || !found {
+			statsLog.Warnw("CQ broadcast: no prompt after CQ", "port", b.PortNum, "error", err)
+			tc.Discard()
+			return
+		}
 
-		statsLog.Debugw("Sent CQ broadcast", "port", ps.PortNum, "len", len(msg))
+		statsLog.Debugw("Sent CQ broadcast", "port", b.PortNum, "format", b.Format, "len", len(msg))
+		sent++
 	}
 
-	statsLog.Infow("CQ broadcasts complete", "ports", len(rfPorts))
+	// The session is still listening to the port, and would mix monitored
+	// frames into the next command's output, so it is not reused
+	tc.Discard()
+	statsLog.Infow("CQ broadcasts complete", "sent", sent, "due", len(due))
+}
+
+// readRoutes sends "R R" and parses the routes table. The table is not
+// followed by a prompt, so this reads until the node goes quiet. The node
+// callsign falls back to the login callsign if the header is missing.
+func (c *LinkStatsCollector) readRoutes(tc *TelnetConn) (string, []RouteEntry, error) {
+	if err := tc.WriteString("R R"); err != nil {
+		return "", nil, fmt.Errorf("failed to send R R: %w", err)
+	}
+	lines, _, err := tc.ReadUntil(func(string) bool { return false }, 3*time.Second)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to read routes: %w", err)
+	}
+	nodeCall, routes := parseRoutesTable(lines)
+	if nodeCall == "" {
+		nodeCall = strings.ToUpper(c.config.Callsign)
+	}
+	return nodeCall, routes, nil
 }
 
 // clampU16 clamps an int64 to uint16 range
@@ -426,178 +536,104 @@ func (c *LinkStatsCollector) sendDailyBulletin() {
 		"dayStart", dayStart.Format(time.RFC3339),
 		"dayEnd", dayEnd.Format(time.RFC3339))
 
-	// Bulletin 1: Hourly intervals from compacted data (LS1H)
-	c.sendHourlyBulletin(dayStart, dayEnd, sys)
-
-	// Delay between bulletins to avoid LinBPQ rejecting rapid connections
-	time.Sleep(5 * time.Second)
+	// Bulletin 1: Hourly intervals, from compacted data where available (LS1H)
+	c.sendIntervalBulletin("LS1H", 60, dayStart, dayEnd, sys)
 
 	// Bulletin 2: 15-minute intervals from raw data (LS15M)
-	c.send15MinBulletin(dayStart, dayEnd, sys)
-
-	time.Sleep(5 * time.Second)
+	c.sendIntervalBulletin("LS15M", 15, dayStart, dayEnd, sys)
 
 	// Bulletin 3: 5-minute intervals from raw data (LS5M)
-	c.send5MinBulletin(dayStart, dayEnd, sys)
-
-	time.Sleep(5 * time.Second)
+	c.sendIntervalBulletin("LS5M", 5, dayStart, dayEnd, sys)
 
 	// Bulletin 4: Per-link 5-minute intervals (LLS5M × N ports)
 	c.sendPerLinkBulletins(dayStart, dayEnd, sys)
 }
 
-// sendHourlyBulletin sends a bulletin with hourly interval summaries for [dayStart, dayEnd).
-func (c *LinkStatsCollector) sendHourlyBulletin(dayStart, dayEnd time.Time, sys BulletinSystemStats) {
-	portNums, err := c.storage.GetHourlyPortNumbersRange(dayStart, dayEnd)
-	if err != nil || len(portNums) == 0 {
-		statsLog.Warnw("Hourly bulletin: no data available", "error", err)
-		return
-	}
-
-	ports := make(map[int][]BulletinInterval)
-	for _, pn := range portNums {
-		summaries, err := c.storage.GetHourlySummaryRange(pn, dayStart, dayEnd)
-		if err != nil {
-			statsLog.Warnw("Hourly bulletin: failed to get summary", "port", pn, "error", err)
-			continue
-		}
-		intervals := make([]BulletinInterval, len(summaries))
-		for i, h := range summaries {
-			intervals[i] = BulletinInterval{
-				DeltaRxed:      clampU16(h.DeltaL2Rxed),
-				DeltaSent:      clampU16(h.DeltaL2Sent),
-				DeltaTimeouts:  clampU16(h.DeltaL2Timeouts),
-				DeltaRej:       clampU8(h.DeltaREJRxed),
-				DeltaCRC:       clampU8(h.DeltaCRCErrors),
-				DeltaAbandoned: clampU8(h.DeltaAbandoned),
-				AvgTxPct:       uint8(h.AvgTxPct),
-				AvgBusyPct:     uint8(h.AvgBusyPct),
-			}
-		}
-		ports[pn] = intervals
-	}
-
-	if len(ports) == 0 {
-		statsLog.Warnw("Hourly bulletin: no port data to send")
+// sendDailyReport posts yesterday's network report to the configured
+// recipient, and on Mondays the report for the week just ended as well.
+func (c *LinkStatsCollector) sendDailyReport() {
+	if c.storage == nil {
 		return
 	}
 
-	encoded := EncodeBulletin(sys, ports, 60)
-	subject := fmt.Sprintf("LS1H %s %s %s",
-		c.config.Callsign,
-		dayStart.Format("2006-01-02"),
-		dayStart.Format("15:04"))
-
-	statsLog.Infow("Hourly bulletin encoded",
-		"ports", len(ports),
-		"encodedLen", len(encoded))
-
-	c.sendBBSBulletin("LS1H", subject, encoded)
-}
-
-// send15MinBulletin sends a bulletin with 15-minute interval summaries for [dayStart, dayEnd).
-func (c *LinkStatsCollector) send15MinBulletin(dayStart, dayEnd time.Time, sys BulletinSystemStats) {
-	portNums, err := c.storage.GetRawPortNumbersRange(dayStart, dayEnd)
-	if err != nil || len(portNums) == 0 {
-		statsLog.Warnw("15-min bulletin: no raw data available", "error", err)
-		return
+	yesterday := time.Now().AddDate(0, 0, -1)
+	periods := []ReportPeriod{ReportDaily}
+	if yesterday.Weekday() == time.Sunday {
+		periods = append(periods, ReportWeekly)
 	}
 
-	ports := make(map[int][]BulletinInterval)
-	for _, pn := range portNums {
-		summaries, err := c.storage.Get15MinSummaryRange(pn, dayStart, dayEnd)
+	for _, period := range periods {
+		report, err := BuildNetworkReport(c.storage, sessionTrackerRef, c.config.Callsign, yesterday, period)
 		if err != nil {
-			statsLog.Warnw("15-min bulletin: failed to get summary", "port", pn, "error", err)
+			statsLog.Warnw("Report: failed to build", "period", period, "error", err)
 			continue
 		}
-		intervals := make([]BulletinInterval, len(summaries))
-		for i, h := range summaries {
-			intervals[i] = BulletinInterval{
-				DeltaRxed:      clampU16(h.DeltaL2Rxed),
-				DeltaSent:      clampU16(h.DeltaL2Sent),
-				DeltaTimeouts:  clampU16(h.DeltaL2Timeouts),
-				DeltaRej:       clampU8(h.DeltaREJRxed),
-				DeltaCRC:       clampU8(h.DeltaCRCErrors),
-				DeltaAbandoned: clampU8(h.DeltaAbandoned),
-				AvgTxPct:       uint8(h.AvgTxPct),
-				AvgBusyPct:     uint8(h.AvgBusyPct),
-			}
-		}
-		ports[pn] = intervals
+		c.sendBBSPersonal(c.config.ReportTo, report.Title(), report.RenderText())
 	}
-
-	if len(ports) == 0 {
-		statsLog.Warnw("15-min bulletin: no port data to send")
-		return
-	}
-
-	encoded := EncodeBulletin(sys, ports, 15)
-	subject := fmt.Sprintf("LS15M %s %s %s",
-		c.config.Callsign,
-		dayStart.Format("2006-01-02"),
-		dayStart.Format("15:04"))
-
-	statsLog.Infow("15-min bulletin encoded",
-		"ports", len(ports),
-		"encodedLen", len(encoded))
-
-	c.sendBBSBulletin("LS15M", subject, encoded)
 }
 
-// send5MinBulletin sends a bulletin with 5-minute interval summaries for [dayStart, dayEnd).
-func (c *LinkStatsCollector) send5MinBulletin(dayStart, dayEnd time.Time, sys BulletinSystemStats) {
-	portNums, err := c.storage.GetRawPortNumbersRange(dayStart, dayEnd)
-	if err != nil || len(portNums) == 0 {
-		statsLog.Warnw("5-min bulletin: no raw data available", "error", err)
-		return
+// bulletinIntervals returns a BulletinInterval for each bucket of
+// [dayStart, dayEnd) with data, in order, for every port with data.
+// Buckets with no data are left out, as the per-table summaries before the
+// query engine left them out, so that the LS1H, LS15M and LS5M payloads
+// keep the shape their decoders read.
+func (c *LinkStatsCollector) bulletinIntervals(dayStart, dayEnd time.Time, bucket time.Duration) (map[int][]BulletinInterval, error) {
+	res, err := c.storage.Query(nil, nil, dayStart, dayEnd, bucket)
+	if err != nil {
+		return nil, err
 	}
-
 	ports := make(map[int][]BulletinInterval)
-	for _, pn := range portNums {
-		summaries, err := c.storage.Get5MinSummaryRange(pn, dayStart, dayEnd)
-		if err != nil {
-			statsLog.Warnw("5-min bulletin: failed to get summary", "port", pn, "error", err)
-			continue
-		}
-		intervals := make([]BulletinInterval, len(summaries))
-		for i, h := range summaries {
-			intervals[i] = BulletinInterval{
-				DeltaRxed:      clampU16(h.DeltaL2Rxed),
-				DeltaSent:      clampU16(h.DeltaL2Sent),
-				DeltaTimeouts:  clampU16(h.DeltaL2Timeouts),
-				DeltaRej:       clampU8(h.DeltaREJRxed),
-				DeltaCRC:       clampU8(h.DeltaCRCErrors),
-				DeltaAbandoned: clampU8(h.DeltaAbandoned),
-				AvgTxPct:       uint8(h.AvgTxPct),
-				AvgBusyPct:     uint8(h.AvgBusyPct),
+	for _, series := range res.Series {
+		intervals := make([]BulletinInterval, 0, len(series.Points))
+		for _, pt := range series.Points {
+			if pt.Missing {
+				continue
 			}
+			intervals = append(intervals, BulletinInterval{
+				DeltaRxed:      clampU16(int64(pt.Values[MetricL2Rxed])),
+				DeltaSent:      clampU16(int64(pt.Values[MetricL2Sent])),
+				DeltaTimeouts:  clampU16(int64(pt.Values[MetricL2Timeouts])),
+				DeltaRej:       clampU8(int64(pt.Values[MetricREJRxed])),
+				DeltaCRC:       clampU8(int64(pt.Values[MetricRXCRCErrors])),
+				DeltaAbandoned: clampU8(int64(pt.Values[MetricFramesAbandoned])),
+				AvgTxPct:       uint8(pt.Values[MetricActiveTxPct]),
+				AvgBusyPct:     uint8(pt.Values[MetricActiveBusyPct]),
+			})
 		}
-		ports[pn] = intervals
+		ports[series.PortNum] = intervals
 	}
+	return ports, nil
+}
 
-	if len(ports) == 0 {
-		statsLog.Warnw("5-min bulletin: no port data to send")
+// sendIntervalBulletin sends a bulletin of all ports at one interval size for
+// [dayStart, dayEnd). toAddr is also the subject prefix.
+func (c *LinkStatsCollector) sendIntervalBulletin(toAddr string, intervalMins int, dayStart, dayEnd time.Time, sys BulletinSystemStats) {
+	ports, err := c.bulletinIntervals(dayStart, dayEnd, time.Duration(intervalMins)*time.Minute)
+	if err != nil || len(ports) == 0 {
+		statsLog.Warnw("Bulletin: no data available", "bulletin", toAddr, "error", err)
 		return
 	}
 
-	encoded := EncodeBulletin(sys, ports, 5)
-	subject := fmt.Sprintf("LS5M %s %s %s",
+	encoded := EncodeBulletin(sys, ports, intervalMins)
+	subject := fmt.Sprintf("%s %s %s %s",
+		toAddr,
 		c.config.Callsign,
 		dayStart.Format("2006-01-02"),
 		dayStart.Format("15:04"))
 
-	statsLog.Infow("5-min bulletin encoded",
+	statsLog.Infow("Bulletin encoded",
+		"bulletin", toAddr,
 		"ports", len(ports),
 		"encodedLen", len(encoded))
 
-	c.sendBBSBulletin("LS5M", subject, encoded)
+	c.sendBBSBulletin(toAddr, subject, encoded)
 }
 
 // sendPerLinkBulletins sends individual per-port 5-minute bulletins for each RF port.
 func (c *LinkStatsCollector) sendPerLinkBulletins(dayStart, dayEnd time.Time, sys BulletinSystemStats) {
-	portNums, err := c.storage.GetRawPortNumbersRange(dayStart, dayEnd)
-	if err != nil || len(portNums) == 0 {
-		statsLog.Warnw("Per-link bulletin: no raw data available", "error", err)
+	ports, err := c.bulletinIntervals(dayStart, dayEnd, 5*time.Minute)
+	if err != nil || len(ports) == 0 {
+		statsLog.Warnw("Per-link bulletin: no data available", "error", err)
 		return
 	}
 
@@ -607,36 +643,19 @@ func (c *LinkStatsCollector) sendPerLinkBulletins(dayStart, dayEnd time.Time, sy
 		neighbors = make(map[int]string)
 	}
 
+	portNums := make([]int, 0, len(ports))
+	for pn := range ports {
+		portNums = append(portNums, pn)
+	}
+	sort.Ints(portNums)
+
 	for _, pn := range portNums {
 		// Skip NetROM virtual port
 		if pn == 32 {
 			continue
 		}
 
-		summaries, err := c.storage.Get5MinSummaryRange(pn, dayStart, dayEnd)
-		if err != nil {
-			statsLog.Warnw("Per-link bulletin: failed to get summary", "port", pn, "error", err)
-			continue
-		}
-		if len(summaries) == 0 {
-			continue
-		}
-
-		intervals := make([]BulletinInterval, len(summaries))
-		for i, h := range summaries {
-			intervals[i] = BulletinInterval{
-				DeltaRxed:      clampU16(h.DeltaL2Rxed),
-				DeltaSent:      clampU16(h.DeltaL2Sent),
-				DeltaTimeouts:  clampU16(h.DeltaL2Timeouts),
-				DeltaRej:       clampU8(h.DeltaREJRxed),
-				DeltaCRC:       clampU8(h.DeltaCRCErrors),
-				DeltaAbandoned: clampU8(h.DeltaAbandoned),
-				AvgTxPct:       uint8(h.AvgTxPct),
-				AvgBusyPct:     uint8(h.AvgBusyPct),
-			}
-		}
-
-		singlePort := map[int][]BulletinInterval{pn: intervals}
+		singlePort := map[int][]BulletinInterval{pn: ports[pn]}
 		encoded := EncodeBulletin(sys, singlePort, 5)
 
 		var subject string
@@ -658,94 +677,75 @@ func (c *LinkStatsCollector) sendPerLinkBulletins(dayStart, dayEnd time.Time, sy
 			"encodedLen", len(encoded))
 
 		c.sendBBSBulletin("LLS5M", subject, encoded)
-
-		// Delay between per-port bulletins
-		time.Sleep(5 * time.Second)
 	}
 }
 
-// sendBBSBulletin opens a short-lived telnet connection, enters BBS mode,
-// and sends the encoded bulletin via SB <toAddr> @. Retries up to 3 times
-// with increasing delays if the connection fails.
+// sendBBSBulletin queues the encoded bulletin to be sent via SB <toAddr> @.
 func (c *LinkStatsCollector) sendBBSBulletin(toAddr, subject, encoded string) {
-	const maxRetries = 3
-
-	for attempt := 1; attempt <= maxRetries; attempt++ {
-		if attempt > 1 {
-			delay := time.Duration(attempt*5) * time.Second
-			statsLog.Infow("Bulletin: retrying", "attempt", attempt, "delay", delay)
-			time.Sleep(delay)
-		}
-
-		err := c.trySendBBSBulletin(toAddr, subject, encoded)
-		if err == nil {
-			return
-		}
-		statsLog.Warnw("Bulletin: attempt failed",
-			"attempt", attempt,
-			"maxRetries", maxRetries,
-			"error", err)
-	}
-
-	statsLog.Errorw("Bulletin: all attempts failed", "subject", subject)
+	c.sendBBSMessage(fmt.Sprintf("SB %s @", toAddr), subject, encoded)
 }
 
-// trySendBBSBulletin makes a single attempt to send a BBS bulletin.
-// Returns nil on success, error on failure.
-func (c *LinkStatsCollector) trySendBBSBulletin(toAddr, subject, encoded string) error {
-	addr := net.JoinHostPort(c.config.Hostname, strconv.Itoa(c.config.Port))
-	conn, err := net.DialTimeout("tcp", addr, 10*time.Second)
-	if err != nil {
-		return fmt.Errorf("connect failed: %w", err)
-	}
-	defer conn.Close()
+// sendBBSPersonal queues a personal message (SP) to toCall on the local BBS.
+func (c *LinkStatsCollector) sendBBSPersonal(toCall, subject, body string) {
+	c.sendBBSMessage(fmt.Sprintf("SP %s", toCall), subject, body)
+}
 
-	tc, err := NewTelnetConn(conn, 2*time.Second, statsLog)
-	if err != nil {
-		return fmt.Errorf("telnet negotiation failed: %w", err)
+// sendBBSMessage adds a message to the outbound bulletin queue, which
+// runBulletinQueue delivers and confirms. sendCmd is e.g. "SB LS1H @".
+func (c *LinkStatsCollector) sendBBSMessage(sendCmd, subject, body string) {
+	if _, err := c.storage.EnqueueBulletin(sendCmd, subject, body); err != nil {
+		statsLog.Errorw("Bulletin: failed to queue", "subject", subject, "error", err)
+		return
 	}
+	statsLog.Infow("Bulletin queued", "subject", subject)
+	BroadcastBulletinQueue(c.storage)
+}
 
-	_, err = tc.Authenticate(c.config.Callsign, c.config.Password, 10*time.Second)
+// trySendBBSMessage makes a single attempt to send a BBS message. It returns
+// the message number from the BBS's "Saved" response, or 0 if none came.
+func (c *LinkStatsCollector) trySendBBSMessage(sendCmd, subject, body string) (int, error) {
+	s, err := c.session(context.Background(), SessionBBS)
 	if err != nil {
-		return fmt.Errorf("auth failed: %w", err)
+		return 0, err
 	}
 
-	// Enter BBS mode
-	if err := tc.WriteString("BBS"); err != nil {
-		return fmt.Errorf("failed to enter BBS: %w", err)
-	}
-	// Wait for BBS SID (e.g. "[LinBPQ-6.0.24.1-B2FHIM$]")
-	_, found, err := tc.ReadUntil(func(line string) bool {
-		return strings.Contains(line, "[") && strings.Contains(line, "]")
-	}, 10*time.Second)
-	if err != nil || !found {
-		return fmt.Errorf("BBS SID not received: %w", err)
-	}
-
-	// Build and send the complete bulletin in one burst
+	// Build and send the complete message in one burst
 	var buf strings.Builder
-	buf.WriteString(fmt.Sprintf("SB %s @\r\n", toAddr))
+	buf.WriteString(sendCmd)
+	buf.WriteString("\r\n")
 	buf.WriteString(subject)
 	buf.WriteString("\r\n")
-	buf.WriteString(encoded)
+	buf.WriteString(strings.ReplaceAll(strings.TrimRight(body, "\n"), "\n", "\r\n"))
 	buf.WriteString("\r\n")
 	buf.WriteString("/EX\r\n")
 
-	if _, err := conn.Write([]byte(buf.String())); err != nil {
-		return fmt.Errorf("failed to send: %w", err)
+	if _, err := s.Write([]byte(buf.String())); err != nil {
+		s.Discard()
+		return 0, fmt.Errorf("failed to send: %w", err)
 	}
 
-	// Wait for confirmation "Message #N Saved"
-	lines, found, _ := tc.ReadUntil(func(line string) bool {
+	// Wait for confirmation "Message #N Saved". Its absence is not treated
+	// as failure here; the queue checks the BBS listing either way. The
+	// session is in an unknown state then, so it is not reused.
+	lines, found, _ := s.ReadUntil(func(line string) bool {
 		lower := strings.ToLower(line)
 		return strings.Contains(lower, "saved") || strings.Contains(lower, "accepted")
 	}, 10*time.Second)
-	if found {
-		statsLog.Infow("Bulletin sent", "subject", subject, "response", lines[len(lines)-1])
-	} else {
+	if !found {
+		s.Discard()
 		statsLog.Warnw("Bulletin: sent but no confirmation received", "subject", subject)
+		return 0, nil
 	}
-	return nil
+	statsLog.Infow("Bulletin sent", "subject", subject, "response", lines[len(lines)-1])
+
+	// Consume the BBS prompt that follows, so the next command on this
+	// session does not mistake it for the end of its own output.
+	if _, found, _ := s.ReadUntil(promptPredicate, 5*time.Second); found {
+		s.Release()
+	} else {
+		s.Discard()
+	}
+	return parseSavedMsgNum(lines[len(lines)-1]), nil
 }
 
 // runCompaction runs hourly compaction and daily purge
@@ -786,6 +786,9 @@ func (c *LinkStatsCollector) runCompaction(ctx context.Context) {
 			if err := c.storage.PurgeOldRaw(30 * 24 * time.Hour); err != nil {
 				statsLog.Errorw("Raw data purge failed", "error", err)
 			}
+			if err := c.storage.PurgeOldBulletins(30 * 24 * time.Hour); err != nil {
+				statsLog.Errorw("Bulletin queue purge failed", "error", err)
+			}
 		}
 	}
 }
@@ -793,19 +796,7 @@ func (c *LinkStatsCollector) runCompaction(ctx context.Context) {
 // BroadcastLinkStats broadcasts a link stats snapshot to all WebSocket clients
 // This is called from the collector and sends directly (not through the circular buffer)
 func BroadcastLinkStats(snap *LinkStatsSnapshot) {
-	msg := struct {
-		Type      string             `json:"type"`
-		Timestamp string             `json:"timestamp"`
-		System    SystemStats        `json:"system"`
-		Ports     map[int]*PortStats `json:"ports"`
-	}{
-		Type:      "link_stats",
-		Timestamp: snap.Timestamp.Format(time.RFC3339),
-		System:    snap.System,
-		Ports:     snap.Ports,
-	}
-
-	data, err := json.Marshal(msg)
+	data, err := json.Marshal(newLinkStatsMessage(snap))
 	if err != nil {
 		statsLog.Errorw("Failed to marshal link stats for broadcast", "error", err)
 		return
@@ -0,0 +1,587 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Metric names accepted by Query. The counters are cumulative in the S
+// command output and are always reported as deltas; the percentages are
+// sampled gauges.
+const (
+	MetricL2Rxed          = "l2_rxed"
+	MetricL2Sent          = "l2_sent"
+	MetricL2Timeouts      = "l2_timeouts"
+	MetricREJRxed         = "rej_rxed"
+	MetricRXCRCErrors     = "rx_crc_errors"
+	MetricFramesAbandoned = "frames_abandoned"
+	MetricActiveTxPct     = "active_tx_pct"
+	MetricActiveBusyPct   = "active_busy_pct"
+)
+
+// counterMetrics and gaugeMetrics list the metrics in column order.
+var (
+	counterMetrics = []string{MetricL2Rxed, MetricL2Sent, MetricL2Timeouts,
+		MetricREJRxed, MetricRXCRCErrors, MetricFramesAbandoned}
+	gaugeMetrics = []string{MetricActiveTxPct, MetricActiveBusyPct}
+)
+
+// AllStatsMetrics is every metric with its default aggregation.
+var AllStatsMetrics = append(append([]string{}, counterMetrics...), gaugeMetrics...)
+
+// Aggregation says how the samples in a bucket are combined.
+type Aggregation string
+
+const (
+	AggSum Aggregation = "sum" // counters: total delta over the bucket
+	AggAvg Aggregation = "avg" // gauges: sample-weighted mean
+	AggMax Aggregation = "max"
+	AggP95 Aggregation = "p95"
+)
+
+// MetricSpec is one requested column, written "name" or "name:agg", e.g.
+// "active_busy_pct:p95". Counters only support sum; gauges default to avg.
+type MetricSpec struct {
+	Name string
+	Agg  Aggregation
+}
+
+// Key is the name the metric's values are reported under.
+func (m MetricSpec) Key() string {
+	if m.Agg == AggSum || m.Agg == AggAvg {
+		return m.Name
+	}
+	return m.Name + ":" + string(m.Agg)
+}
+
+func isCounterMetric(name string) bool {
+	for _, m := range counterMetrics {
+		if m == name {
+			return true
+		}
+	}
+	return false
+}
+
+func isGaugeMetric(name string) bool {
+	for _, m := range gaugeMetrics {
+		if m == name {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseMetricSpec parses "name" or "name:agg".
+func ParseMetricSpec(s string) (MetricSpec, error) {
+	name, agg, _ := strings.Cut(strings.TrimSpace(s), ":")
+	spec := MetricSpec{Name: name, Agg: Aggregation(agg)}
+	switch {
+	case isCounterMetric(name):
+		if spec.Agg == "" {
+			spec.Agg = AggSum
+		}
+		if spec.Agg != AggSum {
+			return spec, fmt.Errorf("counter %s only supports sum", name)
+		}
+	case isGaugeMetric(name):
+		switch spec.Agg {
+		case "":
+			spec.Agg = AggAvg
+		case AggAvg, AggMax, AggP95:
+		default:
+			return spec, fmt.Errorf("unknown aggregation %q for %s", agg, name)
+		}
+	default:
+		return spec, fmt.Errorf("unknown metric %q", name)
+	}
+	return spec, nil
+}
+
+// QueryPoint is one bucket of one port. Missing buckets have no data in any
+// source table and carry no values, so that a chart can draw a gap rather
+// than a misleading zero.
+type QueryPoint struct {
+	BucketStart time.Time          `json:"t"`
+	SampleCount int                `json:"n"`
+	Missing     bool               `json:"missing,omitempty"`
+	Values      map[string]float64 `json:"v,omitempty"`
+}
+
+// QuerySeries is the points for one port, one per bucket from since to
+// until.
+type QuerySeries struct {
+	PortNum int          `json:"portNum"`
+	Points  []QueryPoint `json:"points"`
+}
+
+// QueryResult is the answer to a Query.
+type QueryResult struct {
+	Since      time.Time     `json:"since"`
+	Until      time.Time     `json:"until"`
+	BucketSecs int64         `json:"bucketSecs"`
+	Metrics    []string      `json:"metrics"`
+	Sources    []string      `json:"sources"` // tables that supplied at least one bucket
+	Series     []QuerySeries `json:"series"`
+}
+
+// statsSource is one of the tables a query can read from, in order of
+// decreasing cost.
+type statsSource struct {
+	name       string
+	resolution time.Duration
+	table      string
+	timeCol    string
+	timeFormat string
+}
+
+var (
+	sourceRaw    = statsSource{"raw", 0, "link_stats_raw", "timestamp", time.RFC3339}
+	sourceHourly = statsSource{"hourly", time.Hour, "link_stats_hourly", "hour_start", time.RFC3339}
+	sourceDaily  = statsSource{"daily", 24 * time.Hour, "link_stats_daily", "day_start", "2006-01-02"}
+)
+
+// sourcesFor returns the tables that can answer buckets of the given size,
+// cheapest first. A compacted table can only be used when the bucket is a
+// whole number of its rows. Raw is always last, since it is the only table
+// with the current, not yet compacted, hour.
+func sourcesFor(bucket time.Duration) []statsSource {
+	var sources []statsSource
+	for _, src := range []statsSource{sourceDaily, sourceHourly} {
+		if bucket%src.resolution == 0 {
+			sources = append(sources, src)
+		}
+	}
+	return append(sources, sourceRaw)
+}
+
+// Query returns link stats for ports in [since, until), in buckets of the
+// given size aligned to the clock in since's time zone (so 1h buckets start
+// on the hour and 24h buckets at midnight there). An empty ports
+// list means every port with data. Metrics use the "name[:agg]" form of
+// ParseMetricSpec; empty means AllStatsMetrics.
+//
+// Each hour of a bucket is filled from the cheapest table that has data
+// for it: daily, then hourly, then raw, so that a bucket spanning the
+// compaction boundary takes compacted rows for the hours they cover and raw
+// samples for the rest. The compacted tables hold UTC hours and days, so
+// they only answer buckets that start on one. Gauges aggregated from a compacted table are
+// aggregated over that table's per-row averages, so a p95 over hourly rows
+// is the 95th percentile of hourly means, not of samples.
+func (s *LinkStatsStorage) Query(ports []int, metrics []string, since, until time.Time, bucket time.Duration) (*QueryResult, error) {
+	return s.queryFrom(sourcesFor(bucket), ports, metrics, since, until, bucket)
+}
+
+func (s *LinkStatsStorage) queryFrom(sources []statsSource, ports []int, metrics []string, since, until time.Time, bucket time.Duration) (*QueryResult, error) {
+	if bucket < time.Minute {
+		return nil, fmt.Errorf("bucket must be at least one minute, got %v", bucket)
+	}
+	if !until.After(since) {
+		return nil, fmt.Errorf("empty time range")
+	}
+	if len(metrics) == 0 {
+		metrics = AllStatsMetrics
+	}
+	specs := make([]MetricSpec, 0, len(metrics))
+	keys := make([]string, 0, len(metrics))
+	for _, m := range metrics {
+		spec, err := ParseMetricSpec(m)
+		if err != nil {
+			return nil, err
+		}
+		specs = append(specs, spec)
+		keys = append(keys, spec.Key())
+	}
+
+	// Buckets follow the clock in since's time zone, which for a zone a
+	// half hour off UTC puts hours and days on the half hour
+	_, offset := since.Zone()
+	zone := time.Duration(offset) * time.Second
+	start := since.Add(zone).Truncate(bucket).Add(-zone).UTC()
+	numBuckets := int((until.Sub(start) + bucket - 1) / bucket)
+	if numBuckets > 100000 {
+		return nil, fmt.Errorf("too many buckets (%d); use a larger bucket", numBuckets)
+	}
+
+	// A compacted table holds UTC hours or days, so it can only fill
+	// buckets that start on its rows. Its rows are included if they start
+	// inside the range, so a daily row is only usable for a query that
+	// covers whole UTC days.
+	usable := make([]statsSource, 0, len(sources))
+	for _, src := range sources {
+		if src.resolution > 0 && !start.Truncate(src.resolution).Equal(start) {
+			continue
+		}
+		if src == sourceDaily && (!since.UTC().Truncate(24*time.Hour).Equal(since.UTC()) || !until.UTC().Truncate(24*time.Hour).Equal(until.UTC())) {
+			continue
+		}
+		usable = append(usable, src)
+	}
+	sources = usable
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	// Sources are merged per slot: an hour when a compacted table takes
+	// part, or the whole bucket when only raw samples can answer it.
+	slot := bucket
+	for _, src := range sources {
+		if src.resolution > 0 && src.resolution < slot {
+			slot = src.resolution
+		}
+	}
+	slotsPerBucket := int(bucket / slot)
+
+	// filled[port][i] is the accumulator for bucket i, merged from the slots
+	// each source got to first; claimed[port] is the slots already taken.
+	filled := make(map[int][]*bucketAcc)
+	claimed := make(map[int]map[int]bool)
+	for _, p := range ports {
+		filled[p] = make([]*bucketAcc, numBuckets)
+		claimed[p] = make(map[int]bool)
+	}
+	wantPort := func(p int) bool {
+		if len(ports) == 0 {
+			if _, ok := filled[p]; !ok {
+				filled[p] = make([]*bucketAcc, numBuckets)
+				claimed[p] = make(map[int]bool)
+			}
+			return true
+		}
+		_, ok := filled[p]
+		return ok
+	}
+
+	result := &QueryResult{
+		Since:      since,
+		Until:      until,
+		BucketSecs: int64(bucket / time.Second),
+		Metrics:    keys,
+	}
+
+	numSlots := numBuckets * slotsPerBucket
+	for _, src := range sources {
+		ranges := []timeRange{{since, until}}
+		if src == sourceRaw {
+			ranges = uncoveredRanges(claimed, start, slot, numSlots, since, until)
+		}
+		accs, err := s.loadSource(src, ports, ranges, start, slot, numSlots)
+		if err != nil {
+			return nil, err
+		}
+		// A daily row covers 24 hourly slots
+		span := 1
+		if src.resolution > slot {
+			span = int(src.resolution / slot)
+		}
+		used := false
+		for port, bySlot := range accs {
+			if !wantPort(port) {
+				continue
+			}
+			for j, acc := range bySlot {
+				taken := false
+				for k := j; k < j+span; k++ {
+					taken = taken || claimed[port][k]
+				}
+				if taken {
+					continue
+				}
+				for k := j; k < j+span; k++ {
+					claimed[port][k] = true
+				}
+				i := j / slotsPerBucket
+				if filled[port][i] == nil {
+					filled[port][i] = &bucketAcc{}
+				}
+				filled[port][i].merge(acc)
+				used = true
+			}
+		}
+		if used {
+			result.Sources = append(result.Sources, src.name)
+		}
+	}
+
+	portNums := make([]int, 0, len(filled))
+	for p := range filled {
+		portNums = append(portNums, p)
+	}
+	sort.Ints(portNums)
+
+	for _, p := range portNums {
+		series := QuerySeries{PortNum: p, Points: make([]QueryPoint, numBuckets)}
+		for i, acc := range filled[p] {
+			pt := QueryPoint{BucketStart: start.Add(time.Duration(i) * bucket)}
+			if acc == nil {
+				pt.Missing = true
+			} else {
+				pt.SampleCount = acc.samples
+				pt.Values = acc.values(specs)
+			}
+			series.Points[i] = pt
+		}
+		result.Series = append(result.Series, series)
+	}
+	return result, nil
+}
+
+// bucketAcc accumulates one bucket of one port.
+type bucketAcc struct {
+	samples  int
+	counters [6]int64
+	// gauges[g] holds (value, weight) pairs: raw samples with weight 1, or
+	// compacted rows weighted by their sample count.
+	gauges [2][]weighted
+}
+
+type weighted struct {
+	v float64
+	w int
+}
+
+// merge adds another accumulator's samples to a.
+func (a *bucketAcc) merge(b *bucketAcc) {
+	a.samples += b.samples
+	for k := range a.counters {
+		a.counters[k] += b.counters[k]
+	}
+	for k := range a.gauges {
+		a.gauges[k] = append(a.gauges[k], b.gauges[k]...)
+	}
+}
+
+func (a *bucketAcc) values(specs []MetricSpec) map[string]float64 {
+	out := make(map[string]float64, len(specs))
+	for _, spec := range specs {
+		for i, m := range counterMetrics {
+			if m == spec.Name {
+				out[spec.Key()] = float64(a.counters[i])
+			}
+		}
+		for i, m := range gaugeMetrics {
+			if m == spec.Name {
+				out[spec.Key()] = aggregate(a.gauges[i], spec.Agg)
+			}
+		}
+	}
+	return out
+}
+
+// aggregate reduces gauge values. p95 uses the nearest-rank method over the
+// values, ignoring weights.
+func aggregate(vals []weighted, agg Aggregation) float64 {
+	if len(vals) == 0 {
+		return 0
+	}
+	switch agg {
+	case AggMax:
+		m := vals[0].v
+		for _, x := range vals[1:] {
+			m = math.Max(m, x.v)
+		}
+		return m
+	case AggP95:
+		sorted := make([]float64, len(vals))
+		for i, x := range vals {
+			sorted[i] = x.v
+		}
+		sort.Float64s(sorted)
+		idx := int(math.Ceil(0.95*float64(len(sorted)))) - 1
+		if idx < 0 {
+			idx = 0
+		}
+		return sorted[idx]
+	default:
+		var sum float64
+		var w int
+		for _, x := range vals {
+			sum += x.v * float64(x.w)
+			w += x.w
+		}
+		if w == 0 {
+			return 0
+		}
+		return sum / float64(w)
+	}
+}
+
+// timeRange is the period [from, until).
+type timeRange struct {
+	from, until time.Time
+}
+
+// maxRawRanges bounds the ranges a raw query is split into; past it, the
+// query reads the span of them all.
+const maxRawRanges = 50
+
+// uncoveredRanges returns the parts of [since, until) in slots no port has
+// claimed: the hours the compacted tables do not cover, which compaction
+// covers for every port at once.
+func uncoveredRanges(claimed map[int]map[int]bool, start time.Time, slot time.Duration, numSlots int, since, until time.Time) []timeRange {
+	covered := make(map[int]bool)
+	for _, slots := range claimed {
+		for j := range slots {
+			covered[j] = true
+		}
+	}
+	var ranges []timeRange
+	for j := 0; j < numSlots; j++ {
+		if covered[j] {
+			continue
+		}
+		k := j
+		for k < numSlots && !covered[k] {
+			k++
+		}
+		r := timeRange{start.Add(time.Duration(j) * slot), start.Add(time.Duration(k) * slot)}
+		if r.from.Before(since) {
+			r.from = since
+		}
+		if r.until.After(until) {
+			r.until = until
+		}
+		ranges = append(ranges, r)
+		j = k
+	}
+	if len(ranges) > maxRawRanges {
+		ranges = []timeRange{{ranges[0].from, ranges[len(ranges)-1].until}}
+	}
+	return ranges
+}
+
+// loadSource reads one table for the given ranges and folds its rows into
+// slots of the given size from start, by port and slot index. The caller
+// holds s.mu.
+func (s *LinkStatsStorage) loadSource(src statsSource, ports []int, ranges []timeRange, start time.Time, slot time.Duration, numSlots int) (map[int]map[int]*bucketAcc, error) {
+	if len(ranges) == 0 {
+		return nil, nil
+	}
+	var cols string
+	if src == sourceRaw {
+		cols = "l2_rxed, l2_sent, l2_timeouts, rej_rxed, rx_crc_errors, frames_abandoned, active_tx_pct, active_busy_pct, 1"
+	} else {
+		cols = "d_l2_rxed, d_l2_sent, d_l2_timeouts, d_rej_rxed, d_rx_crc_errors, d_frames_abandoned, avg_active_tx_pct, avg_active_busy_pct, sample_count"
+	}
+
+	conds := make([]string, len(ranges))
+	var args []interface{}
+	for i, r := range ranges {
+		conds[i] = fmt.Sprintf("(%s >= ? AND %s < ?)", src.timeCol, src.timeCol)
+		args = append(args, r.from.UTC().Format(src.timeFormat), r.until.UTC().Format(src.timeFormat))
+	}
+	query := fmt.Sprintf(`SELECT %s, port_num, %s FROM %s WHERE (%s)`,
+		src.timeCol, cols, src.table, strings.Join(conds, " OR "))
+	if len(ports) > 0 {
+		placeholders := strings.TrimSuffix(strings.Repeat("?,", len(ports)), ",")
+		query += " AND port_num IN (" + placeholders + ")"
+		for _, p := range ports {
+			args = append(args, p)
+		}
+	}
+	query += " ORDER BY port_num, " + src.timeCol
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query %s stats: %w", src.name, err)
+	}
+	defer rows.Close()
+
+	accs := make(map[int]map[int]*bucketAcc)
+	type prevSample struct {
+		slot     int
+		counters [6]int64
+	}
+	prev := make(map[int]prevSample)
+
+	for rows.Next() {
+		var ts string
+		var port, weight int
+		var c [6]int64
+		var g [2]float64
+		if err := rows.Scan(&ts, &port, &c[0], &c[1], &c[2], &c[3], &c[4], &c[5], &g[0], &g[1], &weight); err != nil {
+			return nil, fmt.Errorf("failed to scan %s stats: %w", src.name, err)
+		}
+		t, err := time.Parse(src.timeFormat, ts)
+		if err != nil {
+			continue
+		}
+		i := int(t.Sub(start) / slot)
+		if i < 0 || i >= numSlots {
+			continue
+		}
+
+		bySlot, ok := accs[port]
+		if !ok {
+			bySlot = make(map[int]*bucketAcc)
+			accs[port] = bySlot
+		}
+		acc := bySlot[i]
+		if acc == nil {
+			acc = &bucketAcc{}
+			bySlot[i] = acc
+		}
+		acc.samples += weight
+		for k := range g {
+			acc.gauges[k] = append(acc.gauges[k], weighted{g[k], weight})
+		}
+
+		if src != sourceRaw {
+			for k := range c {
+				acc.counters[k] += c[k]
+			}
+			continue
+		}
+		// Raw counters are cumulative. Sum deltas between consecutive
+		// samples in the same slot, as CompactHourly does within the hour,
+		// so that a LinBPQ restart mid-slot does not show as a huge
+		// negative jump.
+		if p, ok := prev[port]; ok && p.slot == i {
+			for k := range c {
+				acc.counters[k] += safeDelta(p.counters[k], c[k])
+			}
+		}
+		prev[port] = prevSample{slot: i, counters: c}
+	}
+	return accs, rows.Err()
+}
+
+// queryPortSummaries runs a single-port query against fixed sources and
+// returns the buckets that have data, for the per-resolution helpers below.
+func (s *LinkStatsStorage) queryPortSummaries(sources []statsSource, portNum int, since, until time.Time, bucket time.Duration) ([]FiveMinSummary, error) {
+	res, err := s.queryFrom(sources, []int{portNum}, nil, since, until, bucket)
+	if err != nil {
+		return nil, err
+	}
+	var out []FiveMinSummary
+	for _, series := range res.Series {
+		for _, pt := range series.Points {
+			if pt.Missing {
+				continue
+			}
+			out = append(out, FiveMinSummary{
+				BucketStart:     pt.BucketStart,
+				PortNum:         series.PortNum,
+				DeltaL2Rxed:     int64(pt.Values[MetricL2Rxed]),
+				DeltaL2Sent:     int64(pt.Values[MetricL2Sent]),
+				DeltaL2Timeouts: int64(pt.Values[MetricL2Timeouts]),
+				DeltaREJRxed:    int64(pt.Values[MetricREJRxed]),
+				DeltaCRCErrors:  int64(pt.Values[MetricRXCRCErrors]),
+				DeltaAbandoned:  int64(pt.Values[MetricFramesAbandoned]),
+				AvgTxPct:        pt.Values[MetricActiveTxPct],
+				AvgBusyPct:      pt.Values[MetricActiveBusyPct],
+				SampleCount:     pt.SampleCount,
+			})
+		}
+	}
+	return out, nil
+}
+
+// queryOpenEnd is the until used by the helpers that take only a since:
+// far enough ahead to include the current bucket.
+func queryOpenEnd() time.Time {
+	return time.Now().Add(24 * time.Hour)
+}
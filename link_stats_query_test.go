@@ -0,0 +1,235 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// insertHourly writes a compacted hourly row directly.
+func insertHourly(t *testing.T, s *LinkStatsStorage, hour time.Time, port int, sent int64, busyPct float64, samples int) {
+	t.Helper()
+	_, err := s.db.Exec(`
+		INSERT INTO link_stats_hourly
+			(hour_start, port_num, d_l2_sent, avg_active_busy_pct, sample_count)
+		VALUES (?, ?, ?, ?, ?)`,
+		hour.UTC().Format(time.RFC3339), port, sent, busyPct, samples)
+	if err != nil {
+		t.Fatalf("insert hourly: %v", err)
+	}
+}
+
+// Six hours of compacted data queried in 6h and 30m buckets: the 6h bucket
+// must come from the hourly table, with weighted averages; the 30m buckets
+// cannot, so they come from raw, where there is nothing, and are all missing.
+func TestQueryBucketSizesAndSource(t *testing.T) {
+	s := newTestStorage(t)
+	base := time.Date(2025, 3, 10, 0, 0, 0, 0, time.UTC)
+
+	for h := 0; h < 6; h++ {
+		busy, samples := 10.0, 60
+		if h == 5 {
+			busy, samples = 70.0, 20
+		}
+		insertHourly(t, s, base.Add(time.Duration(h)*time.Hour), 1, 100, busy, samples)
+	}
+
+	res, err := s.Query([]int{1}, []string{"l2_sent", "active_busy_pct", "active_busy_pct:max"},
+		base, base.Add(6*time.Hour), 6*time.Hour)
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	if len(res.Sources) != 1 || res.Sources[0] != "hourly" {
+		t.Errorf("Sources = %v, want [hourly]", res.Sources)
+	}
+	if len(res.Series) != 1 || len(res.Series[0].Points) != 1 {
+		t.Fatalf("Series = %+v, want one port with one point", res.Series)
+	}
+	pt := res.Series[0].Points[0]
+	if pt.Values["l2_sent"] != 600 {
+		t.Errorf("l2_sent = %v, want 600", pt.Values["l2_sent"])
+	}
+	// (5*60*10 + 20*70) / 320
+	if got, want := pt.Values["active_busy_pct"], 4400.0/320; got != want {
+		t.Errorf("active_busy_pct = %v, want %v", got, want)
+	}
+	if pt.Values["active_busy_pct:max"] != 70 {
+		t.Errorf("active_busy_pct:max = %v, want 70", pt.Values["active_busy_pct:max"])
+	}
+	if pt.SampleCount != 320 {
+		t.Errorf("SampleCount = %d, want 320", pt.SampleCount)
+	}
+
+	res, err = s.Query([]int{1}, nil, base, base.Add(6*time.Hour), 30*time.Minute)
+	if err != nil {
+		t.Fatalf("Query 30m: %v", err)
+	}
+	if len(res.Series) != 1 || len(res.Series[0].Points) != 12 {
+		t.Fatalf("Series = %+v, want 12 points", res.Series)
+	}
+	for _, p := range res.Series[0].Points {
+		if !p.Missing {
+			t.Errorf("point %v not missing; hourly rows cannot fill 30m buckets", p.BucketStart)
+		}
+	}
+}
+
+// An hour that has not been compacted yet is filled from raw samples, and an
+// hour with no data at all is reported as missing rather than dropped.
+func TestQueryFallsBackToRawAndFillsGaps(t *testing.T) {
+	s := newTestStorage(t)
+	base := time.Date(2025, 3, 10, 0, 0, 0, 0, time.UTC)
+
+	insertHourly(t, s, base, 2, 500, 5, 60)
+	for m := 0; m < 60; m++ {
+		insertRaw(t, s, base.Add(2*time.Hour+time.Duration(m)*time.Minute), 2, int64(m), int64(m)*3)
+	}
+
+	res, err := s.Query(nil, []string{"l2_sent"}, base, base.Add(3*time.Hour), time.Hour)
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	if len(res.Sources) != 2 || res.Sources[0] != "hourly" || res.Sources[1] != "raw" {
+		t.Errorf("Sources = %v, want [hourly raw]", res.Sources)
+	}
+	if len(res.Series) != 1 || res.Series[0].PortNum != 2 {
+		t.Fatalf("Series = %+v, want port 2", res.Series)
+	}
+	pts := res.Series[0].Points
+	if len(pts) != 3 {
+		t.Fatalf("got %d points, want 3", len(pts))
+	}
+	if pts[0].Missing || pts[0].Values["l2_sent"] != 500 {
+		t.Errorf("hour 0 = %+v, want 500 from hourly", pts[0])
+	}
+	if !pts[1].Missing || pts[1].Values != nil {
+		t.Errorf("hour 1 = %+v, want missing", pts[1])
+	}
+	if pts[2].Missing || pts[2].Values["l2_sent"] != 59*3 || pts[2].SampleCount != 60 {
+		t.Errorf("hour 2 = %+v, want %d from 60 raw samples", pts[2], 59*3)
+	}
+}
+
+// A bucket spanning the compaction boundary takes the compacted hours from
+// the hourly table and the rest from raw samples, without counting an hour
+// twice when its raw samples have not been purged yet.
+func TestQueryMergesSourcesAcrossCompactionBoundary(t *testing.T) {
+	s := newTestStorage(t)
+	base := time.Date(2025, 3, 10, 0, 0, 0, 0, time.UTC)
+
+	for h := 0; h < 4; h++ {
+		insertHourly(t, s, base.Add(time.Duration(h)*time.Hour), 1, 100, 10, 60)
+	}
+	for _, h := range []int{0, 4, 5} {
+		for m := 0; m < 60; m++ {
+			insertRaw(t, s, base.Add(time.Duration(h)*time.Hour+time.Duration(m)*time.Minute), 1, int64(m), int64(m)*3)
+		}
+	}
+
+	res, err := s.Query([]int{1}, []string{"l2_sent"}, base, base.Add(6*time.Hour), 6*time.Hour)
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	if len(res.Sources) != 2 || res.Sources[0] != "hourly" || res.Sources[1] != "raw" {
+		t.Errorf("Sources = %v, want [hourly raw]", res.Sources)
+	}
+	if len(res.Series) != 1 || len(res.Series[0].Points) != 1 {
+		t.Fatalf("Series = %+v, want one port with one point", res.Series)
+	}
+	pt := res.Series[0].Points[0]
+	// Four compacted hours of 100, and two raw hours of 59*3 each
+	if want := float64(4*100 + 2*59*3); pt.Missing || pt.Values["l2_sent"] != want {
+		t.Errorf("l2_sent = %+v, want %v", pt, want)
+	}
+	if pt.SampleCount != 4*60+2*60 {
+		t.Errorf("SampleCount = %d, want %d", pt.SampleCount, 6*60)
+	}
+}
+
+// In a zone a half hour off UTC, hourly buckets start on the local hour,
+// which the hourly table's UTC rows do not, so raw samples answer them.
+func TestQueryHalfHourZone(t *testing.T) {
+	s := newTestStorage(t)
+	zone := time.FixedZone("IST", 5*3600+1800)
+	since := time.Date(2025, 3, 10, 0, 0, 0, 0, zone) // 18:30 UTC
+	insertHourly(t, s, time.Date(2025, 3, 9, 18, 0, 0, 0, time.UTC), 1, 500, 5, 60)
+	for m := 0; m < 60; m++ {
+		insertRaw(t, s, since.Add(time.Duration(m)*time.Minute), 1, int64(m), int64(m)*2)
+	}
+
+	res, err := s.Query([]int{1}, []string{"l2_sent"}, since, since.Add(2*time.Hour), time.Hour)
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	if len(res.Sources) != 1 || res.Sources[0] != "raw" {
+		t.Errorf("Sources = %v, want [raw]", res.Sources)
+	}
+	pts := res.Series[0].Points
+	if len(pts) != 2 || !pts[0].BucketStart.Equal(since) || pts[0].Values["l2_sent"] != 59*2 || !pts[1].Missing {
+		t.Errorf("points = %+v, want one local hour of raw samples starting %v", pts, since)
+	}
+}
+
+// The raw table is only read for the hours the compacted tables do not
+// cover.
+func TestUncoveredRanges(t *testing.T) {
+	start := time.Date(2025, 3, 10, 0, 0, 0, 0, time.UTC)
+	claimed := map[int]map[int]bool{1: {0: true, 1: true}, 2: {1: true, 3: true}}
+	got := uncoveredRanges(claimed, start, time.Hour, 6, start.Add(30*time.Minute), start.Add(5*time.Hour+30*time.Minute))
+	want := []timeRange{
+		{start.Add(2 * time.Hour), start.Add(3 * time.Hour)},
+		{start.Add(4 * time.Hour), start.Add(5*time.Hour + 30*time.Minute)},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("uncoveredRanges = %v, want %v", got, want)
+	}
+}
+
+// p95 over raw samples uses nearest rank: of 20 samples 1..20 it is the 19th.
+func TestQueryP95(t *testing.T) {
+	s := newTestStorage(t)
+	base := time.Date(2025, 3, 10, 0, 0, 0, 0, time.UTC)
+
+	for i := 1; i <= 20; i++ {
+		_, err := s.db.Exec(`
+			INSERT INTO link_stats_raw (timestamp, port_num, active_busy_pct)
+			VALUES (?, 1, ?)`,
+			base.Add(time.Duration(i)*time.Minute).Format(time.RFC3339), i)
+		if err != nil {
+			t.Fatalf("insert: %v", err)
+		}
+	}
+
+	res, err := s.Query([]int{1}, []string{"active_busy_pct:p95"}, base, base.Add(time.Hour), 30*time.Minute)
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	if got := res.Series[0].Points[0].Values["active_busy_pct:p95"]; got != 19 {
+		t.Errorf("p95 = %v, want 19", got)
+	}
+}
+
+func TestParseMetricSpec(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    MetricSpec
+		wantErr bool
+	}{
+		{"l2_sent", MetricSpec{"l2_sent", AggSum}, false},
+		{"active_tx_pct", MetricSpec{"active_tx_pct", AggAvg}, false},
+		{"active_tx_pct:p95", MetricSpec{"active_tx_pct", AggP95}, false},
+		{"l2_sent:max", MetricSpec{}, true},
+		{"active_tx_pct:median", MetricSpec{}, true},
+		{"bogus", MetricSpec{}, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseMetricSpec(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseMetricSpec(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && got != tt.want {
+			t.Errorf("ParseMetricSpec(%q) = %+v, want %+v", tt.in, got, tt.want)
+		}
+	}
+}
@@ -160,6 +160,69 @@ func (s *LinkStatsStorage) createTables() error {
 	);
 	CREATE INDEX IF NOT EXISTS idx_neighbor_timestamp ON link_stats_neighbor(timestamp);
 	CREATE INDEX IF NOT EXISTS idx_neighbor_call_port ON link_stats_neighbor(callsign, reported_port);
+
+	-- Outbound BBS messages (LS1 bulletins, reports). Kept here rather than
+	-- sent inline so a BBS outage delays them instead of losing them.
+	CREATE TABLE IF NOT EXISTS bulletin_queue (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		created_at DATETIME NOT NULL,
+		send_cmd TEXT NOT NULL,
+		subject TEXT NOT NULL,
+		body TEXT NOT NULL,
+		state TEXT NOT NULL,
+		attempts INTEGER DEFAULT 0,
+		next_attempt_at DATETIME NOT NULL,
+		last_error TEXT DEFAULT '',
+		bbs_msg_num INTEGER DEFAULT 0,
+		sent_at DATETIME,
+		confirmed_at DATETIME
+	);
+	CREATE INDEX IF NOT EXISTS idx_bulletin_queue_state ON bulletin_queue(state, next_attempt_at);
+
+	-- Finished L2 sessions from the OARC session tracker, which only keeps
+	-- the most recent ones in memory. circuits is the JSON circuit list.
+	CREATE TABLE IF NOT EXISTS session_history (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		session_key TEXT NOT NULL,
+		port_num INTEGER NOT NULL,
+		initiator TEXT NOT NULL,
+		responder TEXT NOT NULL,
+		started_at DATETIME,
+		ended_at DATETIME NOT NULL,
+		duration_secs INTEGER DEFAULT 0,
+		i_frames_sent INTEGER DEFAULT 0,
+		i_frames_rcvd INTEGER DEFAULT 0,
+		total_frames INTEGER DEFAULT 0,
+		retry_count INTEGER DEFAULT 0,
+		rej_count INTEGER DEFAULT 0,
+		timeout_retries INTEGER DEFAULT 0,
+		rej_retries INTEGER DEFAULT 0,
+		retry_rate REAL DEFAULT 0,
+		bytes_sent INTEGER DEFAULT 0,
+		bytes_rcvd INTEGER DEFAULT 0,
+		frames_resent INTEGER DEFAULT 0,
+		disconnect_reason TEXT DEFAULT '',
+		outcome TEXT NOT NULL,
+		has_netrom INTEGER DEFAULT 0,
+		has_ip INTEGER DEFAULT 0,
+		has_text INTEGER DEFAULT 0,
+		circuits TEXT DEFAULT ''
+	);
+	CREATE INDEX IF NOT EXISTS idx_session_history_ended ON session_history(ended_at);
+	CREATE INDEX IF NOT EXISTS idx_session_history_initiator ON session_history(initiator);
+	CREATE INDEX IF NOT EXISTS idx_session_history_responder ON session_history(responder);
+
+	CREATE TABLE IF NOT EXISTS link_rtt (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		timestamp DATETIME NOT NULL,
+		port_num INTEGER NOT NULL,
+		callsign TEXT NOT NULL,
+		samples INTEGER NOT NULL,
+		min_ms REAL NOT NULL,
+		median_ms REAL NOT NULL,
+		p95_ms REAL NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS idx_link_rtt_ts ON link_rtt(timestamp);
 	`
 	_, err := s.db.Exec(schema)
 	if err != nil {
@@ -368,36 +431,7 @@ type HourlySummary struct {
 
 // GetHourlySummary returns hourly compacted stats for a port
 func (s *LinkStatsStorage) GetHourlySummary(portNum int, since time.Time) ([]HourlySummary, error) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-
-	rows, err := s.db.Query(`
-		SELECT hour_start, port_num, d_l2_rxed, d_l2_sent, d_l2_timeouts,
-		       d_rej_rxed, d_rx_crc_errors, d_frames_abandoned,
-		       avg_active_tx_pct, avg_active_busy_pct, sample_count
-		FROM link_stats_hourly
-		WHERE port_num = ? AND hour_start >= ?
-		ORDER BY hour_start ASC`,
-		portNum, since.UTC().Format(time.RFC3339))
-	if err != nil {
-		return nil, fmt.Errorf("failed to query hourly summary: %w", err)
-	}
-	defer rows.Close()
-
-	var summaries []HourlySummary
-	for rows.Next() {
-		var h HourlySummary
-		var ts string
-		err := rows.Scan(&ts, &h.PortNum, &h.DeltaL2Rxed, &h.DeltaL2Sent, &h.DeltaL2Timeouts,
-			&h.DeltaREJRxed, &h.DeltaCRCErrors, &h.DeltaAbandoned,
-			&h.AvgTxPct, &h.AvgBusyPct, &h.SampleCount)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan hourly summary: %w", err)
-		}
-		h.HourStart, _ = time.Parse(time.RFC3339, ts)
-		summaries = append(summaries, h)
-	}
-	return summaries, nil
+	return s.GetHourlySummaryRange(portNum, since, queryOpenEnd())
 }
 
 // GetHourlyPortNumbers returns distinct port numbers that have hourly data since the given time
@@ -427,36 +461,14 @@ func (s *LinkStatsStorage) GetHourlyPortNumbers(since time.Time) ([]int, error)
 
 // GetHourlySummaryRange returns hourly compacted stats for a port within a time range [since, until)
 func (s *LinkStatsStorage) GetHourlySummaryRange(portNum int, since, until time.Time) ([]HourlySummary, error) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-
-	rows, err := s.db.Query(`
-		SELECT hour_start, port_num, d_l2_rxed, d_l2_sent, d_l2_timeouts,
-		       d_rej_rxed, d_rx_crc_errors, d_frames_abandoned,
-		       avg_active_tx_pct, avg_active_busy_pct, sample_count
-		FROM link_stats_hourly
-		WHERE port_num = ? AND hour_start >= ? AND hour_start < ?
-		ORDER BY hour_start ASC`,
-		portNum, since.UTC().Format(time.RFC3339), until.UTC().Format(time.RFC3339))
+	fm, err := s.queryPortSummaries([]statsSource{sourceHourly}, portNum, since, until, time.Hour)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query hourly summary range: %w", err)
+		return nil, err
 	}
-	defer rows.Close()
-
-	var summaries []HourlySummary
-	for rows.Next() {
-		var h HourlySummary
-		var ts string
-		err := rows.Scan(&ts, &h.PortNum, &h.DeltaL2Rxed, &h.DeltaL2Sent, &h.DeltaL2Timeouts,
-			&h.DeltaREJRxed, &h.DeltaCRCErrors, &h.DeltaAbandoned,
-			&h.AvgTxPct, &h.AvgBusyPct, &h.SampleCount)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan hourly summary: %w", err)
-		}
-		h.HourStart, _ = time.Parse(time.RFC3339, ts)
-		summaries = append(summaries, h)
+	if len(fm) == 0 {
+		return nil, nil
 	}
-	return summaries, nil
+	return hourlyFrom5Min(fm), nil
 }
 
 // GetHourlyPortNumbersRange returns distinct port numbers that have hourly data in [since, until)
@@ -552,260 +564,17 @@ type FiveMinSummary struct {
 // Get5MinSummary computes 5-minute interval summaries from raw data for a port.
 // Unlike hourly compaction (stored), these are computed on-the-fly from raw snapshots.
 func (s *LinkStatsStorage) Get5MinSummary(portNum int, since time.Time) ([]FiveMinSummary, error) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-
-	rows, err := s.db.Query(`
-		SELECT timestamp, l2_rxed, l2_sent, l2_timeouts, rej_rxed,
-		       rx_crc_errors, frames_abandoned, active_tx_pct, active_busy_pct
-		FROM link_stats_raw
-		WHERE port_num = ? AND timestamp >= ?
-		ORDER BY timestamp ASC`,
-		portNum, since.UTC().Format(time.RFC3339))
-	if err != nil {
-		return nil, fmt.Errorf("failed to query raw data for 5-min summary: %w", err)
-	}
-	defer rows.Close()
-
-	// Collect raw points grouped into 5-minute buckets
-	type rawPoint struct {
-		rxed, sent, timeouts, rej, crc, abandoned int64
-		txPct, busyPct                            int
-	}
-
-	buckets := make(map[time.Time][]rawPoint)
-	var bucketOrder []time.Time
-
-	for rows.Next() {
-		var ts string
-		var p rawPoint
-		err := rows.Scan(&ts, &p.rxed, &p.sent, &p.timeouts, &p.rej,
-			&p.crc, &p.abandoned, &p.txPct, &p.busyPct)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan raw data: %w", err)
-		}
-		t, _ := time.Parse(time.RFC3339, ts)
-		// Truncate to 5-minute bucket
-		bucket := t.Truncate(5 * time.Minute)
-		if _, exists := buckets[bucket]; !exists {
-			bucketOrder = append(bucketOrder, bucket)
-		}
-		buckets[bucket] = append(buckets[bucket], p)
-	}
-
-	// Compute deltas for each bucket
-	var summaries []FiveMinSummary
-	for _, bucket := range bucketOrder {
-		points := buckets[bucket]
-		if len(points) < 2 {
-			// Need at least 2 points to compute a delta
-			// Use single point with zero deltas but include pct averages
-			if len(points) == 1 {
-				summaries = append(summaries, FiveMinSummary{
-					BucketStart: bucket,
-					PortNum:     portNum,
-					AvgTxPct:    float64(points[0].txPct),
-					AvgBusyPct:  float64(points[0].busyPct),
-					SampleCount: 1,
-				})
-			}
-			continue
-		}
-
-		first := points[0]
-		last := points[len(points)-1]
-
-		var txPctSum, busyPctSum float64
-		for _, p := range points {
-			txPctSum += float64(p.txPct)
-			busyPctSum += float64(p.busyPct)
-		}
-
-		summaries = append(summaries, FiveMinSummary{
-			BucketStart:     bucket,
-			PortNum:         portNum,
-			DeltaL2Rxed:     safeDelta(first.rxed, last.rxed),
-			DeltaL2Sent:     safeDelta(first.sent, last.sent),
-			DeltaL2Timeouts: safeDelta(first.timeouts, last.timeouts),
-			DeltaREJRxed:    safeDelta(first.rej, last.rej),
-			DeltaCRCErrors:  safeDelta(first.crc, last.crc),
-			DeltaAbandoned:  safeDelta(first.abandoned, last.abandoned),
-			AvgTxPct:        txPctSum / float64(len(points)),
-			AvgBusyPct:      busyPctSum / float64(len(points)),
-			SampleCount:     len(points),
-		})
-	}
-
-	return summaries, nil
+	return s.Get5MinSummaryRange(portNum, since, queryOpenEnd())
 }
 
 // Get5MinSummaryRange computes 5-minute interval summaries from raw data in [since, until).
 func (s *LinkStatsStorage) Get5MinSummaryRange(portNum int, since, until time.Time) ([]FiveMinSummary, error) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-
-	rows, err := s.db.Query(`
-		SELECT timestamp, l2_rxed, l2_sent, l2_timeouts, rej_rxed,
-		       rx_crc_errors, frames_abandoned, active_tx_pct, active_busy_pct
-		FROM link_stats_raw
-		WHERE port_num = ? AND timestamp >= ? AND timestamp < ?
-		ORDER BY timestamp ASC`,
-		portNum, since.UTC().Format(time.RFC3339), until.UTC().Format(time.RFC3339))
-	if err != nil {
-		return nil, fmt.Errorf("failed to query raw data for 5-min summary range: %w", err)
-	}
-	defer rows.Close()
-
-	type rawPoint struct {
-		rxed, sent, timeouts, rej, crc, abandoned int64
-		txPct, busyPct                            int
-	}
-
-	buckets := make(map[time.Time][]rawPoint)
-	var bucketOrder []time.Time
-
-	for rows.Next() {
-		var ts string
-		var p rawPoint
-		err := rows.Scan(&ts, &p.rxed, &p.sent, &p.timeouts, &p.rej,
-			&p.crc, &p.abandoned, &p.txPct, &p.busyPct)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan raw data: %w", err)
-		}
-		t, _ := time.Parse(time.RFC3339, ts)
-		bucket := t.Truncate(5 * time.Minute)
-		if _, exists := buckets[bucket]; !exists {
-			bucketOrder = append(bucketOrder, bucket)
-		}
-		buckets[bucket] = append(buckets[bucket], p)
-	}
-
-	var summaries []FiveMinSummary
-	for _, bucket := range bucketOrder {
-		points := buckets[bucket]
-		if len(points) < 2 {
-			if len(points) == 1 {
-				summaries = append(summaries, FiveMinSummary{
-					BucketStart: bucket,
-					PortNum:     portNum,
-					AvgTxPct:    float64(points[0].txPct),
-					AvgBusyPct:  float64(points[0].busyPct),
-					SampleCount: 1,
-				})
-			}
-			continue
-		}
-
-		first := points[0]
-		last := points[len(points)-1]
-
-		var txPctSum, busyPctSum float64
-		for _, p := range points {
-			txPctSum += float64(p.txPct)
-			busyPctSum += float64(p.busyPct)
-		}
-
-		summaries = append(summaries, FiveMinSummary{
-			BucketStart:     bucket,
-			PortNum:         portNum,
-			DeltaL2Rxed:     safeDelta(first.rxed, last.rxed),
-			DeltaL2Sent:     safeDelta(first.sent, last.sent),
-			DeltaL2Timeouts: safeDelta(first.timeouts, last.timeouts),
-			DeltaREJRxed:    safeDelta(first.rej, last.rej),
-			DeltaCRCErrors:  safeDelta(first.crc, last.crc),
-			DeltaAbandoned:  safeDelta(first.abandoned, last.abandoned),
-			AvgTxPct:        txPctSum / float64(len(points)),
-			AvgBusyPct:      busyPctSum / float64(len(points)),
-			SampleCount:     len(points),
-		})
-	}
-
-	return summaries, nil
+	return s.queryPortSummaries([]statsSource{sourceRaw}, portNum, since, until, 5*time.Minute)
 }
 
 // Get15MinSummaryRange computes 15-minute interval summaries from raw data in [since, until).
-// Same logic as Get5MinSummaryRange but truncates to 15-minute buckets.
 func (s *LinkStatsStorage) Get15MinSummaryRange(portNum int, since, until time.Time) ([]FiveMinSummary, error) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-
-	rows, err := s.db.Query(`
-		SELECT timestamp, l2_rxed, l2_sent, l2_timeouts, rej_rxed,
-		       rx_crc_errors, frames_abandoned, active_tx_pct, active_busy_pct
-		FROM link_stats_raw
-		WHERE port_num = ? AND timestamp >= ? AND timestamp < ?
-		ORDER BY timestamp ASC`,
-		portNum, since.UTC().Format(time.RFC3339), until.UTC().Format(time.RFC3339))
-	if err != nil {
-		return nil, fmt.Errorf("failed to query raw data for 15-min summary range: %w", err)
-	}
-	defer rows.Close()
-
-	type rawPoint struct {
-		rxed, sent, timeouts, rej, crc, abandoned int64
-		txPct, busyPct                            int
-	}
-
-	buckets := make(map[time.Time][]rawPoint)
-	var bucketOrder []time.Time
-
-	for rows.Next() {
-		var ts string
-		var p rawPoint
-		err := rows.Scan(&ts, &p.rxed, &p.sent, &p.timeouts, &p.rej,
-			&p.crc, &p.abandoned, &p.txPct, &p.busyPct)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan raw data: %w", err)
-		}
-		t, _ := time.Parse(time.RFC3339, ts)
-		bucket := t.Truncate(15 * time.Minute)
-		if _, exists := buckets[bucket]; !exists {
-			bucketOrder = append(bucketOrder, bucket)
-		}
-		buckets[bucket] = append(buckets[bucket], p)
-	}
-
-	var summaries []FiveMinSummary
-	for _, bucket := range bucketOrder {
-		points := buckets[bucket]
-		if len(points) < 2 {
-			if len(points) == 1 {
-				summaries = append(summaries, FiveMinSummary{
-					BucketStart: bucket,
-					PortNum:     portNum,
-					AvgTxPct:    float64(points[0].txPct),
-					AvgBusyPct:  float64(points[0].busyPct),
-					SampleCount: 1,
-				})
-			}
-			continue
-		}
-
-		first := points[0]
-		last := points[len(points)-1]
-
-		var txPctSum, busyPctSum float64
-		for _, p := range points {
-			txPctSum += float64(p.txPct)
-			busyPctSum += float64(p.busyPct)
-		}
-
-		summaries = append(summaries, FiveMinSummary{
-			BucketStart:     bucket,
-			PortNum:         portNum,
-			DeltaL2Rxed:     safeDelta(first.rxed, last.rxed),
-			DeltaL2Sent:     safeDelta(first.sent, last.sent),
-			DeltaL2Timeouts: safeDelta(first.timeouts, last.timeouts),
-			DeltaREJRxed:    safeDelta(first.rej, last.rej),
-			DeltaCRCErrors:  safeDelta(first.crc, last.crc),
-			DeltaAbandoned:  safeDelta(first.abandoned, last.abandoned),
-			AvgTxPct:        txPctSum / float64(len(points)),
-			AvgBusyPct:      busyPctSum / float64(len(points)),
-			SampleCount:     len(points),
-		})
-	}
-
-	return summaries, nil
+	return s.queryPortSummaries([]statsSource{sourceRaw}, portNum, since, until, 15*time.Minute)
 }
 
 // GetNeighborCallsigns returns the most recent neighbor callsign per rx_port
@@ -1161,6 +930,138 @@ func (s *LinkStatsStorage) PurgeOldTARPNStat(retention time.Duration) error {
 	return nil
 }
 
+// NodeRestart marks a point where the node's uptime counter went backwards
+// between two consecutive S polls, i.e. LinBPQ was restarted in between.
+type NodeRestart struct {
+	DetectedAt time.Time `json:"detectedAt"`
+	// UptimeBeforeMins is the last uptime seen before the restart, which is
+	// how long the previous run lasted (to within one poll interval).
+	UptimeBeforeMins int `json:"uptimeBeforeMins"`
+}
+
+// GetNodeRestarts scans the system stats in [since, until) for uptime resets.
+// The row immediately before since is included so a restart right at the
+// start of the window is not missed.
+func (s *LinkStatsStorage) GetNodeRestarts(since, until time.Time) ([]NodeRestart, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rows, err := s.db.Query(`
+		SELECT timestamp, uptime_mins FROM (
+			SELECT timestamp, uptime_mins FROM link_stats_system
+			WHERE timestamp < ? ORDER BY timestamp DESC LIMIT 1
+		)
+		UNION ALL
+		SELECT timestamp, uptime_mins FROM link_stats_system
+		WHERE timestamp >= ? AND timestamp < ?
+		ORDER BY timestamp ASC`,
+		since.UTC().Format(time.RFC3339),
+		since.UTC().Format(time.RFC3339), until.UTC().Format(time.RFC3339))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query system uptime: %w", err)
+	}
+	defer rows.Close()
+
+	var restarts []NodeRestart
+	prevUptime := -1
+	for rows.Next() {
+		var ts string
+		var uptime int
+		if err := rows.Scan(&ts, &uptime); err != nil {
+			return nil, fmt.Errorf("failed to scan system uptime: %w", err)
+		}
+		if prevUptime >= 0 && uptime < prevUptime {
+			t, _ := time.Parse(time.RFC3339, ts)
+			restarts = append(restarts, NodeRestart{DetectedAt: t, UptimeBeforeMins: prevUptime})
+		}
+		prevUptime = uptime
+	}
+	return restarts, nil
+}
+
+// TARPNStatLinkSummary aggregates TARPNstat broadcasts for one callsign on
+// one port over a time window.
+type TARPNStatLinkSummary struct {
+	PortNum   int       `json:"portNum"`
+	Callsign  string    `json:"callsign"`
+	Direction string    `json:"direction"`
+	Reports   int       `json:"reports"`
+	UpReports int       `json:"upReports"`
+	LastSeen  time.Time `json:"lastSeen"`
+}
+
+// GetTARPNStatSummary groups TARPNstat rows in [since, until) by direction,
+// port and callsign. For direction 'T' (our own broadcast) the callsign is the
+// neighbour and UpReports/Reports is how often we considered the link up.
+func (s *LinkStatsStorage) GetTARPNStatSummary(since, until time.Time) ([]TARPNStatLinkSummary, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rows, err := s.db.Query(`
+		SELECT direction, port_num, callsign, COUNT(*), SUM(link_up), MAX(timestamp)
+		FROM link_stats_tarpnstat
+		WHERE timestamp >= ? AND timestamp < ?
+		GROUP BY direction, port_num, callsign
+		ORDER BY port_num ASC, callsign ASC`,
+		since.UTC().Format(time.RFC3339), until.UTC().Format(time.RFC3339))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query TARPNstat summary: %w", err)
+	}
+	defer rows.Close()
+
+	var result []TARPNStatLinkSummary
+	for rows.Next() {
+		var r TARPNStatLinkSummary
+		var ts string
+		if err := rows.Scan(&r.Direction, &r.PortNum, &r.Callsign, &r.Reports, &r.UpReports, &ts); err != nil {
+			return nil, fmt.Errorf("failed to scan TARPNstat summary: %w", err)
+		}
+		r.LastSeen, _ = time.Parse(time.RFC3339, ts)
+		result = append(result, r)
+	}
+	return result, nil
+}
+
+// NeighborCQSummary counts [LS1] CQ broadcasts heard from one neighbour on
+// one local port over a time window.
+type NeighborCQSummary struct {
+	RxPort   int       `json:"rxPort"`
+	Callsign string    `json:"callsign"`
+	Heard    int       `json:"heard"`
+	LastSeen time.Time `json:"lastSeen"`
+}
+
+// GetNeighborCQSummary groups link_stats_neighbor rows in [since, until) by
+// receiving port and callsign.
+func (s *LinkStatsStorage) GetNeighborCQSummary(since, until time.Time) ([]NeighborCQSummary, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rows, err := s.db.Query(`
+		SELECT rx_port, callsign, COUNT(*), MAX(timestamp)
+		FROM link_stats_neighbor
+		WHERE timestamp >= ? AND timestamp < ?
+		GROUP BY rx_port, callsign
+		ORDER BY rx_port ASC, callsign ASC`,
+		since.UTC().Format(time.RFC3339), until.UTC().Format(time.RFC3339))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query neighbor CQ summary: %w", err)
+	}
+	defer rows.Close()
+
+	var result []NeighborCQSummary
+	for rows.Next() {
+		var r NeighborCQSummary
+		var ts string
+		if err := rows.Scan(&r.RxPort, &r.Callsign, &r.Heard, &ts); err != nil {
+			return nil, fmt.Errorf("failed to scan neighbor CQ summary: %w", err)
+		}
+		r.LastSeen, _ = time.Parse(time.RFC3339, ts)
+		result = append(result, r)
+	}
+	return result, nil
+}
+
 // Close closes the database connection
 func (s *LinkStatsStorage) Close() error {
 	return s.db.Close()
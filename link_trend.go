@@ -0,0 +1,373 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Metrics the trend analyser watches.
+const (
+	TrendTimeouts   = "timeouts"
+	TrendCRCErrors  = "crc_errors"
+	TrendRetryRatio = "retry_ratio"
+)
+
+// TrendConfig controls link degradation detection.
+type TrendConfig struct {
+	// BaselineWeeks is how much history before the window the baseline is
+	// fitted to.
+	BaselineWeeks int
+	// Window is the recent period compared against the baseline.
+	Window time.Duration
+	// Factor is how many times the baseline a metric must reach to be
+	// flagged.
+	Factor float64
+	// MinEvents is the fewest timeouts or CRC errors in the window worth
+	// flagging, so that 1 against an expected 0.2 is not a "5x" finding.
+	MinEvents int64
+	// MinSent is the fewest frames sent in the window for the retry ratio to
+	// be judged.
+	MinSent int64
+	// MinBaselineDays is how many days of history an hour of the day needs
+	// before it has a baseline.
+	MinBaselineDays int
+}
+
+// DefaultTrendConfig compares the last day against the four weeks before it.
+func DefaultTrendConfig() TrendConfig {
+	return TrendConfig{
+		BaselineWeeks:   4,
+		Window:          24 * time.Hour,
+		Factor:          2,
+		MinEvents:       10,
+		MinSent:         500,
+		MinBaselineDays: 7,
+	}
+}
+
+// TrendFinding is one port metric that has drifted above its baseline.
+type TrendFinding struct {
+	PortNum int    `json:"portNum"`
+	Metric  string `json:"metric"`
+	// Recent is the metric over the window; Baseline is what the baseline
+	// predicts for the same hours of the day. Both are counts, except for
+	// the retry ratio, which is a percentage of frames sent.
+	Recent   float64 `json:"recent"`
+	Baseline float64 `json:"baseline"`
+	// Ratio is Recent/Baseline, or +Inf (sent as 0) if the baseline is zero.
+	Ratio float64 `json:"ratio"`
+	// HoursAbove of HoursCovered window hours were above their hour's
+	// baseline. A finding needs at least half, so that one bad hour does not
+	// pass for a trend.
+	HoursAbove   int       `json:"hoursAbove"`
+	HoursCovered int       `json:"hoursCovered"`
+	Since        time.Time `json:"since"`
+	Until        time.Time `json:"until"`
+	Message      string    `json:"message"`
+}
+
+func (f TrendFinding) key() string {
+	return fmt.Sprintf("%d/%s", f.PortNum, f.Metric)
+}
+
+// MarshalJSON replaces an infinite ratio with 0, which JSON cannot carry.
+func (f TrendFinding) MarshalJSON() ([]byte, error) {
+	type plain TrendFinding
+	p := plain(f)
+	if math.IsInf(p.Ratio, 0) {
+		p.Ratio = 0
+	}
+	return json.Marshal(p)
+}
+
+// trendHour is one hour's counters for one port.
+type trendHour struct {
+	timeouts, crc, retries, sent float64
+}
+
+// AnalyseLinkTrends compares each port's last cfg.Window of complete hours
+// with a baseline of the same hours of the day over the weeks before, and
+// returns the metrics that have drifted up by cfg.Factor or more. Hours of
+// the day are taken in now's location, since traffic follows the operators'
+// day rather than UTC.
+func AnalyseLinkTrends(storage *LinkStatsStorage, now time.Time, cfg TrendConfig) ([]TrendFinding, error) {
+	windowEnd := now.Truncate(time.Hour)
+	windowStart := windowEnd.Add(-cfg.Window)
+	baseStart := windowStart.Add(-time.Duration(cfg.BaselineWeeks) * 7 * 24 * time.Hour)
+
+	res, err := storage.Query(nil,
+		[]string{MetricL2Sent, MetricL2Timeouts, MetricREJRxed, MetricRXCRCErrors},
+		baseStart, windowEnd, time.Hour)
+	if err != nil {
+		return nil, err
+	}
+
+	var findings []TrendFinding
+	for _, series := range res.Series {
+		// Skip NetROM virtual port
+		if series.PortNum == 32 {
+			continue
+		}
+
+		var baseline [24][]trendHour
+		type recentHour struct {
+			hod int
+			trendHour
+		}
+		var recent []recentHour
+		for _, pt := range series.Points {
+			if pt.Missing {
+				continue
+			}
+			h := trendHour{
+				timeouts: pt.Values[MetricL2Timeouts],
+				crc:      pt.Values[MetricRXCRCErrors],
+				retries:  pt.Values[MetricL2Timeouts] + pt.Values[MetricREJRxed],
+				sent:     pt.Values[MetricL2Sent],
+			}
+			hod := pt.BucketStart.In(now.Location()).Hour()
+			if pt.BucketStart.Before(windowStart) {
+				baseline[hod] = append(baseline[hod], h)
+			} else {
+				recent = append(recent, recentHour{hod, h})
+			}
+		}
+
+		// Per hour of day baseline: mean counts, and the pooled retry ratio.
+		var mean [24]trendHour
+		var fitted [24]bool
+		for hod, hours := range baseline {
+			if len(hours) < cfg.MinBaselineDays {
+				continue
+			}
+			fitted[hod] = true
+			for _, h := range hours {
+				mean[hod].timeouts += h.timeouts
+				mean[hod].crc += h.crc
+				mean[hod].retries += h.retries
+				mean[hod].sent += h.sent
+			}
+			n := float64(len(hours))
+			mean[hod].timeouts /= n
+			mean[hod].crc /= n
+			mean[hod].retries /= n
+			mean[hod].sent /= n
+		}
+
+		var covered []recentHour
+		for _, h := range recent {
+			if fitted[h.hod] {
+				covered = append(covered, h)
+			}
+		}
+		if len(covered) == 0 || float64(len(covered)) < cfg.Window.Hours()/2 {
+			continue
+		}
+
+		newFinding := func(metric string, actual, expected float64, above int) TrendFinding {
+			ratio := math.Inf(1)
+			if expected > 0 {
+				ratio = actual / expected
+			}
+			return TrendFinding{
+				PortNum:      series.PortNum,
+				Metric:       metric,
+				Recent:       actual,
+				Baseline:     expected,
+				Ratio:        ratio,
+				HoursAbove:   above,
+				HoursCovered: len(covered),
+				Since:        windowStart,
+				Until:        windowEnd,
+			}
+		}
+		flagged := func(actual, expected float64, above int) bool {
+			return actual >= cfg.Factor*expected && above*2 >= len(covered)
+		}
+
+		// Timeouts and CRC errors: counts against the mean for each hour.
+		for _, m := range []struct {
+			metric string
+			get    func(trendHour) float64
+		}{
+			{TrendTimeouts, func(h trendHour) float64 { return h.timeouts }},
+			{TrendCRCErrors, func(h trendHour) float64 { return h.crc }},
+		} {
+			var actual, expected float64
+			above := 0
+			for _, h := range covered {
+				v, base := m.get(h.trendHour), m.get(mean[h.hod])
+				actual += v
+				expected += base
+				if v > base {
+					above++
+				}
+			}
+			if actual >= float64(cfg.MinEvents) && flagged(actual, expected, above) {
+				findings = append(findings, newFinding(m.metric, actual, expected, above))
+			}
+		}
+
+		// Retry ratio: retries against what the baseline ratio for each hour
+		// predicts at the traffic actually sent, so a busy day is not a
+		// degraded one.
+		var retries, expectedRetries, sent float64
+		above := 0
+		for _, h := range covered {
+			baseRatio := 0.0
+			if mean[h.hod].sent > 0 {
+				baseRatio = mean[h.hod].retries / mean[h.hod].sent
+			}
+			retries += h.retries
+			expectedRetries += h.sent * baseRatio
+			sent += h.sent
+			if h.sent > 0 && h.retries/h.sent > baseRatio {
+				above++
+			}
+		}
+		if sent >= float64(cfg.MinSent) && retries >= float64(cfg.MinEvents) && flagged(retries, expectedRetries, above) {
+			f := newFinding(TrendRetryRatio, retries/sent*100, expectedRetries/sent*100, above)
+			findings = append(findings, f)
+		}
+	}
+
+	for i := range findings {
+		findings[i].Message = trendMessage(findings[i], cfg)
+	}
+	sort.Slice(findings, func(i, j int) bool {
+		if findings[i].PortNum != findings[j].PortNum {
+			return findings[i].PortNum < findings[j].PortNum
+		}
+		return findings[i].Metric < findings[j].Metric
+	})
+	return findings, nil
+}
+
+// trendMessage describes a finding in one line, e.g. "port 2 timeouts up
+// 3.0x versus the 4-week baseline for these hours (45 vs 15 expected)".
+func trendMessage(f TrendFinding, cfg TrendConfig) string {
+	var what, values string
+	switch f.Metric {
+	case TrendTimeouts:
+		what = "timeouts"
+		values = fmt.Sprintf("%.0f vs %.0f expected", f.Recent, f.Baseline)
+	case TrendCRCErrors:
+		what = "CRC errors"
+		values = fmt.Sprintf("%.0f vs %.0f expected", f.Recent, f.Baseline)
+	case TrendRetryRatio:
+		what = "retry ratio"
+		values = fmt.Sprintf("%.1f%% vs %.1f%% expected", f.Recent, f.Baseline)
+	}
+	up := "up from none"
+	if !math.IsInf(f.Ratio, 0) {
+		up = fmt.Sprintf("up %.1fx", f.Ratio)
+	}
+	return fmt.Sprintf("port %d %s %s versus the %d-week baseline for these hours (%s, last %s)",
+		f.PortNum, what, up, cfg.BaselineWeeks, values, formatTrendWindow(f.Until.Sub(f.Since)))
+}
+
+func formatTrendWindow(d time.Duration) string {
+	if d%(24*time.Hour) == 0 {
+		return fmt.Sprintf("%dd", int(d/(24*time.Hour)))
+	}
+	return fmt.Sprintf("%dh", int(d/time.Hour))
+}
+
+// TrendEvent is published when a finding first appears ("degraded") and
+// when it no longer holds ("recovered").
+type TrendEvent struct {
+	Type    string       `json:"type"`
+	Finding TrendFinding `json:"finding"`
+	At      time.Time    `json:"at"`
+}
+
+// TrendAnalyser reruns AnalyseLinkTrends every hour and publishes changes.
+type TrendAnalyser struct {
+	storage *LinkStatsStorage
+	config  TrendConfig
+	publish func(TrendEvent)
+
+	mu       sync.RWMutex
+	findings []TrendFinding
+}
+
+// NewTrendAnalyser creates an analyser. publish may be nil.
+func NewTrendAnalyser(storage *LinkStatsStorage, config TrendConfig, publish func(TrendEvent)) *TrendAnalyser {
+	return &TrendAnalyser{storage: storage, config: config, publish: publish}
+}
+
+// Findings returns the findings from the latest run.
+func (a *TrendAnalyser) Findings() []TrendFinding {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return append([]TrendFinding(nil), a.findings...)
+}
+
+// Run analyses shortly after startup, once the collector has had a chance
+// to compact, then a few minutes past each hour.
+func (a *TrendAnalyser) Run(ctx context.Context) {
+	timer := time.NewTimer(2 * time.Minute)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+		a.analyse(time.Now())
+		now := time.Now()
+		timer.Reset(now.Truncate(time.Hour).Add(time.Hour + 5*time.Minute).Sub(now))
+	}
+}
+
+// analyse runs one analysis and publishes what changed since the last.
+func (a *TrendAnalyser) analyse(now time.Time) {
+	findings, err := AnalyseLinkTrends(a.storage, now, a.config)
+	if err != nil {
+		statsLog.Warnw("Trend analysis failed", "error", err)
+		return
+	}
+
+	a.mu.Lock()
+	previous := make(map[string]TrendFinding, len(a.findings))
+	for _, f := range a.findings {
+		previous[f.key()] = f
+	}
+	a.findings = findings
+	a.mu.Unlock()
+
+	for _, f := range findings {
+		if _, ok := previous[f.key()]; ok {
+			delete(previous, f.key())
+			continue
+		}
+		statsLog.Warnw("Link degradation", "port", f.PortNum, "metric", f.Metric, "detail", f.Message)
+		a.emit(TrendEvent{Type: "degraded", Finding: f, At: now})
+	}
+	for _, f := range previous {
+		statsLog.Infow("Link degradation cleared", "port", f.PortNum, "metric", f.Metric)
+		a.emit(TrendEvent{Type: "recovered", Finding: f, At: now})
+	}
+}
+
+func (a *TrendAnalyser) emit(ev TrendEvent) {
+	if a.publish != nil {
+		a.publish(ev)
+	}
+}
+
+// trendAnalyserRef is set in main for the WebSocket handlers.
+var trendAnalyserRef *TrendAnalyser
+
+// BroadcastTrendEvent sends a trend event to all WebSocket clients.
+func BroadcastTrendEvent(ev TrendEvent) {
+	msg := LinkTrendEventMessage{Type: "link_trend_event", Event: ev}
+	if data, err := json.Marshal(msg); err == nil {
+		broadcastDirect(string(data))
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// insertTrendHour writes an hourly row with the counters the trend analyser
+// reads.
+func insertTrendHour(t *testing.T, s *LinkStatsStorage, hour time.Time, port int, sent, timeouts, crc int64) {
+	t.Helper()
+	_, err := s.db.Exec(`
+		INSERT INTO link_stats_hourly
+			(hour_start, port_num, d_l2_sent, d_l2_timeouts, d_rx_crc_errors, sample_count)
+		VALUES (?, ?, ?, ?, ?, 60)`,
+		hour.UTC().Format(time.RFC3339), port, sent, timeouts, crc)
+	if err != nil {
+		t.Fatalf("insert hourly: %v", err)
+	}
+}
+
+// Port 2's timeouts triple over the last day; port 3 is steady. Only port 2
+// is flagged, and only for timeouts and the retry ratio they drive.
+func TestAnalyseLinkTrendsFlagsDrift(t *testing.T) {
+	s := newTestStorage(t)
+	now := time.Date(2025, 6, 1, 0, 30, 0, 0, time.UTC)
+	windowStart := now.Truncate(time.Hour).Add(-24 * time.Hour)
+
+	for h := windowStart.Add(-28 * 24 * time.Hour); h.Before(now.Truncate(time.Hour)); h = h.Add(time.Hour) {
+		timeouts := int64(2)
+		if !h.Before(windowStart) {
+			timeouts = 6
+		}
+		insertTrendHour(t, s, h, 2, 100, timeouts, 1)
+		insertTrendHour(t, s, h, 3, 100, 2, 1)
+	}
+
+	findings, err := AnalyseLinkTrends(s, now, DefaultTrendConfig())
+	if err != nil {
+		t.Fatalf("AnalyseLinkTrends: %v", err)
+	}
+	if len(findings) != 2 {
+		t.Fatalf("got %d findings, want 2: %+v", len(findings), findings)
+	}
+	for _, f := range findings {
+		if f.PortNum != 2 {
+			t.Errorf("finding for port %d, want port 2 only", f.PortNum)
+		}
+		if f.Ratio != 3 {
+			t.Errorf("%s ratio = %v, want 3", f.Metric, f.Ratio)
+		}
+		if f.HoursAbove != 24 || f.HoursCovered != 24 {
+			t.Errorf("%s hours above = %d of %d, want 24 of 24", f.Metric, f.HoursAbove, f.HoursCovered)
+		}
+	}
+	if findings[0].Metric != TrendRetryRatio || findings[1].Metric != TrendTimeouts {
+		t.Errorf("metrics = %s, %s; want retry_ratio, timeouts", findings[0].Metric, findings[1].Metric)
+	}
+	if want := "port 2 timeouts up 3.0x versus the 4-week baseline"; !strings.HasPrefix(findings[1].Message, want) {
+		t.Errorf("message = %q, want prefix %q", findings[1].Message, want)
+	}
+}
+
+// A port that is always bad at the same hour of the day (a nightly beacon
+// storm, say) is not flagged for it, and a single bad hour is not a trend.
+func TestAnalyseLinkTrendsTimeOfDay(t *testing.T) {
+	s := newTestStorage(t)
+	now := time.Date(2025, 6, 1, 0, 30, 0, 0, time.UTC)
+	windowStart := now.Truncate(time.Hour).Add(-24 * time.Hour)
+
+	for h := windowStart.Add(-28 * 24 * time.Hour); h.Before(now.Truncate(time.Hour)); h = h.Add(time.Hour) {
+		timeouts := int64(1)
+		if h.Hour() == 3 {
+			timeouts = 40
+		}
+		// One awful hour in the window
+		if h.Equal(windowStart.Add(12 * time.Hour)) {
+			timeouts = 200
+		}
+		insertTrendHour(t, s, h, 1, 100, timeouts, 0)
+	}
+
+	findings, err := AnalyseLinkTrends(s, now, DefaultTrendConfig())
+	if err != nil {
+		t.Fatalf("AnalyseLinkTrends: %v", err)
+	}
+	if len(findings) != 0 {
+		t.Errorf("got findings %+v, want none", findings)
+	}
+}
+
+// The analyser publishes a finding once when it appears and once when it
+// clears.
+func TestTrendAnalyserEvents(t *testing.T) {
+	s := newTestStorage(t)
+	now := time.Date(2025, 6, 1, 0, 30, 0, 0, time.UTC)
+	windowStart := now.Truncate(time.Hour).Add(-24 * time.Hour)
+
+	for h := windowStart.Add(-28 * 24 * time.Hour); h.Before(now.Truncate(time.Hour)); h = h.Add(time.Hour) {
+		crc := int64(0)
+		if !h.Before(windowStart) {
+			crc = 5
+		}
+		insertTrendHour(t, s, h, 1, 100, 0, crc)
+	}
+
+	var events []TrendEvent
+	a := NewTrendAnalyser(s, DefaultTrendConfig(), func(ev TrendEvent) { events = append(events, ev) })
+
+	a.analyse(now)
+	a.analyse(now)
+	if len(events) != 1 || events[0].Type != "degraded" || events[0].Finding.Metric != TrendCRCErrors {
+		t.Fatalf("events = %+v, want one degraded crc_errors", events)
+	}
+	if len(a.Findings()) != 1 {
+		t.Errorf("Findings() = %+v, want one", a.Findings())
+	}
+
+	// Four weeks on, with nothing recorded since, the finding no longer holds
+	a.analyse(now.Add(28 * 24 * time.Hour))
+	if len(events) != 2 || events[1].Type != "recovered" {
+		t.Errorf("events = %+v, want degraded then recovered", events)
+	}
+}
@@ -27,6 +27,9 @@ var (
 	neighborLog  *zap.SugaredLogger
 	oarcLog      *zap.SugaredLogger
 	sessionLog   *zap.SugaredLogger
+	telnetLog    *zap.SugaredLogger
+	authLog      *zap.SugaredLogger
+	auditLog     *zap.SugaredLogger
 )
 
 func init() {
@@ -57,6 +60,9 @@ func init() {
 	neighborLog = baseLogger.Named("NEIGHBOR").Sugar()
 	oarcLog = baseLogger.Named("OARC").Sugar()
 	sessionLog = baseLogger.Named("SESSION").Sugar()
+	telnetLog = baseLogger.Named("TELNET").Sugar()
+	authLog = baseLogger.Named("AUTH").Sugar()
+	auditLog = baseLogger.Named("AUDIT").Sugar()
 }
 
 // SetDebugLogging enables or disables debug logging globally
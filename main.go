@@ -11,11 +11,13 @@ import (
 	"net"
 	"net/http"
 	"os"
+	"os/signal"
 	"regexp"
 	"runtime/debug"
 	"strconv"
 	"strings"
 	"sync/atomic"
+	"syscall"
 	"time"
 )
 
@@ -69,9 +71,54 @@ var (
 	statsInterval   int
 	statsNoCQ       bool
 	statsNoBulletin bool
+	statsReportTo   string
+
+	// CQ broadcast schedule
+	statsCQInterval     time.Duration
+	statsCQJitter       time.Duration
+	statsCQPorts        string
+	statsCQQuiet        string
+	statsCQBusyPct      int
+	statsCQHeard        time.Duration
+	statsTARPNStatEvery time.Duration
+
+	// Telnet session pool
+	telnetMaxSessions int
+	telnetIdleTimeout time.Duration
 
 	// OARC listener configuration
-	oarcPort int
+	oarcPort           int
+	oarcBind           string
+	oarcTCPPort        int
+	oarcAllow          string
+	oarcForward        string
+	oarcForwardQueue   int
+	oarcCapture        string
+	oarcReplay         string
+	oarcReplaySpeed    float64
+	sessionHistoryDays int
+
+	// Session tracker persistence
+	sessionStatePath   string
+	sessionStateMaxAge time.Duration
+	sessionReconcile   bool
+
+	// Web authentication
+	usersPath      string
+	addUser        string
+	addUserRole    string
+	deleteUser     string
+	allowedOrigins string
+
+	// Audit log of operator actions
+	auditPath string
+	auditDays int
+
+	// HTTP server
+	listenAddrs string
+	tlsCert     string
+	tlsKey      string
+	basePath    string
 
 	// Debug logging
 	debugMode bool
@@ -351,6 +398,15 @@ func handleConnection(ctx context.Context, conn net.Conn) error {
 						RouteColor: hashCallsign(matches[3]),
 					}
 
+					// Note receive activity per port for the CQ scheduler,
+					// and the sending station for the station directory
+					if matches[2] == "R" {
+						if portNum, err := strconv.Atoi(matches[4]); err == nil {
+							RecordPortHeard(portNum)
+							stationsHeard.Record(strings.SplitN(matches[3], ">", 2)[0], portNum, time.Now())
+						}
+					}
+
 					// Enrich with frame type from control field parsing
 					if parsed := ParseFrameControl(matches[5]); parsed != nil {
 						logMsgData.FrameType = parsed.FrameType
@@ -488,15 +544,61 @@ func main() {
 	flag.IntVar(&statsInterval, "stats-interval", 60, "stats polling interval in seconds")
 	flag.BoolVar(&statsNoCQ, "stats-no-cq", false, "collect stats but do not broadcast [LS1] link stats via CQ")
 	flag.BoolVar(&statsNoBulletin, "stats-no-bulletin", false, "collect stats but do not post the daily BBS bulletin")
+	flag.DurationVar(&statsCQInterval, "stats-cq-interval", 10*time.Minute, "interval between [LS1] CQ broadcasts on each port")
+	flag.DurationVar(&statsTARPNStatEvery, "stats-tarpnstat-interval", 0, "interval between [TARPNstat V2] CQ broadcasts on each port, replacing send-routes-via-cq (0 = off)")
+	flag.DurationVar(&statsCQJitter, "stats-cq-jitter", 2*time.Minute, "maximum random offset added to each CQ interval")
+	flag.StringVar(&statsCQPorts, "stats-cq-ports", "", "per-port CQ overrides, optionally for one format, e.g. \"3=off,4=20m,5=ls1:on,5=tarpnstat:30m\"")
+	flag.StringVar(&statsCQQuiet, "stats-cq-quiet", "", "local time window with no CQ broadcasts, e.g. \"22:00-07:00\"")
+	flag.IntVar(&statsCQBusyPct, "stats-cq-busy", 50, "skip a port's CQ while its channel busy % is at or above this (0 = never skip)")
+	flag.DurationVar(&statsCQHeard, "stats-cq-heard", 30*time.Second, "skip a port's CQ if a frame was heard on it this recently (0 = never skip)")
+	flag.StringVar(&statsReportTo, "stats-report-to", "", "callsign to send the daily network report to as BBS mail (disabled if empty)")
+
+	// Telnet session pool flags
+	flag.IntVar(&telnetMaxSessions, "telnet-max-sessions", 4, "maximum telnet sessions open to LinBPQ at once, shared by stats, CQs, bulletins, node console and BBS")
+	flag.DurationVar(&telnetIdleTimeout, "telnet-idle-timeout", 5*time.Minute, "close pooled telnet sessions unused for this long (keep below LinBPQ's L4 idle timeout)")
 
 	// OARC listener flag
 	flag.IntVar(&oarcPort, "oarc-port", 13579, "UDP port for OARC API events from LinBPQ")
+	flag.StringVar(&oarcBind, "oarc-bind", "", "address to accept OARC events on (default all interfaces)")
+	flag.IntVar(&oarcTCPPort, "oarc-tcp-port", 0, "also accept newline-delimited OARC JSON over TCP on this port (0 = off)")
+	flag.StringVar(&oarcAllow, "oarc-allow", "", "comma-separated source IPs or CIDRs to accept OARC events from (default any)")
+	flag.StringVar(&oarcForward, "oarc-forward", "", "comma-separated targets to re-send OARC events to, e.g. udp://127.0.0.1:13580,tcp://host:9000?types=LinkUpEvent+LinkDownEvent")
+	flag.IntVar(&oarcForwardQueue, "oarc-forward-queue", defaultOARCForwardQueue, "OARC events buffered per forward target before dropping")
+	flag.StringVar(&oarcCapture, "oarc-capture", "", "append every OARC event received, with its receive time, to this file")
+	flag.StringVar(&oarcReplay, "oarc-replay", "", "replay OARC events from a capture file on startup")
+	flag.Float64Var(&oarcReplaySpeed, "oarc-replay-speed", 1, "replay timing: 1 = as captured, 2 = twice as fast, 0 = no delays")
+	flag.IntVar(&sessionHistoryDays, "session-history-days", 365, "days of finished sessions to keep in the database")
+	flag.StringVar(&sessionStatePath, "session-state", "tarpn-mon-sessions.json", "file to save live sessions to across restarts (empty = off)")
+	flag.DurationVar(&sessionStateMaxAge, "session-state-max-age", 10*time.Minute, "ignore saved sessions older than this on startup")
+	flag.BoolVar(&sessionReconcile, "session-reconcile", true, "on startup, check sessions against the node's LINKS and CIRCUITS (needs -stats)")
+
+	// Web authentication flags
+	flag.StringVar(&usersPath, "users", "tarpn-mon-users.json", "file of web UI users; while it has none, the web UI and APIs are open to anyone")
+	flag.StringVar(&addUser, "add-user", "", "create or update this web user, reading the password from standard input, and exit")
+	flag.StringVar(&addUserRole, "add-user-role", string(RoleAdmin), "role for -add-user: viewer, operator or admin")
+	flag.StringVar(&deleteUser, "delete-user", "", "delete this web user and exit")
+	flag.StringVar(&auditPath, "audit-db", "audit.db", "SQLite file to record operator actions in: node commands, chat and BBS sends, feature and settings changes")
+	flag.IntVar(&auditDays, "audit-days", 365, "days of operator actions to keep in the audit log (0 = keep them all)")
+	flag.StringVar(&allowedOrigins, "allowed-origins", "", "comma-separated origins (e.g. https://tarpn.example.org) allowed to open WebSockets besides the UI's own; * allows any")
+
+	// HTTP server flags
+	flag.StringVar(&listenAddrs, "listen", ":8212", "comma-separated addresses to serve the web UI on: host:port, [ipv6]:port or unix:/path/to.sock")
+	flag.StringVar(&tlsCert, "tls-cert", "", "TLS certificate file; with -tls-key, TCP addresses are served over HTTPS and renewed files are picked up without a restart")
+	flag.StringVar(&tlsKey, "tls-key", "", "TLS private key file for -tls-cert")
+	flag.StringVar(&basePath, "base-path", "", "path prefix when served behind a reverse proxy, e.g. /tarpn/")
+
+	// WebSocket client queue flags
+	flag.IntVar(&wsQueueSize, "ws-queue", wsQueueSize, "messages each WebSocket client may have waiting to be sent")
+	flag.DurationVar(&wsWriteTimeout, "ws-write-timeout", wsWriteTimeout, "disconnect a WebSocket client whose write stalls this long")
+	flag.StringVar(&wsOverflowPolicy, "ws-overflow", wsOverflowPolicy, "when a client's queue is full: drop-oldest (drop its oldest monitor, chat or node lines; it re-syncs) or disconnect")
 
 	// Debug flag
 	flag.BoolVar(&debugMode, "debug", false, "enable verbose debug logging")
 
 	// Config file flag
 	configPath := flag.String("config", "tarpn-mon.json", "path to JSON config file")
+	secretsPath := flag.String("secrets", "tarpn-mon-secrets.json", "file to keep feature passwords in, readable only by its owner")
+	secretKeyPath := flag.String("secret-key-file", "", "encrypt the secrets file with the key in this file, creating it if missing (empty = not encrypted)")
 
 	flag.Parse()
 
@@ -512,8 +614,43 @@ func main() {
 		os.Exit(0)
 	}
 
+	if wsOverflowPolicy != wsOverflowDropOldest && wsOverflowPolicy != wsOverflowDisconnect {
+		mainLog.Fatalw("Invalid -ws-overflow", "value", wsOverflowPolicy)
+	}
+	if wsQueueSize < 1 {
+		mainLog.Fatalw("Invalid -ws-queue", "value", wsQueueSize)
+	}
+
+	users := NewUserStore(usersPath)
+	if err := users.Load(); err != nil {
+		mainLog.Fatalw("Failed to load users file", "path", usersPath, "error", err)
+	}
+	if addUser != "" || deleteUser != "" {
+		if err := manageUsers(users); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	webAuthRef = NewWebAuth(users, strings.Split(allowedOrigins, ","))
+	if !webAuthRef.Enabled() {
+		mainLog.Warnw("No web users configured; the web UI and APIs are open to anyone who can reach them. Create an admin with -add-user", "users", usersPath)
+	}
+
+	// Load passwords before settings, which fill them in from here. A
+	// failure is fatal, as carrying on would save over them.
+	secrets := NewSecretStore(*secretsPath)
+	if *secretKeyPath != "" {
+		if err := secrets.UseKeyFile(*secretKeyPath); err != nil {
+			mainLog.Fatalw("Failed to load secret key", "path", *secretKeyPath, "error", err)
+		}
+	}
+	if err := secrets.Load(); err != nil {
+		mainLog.Fatalw("Failed to load secrets file", "path", *secretsPath, "error", err)
+	}
+
 	// Load persistent settings
-	appSettings = NewAppSettings(*configPath)
+	appSettings = NewAppSettings(*configPath, secrets)
 	if err := appSettings.Load(); err != nil {
 		mainLog.Warnw("Failed to load settings file", "path", *configPath, "error", err)
 	}
@@ -587,12 +724,50 @@ func main() {
 	dataBuffer = newCircularBuffer(bufferSize)
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
+	defer SyncLoggers()
+
+	// Stop on SIGINT or SIGTERM by cancelling ctx, so that main returns and
+	// its deferred closes run
+	shutdown := make(chan os.Signal, 1)
+	signal.Notify(shutdown, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-shutdown
+		mainLog.Infow("Shutting down", "signal", sig.String())
+		cancel()
+	}()
+
+	// One pool of logged-in telnet sessions for everything that talks to
+	// the node, so that each does not hold or churn its own LinBPQ stream.
+	poolConfig := DefaultTelnetPoolConfig()
+	poolConfig.MaxSessions = telnetMaxSessions
+	poolConfig.IdleTimeout = telnetIdleTimeout
+	telnetPool = NewTelnetPool(poolConfig)
+	go telnetPool.Run(ctx)
+
+	// Open the audit log before the routes that record in it serve. Without
+	// it, actions would go unrecorded in a period its reports vouch for.
+	auditStore, err := NewAuditStore(auditPath)
+	if err != nil {
+		mainLog.Fatalw("Failed to open audit log", "path", auditPath, "error", err)
+	}
+	defer auditStore.Close()
+	auditStoreRef = auditStore
+	if auditDays > 0 {
+		go runAuditPurge(ctx, auditStore, time.Duration(auditDays)*24*time.Hour)
+	}
 
 	// Set up HTTP routes and WebSocket handler
+	httpBasePath = normalizeBasePath(basePath)
 	setupRoutes()
+	setupAuthRoutes()
 	setupChatRoutes()
 	setupBBSRoutes()
 	setupNodeRoutes()
+	setupReportRoutes()
+	setupSessionHistoryRoutes()
+	setupStationRoutes()
+	setupOARCRoutes()
+	setupRESTRoutes()
 
 	// Auto-connect features with saved settings
 	autoConnectFeatures()
@@ -616,6 +791,23 @@ func main() {
 		}
 		interval := time.Duration(statsInterval) * time.Second
 
+		cqPorts, err := parseCQPorts(statsCQPorts)
+		if err != nil {
+			mainLog.Fatalw("Invalid -stats-cq-ports", "error", err)
+		}
+		quietStart, quietEnd, err := parseQuietHours(statsCQQuiet)
+		if err != nil {
+			mainLog.Fatalw("Invalid -stats-cq-quiet", "error", err)
+		}
+		cqSchedule := DefaultCQScheduleConfig()
+		cqSchedule.LS1Interval = statsCQInterval
+		cqSchedule.TARPNStatInterval = statsTARPNStatEvery
+		cqSchedule.Jitter = statsCQJitter
+		cqSchedule.Ports = cqPorts
+		cqSchedule.QuietStart, cqSchedule.QuietEnd = quietStart, quietEnd
+		cqSchedule.BusyPct = statsCQBusyPct
+		cqSchedule.HeardWithin = statsCQHeard
+
 		collector := NewLinkStatsCollector(LinkStatsCollectorConfig{
 			Hostname:        hostname,
 			Port:            statsPort,
@@ -624,6 +816,8 @@ func main() {
 			PollInterval:    interval,
 			DisableCQ:       statsNoCQ,
 			DisableBulletin: statsNoBulletin,
+			ReportTo:        strings.ToUpper(statsReportTo),
+			CQSchedule:      cqSchedule,
 		}, storage)
 
 		collector.SetBroadcastFunc(BroadcastLinkStats)
@@ -635,12 +829,89 @@ func main() {
 		mainLog.Infow("Starting link stats collector",
 			"callsign", statsCall, "host", hostname, "port", statsPort, "interval", interval)
 		go collector.Run(ctx)
+
+		// Watch the compacted history for slow link degradation
+		trendAnalyser := NewTrendAnalyser(storage, DefaultTrendConfig(), BroadcastTrendEvent)
+		trendAnalyserRef = trendAnalyser
+		go trendAnalyser.Run(ctx)
 	}
 
 	// Initialize session tracker and OARC listener
 	sessionTracker := NewSessionTracker(200, BroadcastSessionUpdate, sessionLog)
 	sessionTrackerRef = sessionTracker
-	oarcListener := NewOARCListener(oarcPort, sessionTracker, oarcLog)
+	sessionTracker.SetUserSessionFunc(BroadcastUserSessionUpdate)
+	sessionTracker.SetAnomalyFunc(BroadcastLinkAnomaly)
+	go runRTTRecorder(ctx, sessionTracker, storage)
+	if storage != nil {
+		// Keep finished sessions beyond the tracker's in-memory window
+		sessionTracker.SetEndFunc(func(sess *Session) {
+			if err := storage.SaveSessionHistory(sess); err != nil {
+				sessionLog.Warnw("Failed to save session history", "id", sess.ID, "error", err)
+			}
+		})
+		go runSessionHistoryPurge(ctx, storage, time.Duration(sessionHistoryDays)*24*time.Hour)
+	} else {
+		mainLog.Warnw("Finished sessions are not kept: session history needs the link stats database")
+	}
+	if sessionStatePath != "" {
+		state, err := LoadTrackerState(sessionStatePath)
+		if err != nil {
+			mainLog.Warnw("Failed to load session state", "path", sessionStatePath, "error", err)
+		} else if state != nil {
+			restored := sessionTracker.Restore(state, time.Now(), sessionStateMaxAge)
+			mainLog.Infow("Restored session state", "sessions", restored, "savedAt", state.SavedAt)
+		}
+		go runTrackerPersist(ctx, sessionTracker, sessionStatePath)
+	}
+	if sessionReconcile && linkStatsCollectorRef != nil {
+		go func() {
+			if err := reconcileWithNode(ctx, sessionTracker, linkStatsCollectorRef); err != nil {
+				sessionLog.Warnw("Failed to reconcile sessions with node", "error", err)
+			}
+		}()
+	}
+	oarcAllowFrom, err := ParseAllowList(oarcAllow)
+	if err != nil {
+		mainLog.Fatalw("Invalid -oarc-allow", "error", err)
+	}
+	oarcListener := NewOARCListener(OARCListenerConfig{
+		BindAddr:  oarcBind,
+		Port:      oarcPort,
+		TCPPort:   oarcTCPPort,
+		AllowFrom: oarcAllowFrom,
+	}, sessionTracker, oarcLog)
+	oarcListenerRef = oarcListener
+	oarcTargets, err := ParseOARCTargets(oarcForward)
+	if err != nil {
+		mainLog.Fatalw("Invalid -oarc-forward", "error", err)
+	}
+	oarcFanout := NewOARCFanout(oarcTargets, oarcForwardQueue)
+	oarcFanoutRef = oarcFanout
+	oarcListener.SetFanout(oarcFanout)
+	if oarcCapture != "" {
+		capture, err := NewOARCCapture(oarcCapture)
+		if err != nil {
+			mainLog.Fatalw("Invalid -oarc-capture", "error", err)
+		}
+		defer capture.Close()
+		oarcListener.SetCapture(capture)
+		mainLog.Infow("Capturing OARC events", "path", oarcCapture)
+	}
+	if oarcReplay != "" {
+		records, err := LoadOARCCapture(oarcReplay)
+		if err != nil {
+			mainLog.Fatalw("Invalid -oarc-replay", "error", err)
+		}
+		go func() {
+			mainLog.Infow("Replaying OARC capture", "path", oarcReplay, "events", len(records), "speed", oarcReplaySpeed)
+			if err := oarcListener.Replay(ctx, records, oarcReplaySpeed); err != nil {
+				mainLog.Warnw("OARC replay stopped", "error", err)
+				return
+			}
+			mainLog.Infow("OARC replay finished", "path", oarcReplay)
+		}()
+	}
+	go oarcFanout.Run(ctx)
 	go func() {
 		if err := oarcListener.Start(ctx); err != nil {
 			mainLog.Errorw("OARC listener failed", "error", err)
@@ -648,14 +919,32 @@ func main() {
 	}()
 
 	// Start the HTTP server
-	go func() {
-		mainLog.Infow("Starting HTTP server", "port", 8212)
-		if err := http.ListenAndServe(":8212", nil); err != nil {
-			mainLog.Fatalw("HTTP server failed", "error", err)
+	httpConfig := HTTPServerConfig{TLSCert: tlsCert, TLSKey: tlsKey, BasePath: httpBasePath}
+	for _, addr := range strings.Split(listenAddrs, ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			httpConfig.Listen = append(httpConfig.Listen, addr)
 		}
-	}()
+	}
+	if _, err := StartHTTPServer(httpConfig, webAuthRef.Middleware(http.DefaultServeMux)); err != nil {
+		mainLog.Fatalw("Failed to start HTTP server", "error", err)
+	}
 
-	// Main connection loop
+	go runMonitorConnection(ctx)
+	<-ctx.Done()
+
+	// Save once more on the way out. Without this a restart loses up to
+	// a minute of session changes.
+	if sessionStatePath != "" {
+		if err := SaveTrackerState(sessionStatePath, sessionTracker); err != nil {
+			mainLog.Warnw("Failed to save session state", "path", sessionStatePath, "error", err)
+		}
+	}
+}
+
+// runMonitorConnection keeps the monitor connection to the node up until
+// ctx is done. A read in progress is not interrupted; main does not wait
+// for it.
+func runMonitorConnection(ctx context.Context) {
 	firstConnect := true
 	for {
 		select {
@@ -700,6 +989,34 @@ func main() {
 	}
 }
 
+// manageUsers carries out -add-user or -delete-user. The password for
+// -add-user is read from the first line of standard input, so it can be
+// piped in rather than left in the shell history.
+func manageUsers(users *UserStore) error {
+	if deleteUser != "" {
+		if err := users.DeleteUser(deleteUser); err != nil {
+			return err
+		}
+		fmt.Printf("Deleted web user %s\n", deleteUser)
+		return nil
+	}
+
+	fmt.Fprintf(os.Stderr, "Password for %s: ", addUser)
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return fmt.Errorf("failed to read password: %w", err)
+	}
+	pw := strings.TrimRight(line, "\r\n")
+	if pw == "" && users.Get(addUser) == nil {
+		return fmt.Errorf("a password is required for a new user")
+	}
+	if err := users.SetUser(addUser, pw, Role(addUserRole)); err != nil {
+		return err
+	}
+	fmt.Printf("Saved web user %s (%s) to %s\n", addUser, addUserRole, usersPath)
+	return nil
+}
+
 // autoConnectFeatures connects features that are enabled in settings with valid credentials.
 func autoConnectFeatures() {
 	for _, name := range []string{"chat", "bbs", "node"} {
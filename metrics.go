@@ -10,10 +10,17 @@ import (
 
 // Metric labels
 const (
-	labelPort     = "port"
-	labelCallsign = "callsign"
-	labelFeature  = "feature"
-	labelState    = "state"
+	labelPort      = "port"
+	labelCallsign  = "callsign"
+	labelFeature   = "feature"
+	labelState     = "state"
+	labelMode      = "mode"
+	labelTarget    = "target"
+	labelType      = "type"
+	labelTransport = "transport"
+	labelStat      = "stat"
+	labelKind      = "kind"
+	labelSocket    = "socket"
 )
 
 var (
@@ -168,6 +175,31 @@ var (
 		},
 	)
 
+	websocketQueueLagSeconds = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "tarpn_websocket_queue_lag_seconds",
+			Help:    "Time WebSocket messages wait in a client's outbound queue before being written",
+			Buckets: []float64{0.001, 0.01, 0.1, 0.5, 1, 5, 10, 30},
+		},
+		[]string{labelSocket},
+	)
+
+	websocketDroppedTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "tarpn_websocket_dropped_messages_total",
+			Help: "Stream messages dropped from a slow client's full outbound queue",
+		},
+		[]string{labelSocket},
+	)
+
+	websocketEvictionsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "tarpn_websocket_evictions_total",
+			Help: "WebSocket clients disconnected because their outbound queue was full",
+		},
+		[]string{labelSocket},
+	)
+
 	// Buffer metrics
 	monitorBufferMessages = prometheus.NewGauge(
 		prometheus.GaugeOpts{
@@ -364,6 +396,120 @@ var (
 		},
 	)
 
+	// Telnet session pool
+	telnetPoolLogins = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "tarpn_telnet_pool_logins_total",
+			Help: "Telnet sessions opened and logged in by the session pool",
+		},
+		[]string{labelMode},
+	)
+
+	telnetPoolLoginFailures = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "tarpn_telnet_pool_login_failures_total",
+			Help: "Telnet session pool connect or login failures",
+		},
+		[]string{labelMode},
+	)
+
+	telnetPoolInUse = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "tarpn_telnet_pool_sessions_in_use",
+			Help: "Telnet sessions currently checked out of the pool",
+		},
+		[]string{labelMode},
+	)
+
+	telnetPoolIdle = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "tarpn_telnet_pool_sessions_idle",
+			Help: "Logged-in telnet sessions waiting in the pool for reuse",
+		},
+	)
+
+	// OARC listener
+	oarcEventsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "tarpn_oarc_events_total",
+			Help: "OARC events received, by @type (unrecognised types count as unknown)",
+		},
+		[]string{labelType},
+	)
+
+	oarcParseFailures = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "tarpn_oarc_parse_failures_total",
+			Help: "OARC events that failed to parse, by @type (invalid = not JSON)",
+		},
+		[]string{labelType},
+	)
+
+	oarcRejectedTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "tarpn_oarc_rejected_total",
+			Help: "OARC datagrams and connections rejected by the source allow-list",
+		},
+		[]string{labelTransport},
+	)
+
+	// Link round-trip time
+	linkRTTSeconds = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "tarpn_link_rtt_seconds",
+			Help: "L2 round-trip time per neighbour from I-frame to ack, over recent frames (stat: min, median, p95)",
+		},
+		[]string{labelPort, labelCallsign, labelStat},
+	)
+
+	// L2 anomalies
+	linkAnomaliesTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "tarpn_link_anomalies_total",
+			Help: "Pathological L2 conditions detected, by kind (sabm_loop, sabm_refused, rnr_storm, stuck_busy, frmr_loop) and the station at fault",
+		},
+		[]string{labelPort, labelCallsign, labelKind},
+	)
+
+	// OARC forwarding and streams
+	oarcForwardSent = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "tarpn_oarc_forward_sent_total",
+			Help: "OARC datagrams re-sent to a forward target",
+		},
+		[]string{labelTarget},
+	)
+
+	oarcForwardDropped = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "tarpn_oarc_forward_dropped_total",
+			Help: "OARC datagrams dropped for a forward target (queue full or write failed)",
+		},
+		[]string{labelTarget},
+	)
+
+	oarcForwardQueued = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "tarpn_oarc_forward_queued",
+			Help: "OARC datagrams waiting to be sent to a forward target",
+		},
+		[]string{labelTarget},
+	)
+
+	oarcStreamClients = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "tarpn_oarc_stream_clients",
+			Help: "HTTP and WebSocket clients streaming OARC events",
+		},
+	)
+
+	oarcStreamDropped = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "tarpn_oarc_stream_dropped_total",
+			Help: "OARC events dropped for stream clients that fell behind",
+		},
+	)
+
 	// Build info
 	buildInfo = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
@@ -401,6 +547,9 @@ func init() {
 		websocketChatClientsTotal,
 		websocketBBSClientsTotal,
 		websocketNodeClientsTotal,
+		websocketQueueLagSeconds,
+		websocketDroppedTotal,
+		websocketEvictionsTotal,
 
 		// Buffer metrics
 		monitorBufferMessages,
@@ -441,6 +590,30 @@ func init() {
 		statsPollsTotal,
 		statsPollErrorsTotal,
 
+		// Telnet session pool
+		telnetPoolLogins,
+		telnetPoolLoginFailures,
+		telnetPoolInUse,
+		telnetPoolIdle,
+
+		// OARC listener
+		oarcEventsTotal,
+		oarcParseFailures,
+		oarcRejectedTotal,
+
+		// OARC forwarding and streams
+		oarcForwardSent,
+		oarcForwardDropped,
+		oarcForwardQueued,
+		oarcStreamClients,
+		oarcStreamDropped,
+
+		// Link round-trip time
+		linkRTTSeconds,
+
+		// L2 anomalies
+		linkAnomaliesTotal,
+
 		// Build info
 		buildInfo,
 	)
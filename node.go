@@ -1,7 +1,6 @@
 package main
 
 import (
-	"bufio"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -34,9 +33,10 @@ type NodeClient struct {
 	callsign string
 	password string
 
-	conn  net.Conn
-	state FeatureState
-	mu    sync.RWMutex
+	session *PoolSession
+	conn    net.Conn // session.Conn(), kept for the read loop and writers
+	state   FeatureState
+	mu      sync.RWMutex
 
 	// Dynamic connection state
 	connectedAt *time.Time
@@ -109,9 +109,19 @@ func (n *NodeClient) Connect() error {
 	n.broadcastStatus()
 	BroadcastFeatureStatus(n.GetStatus())
 
-	conn, err := net.DialTimeout("tcp", addr, 30*time.Second)
+	// The console is interactive, so its session is never handed back to
+	// the pool for reuse; it is discarded on disconnect.
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	session, err := telnetPool.Acquire(ctx, SessionTarget{
+		Hostname: n.hostname,
+		Port:     n.port,
+		Callsign: n.callsign,
+		Password: n.password,
+		Mode:     SessionNode,
+	})
+	cancel()
 	if err != nil {
-		nodeLog.Errorf("TCP connection failed to %s: %v", addr, err)
+		nodeLog.Errorf("Connection failed to %s: %v", addr, err)
 		n.mu.Lock()
 		n.state = StateError
 		n.lastError = fmt.Sprintf("failed to connect to node: %v", err)
@@ -120,20 +130,22 @@ func (n *NodeClient) Connect() error {
 		BroadcastFeatureStatus(n.GetStatus())
 		return fmt.Errorf("failed to connect to node: %w", err)
 	}
-	nodeLog.Debugf("TCP connection established to %s", addr)
+	nodeLog.Debugf("Logged in to %s", addr)
 
 	n.mu.Lock()
-	n.conn = conn
+	n.session = session
+	n.conn = session.Conn()
 	n.mu.Unlock()
 
 	// Initialize the connection
-	nodeLog.Debugf("Starting authentication sequence")
+	nodeLog.Debugf("Starting console initialisation")
 	if err := n.initConnection(); err != nil {
-		nodeLog.Errorf("Authentication/init failed: %v", err)
-		conn.Close()
+		nodeLog.Errorf("Init failed: %v", err)
+		session.Discard()
 		n.mu.Lock()
 		n.state = StateError
 		n.lastError = err.Error()
+		n.session = nil
 		n.conn = nil
 		n.mu.Unlock()
 		n.broadcastStatus()
@@ -169,21 +181,9 @@ func (n *NodeClient) ConnectWithConfig(config FeatureConfig) error {
 }
 
 
-// initConnection sends the initial authentication
-// Uses the shared TelnetConn for proper prompt-based auth
+// initConnection brings a freshly logged-in session to the node prompt
 func (n *NodeClient) initConnection() error {
-	// Create telnet connection wrapper - handles IAC negotiation
-	tc, err := NewTelnetConn(n.conn, 2*time.Second, nodeLog)
-	if err != nil {
-		return fmt.Errorf("telnet negotiation failed: %w", err)
-	}
-
-	// Authenticate using standard telnet protocol (waits for prompts)
-	nodeLog.Debugf("Starting authentication")
-	_, err = tc.Authenticate(n.callsign, n.password, 5*time.Second)
-	if err != nil {
-		return fmt.Errorf("authentication failed: %w", err)
-	}
+	tc := n.session.TelnetConn
 
 	// Broadcast CTEXT
 	n.broadcastOutput([]string{"Connected successfully"})
@@ -246,15 +246,15 @@ func (n *NodeClient) Run() {
 		nodeLog.Debugf("Read loop exiting, cleaning up")
 		n.mu.Lock()
 		n.state = StateDisconnected
-		if n.conn != nil {
-			n.conn.Close()
+		if n.session != nil {
+			n.session.Discard()
 		}
 		n.mu.Unlock()
 		n.broadcastStatus()
 		BroadcastFeatureStatus(n.GetStatus())
 	}()
 
-	reader := bufio.NewReader(n.conn)
+	reader := n.session.Reader()
 
 	// Start command sender goroutine
 	go n.commandSender()
@@ -423,7 +423,8 @@ func (n *NodeClient) Close() {
 		// Send bye command before closing
 		n.conn.Write([]byte("BYE\r"))
 		time.Sleep(100 * time.Millisecond)
-		n.conn.Close()
+		n.session.Discard()
+		n.session = nil
 		n.conn = nil
 	}
 	n.state = StateDisconnected
@@ -493,15 +494,13 @@ func (n *NodeClient) broadcast(msg *NodeMessage) {
 	if nodeBuffer != nil {
 		nodeBuffer.add(msg.Seq, msgStr)
 	}
+	nodeFeed.Publish(msgStr)
 
 	nodeClientsMu.RLock()
 	defer nodeClientsMu.RUnlock()
 
 	for client := range nodeClients {
-		if err := client.write(msgStr); err != nil {
-			nodeLog.Errorf("Node websocket error: %v", err)
-			go client.kill()
-		}
+		client.writeDroppable(msgStr)
 	}
 }
 
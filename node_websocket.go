@@ -20,10 +20,9 @@ func nodeWebsocketHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	wc := &websocketConn{
-		wc: conn,
-	}
+	wc := newWebsocketConn(conn, "node", r)
 	defer wc.kill()
+	actor := requestActor(r)
 
 	// Register this client for node broadcasts
 	nodeClientsMu.Lock()
@@ -83,14 +82,24 @@ func nodeWebsocketHandler(w http.ResponseWriter, r *http.Request) {
 			if nodeBuffer != nil {
 				items := nodeBuffer.getSince(cmd.LastSeq)
 				for _, item := range items {
-					wc.write(item)
+					if err := wc.writeWait(item); err != nil {
+						return
+					}
 				}
 			}
 
 		case "exec":
 			// Execute a command on the node
 			if nodeClient != nil && cmd.Command != "" {
-				if err := nodeClient.SendCommand(cmd.Command); err != nil {
+				// Wait for a REST command's output to be collected, so
+				// that this one's does not end up in it
+				if err := nodeExecMu.lock(r.Context()); err != nil {
+					return
+				}
+				err := nodeClient.SendCommand(cmd.Command)
+				nodeExecMu.unlock()
+				actor.record(auditNodeExec, cmd.Command, true, err)
+				if err != nil {
 					errMsg := &NodeMessage{
 						Type:  "node_error",
 						Error: "Failed to send command: " + err.Error(),
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// OARCCaptureRecord is one raw OARC datagram (or TCP line) as received. A
+// capture file is one JSON record per line. Data is kept as a string rather
+// than embedded JSON so that malformed events are captured byte for byte.
+type OARCCaptureRecord struct {
+	At   time.Time `json:"at"`
+	From string    `json:"from,omitempty"`
+	Data string    `json:"data"`
+}
+
+// OARCCapture appends received OARC events to a capture file.
+type OARCCapture struct {
+	mu sync.Mutex
+	f  *os.File
+	w  *bufio.Writer
+}
+
+// NewOARCCapture opens path for appending captured events.
+func NewOARCCapture(path string) (*OARCCapture, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open capture file: %w", err)
+	}
+	return &OARCCapture{f: f, w: bufio.NewWriter(f)}, nil
+}
+
+// Record writes one event. Each record is flushed, so a capture taken up to
+// a crash is complete.
+func (c *OARCCapture) Record(at time.Time, from string, data []byte) error {
+	line, err := json.Marshal(OARCCaptureRecord{At: at, From: from, Data: string(data)})
+	if err != nil {
+		return fmt.Errorf("failed to encode capture record: %w", err)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.w.Write(line)
+	c.w.WriteByte('\n')
+	if err := c.w.Flush(); err != nil {
+		return fmt.Errorf("failed to write capture record: %w", err)
+	}
+	return nil
+}
+
+// Close flushes and closes the capture file.
+func (c *OARCCapture) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.w.Flush()
+	return c.f.Close()
+}
+
+// ReadOARCCapture parses a capture file's records.
+func ReadOARCCapture(r io.Reader) ([]OARCCaptureRecord, error) {
+	var records []OARCCaptureRecord
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 4096), 1<<20)
+	for n := 1; scanner.Scan(); n++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var rec OARCCaptureRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return nil, fmt.Errorf("failed to parse capture line %d: %w", n, err)
+		}
+		records = append(records, rec)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read capture: %w", err)
+	}
+	return records, nil
+}
+
+// LoadOARCCapture reads a capture file from disk.
+func LoadOARCCapture(path string) ([]OARCCaptureRecord, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open capture file: %w", err)
+	}
+	defer f.Close()
+	return ReadOARCCapture(f)
+}
+
+// ReplayOARC passes each record's data to inject in order. With speed 1 the
+// original gaps between records are kept, with 2 they are halved, and so
+// on; speed 0 or less replays as fast as possible. It stops early if ctx is
+// done.
+func ReplayOARC(ctx context.Context, records []OARCCaptureRecord, speed float64, inject func([]byte)) error {
+	for i, rec := range records {
+		if speed > 0 && i > 0 {
+			if gap := rec.At.Sub(records[i-1].At); gap > 0 {
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case <-time.After(time.Duration(float64(gap) / speed)):
+				}
+			}
+		} else if err := ctx.Err(); err != nil {
+			return err
+		}
+		inject([]byte(rec.Data))
+	}
+	return nil
+}
+
+// SetCapture records every event accepted from the network to capture, as
+// received and before it is parsed. Call before Start.
+func (o *OARCListener) SetCapture(capture *OARCCapture) {
+	o.capture = capture
+}
+
+// captureEvent records a received event if capturing is on.
+func (o *OARCListener) captureEvent(from string, data []byte) {
+	if o.capture == nil {
+		return
+	}
+	if err := o.capture.Record(time.Now(), from, data); err != nil {
+		o.logger.Warnw("Failed to capture OARC event", "error", err)
+	}
+}
+
+// Replay injects captured events into the listener as if they had just been
+// received, with timing as for ReplayOARC.
+func (o *OARCListener) Replay(ctx context.Context, records []OARCCaptureRecord, speed float64) error {
+	return ReplayOARC(ctx, records, speed, o.parseOARCEvent)
+}
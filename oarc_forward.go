@@ -0,0 +1,422 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// defaultOARCForwardQueue is the default number of datagrams a forward target
+	// buffers while its destination is slow or down.
+	defaultOARCForwardQueue = 1024
+	// oarcStreamQueue is how many events an HTTP or WebSocket stream client
+	// may fall behind before events are dropped for it.
+	oarcStreamQueue = 256
+	// oarcWriteTimeout bounds each write to a forward target.
+	oarcWriteTimeout = 5 * time.Second
+)
+
+// oarcTypeFilter holds the @type values a consumer wants. A nil filter
+// accepts everything.
+type oarcTypeFilter map[string]bool
+
+// parseOARCTypes turns a comma-separated @type list into a filter.
+func parseOARCTypes(list string) oarcTypeFilter {
+	var f oarcTypeFilter
+	for _, typ := range strings.Split(list, ",") {
+		if typ = strings.TrimSpace(typ); typ != "" {
+			if f == nil {
+				f = make(oarcTypeFilter)
+			}
+			f[typ] = true
+		}
+	}
+	return f
+}
+
+func (f oarcTypeFilter) accepts(typ string) bool {
+	return f == nil || f[typ]
+}
+
+func (f oarcTypeFilter) list() []string {
+	types := make([]string, 0, len(f))
+	for typ := range f {
+		types = append(types, typ)
+	}
+	return types
+}
+
+// OARCTargetConfig is one destination OARC datagrams are re-sent to.
+type OARCTargetConfig struct {
+	Network string // "udp" or "tcp"
+	Addr    string // host:port
+	Types   oarcTypeFilter
+}
+
+func (c OARCTargetConfig) String() string {
+	return c.Network + "://" + c.Addr
+}
+
+// ParseOARCTargets parses a comma-separated list of forward targets such as
+// "udp://127.0.0.1:13580,tcp://mapper.local:9000?types=LinkUpEvent+LinkDownEvent".
+// UDP targets get each datagram unchanged; TCP targets get one event per line.
+func ParseOARCTargets(spec string) ([]OARCTargetConfig, error) {
+	var targets []OARCTargetConfig
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		u, err := url.Parse(item)
+		if err != nil {
+			return nil, fmt.Errorf("invalid OARC target %q: %w", item, err)
+		}
+		if u.Scheme != "udp" && u.Scheme != "tcp" {
+			return nil, fmt.Errorf("invalid OARC target %q: scheme must be udp or tcp", item)
+		}
+		if _, _, err := net.SplitHostPort(u.Host); err != nil {
+			return nil, fmt.Errorf("invalid OARC target %q: %w", item, err)
+		}
+		targets = append(targets, OARCTargetConfig{
+			Network: u.Scheme,
+			Addr:    u.Host,
+			// "+" separates types, as "," already separates targets
+			Types: parseOARCTypes(strings.ReplaceAll(u.Query().Get("types"), " ", ",")),
+		})
+	}
+	return targets, nil
+}
+
+// oarcSink is one consumer of the fan-out: a forward target or a stream
+// client. Events it cannot keep up with are dropped and counted rather than
+// holding up the listener.
+type oarcSink struct {
+	types   oarcTypeFilter
+	queue   chan []byte
+	dropped atomic.Uint64
+}
+
+// offer queues data without blocking, and reports whether there was room.
+func (s *oarcSink) offer(data []byte) bool {
+	select {
+	case s.queue <- data:
+		return true
+	default:
+		s.dropped.Add(1)
+		return false
+	}
+}
+
+// OARCForwardTarget re-sends OARC datagrams to one destination.
+type OARCForwardTarget struct {
+	oarcSink
+	config OARCTargetConfig
+
+	sent      atomic.Uint64
+	connected atomic.Bool
+	mu        sync.Mutex
+	lastError string
+}
+
+// OARCTargetStats reports a forward target's counters.
+type OARCTargetStats struct {
+	Target    string   `json:"target"`
+	Types     []string `json:"types,omitempty"`
+	Connected bool     `json:"connected"`
+	Queued    int      `json:"queued"`
+	Sent      uint64   `json:"sent"`
+	Dropped   uint64   `json:"dropped"`
+	LastError string   `json:"lastError,omitempty"`
+}
+
+func (t *OARCForwardTarget) stats() OARCTargetStats {
+	t.mu.Lock()
+	lastError := t.lastError
+	t.mu.Unlock()
+	return OARCTargetStats{
+		Target:    t.config.String(),
+		Types:     t.config.Types.list(),
+		Connected: t.connected.Load(),
+		Queued:    len(t.queue),
+		Sent:      t.sent.Load(),
+		Dropped:   t.dropped.Load(),
+		LastError: lastError,
+	}
+}
+
+// run dials the target and writes queued datagrams to it until ctx is
+// done, redialling with backoff after errors. A datagram whose write fails
+// is lost and counted as dropped.
+func (t *OARCForwardTarget) run(ctx context.Context) {
+	name := t.config.String()
+	backoff := initialBackoff
+	for {
+		dialer := net.Dialer{Timeout: oarcWriteTimeout}
+		conn, err := dialer.DialContext(ctx, t.config.Network, t.config.Addr)
+		if err == nil {
+			oarcLog.Infow("OARC forward target connected", "target", name)
+			t.connected.Store(true)
+			err = t.drain(ctx, conn)
+			t.connected.Store(false)
+			conn.Close()
+			backoff = initialBackoff
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		t.mu.Lock()
+		t.lastError = err.Error()
+		t.mu.Unlock()
+		oarcLog.Warnw("OARC forward target failed", "target", name, "error", err, "backoff", backoff)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// drain writes queued datagrams to conn until a write fails or ctx is done.
+func (t *OARCForwardTarget) drain(ctx context.Context, conn net.Conn) error {
+	name := t.config.String()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case data := <-t.queue:
+			oarcForwardQueued.WithLabelValues(name).Set(float64(len(t.queue)))
+			if t.config.Network == "tcp" {
+				data = ndjsonLine(data)
+			}
+			conn.SetWriteDeadline(time.Now().Add(oarcWriteTimeout))
+			if _, err := conn.Write(data); err != nil {
+				t.dropped.Add(1)
+				oarcForwardDropped.WithLabelValues(name).Inc()
+				return err
+			}
+			t.sent.Add(1)
+			oarcForwardSent.WithLabelValues(name).Inc()
+		}
+	}
+}
+
+// ndjsonLine returns an OARC datagram as a single newline-terminated line.
+func ndjsonLine(data []byte) []byte {
+	line := bytes.TrimRight(data, "\r\n\t ")
+	out := make([]byte, len(line)+1)
+	copy(out, line)
+	out[len(line)] = '\n'
+	return out
+}
+
+// OARCFanout passes every OARC datagram the listener receives on to the
+// configured forward targets and to any local stream clients, each with its
+// own @type filter and queue.
+type OARCFanout struct {
+	targets []*OARCForwardTarget
+
+	mu      sync.RWMutex
+	streams map[*oarcSink]struct{}
+}
+
+// NewOARCFanout creates a fan-out for the given targets. queueSize <= 0
+// uses the default.
+func NewOARCFanout(targets []OARCTargetConfig, queueSize int) *OARCFanout {
+	if queueSize <= 0 {
+		queueSize = defaultOARCForwardQueue
+	}
+	f := &OARCFanout{streams: make(map[*oarcSink]struct{})}
+	for _, cfg := range targets {
+		f.targets = append(f.targets, &OARCForwardTarget{
+			oarcSink: oarcSink{types: cfg.Types, queue: make(chan []byte, queueSize)},
+			config:   cfg,
+		})
+	}
+	return f
+}
+
+// Run starts a writer for each forward target and returns when ctx is done.
+func (f *OARCFanout) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, t := range f.targets {
+		oarcLog.Infow("Forwarding OARC events", "target", t.config.String(), "types", t.config.Types.list())
+		wg.Add(1)
+		go func(t *OARCForwardTarget) {
+			defer wg.Done()
+			t.run(ctx)
+		}(t)
+	}
+	wg.Wait()
+}
+
+// Publish hands a datagram to every target and stream that wants its type.
+// It never blocks.
+func (f *OARCFanout) Publish(typ string, data []byte) {
+	for _, t := range f.targets {
+		if !t.types.accepts(typ) {
+			continue
+		}
+		name := t.config.String()
+		if t.offer(data) {
+			oarcForwardQueued.WithLabelValues(name).Set(float64(len(t.queue)))
+		} else {
+			oarcForwardDropped.WithLabelValues(name).Inc()
+		}
+	}
+
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	for s := range f.streams {
+		if s.types.accepts(typ) && !s.offer(data) {
+			oarcStreamDropped.Inc()
+		}
+	}
+}
+
+// Subscribe registers a stream client for the given types (nil = all).
+func (f *OARCFanout) Subscribe(types oarcTypeFilter) *oarcSink {
+	s := &oarcSink{types: types, queue: make(chan []byte, oarcStreamQueue)}
+	f.mu.Lock()
+	f.streams[s] = struct{}{}
+	oarcStreamClients.Set(float64(len(f.streams)))
+	f.mu.Unlock()
+	return s
+}
+
+// Unsubscribe removes a stream client.
+func (f *OARCFanout) Unsubscribe(s *oarcSink) {
+	f.mu.Lock()
+	delete(f.streams, s)
+	oarcStreamClients.Set(float64(len(f.streams)))
+	f.mu.Unlock()
+}
+
+// TargetStats returns the counters of every forward target.
+func (f *OARCFanout) TargetStats() []OARCTargetStats {
+	stats := make([]OARCTargetStats, 0, len(f.targets))
+	for _, t := range f.targets {
+		stats = append(stats, t.stats())
+	}
+	return stats
+}
+
+// oarcFanoutRef is set in main for the HTTP and WebSocket stream handlers.
+var oarcFanoutRef *OARCFanout
+
+// oarcStreamHandler serves /api/oarc/stream: OARC events as newline-delimited
+// JSON for as long as the client stays connected. ?types=L2Trace,LinkUpEvent
+// limits the stream to those @type values.
+func oarcStreamHandler(w http.ResponseWriter, r *http.Request) {
+	if oarcFanoutRef == nil {
+		http.Error(w, "OARC listener not running", http.StatusServiceUnavailable)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	// The stream outlives the server's write timeout
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	sub := oarcFanoutRef.Subscribe(parseOARCTypes(r.URL.Query().Get("types")))
+	defer oarcFanoutRef.Unsubscribe(sub)
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	bw := bufio.NewWriter(w)
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case data := <-sub.queue:
+			bw.Write(ndjsonLine(data))
+			// Batch whatever else is already waiting into the same flush
+			for len(sub.queue) > 0 {
+				bw.Write(ndjsonLine(<-sub.queue))
+			}
+			if err := bw.Flush(); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// oarcWebsocketHandler serves /ws/oarc: one OARC event per text message,
+// filtered by ?types= as for the HTTP stream.
+func oarcWebsocketHandler(w http.ResponseWriter, r *http.Request) {
+	if oarcFanoutRef == nil {
+		http.Error(w, "OARC listener not running", http.StatusServiceUnavailable)
+		return
+	}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		oarcLog.Errorw("OARC WebSocket upgrade failed", "error", err)
+		return
+	}
+	wc := newWebsocketConn(conn, "oarc", r)
+	defer wc.kill()
+
+	sub := oarcFanoutRef.Subscribe(parseOARCTypes(r.URL.Query().Get("types")))
+	defer oarcFanoutRef.Unsubscribe(sub)
+
+	// The client sends nothing; reading notices when it goes away
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case <-closed:
+			return
+		case data := <-sub.queue:
+			if err := wc.write(string(bytes.TrimRight(data, "\r\n\t "))); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// oarcTargetsHandler serves /api/oarc/targets: forward target counters.
+func oarcTargetsHandler(w http.ResponseWriter, r *http.Request) {
+	stats := []OARCTargetStats{}
+	if oarcFanoutRef != nil {
+		stats = oarcFanoutRef.TargetStats()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
+
+// setupOARCRoutes adds the OARC stream endpoints
+func setupOARCRoutes() {
+	http.HandleFunc("/api/oarc/stream", oarcStreamHandler)
+	http.HandleFunc("/api/oarc/targets", oarcTargetsHandler)
+	http.HandleFunc("/api/oarc/unknown", oarcUnknownHandler)
+	http.HandleFunc("/ws/oarc", oarcWebsocketHandler)
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+const (
+	testLinkUp  = `{"@type": "LinkUpEvent", "node": "WA2M", "id": 1, "direction": "outgoing", "port": "1", "remote": "N3LLO-2", "local": "WA2M-2"}`
+	testL2Trace = `{"@type": "L2Trace", "serial": 1, "port": "1", "srce": "N3LLO-2", "dest": "WA2M-2", "l2Type": "RR"}`
+)
+
+func TestParseOARCTargets(t *testing.T) {
+	targets, err := ParseOARCTargets("udp://127.0.0.1:13580, tcp://mapper.local:9000?types=LinkUpEvent+LinkDownEvent")
+	if err != nil {
+		t.Fatalf("ParseOARCTargets: %v", err)
+	}
+	if len(targets) != 2 {
+		t.Fatalf("got %d targets, want 2", len(targets))
+	}
+	if targets[0].String() != "udp://127.0.0.1:13580" || targets[0].Types != nil {
+		t.Errorf("targets[0] = %+v, want unfiltered udp://127.0.0.1:13580", targets[0])
+	}
+	if targets[1].String() != "tcp://mapper.local:9000" || len(targets[1].Types) != 2 ||
+		!targets[1].Types.accepts(OARCTypeLinkDown) || targets[1].Types.accepts(OARCTypeL2Trace) {
+		t.Errorf("targets[1] = %+v, want tcp filtered to link events", targets[1])
+	}
+
+	for _, bad := range []string{"http://host:80", "udp://host", "udp://[::1"} {
+		if _, err := ParseOARCTargets(bad); err == nil {
+			t.Errorf("ParseOARCTargets(%q) succeeded, want error", bad)
+		}
+	}
+}
+
+// Datagrams received by the listener reach a UDP target unchanged, and a
+// filtered TCP target gets only its types, one per line.
+func TestOARCForwarding(t *testing.T) {
+	udp, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen udp: %v", err)
+	}
+	defer udp.Close()
+	tcp, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen tcp: %v", err)
+	}
+	defer tcp.Close()
+
+	fanout := NewOARCFanout([]OARCTargetConfig{
+		{Network: "udp", Addr: udp.LocalAddr().String()},
+		{Network: "tcp", Addr: tcp.Addr().String(), Types: parseOARCTypes(OARCTypeLinkUp)},
+	}, 16)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go fanout.Run(ctx)
+
+	listener := newTestOARCListener(&mockHandler{})
+	listener.SetFanout(fanout)
+	listener.parseOARCEvent([]byte(testL2Trace))
+	listener.parseOARCEvent([]byte(testLinkUp + "\r\n"))
+	listener.parseOARCEvent([]byte("not json"))
+
+	buf := make([]byte, 2048)
+	udp.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for _, want := range []string{testL2Trace, testLinkUp + "\r\n"} {
+		n, _, err := udp.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("udp read: %v", err)
+		}
+		if got := string(buf[:n]); got != want {
+			t.Errorf("udp got %q, want %q", got, want)
+		}
+	}
+
+	conn, err := tcp.Accept()
+	if err != nil {
+		t.Fatalf("accept: %v", err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		t.Fatalf("tcp read: %v", err)
+	}
+	if line != testLinkUp+"\n" {
+		t.Errorf("tcp got %q, want the LinkUpEvent line", line)
+	}
+
+	stats := fanout.TargetStats()
+	if stats[0].Sent != 2 || stats[1].Sent != 1 {
+		t.Errorf("stats = %+v, want 2 sent via udp and 1 via tcp", stats)
+	}
+}
+
+// A target that cannot keep up drops events and counts them instead of
+// holding up the listener.
+func TestOARCForwardQueueDrops(t *testing.T) {
+	fanout := NewOARCFanout([]OARCTargetConfig{{Network: "udp", Addr: "127.0.0.1:9"}}, 2)
+	for i := 0; i < 5; i++ {
+		fanout.Publish(OARCTypeL2Trace, []byte(testL2Trace))
+	}
+	stats := fanout.TargetStats()[0]
+	if stats.Queued != 2 || stats.Dropped != 3 {
+		t.Errorf("stats = %+v, want 2 queued and 3 dropped", stats)
+	}
+}
+
+// The HTTP stream sends matching events as newline-delimited JSON.
+func TestOARCStreamHandler(t *testing.T) {
+	fanout := NewOARCFanout(nil, 0)
+	oarcFanoutRef = fanout
+	defer func() { oarcFanoutRef = nil }()
+
+	srv := httptest.NewServer(http.HandlerFunc(oarcStreamHandler))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "?types=LinkUpEvent")
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "application/x-ndjson" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+
+	// Headers are flushed once the client is subscribed
+	fanout.Publish(OARCTypeL2Trace, []byte(testL2Trace))
+	fanout.Publish(OARCTypeLinkUp, []byte(testLinkUp))
+
+	line, err := bufio.NewReader(resp.Body).ReadString('\n')
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if line != testLinkUp+"\n" {
+		t.Errorf("got %q, want the LinkUpEvent line", line)
+	}
+}
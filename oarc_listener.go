@@ -1,10 +1,17 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"go.uber.org/zap"
 )
@@ -18,6 +25,16 @@ const (
 	OARCTypeCircuitDown = "CircuitDownEvent"
 )
 
+// oarcKnownTypes are the @type values the listener parses. Others are
+// counted under "unknown" so that arbitrary input cannot grow the metrics.
+var oarcKnownTypes = map[string]bool{
+	OARCTypeL2Trace:     true,
+	OARCTypeLinkUp:      true,
+	OARCTypeLinkDown:    true,
+	OARCTypeCircuitUp:   true,
+	OARCTypeCircuitDown: true,
+}
+
 // L2TraceEvent represents a structured AX.25 frame event from the OARC API.
 // LinBPQ sends "port" as a JSON string (e.g. "2") and uses abbreviated l2Type
 // values: "C" for connect (SABM), "D" for disconnect (DISC).
@@ -132,33 +149,139 @@ type SessionEventHandler interface {
 	HandleCircuitDown(event *CircuitDownEvent)
 }
 
-// OARCListener listens for JSON events from LinBPQ's OARC API on a UDP port.
+// oarcUnknownKeep is how many events of unrecognised @type the listener
+// keeps for inspection.
+const oarcUnknownKeep = 50
+
+// Senders choose the @type, so the counts of unrecognised types are
+// bounded: types are cut to oarcUnknownTypeMax bytes, and past
+// oarcUnknownTypes distinct types the rest are counted as "other".
+const (
+	oarcUnknownTypes   = 100
+	oarcUnknownTypeMax = 64
+)
+
+// OARCListenerConfig controls where the OARC listener accepts events from.
+type OARCListenerConfig struct {
+	// BindAddr is the address to listen on; empty means all interfaces.
+	BindAddr string
+	// Port is the UDP port LinBPQ sends to.
+	Port int
+	// TCPPort, if non-zero, also accepts newline-delimited JSON events over
+	// TCP on BindAddr, for local senders that want reliable delivery.
+	TCPPort int
+	// AllowFrom lists the source networks events are accepted from; empty
+	// accepts any source.
+	AllowFrom []*net.IPNet
+}
+
+// ParseAllowList parses a comma-separated list of IP addresses and CIDR
+// networks, e.g. "127.0.0.1,192.168.1.0/24".
+func ParseAllowList(spec string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if !strings.Contains(item, "/") {
+			ip := net.ParseIP(item)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid address %q", item)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(item)
+		if err != nil {
+			return nil, fmt.Errorf("invalid network %q: %w", item, err)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+// UnknownOARCEvent is an event with an @type the listener does not handle,
+// kept so that new LinBPQ event types can be inspected.
+type UnknownOARCEvent struct {
+	Type       string          `json:"type"`
+	ReceivedAt time.Time       `json:"receivedAt"`
+	Data       json.RawMessage `json:"data"`
+}
+
+// OARCListener listens for JSON events from LinBPQ's OARC API on a UDP port,
+// and optionally on a TCP port.
 type OARCListener struct {
 	conn    *net.UDPConn
-	port    int
+	config  OARCListenerConfig
 	handler SessionEventHandler
+	fanout  *OARCFanout
+	capture *OARCCapture
 	logger  *zap.SugaredLogger
+
+	mu            sync.Mutex
+	unknown       []UnknownOARCEvent // most recent last
+	unknownCounts map[string]uint64
 }
 
-// NewOARCListener creates a new OARC UDP listener on the given port.
-func NewOARCListener(port int, handler SessionEventHandler, logger *zap.SugaredLogger) *OARCListener {
+// NewOARCListener creates a new OARC listener.
+func NewOARCListener(config OARCListenerConfig, handler SessionEventHandler, logger *zap.SugaredLogger) *OARCListener {
 	return &OARCListener{
-		port:    port,
-		handler: handler,
-		logger:  logger,
+		config:        config,
+		handler:       handler,
+		logger:        logger,
+		unknownCounts: make(map[string]uint64),
+	}
+}
+
+// SetFanout passes every well-formed datagram on to fanout, before it is
+// parsed for the session handler. Call before Start.
+func (o *OARCListener) SetFanout(fanout *OARCFanout) {
+	o.fanout = fanout
+}
+
+// allowed reports whether events from ip are accepted.
+func (o *OARCListener) allowed(ip net.IP) bool {
+	if len(o.config.AllowFrom) == 0 {
+		return true
+	}
+	for _, n := range o.config.AllowFrom {
+		if n.Contains(ip) {
+			return true
+		}
 	}
+	return false
 }
 
-// Start binds the UDP socket and processes incoming OARC events until the
-// context is cancelled.
+// Start binds the UDP socket (and the TCP listener, if configured) and
+// processes incoming OARC events until the context is cancelled.
 func (o *OARCListener) Start(ctx context.Context) error {
-	addr := &net.UDPAddr{Port: o.port}
-	conn, err := net.ListenUDP("udp", addr)
+	addr := net.JoinHostPort(o.config.BindAddr, strconv.Itoa(o.config.Port))
+	udpAddr, err := net.ResolveUDPAddr("udp", addr)
 	if err != nil {
-		return fmt.Errorf("failed to bind UDP port %d: %w", o.port, err)
+		return fmt.Errorf("invalid OARC listen address %s: %w", addr, err)
+	}
+	conn, err := net.ListenUDP("udp", udpAddr)
+	if err != nil {
+		return fmt.Errorf("failed to bind UDP port %d: %w", o.config.Port, err)
 	}
 	o.conn = conn
-	o.logger.Infow("OARC listener started", "port", o.port)
+	o.logger.Infow("OARC listener started", "addr", addr, "allowFrom", len(o.config.AllowFrom))
+
+	if o.config.TCPPort != 0 {
+		tcpAddr := net.JoinHostPort(o.config.BindAddr, strconv.Itoa(o.config.TCPPort))
+		ln, err := net.Listen("tcp", tcpAddr)
+		if err != nil {
+			conn.Close()
+			return fmt.Errorf("failed to bind TCP port %d: %w", o.config.TCPPort, err)
+		}
+		o.logger.Infow("OARC TCP listener started", "addr", tcpAddr)
+		go o.serveTCP(ctx, ln)
+	}
 
 	go func() {
 		<-ctx.Done()
@@ -167,7 +290,7 @@ func (o *OARCListener) Start(ctx context.Context) error {
 
 	buf := make([]byte, 65535)
 	for {
-		n, _, err := conn.ReadFromUDP(buf)
+		n, from, err := conn.ReadFromUDP(buf)
 		if err != nil {
 			// Check if we were shut down via context cancellation
 			select {
@@ -182,14 +305,121 @@ func (o *OARCListener) Start(ctx context.Context) error {
 		if n == 0 {
 			continue
 		}
+		if !o.allowed(from.IP) {
+			oarcRejectedTotal.WithLabelValues("udp").Inc()
+			o.logger.Debugw("OARC datagram from disallowed source", "from", from.String())
+			continue
+		}
 
 		data := make([]byte, n)
 		copy(data, buf[:n])
 
+		o.captureEvent(from.String(), data)
 		o.parseOARCEvent(data)
 	}
 }
 
+// serveTCP accepts TCP senders until ctx is done. Each line is one event.
+func (o *OARCListener) serveTCP(ctx context.Context, ln net.Listener) {
+	go func() {
+		<-ctx.Done()
+		ln.Close()
+	}()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if ctx.Err() == nil {
+				o.logger.Warnw("OARC TCP accept failed", "error", err)
+			}
+			return
+		}
+		from, _ := conn.RemoteAddr().(*net.TCPAddr)
+		if from == nil || !o.allowed(from.IP) {
+			oarcRejectedTotal.WithLabelValues("tcp").Inc()
+			o.logger.Debugw("OARC TCP connection from disallowed source", "from", conn.RemoteAddr().String())
+			conn.Close()
+			continue
+		}
+		go o.readTCP(ctx, conn)
+	}
+}
+
+// readTCP parses newline-delimited events from one TCP sender.
+func (o *OARCListener) readTCP(ctx context.Context, conn net.Conn) {
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	o.logger.Debugw("OARC TCP sender connected", "from", conn.RemoteAddr().String())
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 4096), 65535)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		data := make([]byte, len(line))
+		copy(data, line)
+		o.captureEvent(conn.RemoteAddr().String(), data)
+		o.parseOARCEvent(data)
+	}
+	if err := scanner.Err(); err != nil && ctx.Err() == nil {
+		o.logger.Debugw("OARC TCP sender dropped", "from", conn.RemoteAddr().String(), "error", err)
+	}
+}
+
+// recordUnknown counts and keeps an event of unrecognised type.
+func (o *OARCListener) recordUnknown(typ string, data []byte) {
+	if len(typ) > oarcUnknownTypeMax {
+		typ = strings.ToValidUTF8(typ[:oarcUnknownTypeMax], "")
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if _, seen := o.unknownCounts[typ]; seen || len(o.unknownCounts) < oarcUnknownTypes {
+		o.unknownCounts[typ]++
+	} else {
+		o.unknownCounts["other"]++
+	}
+	o.unknown = append(o.unknown, UnknownOARCEvent{Type: typ, ReceivedAt: time.Now(), Data: data})
+	if len(o.unknown) > oarcUnknownKeep {
+		o.unknown = o.unknown[len(o.unknown)-oarcUnknownKeep:]
+	}
+}
+
+// UnknownEvents returns the most recent events of unrecognised type, newest
+// first, and how many of each type have been seen.
+func (o *OARCListener) UnknownEvents() ([]UnknownOARCEvent, map[string]uint64) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	events := make([]UnknownOARCEvent, len(o.unknown))
+	for i, ev := range o.unknown {
+		events[len(o.unknown)-1-i] = ev
+	}
+	counts := make(map[string]uint64, len(o.unknownCounts))
+	for typ, n := range o.unknownCounts {
+		counts[typ] = n
+	}
+	return events, counts
+}
+
+// oarcListenerRef is set in main for the HTTP handlers.
+var oarcListenerRef *OARCListener
+
+// oarcUnknownHandler serves /api/oarc/unknown: recent events of unrecognised
+// @type and per-type counts.
+func oarcUnknownHandler(w http.ResponseWriter, r *http.Request) {
+	resp := map[string]interface{}{
+		"events": []UnknownOARCEvent{},
+		"counts": map[string]uint64{},
+	}
+	if oarcListenerRef != nil {
+		resp["events"], resp["counts"] = oarcListenerRef.UnknownEvents()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
 // parseOARCEvent parses a single OARC JSON datagram and routes it to the
 // appropriate handler method. Exported for testing.
 func (o *OARCListener) parseOARCEvent(data []byte) {
@@ -198,14 +428,24 @@ func (o *OARCListener) parseOARCEvent(data []byte) {
 		Type string `json:"@type"`
 	}
 	if err := json.Unmarshal(data, &envelope); err != nil {
+		oarcParseFailures.WithLabelValues("invalid").Inc()
 		o.logger.Debugw("Failed to parse OARC event envelope", "error", err, "data", string(data))
 		return
 	}
+	if oarcKnownTypes[envelope.Type] {
+		oarcEventsTotal.WithLabelValues(envelope.Type).Inc()
+	} else {
+		oarcEventsTotal.WithLabelValues("unknown").Inc()
+	}
+	if o.fanout != nil {
+		o.fanout.Publish(envelope.Type, data)
+	}
 
 	switch envelope.Type {
 	case OARCTypeL2Trace:
 		var event L2TraceEvent
 		if err := json.Unmarshal(data, &event); err != nil {
+			oarcParseFailures.WithLabelValues(envelope.Type).Inc()
 			o.logger.Warnw("Failed to parse l2_trace event", "error", err)
 			return
 		}
@@ -216,6 +456,7 @@ func (o *OARCListener) parseOARCEvent(data []byte) {
 	case OARCTypeLinkUp:
 		var event LinkUpEvent
 		if err := json.Unmarshal(data, &event); err != nil {
+			oarcParseFailures.WithLabelValues(envelope.Type).Inc()
 			o.logger.Warnw("Failed to parse link_up event", "error", err)
 			return
 		}
@@ -226,6 +467,7 @@ func (o *OARCListener) parseOARCEvent(data []byte) {
 	case OARCTypeLinkDown:
 		var event LinkDownEvent
 		if err := json.Unmarshal(data, &event); err != nil {
+			oarcParseFailures.WithLabelValues(envelope.Type).Inc()
 			o.logger.Warnw("Failed to parse link_down event", "error", err)
 			return
 		}
@@ -236,6 +478,7 @@ func (o *OARCListener) parseOARCEvent(data []byte) {
 	case OARCTypeCircuitUp:
 		var event CircuitUpEvent
 		if err := json.Unmarshal(data, &event); err != nil {
+			oarcParseFailures.WithLabelValues(envelope.Type).Inc()
 			o.logger.Warnw("Failed to parse circuit_up event", "error", err)
 			return
 		}
@@ -246,6 +489,7 @@ func (o *OARCListener) parseOARCEvent(data []byte) {
 	case OARCTypeCircuitDown:
 		var event CircuitDownEvent
 		if err := json.Unmarshal(data, &event); err != nil {
+			oarcParseFailures.WithLabelValues(envelope.Type).Inc()
 			o.logger.Warnw("Failed to parse circuit_down event", "error", err)
 			return
 		}
@@ -254,5 +498,6 @@ func (o *OARCListener) parseOARCEvent(data []byte) {
 
 	default:
 		o.logger.Debugw("Unknown OARC event type", "type", envelope.Type)
+		o.recordUnknown(envelope.Type, data)
 	}
 }
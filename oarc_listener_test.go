@@ -1,8 +1,15 @@
 package main
 
 import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"go.uber.org/zap"
 )
 
@@ -27,7 +34,7 @@ func oarcTestLogger() *zap.SugaredLogger {
 }
 
 func newTestOARCListener(handler *mockHandler) *OARCListener {
-	return NewOARCListener(0, handler, oarcTestLogger())
+	return NewOARCListener(OARCListenerConfig{}, handler, oarcTestLogger())
 }
 
 func TestParseL2TraceEvent(t *testing.T) {
@@ -428,6 +435,56 @@ func TestParseUnknownEventType(t *testing.T) {
 		len(h.circuitUps) != 0 || len(h.circuitDowns) != 0 {
 		t.Error("Unknown event type should not be routed to any handler")
 	}
+
+	// ...but kept for inspection
+	events, counts := listener.UnknownEvents()
+	if len(events) != 1 || events[0].Type != "unknown_future_type" || string(events[0].Data) != json {
+		t.Errorf("UnknownEvents() = %+v, want the event", events)
+	}
+	if counts["unknown_future_type"] != 1 {
+		t.Errorf("counts = %v, want unknown_future_type: 1", counts)
+	}
+}
+
+func TestUnknownEventsKeepsMostRecent(t *testing.T) {
+	listener := newTestOARCListener(&mockHandler{})
+	for i := 0; i < oarcUnknownKeep+10; i++ {
+		listener.parseOARCEvent([]byte(fmt.Sprintf(`{"@type": "NewEvent", "id": %d}`, i)))
+	}
+
+	events, counts := listener.UnknownEvents()
+	if len(events) != oarcUnknownKeep {
+		t.Fatalf("kept %d events, want %d", len(events), oarcUnknownKeep)
+	}
+	if want := fmt.Sprintf(`{"@type": "NewEvent", "id": %d}`, oarcUnknownKeep+9); string(events[0].Data) != want {
+		t.Errorf("newest = %s, want %s", events[0].Data, want)
+	}
+	if counts["NewEvent"] != oarcUnknownKeep+10 {
+		t.Errorf("count = %d, want %d", counts["NewEvent"], oarcUnknownKeep+10)
+	}
+}
+
+// Senders cannot grow the counts without bound with made-up types.
+func TestUnknownEventCountsBounded(t *testing.T) {
+	listener := newTestOARCListener(&mockHandler{})
+	for i := 0; i < oarcUnknownTypes+20; i++ {
+		listener.parseOARCEvent([]byte(fmt.Sprintf(`{"@type": "Junk%d"}`, i)))
+	}
+	listener.parseOARCEvent([]byte(`{"@type": "Junk0"}`))
+	listener.parseOARCEvent([]byte(`{"@type": "` + strings.Repeat("x", 1000) + `"}`))
+
+	_, counts := listener.UnknownEvents()
+	if len(counts) != oarcUnknownTypes+1 {
+		t.Errorf("%d distinct types counted, want %d and other", len(counts), oarcUnknownTypes)
+	}
+	if counts["Junk0"] != 2 || counts["other"] != 21 {
+		t.Errorf("Junk0 = %d, other = %d, want 2 and 21", counts["Junk0"], counts["other"])
+	}
+	for typ := range counts {
+		if len(typ) > oarcUnknownTypeMax {
+			t.Errorf("type of %d bytes counted", len(typ))
+		}
+	}
 }
 
 func TestParseInvalidJSON(t *testing.T) {
@@ -452,12 +509,111 @@ func TestParseMalformedEventBody(t *testing.T) {
 
 	h := &mockHandler{}
 	listener := newTestOARCListener(h)
+	before := testutil.ToFloat64(oarcParseFailures.WithLabelValues(OARCTypeL2Trace))
 	listener.parseOARCEvent([]byte(json))
 
 	// Should fail to unmarshal into L2TraceEvent and not call handler
 	if len(h.l2Traces) != 0 {
 		t.Error("Malformed event body should not be routed to handler")
 	}
+	if got := testutil.ToFloat64(oarcParseFailures.WithLabelValues(OARCTypeL2Trace)) - before; got != 1 {
+		t.Errorf("parse failures went up by %v, want 1", got)
+	}
+}
+
+func TestParseAllowList(t *testing.T) {
+	nets, err := ParseAllowList("127.0.0.1, 192.168.1.0/24,::1")
+	if err != nil {
+		t.Fatalf("ParseAllowList: %v", err)
+	}
+	listener := NewOARCListener(OARCListenerConfig{AllowFrom: nets}, &mockHandler{}, oarcTestLogger())
+	for ip, want := range map[string]bool{
+		"127.0.0.1":   true,
+		"127.0.0.2":   false,
+		"192.168.1.7": true,
+		"192.168.2.7": false,
+		"::1":         true,
+	} {
+		if got := listener.allowed(net.ParseIP(ip)); got != want {
+			t.Errorf("allowed(%s) = %v, want %v", ip, got, want)
+		}
+	}
+
+	if !newTestOARCListener(&mockHandler{}).allowed(net.ParseIP("10.1.2.3")) {
+		t.Error("an empty allow-list should accept any source")
+	}
+	for _, bad := range []string{"localhost", "10.0.0.0/33"} {
+		if _, err := ParseAllowList(bad); err == nil {
+			t.Errorf("ParseAllowList(%q) succeeded, want error", bad)
+		}
+	}
+}
+
+// Events sent over the TCP listener, one per line, reach the handler.
+func TestOARCTCPListener(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	tcpPort := ln.Addr().(*net.TCPAddr).Port
+	ln.Close()
+
+	h := &mockHandler{}
+	var mu sync.Mutex
+	listener := NewOARCListener(OARCListenerConfig{BindAddr: "127.0.0.1", TCPPort: tcpPort},
+		lockedHandler{h, &mu}, oarcTestLogger())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go listener.Start(ctx)
+
+	var conn net.Conn
+	for i := 0; i < 50; i++ {
+		if conn, err = net.Dial("tcp", ln.Addr().String()); err == nil {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	fmt.Fprintf(conn, "%s\n\n%s\n",
+		`{"@type": "LinkUpEvent", "id": 1, "port": "1", "remote": "N3LLO-2", "local": "WA2M-2"}`,
+		`{"@type": "LinkDownEvent", "id": 1, "port": "1", "remote": "N3LLO-2", "local": "WA2M-2", "reason": "Normal"}`)
+	conn.Close()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		mu.Lock()
+		done := len(h.linkDowns) == 1
+		mu.Unlock()
+		if done {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(h.linkUps) != 1 || len(h.linkDowns) != 1 {
+		t.Errorf("got %d link ups and %d downs, want 1 of each", len(h.linkUps), len(h.linkDowns))
+	}
+}
+
+// lockedHandler guards a mockHandler used from the listener's goroutines.
+type lockedHandler struct {
+	*mockHandler
+	mu *sync.Mutex
+}
+
+func (l lockedHandler) HandleLinkUp(e *LinkUpEvent) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.mockHandler.HandleLinkUp(e)
+}
+
+func (l lockedHandler) HandleLinkDown(e *LinkDownEvent) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.mockHandler.HandleLinkDown(e)
 }
 
 func TestMultipleEventsSequentially(t *testing.T) {
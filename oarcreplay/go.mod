@@ -0,0 +1,3 @@
+module oarcreplay
+
+go 1.24.11
@@ -0,0 +1,105 @@
+// oarc-replay - send a captured OARC event stream to a listener.
+//
+// tarpn-mon -oarc-capture writes every OARC event it receives to a file, one
+// JSON record per line with the receive time and the raw datagram:
+//
+//	{"at":"2025-03-10T12:00:01.25Z","from":"127.0.0.1:41234","data":"{\"@type\": ...}"}
+//
+// This replays such a file as UDP datagrams, so a session-tracker problem
+// seen on one node can be reproduced against a tarpn-mon on a laptop, or
+// fed to anything else that speaks the OARC API. tarpn-mon can also replay
+// a capture itself with -oarc-replay; this is for when it should arrive
+// over the network like the real thing.
+//
+// Timing follows the capture: -speed 1 keeps the original gaps, 10 plays
+// ten times faster, 0 sends back to back.
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"time"
+)
+
+var Version = "dev"
+
+// record matches OARCCaptureRecord in tarpn-mon.
+type record struct {
+	At   time.Time `json:"at"`
+	From string    `json:"from,omitempty"`
+	Data string    `json:"data"`
+}
+
+func main() {
+	to := flag.String("to", "127.0.0.1:13579", "UDP address to send events to")
+	speed := flag.Float64("speed", 1, "replay speed: 1 = as captured, 2 = twice as fast, 0 = no delays")
+	version := flag.Bool("version", false, "print version and exit")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: oarc-replay [flags] capture.ndjson\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if *version {
+		fmt.Println(Version)
+		return
+	}
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	records, err := load(flag.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	conn, err := net.Dial("udp", *to)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "dial %s: %v\n", *to, err)
+		os.Exit(1)
+	}
+	defer conn.Close()
+
+	start := time.Now()
+	for i, rec := range records {
+		if *speed > 0 && i > 0 {
+			if gap := rec.At.Sub(records[i-1].At); gap > 0 {
+				time.Sleep(time.Duration(float64(gap) / *speed))
+			}
+		}
+		if _, err := conn.Write([]byte(rec.Data)); err != nil {
+			fmt.Fprintf(os.Stderr, "send event %d: %v\n", i+1, err)
+			os.Exit(1)
+		}
+	}
+	fmt.Printf("sent %d events to %s in %s\n", len(records), *to, time.Since(start).Round(time.Millisecond))
+}
+
+// load reads a capture file.
+func load(path string) ([]record, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var records []record
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 4096), 1<<20)
+	for n := 1; scanner.Scan(); n++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var rec record
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return nil, fmt.Errorf("%s line %d: %v", path, n, err)
+		}
+		records = append(records, rec)
+	}
+	return records, scanner.Err()
+}
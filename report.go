@@ -0,0 +1,602 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ReportPeriod selects how much history a NetworkReport covers.
+type ReportPeriod string
+
+const (
+	ReportDaily  ReportPeriod = "daily"
+	ReportWeekly ReportPeriod = "weekly"
+)
+
+// reportWorstHours is how many of the worst port-hours a report lists.
+const reportWorstHours = 5
+
+// reportTopTalkers is how many stations the top-talkers table lists.
+const reportTopTalkers = 10
+
+// NetworkReport is a human-readable summary of one day or one week of link
+// activity. The LS1 bulletins carry the same raw numbers in a compact
+// machine-readable form; this is the version meant for a person, rendered as
+// HTML for the web UI and as plain text for BBS mail.
+type NetworkReport struct {
+	Callsign    string                 `json:"callsign"`
+	Period      ReportPeriod           `json:"period"`
+	Start       time.Time              `json:"start"`
+	End         time.Time              `json:"end"`
+	GeneratedAt time.Time              `json:"generatedAt"`
+	Resolution  string                 `json:"resolution"` // source tables used, e.g. "hourly+raw"
+	Ports       []PortReport           `json:"ports"`
+	WorstHours  []WorstHour            `json:"worstHours"`
+	Neighbors   []NeighborAvailability `json:"neighbors"`
+	Restarts    []NodeRestart          `json:"restarts"`
+	TopTalkers  []TalkerStats          `json:"topTalkers"`
+	Trends      []TrendFinding         `json:"trends"` // degradation flagged in the last day of the window
+}
+
+// PortReport totals one port's L2 counters over the report window.
+type PortReport struct {
+	PortNum    int     `json:"portNum"`
+	Neighbor   string  `json:"neighbor,omitempty"`
+	Rxed       int64   `json:"rxed"`
+	Sent       int64   `json:"sent"`
+	Timeouts   int64   `json:"timeouts"`
+	REJ        int64   `json:"rej"`
+	CRCErrors  int64   `json:"crcErrors"`
+	Abandoned  int64   `json:"abandoned"`
+	AvgTxPct   float64 `json:"avgTxPct"`
+	AvgBusyPct float64 `json:"avgBusyPct"`
+	MaxBusyPct float64 `json:"maxBusyPct"`
+	// TimeoutPct is timeouts as a percentage of frames sent: the closest
+	// thing the port counters have to a retry rate.
+	TimeoutPct float64 `json:"timeoutPct"`
+}
+
+// WorstHour is a single port-hour ranked by L2 timeouts.
+type WorstHour struct {
+	PortNum    int       `json:"portNum"`
+	HourStart  time.Time `json:"hourStart"`
+	Timeouts   int64     `json:"timeouts"`
+	Sent       int64     `json:"sent"`
+	AvgBusyPct float64   `json:"avgBusyPct"`
+}
+
+// NeighborAvailability merges what we know about a neighbour from the
+// TARPNstat and [LS1] CQs we heard from it.
+type NeighborAvailability struct {
+	Callsign string `json:"callsign"`
+	PortNum  int    `json:"portNum"`
+	// Reports and UpReports count the neighbour's TARPNstat broadcasts, and
+	// how many of them had the link chevron set. Zero Reports means the
+	// neighbour is not sending TARPNstat.
+	Reports         int       `json:"reports"`
+	UpReports       int       `json:"upReports"`
+	AvailabilityPct float64   `json:"availabilityPct"`
+	CQHeard         int       `json:"cqHeard"`
+	LastHeard       time.Time `json:"lastHeard"`
+}
+
+// TalkerStats totals L2 session activity for one remote station.
+type TalkerStats struct {
+	Callsign string `json:"callsign"`
+	Sessions int    `json:"sessions"`
+	IFrames  int    `json:"iFrames"`
+	Bytes    int64  `json:"bytes"`
+	Retries  int    `json:"retries"`
+}
+
+// reportWindow returns [start, end) for a report ending with the local
+// calendar day containing day. Weekly reports cover the seven days up to and
+// including that day.
+func reportWindow(day time.Time, period ReportPeriod) (time.Time, time.Time) {
+	start := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, day.Location())
+	end := start.AddDate(0, 0, 1)
+	if period == ReportWeekly {
+		start = end.AddDate(0, 0, -7)
+	}
+	return start, end
+}
+
+// BuildNetworkReport assembles a report for the window ending with day.
+// storage must be non-nil; tracker may be nil, in which case the top-talkers
+// table is left empty. localCall is excluded from neighbour and talker lists.
+func BuildNetworkReport(storage *LinkStatsStorage, tracker *SessionTracker, localCall string, day time.Time, period ReportPeriod) (*NetworkReport, error) {
+	start, end := reportWindow(day, period)
+	report := &NetworkReport{
+		Callsign:    strings.ToUpper(localCall),
+		Period:      period,
+		Start:       start,
+		End:         end,
+		GeneratedAt: time.Now(),
+	}
+
+	hours, sources, err := reportHourlyData(storage, start, end)
+	if err != nil {
+		return nil, err
+	}
+	report.Resolution = strings.Join(sources, "+")
+
+	neighbors, err := storage.GetNeighborCallsigns(localCall)
+	if err != nil {
+		statsLog.Warnw("Report: failed to get neighbor callsigns", "error", err)
+		neighbors = map[int]string{}
+	}
+
+	report.Ports = summarisePorts(hours, neighbors)
+	report.WorstHours = worstHours(hours, reportWorstHours)
+
+	report.Trends, err = AnalyseLinkTrends(storage, end, DefaultTrendConfig())
+	if err != nil {
+		statsLog.Warnw("Report: trend analysis failed", "error", err)
+	}
+
+	report.Restarts, err = storage.GetNodeRestarts(start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	tarpnStats, err := storage.GetTARPNStatSummary(start, end)
+	if err != nil {
+		return nil, err
+	}
+	cqs, err := storage.GetNeighborCQSummary(start, end)
+	if err != nil {
+		return nil, err
+	}
+	report.Neighbors = mergeNeighborAvailability(tarpnStats, cqs, localCall)
+
+	if tracker != nil {
+		report.TopTalkers = topTalkers(tracker.GetSessions(), localCall, start, end, reportTopTalkers)
+	}
+
+	return report, nil
+}
+
+// reportHourlyData loads one row per port per hour in [start, end), from
+// whichever tables hold it, and returns the names of the tables used. Hours
+// with no data are left out.
+func reportHourlyData(storage *LinkStatsStorage, start, end time.Time) ([]HourlySummary, []string, error) {
+	res, err := storage.Query(nil, nil, start, end, time.Hour)
+	if err != nil {
+		return nil, nil, err
+	}
+	var all []HourlySummary
+	for _, series := range res.Series {
+		for _, pt := range series.Points {
+			if pt.Missing {
+				continue
+			}
+			all = append(all, HourlySummary{
+				HourStart:       pt.BucketStart,
+				PortNum:         series.PortNum,
+				DeltaL2Rxed:     int64(pt.Values[MetricL2Rxed]),
+				DeltaL2Sent:     int64(pt.Values[MetricL2Sent]),
+				DeltaL2Timeouts: int64(pt.Values[MetricL2Timeouts]),
+				DeltaREJRxed:    int64(pt.Values[MetricREJRxed]),
+				DeltaCRCErrors:  int64(pt.Values[MetricRXCRCErrors]),
+				DeltaAbandoned:  int64(pt.Values[MetricFramesAbandoned]),
+				AvgTxPct:        pt.Values[MetricActiveTxPct],
+				AvgBusyPct:      pt.Values[MetricActiveBusyPct],
+				SampleCount:     pt.SampleCount,
+			})
+		}
+	}
+	return all, res.Sources, nil
+}
+
+// summarisePorts totals the per-interval rows into one PortReport per port.
+// Port 32 (the NetROM virtual port) is left out, as in the per-link bulletins.
+func summarisePorts(rows []HourlySummary, neighbors map[int]string) []PortReport {
+	byPort := make(map[int]*PortReport)
+	samples := make(map[int]int)
+	for _, h := range rows {
+		if h.PortNum == 32 {
+			continue
+		}
+		pr, ok := byPort[h.PortNum]
+		if !ok {
+			pr = &PortReport{PortNum: h.PortNum, Neighbor: neighbors[h.PortNum]}
+			byPort[h.PortNum] = pr
+		}
+		pr.Rxed += h.DeltaL2Rxed
+		pr.Sent += h.DeltaL2Sent
+		pr.Timeouts += h.DeltaL2Timeouts
+		pr.REJ += h.DeltaREJRxed
+		pr.CRCErrors += h.DeltaCRCErrors
+		pr.Abandoned += h.DeltaAbandoned
+		pr.AvgTxPct += h.AvgTxPct
+		pr.AvgBusyPct += h.AvgBusyPct
+		if h.AvgBusyPct > pr.MaxBusyPct {
+			pr.MaxBusyPct = h.AvgBusyPct
+		}
+		samples[h.PortNum]++
+	}
+
+	result := make([]PortReport, 0, len(byPort))
+	for pn, pr := range byPort {
+		if n := samples[pn]; n > 0 {
+			pr.AvgTxPct /= float64(n)
+			pr.AvgBusyPct /= float64(n)
+		}
+		if pr.Sent > 0 {
+			pr.TimeoutPct = float64(pr.Timeouts) / float64(pr.Sent) * 100
+		}
+		result = append(result, *pr)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].PortNum < result[j].PortNum })
+	return result
+}
+
+// worstHours returns up to n port-intervals with the most timeouts. Intervals
+// with no timeouts at all are not "worst" and are never listed.
+func worstHours(rows []HourlySummary, n int) []WorstHour {
+	var candidates []WorstHour
+	for _, h := range rows {
+		if h.PortNum == 32 || h.DeltaL2Timeouts == 0 {
+			continue
+		}
+		candidates = append(candidates, WorstHour{
+			PortNum:    h.PortNum,
+			HourStart:  h.HourStart,
+			Timeouts:   h.DeltaL2Timeouts,
+			Sent:       h.DeltaL2Sent,
+			AvgBusyPct: h.AvgBusyPct,
+		})
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].Timeouts != candidates[j].Timeouts {
+			return candidates[i].Timeouts > candidates[j].Timeouts
+		}
+		return candidates[i].HourStart.Before(candidates[j].HourStart)
+	})
+	if len(candidates) > n {
+		candidates = candidates[:n]
+	}
+	return candidates
+}
+
+// mergeNeighborAvailability combines the TARPNstat broadcasts we received
+// ('R' rows; each names its sender and says whether the sender has the link
+// up) with the [LS1] CQs heard from neighbours.
+func mergeNeighborAvailability(stats []TARPNStatLinkSummary, cqs []NeighborCQSummary, localCall string) []NeighborAvailability {
+	type key struct {
+		port int
+		call string
+	}
+	local := baseCallsign(localCall)
+	byKey := make(map[key]*NeighborAvailability)
+	get := func(port int, call string) *NeighborAvailability {
+		k := key{port, strings.ToUpper(call)}
+		na, ok := byKey[k]
+		if !ok {
+			na = &NeighborAvailability{Callsign: k.call, PortNum: port}
+			byKey[k] = na
+		}
+		return na
+	}
+
+	for _, s := range stats {
+		if s.Direction != "R" || baseCallsign(s.Callsign) == local {
+			continue
+		}
+		na := get(s.PortNum, s.Callsign)
+		na.Reports += s.Reports
+		na.UpReports += s.UpReports
+		if s.LastSeen.After(na.LastHeard) {
+			na.LastHeard = s.LastSeen
+		}
+	}
+	for _, c := range cqs {
+		if baseCallsign(c.Callsign) == local {
+			continue
+		}
+		na := get(c.RxPort, c.Callsign)
+		na.CQHeard += c.Heard
+		if c.LastSeen.After(na.LastHeard) {
+			na.LastHeard = c.LastSeen
+		}
+	}
+
+	result := make([]NeighborAvailability, 0, len(byKey))
+	for _, na := range byKey {
+		if na.Reports > 0 {
+			na.AvailabilityPct = float64(na.UpReports) / float64(na.Reports) * 100
+		}
+		result = append(result, *na)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].PortNum != result[j].PortNum {
+			return result[i].PortNum < result[j].PortNum
+		}
+		return result[i].Callsign < result[j].Callsign
+	})
+	return result
+}
+
+// topTalkers ranks remote stations by I-frames exchanged in sessions active
+// during [start, end). The tracker only holds recent sessions, so for a
+// weekly report this is a lower bound.
+func topTalkers(sessions []*Session, localCall string, start, end time.Time, n int) []TalkerStats {
+	local := baseCallsign(localCall)
+	byCall := make(map[string]*TalkerStats)
+	for _, sess := range sessions {
+		if sess.LastActivity.Before(start) || !sess.LastActivity.Before(end) {
+			continue
+		}
+		for _, call := range []string{sess.Initiator, sess.Responder} {
+			call = strings.ToUpper(call)
+			if call == "" || baseCallsign(call) == local {
+				continue
+			}
+			ts, ok := byCall[call]
+			if !ok {
+				ts = &TalkerStats{Callsign: call}
+				byCall[call] = ts
+			}
+			ts.Sessions++
+			ts.IFrames += sess.IFramesSent + sess.IFramesReceived
+			ts.Bytes += sess.BytesSent + sess.BytesReceived
+			ts.Retries += sess.RetryCount
+		}
+	}
+
+	result := make([]TalkerStats, 0, len(byCall))
+	for _, ts := range byCall {
+		result = append(result, *ts)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].IFrames != result[j].IFrames {
+			return result[i].IFrames > result[j].IFrames
+		}
+		return result[i].Callsign < result[j].Callsign
+	})
+	if len(result) > n {
+		result = result[:n]
+	}
+	return result
+}
+
+// baseCallsign strips the SSID and normalises case, so that N0CALL-2 and
+// n0call-7 compare equal.
+func baseCallsign(call string) string {
+	return strings.Split(strings.ToUpper(strings.TrimSpace(call)), "-")[0]
+}
+
+// Title returns the subject line used for both the HTML page and BBS mail.
+func (r *NetworkReport) Title() string {
+	if r.Period == ReportWeekly {
+		return fmt.Sprintf("%s weekly network report %s to %s",
+			r.Callsign, r.Start.Format("2006-01-02"), r.End.AddDate(0, 0, -1).Format("2006-01-02"))
+	}
+	return fmt.Sprintf("%s daily network report %s", r.Callsign, r.Start.Format("2006-01-02"))
+}
+
+// RenderText formats the report as plain text that fits an 80-column BBS
+// terminal.
+func (r *NetworkReport) RenderText() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s\n", r.Title())
+	fmt.Fprintf(&b, "Window: %s - %s (%s data)\n\n",
+		r.Start.Format("2006-01-02 15:04"), r.End.Format("2006-01-02 15:04 MST"), r.Resolution)
+
+	b.WriteString("PORT TRAFFIC\n")
+	if len(r.Ports) == 0 {
+		b.WriteString("  No link stats recorded.\n")
+	} else {
+		fmt.Fprintf(&b, "  %-4s %-9s %7s %7s %6s %5s %4s %4s %5s %5s\n",
+			"Port", "Neighbor", "Rxed", "Sent", "T/O", "T/O%", "REJ", "CRC", "Tx%", "Busy%")
+		for _, p := range r.Ports {
+			fmt.Fprintf(&b, "  %-4d %-9s %7d %7d %6d %5.1f %4d %4d %5.1f %5.1f\n",
+				p.PortNum, reportDash(p.Neighbor), p.Rxed, p.Sent, p.Timeouts, p.TimeoutPct,
+				p.REJ, p.CRCErrors, p.AvgTxPct, p.AvgBusyPct)
+		}
+	}
+
+	b.WriteString("\nWORST HOURS (by L2 timeouts)\n")
+	if len(r.WorstHours) == 0 {
+		b.WriteString("  No timeouts.\n")
+	}
+	for _, w := range r.WorstHours {
+		fmt.Fprintf(&b, "  %s  port %-2d  %d timeouts / %d sent, busy %.0f%%\n",
+			w.HourStart.In(r.Start.Location()).Format("01-02 15:04"), w.PortNum, w.Timeouts, w.Sent, w.AvgBusyPct)
+	}
+
+	b.WriteString("\nDEGRADATION TRENDS\n")
+	if len(r.Trends) == 0 {
+		b.WriteString("  None.\n")
+	}
+	for _, t := range r.Trends {
+		fmt.Fprintf(&b, "  %s\n", t.Message)
+	}
+
+	b.WriteString("\nNEIGHBOURS\n")
+	if len(r.Neighbors) == 0 {
+		b.WriteString("  No neighbour reports.\n")
+	}
+	for _, n := range r.Neighbors {
+		avail := "n/a"
+		if n.Reports > 0 {
+			avail = fmt.Sprintf("%.0f%% up", n.AvailabilityPct)
+		}
+		fmt.Fprintf(&b, "  %-9s port %-2d  %-8s  %3d CQs heard, last %s\n",
+			n.Callsign, n.PortNum, avail, n.CQHeard, n.LastHeard.In(r.Start.Location()).Format("01-02 15:04"))
+	}
+
+	b.WriteString("\nNODE RESTARTS\n")
+	if len(r.Restarts) == 0 {
+		b.WriteString("  None.\n")
+	}
+	for _, rs := range r.Restarts {
+		fmt.Fprintf(&b, "  %s after %s uptime\n",
+			rs.DetectedAt.In(r.Start.Location()).Format("01-02 15:04"), formatUptimeMins(rs.UptimeBeforeMins))
+	}
+
+	b.WriteString("\nTOP TALKERS\n")
+	if len(r.TopTalkers) == 0 {
+		b.WriteString("  No sessions seen.\n")
+	}
+	for _, t := range r.TopTalkers {
+		fmt.Fprintf(&b, "  %-9s %3d sessions %6d I-frames %8d bytes %4d retries\n",
+			t.Callsign, t.Sessions, t.IFrames, t.Bytes, t.Retries)
+	}
+
+	fmt.Fprintf(&b, "\nGenerated %s by tarpn-mon %s\n", r.GeneratedAt.Format("2006-01-02 15:04 MST"), Version)
+	return b.String()
+}
+
+func reportDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// formatUptimeMins renders minutes as "3d4h12m".
+func formatUptimeMins(mins int) string {
+	return fmt.Sprintf("%dd%dh%dm", mins/(24*60), (mins%(24*60))/60, mins%60)
+}
+
+var reportHTMLTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"dash":   reportDash,
+	"uptime": formatUptimeMins,
+	"when": func(t time.Time, loc time.Time) string {
+		return t.In(loc.Location()).Format("2006-01-02 15:04")
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: sans-serif; margin: 1.5em; color: #222; }
+table { border-collapse: collapse; margin-bottom: 1.5em; }
+th, td { border: 1px solid #ccc; padding: 0.25em 0.6em; text-align: right; }
+th { background: #f0f0f0; }
+td.l, th.l { text-align: left; }
+.muted { color: #777; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p class="muted">{{when .Start .Start}} to {{when .End .Start}} ({{.Resolution}} data)</p>
+
+<h2>Port traffic</h2>
+{{if .Ports}}<table>
+<tr><th>Port</th><th class="l">Neighbor</th><th>Rxed</th><th>Sent</th><th>Timeouts</th><th>T/O %</th><th>REJ</th><th>CRC</th><th>Abandoned</th><th>Avg Tx %</th><th>Avg Busy %</th><th>Max Busy %</th></tr>
+{{range .Ports}}<tr><td>{{.PortNum}}</td><td class="l">{{dash .Neighbor}}</td><td>{{.Rxed}}</td><td>{{.Sent}}</td><td>{{.Timeouts}}</td><td>{{printf "%.1f" .TimeoutPct}}</td><td>{{.REJ}}</td><td>{{.CRCErrors}}</td><td>{{.Abandoned}}</td><td>{{printf "%.1f" .AvgTxPct}}</td><td>{{printf "%.1f" .AvgBusyPct}}</td><td>{{printf "%.1f" .MaxBusyPct}}</td></tr>
+{{end}}</table>{{else}}<p>No link stats recorded.</p>{{end}}
+
+<h2>Worst hours</h2>
+{{if .WorstHours}}<table>
+<tr><th class="l">Hour</th><th>Port</th><th>Timeouts</th><th>Sent</th><th>Busy %</th></tr>
+{{range .WorstHours}}<tr><td class="l">{{when .HourStart $.Start}}</td><td>{{.PortNum}}</td><td>{{.Timeouts}}</td><td>{{.Sent}}</td><td>{{printf "%.0f" .AvgBusyPct}}</td></tr>
+{{end}}</table>{{else}}<p>No timeouts.</p>{{end}}
+
+<h2>Degradation trends</h2>
+{{if .Trends}}<ul>
+{{range .Trends}}<li>{{.Message}}</li>
+{{end}}</ul>{{else}}<p>None.</p>{{end}}
+
+<h2>Neighbours</h2>
+{{if .Neighbors}}<table>
+<tr><th class="l">Callsign</th><th>Port</th><th>Availability</th><th>CQs heard</th><th class="l">Last heard</th></tr>
+{{range .Neighbors}}<tr><td class="l">{{.Callsign}}</td><td>{{.PortNum}}</td><td>{{if .Reports}}{{printf "%.0f" .AvailabilityPct}}%{{else}}n/a{{end}}</td><td>{{.CQHeard}}</td><td class="l">{{when .LastHeard $.Start}}</td></tr>
+{{end}}</table>{{else}}<p>No neighbour reports.</p>{{end}}
+
+<h2>Node restarts</h2>
+{{if .Restarts}}<ul>
+{{range .Restarts}}<li>{{when .DetectedAt $.Start}} after {{uptime .UptimeBeforeMins}} uptime</li>
+{{end}}</ul>{{else}}<p>None.</p>{{end}}
+
+<h2>Top talkers</h2>
+{{if .TopTalkers}}<table>
+<tr><th class="l">Callsign</th><th>Sessions</th><th>I-frames</th><th>Bytes</th><th>Retries</th></tr>
+{{range .TopTalkers}}<tr><td class="l">{{.Callsign}}</td><td>{{.Sessions}}</td><td>{{.IFrames}}</td><td>{{.Bytes}}</td><td>{{.Retries}}</td></tr>
+{{end}}</table>{{else}}<p>No sessions seen.</p>{{end}}
+
+<p class="muted">Generated {{when .GeneratedAt .Start}} by tarpn-mon {{.Version}}</p>
+</body>
+</html>
+`))
+
+// RenderHTML writes the report as a standalone HTML page.
+func (r *NetworkReport) RenderHTML(w http.ResponseWriter) error {
+	data := struct {
+		*NetworkReport
+		Title   string
+		Version string
+	}{r, r.Title(), Version}
+	return reportHTMLTemplate.Execute(w, data)
+}
+
+// reportHandler serves /reports/<YYYY-MM-DD>. An empty date means yesterday.
+// ?period=weekly covers the seven days ending on that date, and ?format=text
+// returns the same plain text that is posted to the BBS.
+func reportHandler(w http.ResponseWriter, r *http.Request) {
+	if neighborStorageRef == nil {
+		http.Error(w, "link stats storage not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	dateStr := strings.Trim(strings.TrimPrefix(r.URL.Path, "/reports/"), "/")
+	var day time.Time
+	if dateStr == "" {
+		day = time.Now().AddDate(0, 0, -1)
+	} else {
+		var err error
+		day, err = time.ParseInLocation("2006-01-02", dateStr, time.Local)
+		if err != nil {
+			http.Error(w, "date must be YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+	}
+
+	period := ReportDaily
+	switch r.URL.Query().Get("period") {
+	case "", "daily", "day":
+	case "weekly", "week":
+		period = ReportWeekly
+	default:
+		http.Error(w, "period must be daily or weekly", http.StatusBadRequest)
+		return
+	}
+
+	report, err := BuildNetworkReport(neighborStorageRef, sessionTrackerRef, reportCallsign(), day, period)
+	if err != nil {
+		wsLog.Warnw("Failed to build report", "date", dateStr, "error", err)
+		http.Error(w, "failed to build report", http.StatusInternalServerError)
+		return
+	}
+
+	if r.URL.Query().Get("format") == "text" {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write([]byte(report.RenderText()))
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := report.RenderHTML(w); err != nil {
+		wsLog.Warnw("Failed to render report", "error", err)
+	}
+}
+
+// reportCallsign is the callsign reports are generated for: the stats
+// callsign if one was given, otherwise the main -call value.
+func reportCallsign() string {
+	if statsCallsign != "" {
+		return statsCallsign
+	}
+	return callsign
+}
+
+// setupReportRoutes adds the report pages
+func setupReportRoutes() {
+	http.HandleFunc("/reports/", reportHandler)
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// A report for a day that has not been compacted yet must still have port
+// traffic (from raw samples), and must pick up restarts and
+// neighbour availability from the other tables.
+func TestBuildNetworkReport(t *testing.T) {
+	s := newTestStorage(t)
+	day := time.Date(2025, 3, 10, 0, 0, 0, 0, time.UTC)
+
+	exec := func(q string, args ...interface{}) {
+		t.Helper()
+		if _, err := s.db.Exec(q, args...); err != nil {
+			t.Fatalf("exec: %v", err)
+		}
+	}
+	ts := func(d time.Duration) string { return day.Add(d).UTC().Format(time.RFC3339) }
+
+	// Port 1 polled once a minute for three hours: 25 frames sent per
+	// minute (59 x 25 counted per hour bucket) and 5 timeouts at 02:06.
+	for i := 0; i < 180; i++ {
+		d := time.Duration(i) * time.Minute
+		timeouts := int64(0)
+		if d >= 2*time.Hour+6*time.Minute {
+			timeouts = 5
+		}
+		exec(`INSERT INTO link_stats_raw
+			(timestamp, port_num, l2_rxed, l2_sent, l2_timeouts, rej_rxed,
+			 rx_crc_errors, frames_abandoned, active_tx_pct, active_busy_pct)
+			VALUES (?, 1, ?, ?, ?, 0, 0, 0, 10, 20)`,
+			ts(d), int64(i)*10, int64(i)*25, timeouts)
+	}
+
+	// Uptime drops between 01:00 and 01:05: one restart after 3 hours up.
+	exec(`INSERT INTO link_stats_system (timestamp, uptime_mins) VALUES (?, 180)`, ts(time.Hour))
+	exec(`INSERT INTO link_stats_system (timestamp, uptime_mins) VALUES (?, 2)`, ts(time.Hour+5*time.Minute))
+	exec(`INSERT INTO link_stats_system (timestamp, uptime_mins) VALUES (?, 7)`, ts(time.Hour+10*time.Minute))
+
+	// K1ABC-2's TARPNstat for its link to us on port 1: up 3 times out of 4,
+	// plus our own broadcast, which is not a neighbour report.
+	for i, up := range []int{1, 1, 0, 1} {
+		exec(`INSERT INTO link_stats_tarpnstat (timestamp, direction, port_num, callsign, link_up)
+			VALUES (?, 'R', 1, 'K1ABC-2', ?)`, ts(time.Duration(i)*10*time.Minute), up)
+	}
+	exec(`INSERT INTO link_stats_tarpnstat (timestamp, direction, port_num, callsign, link_up)
+		VALUES (?, 'T', 1, 'N0CALL-2', 1)`, ts(time.Hour))
+	// A CQ heard from that neighbour, and one of our own heard back via a
+	// digipeater, which must not show as a neighbour.
+	exec(`INSERT INTO link_stats_neighbor (timestamp, callsign, reported_port, rx_port)
+		VALUES (?, 'K1ABC-2', 3, 1)`, ts(time.Hour))
+	exec(`INSERT INTO link_stats_neighbor (timestamp, callsign, reported_port, rx_port)
+		VALUES (?, 'N0CALL-2', 1, 1)`, ts(time.Hour))
+
+	// Outside the window: must be ignored.
+	exec(`INSERT INTO link_stats_neighbor (timestamp, callsign, reported_port, rx_port)
+		VALUES (?, 'K1ABC-2', 3, 1)`, ts(-time.Hour))
+
+	r, err := BuildNetworkReport(s, nil, "n0call", day.Add(12*time.Hour), ReportDaily)
+	if err != nil {
+		t.Fatalf("BuildNetworkReport: %v", err)
+	}
+
+	if r.Resolution != "raw" {
+		t.Errorf("Resolution = %q, want raw", r.Resolution)
+	}
+	if len(r.Ports) != 1 || r.Ports[0].PortNum != 1 {
+		t.Fatalf("Ports = %+v, want port 1 only", r.Ports)
+	}
+	if got := r.Ports[0].Sent; got != 3*59*25 {
+		t.Errorf("port 1 Sent = %d, want %d", got, 3*59*25)
+	}
+	if got := r.Ports[0].Timeouts; got != 5 {
+		t.Errorf("port 1 Timeouts = %d, want 5", got)
+	}
+	if len(r.WorstHours) != 1 || r.WorstHours[0].HourStart.UTC().Hour() != 2 {
+		t.Errorf("WorstHours = %+v, want the 02:00 hour only", r.WorstHours)
+	}
+
+	if len(r.Restarts) != 1 || r.Restarts[0].UptimeBeforeMins != 180 {
+		t.Errorf("Restarts = %+v, want one after 180 minutes", r.Restarts)
+	}
+
+	if len(r.Neighbors) != 1 {
+		t.Fatalf("Neighbors = %+v, want K1ABC-2 only", r.Neighbors)
+	}
+	n := r.Neighbors[0]
+	if n.Callsign != "K1ABC-2" || n.Reports != 4 || n.UpReports != 3 || n.CQHeard != 1 {
+		t.Errorf("neighbour = %+v", n)
+	}
+	if n.AvailabilityPct != 75 {
+		t.Errorf("AvailabilityPct = %.1f, want 75", n.AvailabilityPct)
+	}
+
+	text := r.RenderText()
+	for _, want := range []string{"N0CALL daily network report 2025-03-10", "K1ABC-2", "75% up", "0d3h0m uptime"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("text report missing %q:\n%s", want, text)
+		}
+	}
+	for _, line := range strings.Split(text, "\n") {
+		if len(line) > 80 {
+			t.Errorf("text line wider than 80 columns: %q", line)
+		}
+	}
+}
+
+func TestTopTalkersWindowAndLocal(t *testing.T) {
+	start := time.Date(2025, 3, 10, 0, 0, 0, 0, time.UTC)
+	end := start.Add(24 * time.Hour)
+	sessions := []*Session{
+		{Initiator: "N0CALL-2", Responder: "K1ABC-7", LastActivity: start.Add(time.Hour), IFramesSent: 10, BytesSent: 500},
+		{Initiator: "W2XYZ", Responder: "N0CALL", LastActivity: start.Add(2 * time.Hour), IFramesReceived: 3},
+		{Initiator: "K1ABC-7", Responder: "N0CALL", LastActivity: start.Add(3 * time.Hour), IFramesReceived: 5},
+		{Initiator: "W2XYZ", Responder: "N0CALL", LastActivity: end.Add(time.Minute), IFramesReceived: 100},
+	}
+
+	got := topTalkers(sessions, "N0CALL-2", start, end, 10)
+	if len(got) != 2 {
+		t.Fatalf("topTalkers = %+v, want 2 stations", got)
+	}
+	if got[0].Callsign != "K1ABC-7" || got[0].Sessions != 2 || got[0].IFrames != 15 {
+		t.Errorf("first = %+v, want K1ABC-7 with 2 sessions / 15 I-frames", got[0])
+	}
+	if got[1].Callsign != "W2XYZ" || got[1].IFrames != 3 {
+		t.Errorf("second = %+v, want W2XYZ with 3 I-frames", got[1])
+	}
+}
@@ -0,0 +1,1016 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// The REST API under /api/v1 offers scripts and cron jobs what the
+// WebSocket protocols offer the web UI. Monitor commands run through the
+// same handlers as /ws and answer with the same messages; what the
+// WebSockets stream is served as server-sent events or long polls; and the
+// BBS and node consoles, which answer asynchronously, are waited on so that
+// a request returns the answer.
+
+// How long REST requests wait on the BBS and node consoles.
+const (
+	restBBSTimeout      = 30 * time.Second
+	nodeExecTimeout     = 15 * time.Second
+	nodeExecTimeoutMax  = 60 * time.Second
+	nodeExecQuiet       = 2 * time.Second // after the last line, when no prompt comes
+	restLongPollMax     = 60 * time.Second
+	restEventsKeepalive = 30 * time.Second
+	eventFeedQueue      = 256
+	// restWriteMargin is how long a request that waited has left to write
+	// its answer.
+	restWriteMargin = 10 * time.Second
+)
+
+// extendWriteDeadline gives a request that is about to wait up to d the
+// time to wait and then write, which the server's write timeout, counted
+// from when the request arrived, may not.
+func extendWriteDeadline(w http.ResponseWriter, d time.Duration) {
+	http.NewResponseController(w).SetWriteDeadline(time.Now().Add(d + restWriteMargin))
+}
+
+// restLock lets one request at a time at a console. Unlike a sync.Mutex,
+// a request stops waiting for it when the client goes away.
+type restLock chan struct{}
+
+func (l restLock) lock(ctx context.Context) error {
+	select {
+	case l <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (l restLock) unlock() { <-l }
+
+// eventFeed fans one WebSocket's broadcasts out to REST clients: event
+// streams, long polls and requests waiting for the BBS or node to answer.
+type eventFeed struct {
+	mu   sync.RWMutex
+	subs map[*eventSub]struct{}
+}
+
+// eventSub is one listener on a feed. A listener that falls behind loses
+// messages rather than holding up the broadcast; streams can catch up by
+// sequence number.
+type eventSub struct {
+	queue chan string
+	lost  atomic.Int64 // messages dropped because the queue was full
+}
+
+// The feeds, published to alongside the /ws, /ws/chat, /ws/bbs and
+// /ws/node broadcasts.
+var (
+	monitorFeed = newEventFeed()
+	chatFeed    = newEventFeed()
+	bbsFeed     = newEventFeed()
+	nodeFeed    = newEventFeed()
+)
+
+func newEventFeed() *eventFeed {
+	return &eventFeed{subs: make(map[*eventSub]struct{})}
+}
+
+// Subscribe adds a listener. Callers must Unsubscribe it.
+func (f *eventFeed) Subscribe() *eventSub {
+	s := &eventSub{queue: make(chan string, eventFeedQueue)}
+	f.mu.Lock()
+	f.subs[s] = struct{}{}
+	f.mu.Unlock()
+	return s
+}
+
+// Unsubscribe removes a listener.
+func (f *eventFeed) Unsubscribe(s *eventSub) {
+	f.mu.Lock()
+	delete(f.subs, s)
+	f.mu.Unlock()
+}
+
+// Publish offers a message to every listener without blocking.
+func (f *eventFeed) Publish(message string) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	for s := range f.subs {
+		select {
+		case s.queue <- message:
+		default:
+			s.lost.Add(1)
+		}
+	}
+}
+
+// messageType returns a JSON message's "type".
+func messageType(message string) string {
+	var head struct {
+		Type string `json:"type"`
+	}
+	json.Unmarshal([]byte(message), &head)
+	return head.Type
+}
+
+// wsErrTimeout is the error code for a console that did not answer a REST
+// request in time.
+const wsErrTimeout = "timeout"
+
+// restErrorStatus is the HTTP status for each error code.
+var restErrorStatus = map[string]int{
+	wsErrBadRequest:          http.StatusBadRequest,
+	wsErrUnknownCommand:      http.StatusNotFound,
+	wsErrPermissionDenied:    http.StatusForbidden,
+	wsErrInvalidParams:       http.StatusBadRequest,
+	wsErrNotFound:            http.StatusNotFound,
+	wsErrUnavailable:         http.StatusServiceUnavailable,
+	wsErrUnsupportedProtocol: http.StatusBadRequest,
+	wsErrInternal:            http.StatusInternalServerError,
+	wsErrTimeout:             http.StatusGatewayTimeout,
+}
+
+// restRoute is one /api/v1 endpoint. A route with a cmd runs that /ws
+// command, taking its parameters from the path, the query string and the
+// JSON body; the others have their own handler.
+type restRoute struct {
+	method  string
+	path    string
+	tag     string // OpenAPI group
+	summary string
+
+	cmd  string // the /ws command it runs
+	body string // the parameter the body fills; "" = the body is the parameters
+	list bool   // the command sends messages before its reply
+
+	role    Role        // least role, for routes with their own handler
+	params  interface{} // parameters of a route with its own handler; nil if none
+	reply   interface{} // reply of a route with its own handler
+	stream  bool        // serves server-sent events
+	audit   string      // audit action, recorded when the role refuses it too
+	handler http.HandlerFunc
+}
+
+// restRoutes is every /api/v1 endpoint. It is filled in init, as the
+// OpenAPI document is one of them.
+var restRoutes []restRoute
+
+// RestMessages answers a command that sends messages before its reply,
+// such as the monitor history.
+type RestMessages struct {
+	Messages []json.RawMessage `json:"messages"`
+	Reply    json.RawMessage   `json:"reply"` // the command's reply: an ack, or load_complete
+}
+
+// MonitorParams selects monitor messages: the latest, those after a
+// sequence number, waiting up to wait seconds for some if there are none
+// yet, or those before one.
+type MonitorParams struct {
+	After  int64 `json:"after,omitempty"`
+	Before int64 `json:"before,omitempty"`
+	Limit  int   `json:"limit,omitempty"`
+	Wait   int   `json:"wait,omitempty"`
+}
+
+// ChatMessagesParams selects chat messages as MonitorParams selects
+// monitor messages.
+type ChatMessagesParams struct {
+	After  int64 `json:"after,omitempty"`
+	Before int64 `json:"before,omitempty"`
+	Limit  int   `json:"limit,omitempty"` // default 200, at most 500
+	Wait   int   `json:"wait,omitempty"`
+}
+
+// ChatMessagesMessage is a page of chat messages.
+type ChatMessagesMessage struct {
+	Type     string         `json:"type"` // "chat_messages"
+	Messages []*ChatMessage `json:"messages"`
+	Buffer   ChatBufferInfo `json:"buffer"`
+}
+
+// ChatSendParams is a chat message to send as the station.
+type ChatSendParams struct {
+	Message string `json:"message"`
+}
+
+// BBSListParams asks for a BBS message listing.
+type BBSListParams struct {
+	ListType string `json:"listType,omitempty"` // "LM", "LB", "LL 20", ...; default LM
+}
+
+// BBSNumberParams names a BBS message.
+type BBSNumberParams struct {
+	Number int `json:"number"`
+}
+
+// BBSSendParams is a BBS message to send.
+type BBSSendParams struct {
+	To       string `json:"to"`
+	Subject  string `json:"subject"`
+	Body     string `json:"body"`
+	Bulletin bool   `json:"bulletin,omitempty"`
+}
+
+// NodeExecParams is a console command to run on the node.
+type NodeExecParams struct {
+	Command string `json:"command"`
+	Timeout int    `json:"timeout,omitempty"` // seconds to wait for output; default 15, at most 60
+}
+
+// NodeExecMessage is what a console command printed.
+type NodeExecMessage struct {
+	Type    string   `json:"type"` // "node_exec"
+	Command string   `json:"command"`
+	Lines   []string `json:"lines"`
+	Prompt  string   `json:"prompt,omitempty"`
+	Ended   string   `json:"ended"` // "prompt", "quiet" (no more output for a while) or "timeout"
+	// Truncated is set when output came faster than it could be collected
+	// and some was lost.
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+func init() {
+	restRoutes = []restRoute{
+		{method: "GET", path: "/api/v1/monitor", tag: "monitor", summary: "Monitor messages: the latest, those after a sequence number (long-polling with wait), or those before one.",
+			params: MonitorParams{}, reply: RestMessages{}, handler: restMonitor},
+		{method: "GET", path: "/api/v1/monitor/status", tag: "monitor", cmd: "status"},
+		{method: "GET", path: "/api/v1/events", tag: "monitor", summary: "Every /ws broadcast as server-sent events: monitor lines, sessions, link stats and feature statuses.",
+			stream: true, handler: eventStreamHandler(monitorFeed, func(seq int64) []string { return dataBuffer.getSince(seq) })},
+
+		{method: "GET", path: "/api/v1/sessions", tag: "sessions", cmd: "get_sessions"},
+		{method: "GET", path: "/api/v1/sessions/history", tag: "sessions", cmd: "get_session_history"},
+		{method: "GET", path: "/api/v1/sessions/{session_id}/timeline", tag: "sessions", cmd: "get_session_timeline"},
+		{method: "GET", path: "/api/v1/user-sessions", tag: "sessions", cmd: "get_user_sessions"},
+		{method: "GET", path: "/api/v1/stations/{station}", tag: "sessions", cmd: "get_station"},
+
+		{method: "GET", path: "/api/v1/link-stats", tag: "link stats", cmd: "get_link_stats"},
+		{method: "GET", path: "/api/v1/link-stats/{port_num}/history", tag: "link stats", cmd: "get_link_stats_history"},
+		{method: "GET", path: "/api/v1/link-stats/query", tag: "link stats", cmd: "query_link_stats"},
+		{method: "GET", path: "/api/v1/link-anomalies", tag: "link stats", cmd: "get_link_anomalies"},
+		{method: "GET", path: "/api/v1/link-trends", tag: "link stats", cmd: "get_link_trends"},
+		{method: "GET", path: "/api/v1/bulletin-queue", tag: "link stats", cmd: "get_bulletin_queue"},
+
+		{method: "GET", path: "/api/v1/features", tag: "features", cmd: "feature_status", list: true},
+		{method: "GET", path: "/api/v1/features/{feature}", tag: "features", cmd: "feature_status"},
+		{method: "POST", path: "/api/v1/features/{feature}/connect", tag: "features", cmd: "feature_connect"},
+		{method: "POST", path: "/api/v1/features/{feature}/disconnect", tag: "features", cmd: "feature_disconnect"},
+		{method: "GET", path: "/api/v1/settings", tag: "features", cmd: "get_settings"},
+		{method: "PUT", path: "/api/v1/settings/{feature}", tag: "features", cmd: "update_settings", body: "settings"},
+
+		{method: "GET", path: "/api/v1/chat", tag: "chat", summary: "The chat connection's status.",
+			reply: ChatMessage{}, handler: restChatStatus},
+		{method: "GET", path: "/api/v1/chat/messages", tag: "chat", summary: "Chat messages: the latest, those after a sequence number (long-polling with wait), or those before one.",
+			params: ChatMessagesParams{}, reply: ChatMessagesMessage{}, handler: restChatMessages},
+		{method: "POST", path: "/api/v1/chat/messages", tag: "chat", summary: "Send a chat message as the station.",
+			role: chatCommandRoles["send"], params: ChatSendParams{}, reply: AckMessage{}, audit: auditChatSend, handler: restChatSend},
+		{method: "GET", path: "/api/v1/chat/users", tag: "chat", summary: "The users in chat.",
+			reply: ChatMessage{}, handler: restChatUsers},
+		{method: "GET", path: "/api/v1/chat/events", tag: "chat", summary: "Every /ws/chat broadcast as server-sent events.",
+			stream: true, handler: eventStreamHandler(chatFeed, chatMessagesSince)},
+
+		{method: "GET", path: "/api/v1/bbs", tag: "bbs", summary: "The BBS connection's status.",
+			reply: BBSClientMessage{}, handler: restBBSStatus},
+		{method: "POST", path: "/api/v1/bbs/enter", tag: "bbs", summary: "Enter BBS mode.",
+			role: bbsCommandRoles["enter"], reply: BBSClientMessage{}, handler: restBBSEnter},
+		{method: "POST", path: "/api/v1/bbs/exit", tag: "bbs", summary: "Leave BBS mode.",
+			role: bbsCommandRoles["exit"], reply: BBSClientMessage{}, handler: restBBSExit},
+		{method: "GET", path: "/api/v1/bbs/messages", tag: "bbs", summary: "List messages, waiting for the BBS's listing.",
+			params: BBSListParams{}, reply: BBSClientMessage{}, handler: restBBSList},
+		{method: "GET", path: "/api/v1/bbs/messages/{number}", tag: "bbs", summary: "Read a message, waiting for the BBS to send it.",
+			role: bbsCommandRoles["read"], params: BBSNumberParams{}, reply: BBSClientMessage{}, handler: restBBSRead},
+		{method: "POST", path: "/api/v1/bbs/messages", tag: "bbs", summary: "Send a message, waiting for the BBS to confirm it.",
+			role: bbsCommandRoles["send"], params: BBSSendParams{}, reply: BBSClientMessage{}, audit: auditBBSSend, handler: restBBSSend},
+		{method: "DELETE", path: "/api/v1/bbs/messages/{number}", tag: "bbs", summary: "Delete a message.",
+			role: bbsCommandRoles["delete"], params: BBSNumberParams{}, reply: BBSClientMessage{}, audit: auditBBSDelete, handler: restBBSDelete},
+		{method: "GET", path: "/api/v1/bbs/events", tag: "bbs", summary: "Every /ws/bbs broadcast as server-sent events, which include the messages read.",
+			role: bbsCommandRoles["read"], stream: true, handler: eventStreamHandler(bbsFeed, nil)},
+
+		{method: "GET", path: "/api/v1/node", tag: "node", summary: "The node console's status.",
+			role: RoleOperator, reply: NodeMessage{}, handler: restNodeStatus},
+		{method: "POST", path: "/api/v1/node/exec", tag: "node", summary: "Run a console command and return its output, collected until the node prompts, goes quiet or the timeout passes.",
+			role: RoleOperator, params: NodeExecParams{}, reply: NodeExecMessage{}, audit: auditNodeExec, handler: restNodeExec},
+		{method: "GET", path: "/api/v1/node/events", tag: "node", summary: "Every /ws/node broadcast as server-sent events.",
+			role: RoleOperator, stream: true, handler: eventStreamHandler(nodeFeed, func(seq int64) []string {
+				if nodeBuffer == nil {
+					return nil
+				}
+				return nodeBuffer.getSince(seq)
+			})},
+
+		{method: "GET", path: "/api/v1/audit", tag: "audit", summary: "Operator actions over a period, newest first, with how many transmitted and whether the log covers the whole period.",
+			role: RoleAdmin, params: AuditParams{}, reply: AuditReport{}, handler: restAudit},
+
+		{method: "GET", path: "/api/v1/openapi.json", tag: "meta", summary: "This API's OpenAPI document.",
+			reply: map[string]interface{}{}, handler: openAPIHandler},
+	}
+}
+
+// resolved fills in a command route's role, parameters and summary from
+// its /ws command, which ws_commands.go registers in its own init.
+func (route restRoute) resolved() restRoute {
+	if route.cmd != "" {
+		cmd := wsCommands[route.cmd]
+		route.role = cmd.role
+		route.params = cmd.params
+		route.audit = cmd.audit
+		if route.summary == "" {
+			route.summary = cmd.doc
+		}
+	}
+	if route.role == "" {
+		route.role = RoleViewer
+	}
+	return route
+}
+
+// setupRESTRoutes adds the /api/v1 endpoints.
+func setupRESTRoutes() {
+	addRESTRoutes(http.DefaultServeMux)
+}
+
+func addRESTRoutes(mux *http.ServeMux) {
+	for _, route := range restRoutes {
+		mux.Handle(route.method+" "+route.path, route.resolved())
+	}
+	mux.HandleFunc("/api/v1/", func(w http.ResponseWriter, r *http.Request) {
+		writeRESTError(w, "", wsErrorf(wsErrNotFound, "no such endpoint"))
+	})
+}
+
+func (route restRoute) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !requestRole(r).Allows(route.role) {
+		if route.audit != "" {
+			requestActor(r).record(route.audit, "", false, errAuditDenied)
+		}
+		writeRESTError(w, route.cmd, wsErrorf(wsErrPermissionDenied, "permission denied"))
+		return
+	}
+	// Browsers send an Origin with cross-site requests; refuse writes from
+	// origins the WebSockets would refuse
+	if r.Method != http.MethodGet && !checkWebSocketOrigin(r) {
+		writeRESTError(w, route.cmd, wsErrorf(wsErrPermissionDenied, "origin not allowed"))
+		return
+	}
+	if route.handler != nil {
+		route.handler(w, r)
+		return
+	}
+	params, err := restParams(r, route.params, route.body)
+	if err != nil {
+		writeRESTError(w, route.cmd, err)
+		return
+	}
+	writeCommandReply(w, runCommand(r, route.cmd, params), route.list)
+}
+
+// restCollector is a REST request's wsOutput: it keeps what a command
+// sends, for the response.
+type restCollector struct {
+	messages []json.RawMessage
+}
+
+func (c *restCollector) write(message string) error {
+	c.messages = append(c.messages, json.RawMessage(message))
+	return nil
+}
+
+func (c *restCollector) writeBatch(messages []string) error {
+	for _, m := range messages {
+		c.write(m)
+	}
+	return nil
+}
+
+// runCommand runs a /ws command for a REST request, as its user, and
+// returns what it sent; the reply, or an error, is last.
+func runCommand(r *http.Request, cmd string, params map[string]interface{}) []json.RawMessage {
+	if params == nil {
+		params = map[string]interface{}{}
+	}
+	params["cmd"] = cmd
+	data, err := json.Marshal(params)
+	if err != nil {
+		data = []byte(fmt.Sprintf(`{"cmd":%q}`, cmd))
+	}
+	c := &restCollector{}
+	s := &wsSession{out: c, role: requestRole(r), actor: requestActor(r)}
+	s.handle(data)
+	return c.messages
+}
+
+// writeCommandReply writes a command's reply, with the messages before it
+// if list is set, or its error with the matching status.
+func writeCommandReply(w http.ResponseWriter, messages []json.RawMessage, list bool) {
+	if len(messages) == 0 {
+		writeRESTError(w, "", wsErrorf(wsErrInternal, "no reply"))
+		return
+	}
+	reply := messages[len(messages)-1]
+	var head struct {
+		Type string `json:"type"`
+		Code string `json:"code"`
+	}
+	json.Unmarshal(reply, &head)
+	if head.Type == "error" {
+		writeJSONStatus(w, restStatus(head.Code), reply)
+		return
+	}
+	if list {
+		writeJSONStatus(w, http.StatusOK, RestMessages{Messages: append([]json.RawMessage{}, messages[:len(messages)-1]...), Reply: reply})
+		return
+	}
+	writeJSONStatus(w, http.StatusOK, reply)
+}
+
+func restStatus(code string) int {
+	if status, ok := restErrorStatus[code]; ok {
+		return status
+	}
+	return http.StatusInternalServerError
+}
+
+// writeRESTError writes an error as /ws would send it, with the matching
+// status. Errors that are not a wsError are internal.
+func writeRESTError(w http.ResponseWriter, cmd string, err error) {
+	werr, ok := err.(*wsError)
+	if !ok {
+		wsLog.Warnw("REST request failed", "cmd", cmd, "error", err)
+		werr = wsErrorf(wsErrInternal, "%v", err)
+	}
+	writeJSONStatus(w, restStatus(werr.code), &ErrorMessage{Type: "error", Cmd: cmd, Code: werr.code, Error: werr.message})
+}
+
+func writeJSONStatus(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// restParams builds a command's parameters, as the JSON object /ws would
+// be sent, from a request: the JSON body, then query parameters and path
+// values converted to the types of the parameters struct's fields. body
+// names the parameter the request body fills, if not all of them.
+func restParams(r *http.Request, params interface{}, body string) (map[string]interface{}, error) {
+	m := map[string]interface{}{}
+	if r.Body != nil && (r.Method == http.MethodPost || r.Method == http.MethodPut) {
+		data, err := io.ReadAll(http.MaxBytesReader(nil, r.Body, 1<<20))
+		if err != nil {
+			return nil, wsErrorf(wsErrBadRequest, "failed to read body: %v", err)
+		}
+		if len(strings.TrimSpace(string(data))) > 0 {
+			if body != "" {
+				m[body] = json.RawMessage(data)
+			} else if err := json.Unmarshal(data, &m); err != nil {
+				return nil, wsErrorf(wsErrBadRequest, "body must be a JSON object: %v", err)
+			}
+		}
+	}
+	if params == nil {
+		return m, nil
+	}
+	q := r.URL.Query()
+	t := reflect.TypeOf(params)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		raw := r.PathValue(name)
+		ok := raw != ""
+		if !ok {
+			raw, ok = strings.Join(q[name], ","), q.Has(name)
+		}
+		if !ok {
+			continue
+		}
+		v, err := restParamValue(f.Type, raw)
+		if err != nil {
+			return nil, wsErrorf(wsErrInvalidParams, "%s: %v", name, err)
+		}
+		m[name] = v
+	}
+	return m, nil
+}
+
+// restParamValue converts a path or query value to a field's type. Lists
+// are comma-separated.
+func restParamValue(t reflect.Type, s string) (interface{}, error) {
+	switch t.Kind() {
+	case reflect.String:
+		return s, nil
+	case reflect.Bool:
+		if s == "" {
+			return true, nil // ?flag
+		}
+		return strconv.ParseBool(s)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a number", s)
+		}
+		return n, nil
+	case reflect.Slice:
+		list := []interface{}{}
+		for _, part := range strings.Split(s, ",") {
+			if part = strings.TrimSpace(part); part == "" {
+				continue
+			}
+			v, err := restParamValue(t.Elem(), part)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+		}
+		return list, nil
+	}
+	return nil, fmt.Errorf("cannot be given in a URL")
+}
+
+// decodeRESTParams reads a route's own parameters into params.
+func decodeRESTParams(r *http.Request, params interface{}) error {
+	m, err := restParams(r, reflect.ValueOf(params).Elem().Interface(), "")
+	if err != nil {
+		return err
+	}
+	data, _ := json.Marshal(m)
+	if err := json.Unmarshal(data, params); err != nil {
+		return wsErrorf(wsErrInvalidParams, "invalid parameters: %v", err)
+	}
+	return nil
+}
+
+// waitFor waits until ready reports true, checking again each time feed
+// publishes, for at most wait or until the request goes away.
+func waitFor(ctx context.Context, feed *eventFeed, wait time.Duration, ready func() bool) {
+	sub := feed.Subscribe()
+	defer feed.Unsubscribe(sub)
+	if ready() || wait <= 0 {
+		return
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	for {
+		select {
+		case <-sub.queue:
+			if ready() {
+				return
+			}
+		case <-timer.C:
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// longPollWait is a request's wait parameter, in seconds, as a duration.
+func longPollWait(seconds int) time.Duration {
+	return min(time.Duration(seconds)*time.Second, restLongPollMax)
+}
+
+func restMonitor(w http.ResponseWriter, r *http.Request) {
+	var p MonitorParams
+	if err := decodeRESTParams(r, &p); err != nil {
+		writeRESTError(w, "", err)
+		return
+	}
+	q := r.URL.Query()
+	switch {
+	case q.Has("before"):
+		writeCommandReply(w, runCommand(r, "load_before", map[string]interface{}{"before_seq": p.Before, "limit": p.Limit}), true)
+	case q.Has("after"):
+		extendWriteDeadline(w, longPollWait(p.Wait))
+		waitFor(r.Context(), monitorFeed, longPollWait(p.Wait), func() bool {
+			_, maxSeq, _ := dataBuffer.getInfo()
+			return maxSeq > p.After
+		})
+		writeCommandReply(w, runCommand(r, "sync", map[string]interface{}{"last_seq": p.After}), true)
+	default:
+		writeCommandReply(w, runCommand(r, "latest", map[string]interface{}{"limit": p.Limit}), true)
+	}
+}
+
+// eventStreamHandler serves a feed as server-sent events, one JSON message
+// per event named by its type. A client reconnecting with Last-Event-ID is
+// first sent what it missed, where replay can find it.
+func eventStreamHandler(feed *eventFeed, replay func(seq int64) []string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			writeRESTError(w, "", wsErrorf(wsErrInternal, "streaming not supported"))
+			return
+		}
+
+		// The stream outlives the server's write timeout
+		http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+		sub := feed.Subscribe()
+		defer feed.Unsubscribe(sub)
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+
+		bw := bufio.NewWriter(w)
+		if last, err := strconv.ParseInt(r.Header.Get("Last-Event-ID"), 10, 64); err == nil && replay != nil {
+			for _, m := range replay(last) {
+				writeEvent(bw, m)
+			}
+		}
+		bw.Flush()
+		flusher.Flush()
+
+		keepalive := time.NewTicker(restEventsKeepalive)
+		defer keepalive.Stop()
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-keepalive.C:
+				bw.WriteString(": keepalive\n\n")
+			case m := <-sub.queue:
+				writeEvent(bw, m)
+				// Batch whatever else is already waiting into the same flush
+				for len(sub.queue) > 0 {
+					writeEvent(bw, <-sub.queue)
+				}
+			}
+			if err := bw.Flush(); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// writeEvent writes one server-sent event, with the message's seq, if it
+// has one, as its id.
+func writeEvent(w *bufio.Writer, message string) {
+	var head struct {
+		Type string `json:"type"`
+		Seq  int64  `json:"seq"`
+	}
+	json.Unmarshal([]byte(message), &head)
+	if head.Seq > 0 {
+		fmt.Fprintf(w, "id: %d\n", head.Seq)
+	}
+	if head.Type != "" {
+		fmt.Fprintf(w, "event: %s\n", head.Type)
+	}
+	fmt.Fprintf(w, "data: %s\n\n", message)
+}
+
+var errNoChat = wsErrorf(wsErrUnavailable, "chat is not running")
+
+// chatMessagesSince returns stored chat messages after seq, as JSON.
+func chatMessagesSince(seq int64) []string {
+	if chatBuffer == nil {
+		return nil
+	}
+	var messages []string
+	for _, msg := range chatBuffer.GetMessagesSince(seq) {
+		if s := chatMessageToJSON(msg); s != "" {
+			messages = append(messages, s)
+		}
+	}
+	return messages
+}
+
+func restChatStatus(w http.ResponseWriter, r *http.Request) {
+	if chatClient == nil {
+		writeRESTError(w, "", errNoChat)
+		return
+	}
+	writeJSONStatus(w, http.StatusOK, &ChatMessage{Type: "chat_status", Connected: chatClient.IsConnected()})
+}
+
+func restChatUsers(w http.ResponseWriter, r *http.Request) {
+	if chatClient == nil {
+		writeRESTError(w, "", errNoChat)
+		return
+	}
+	writeJSONStatus(w, http.StatusOK, &ChatMessage{Type: "chat_users", Users: chatClient.GetUsers()})
+}
+
+func restChatMessages(w http.ResponseWriter, r *http.Request) {
+	var p ChatMessagesParams
+	if err := decodeRESTParams(r, &p); err != nil {
+		writeRESTError(w, "", err)
+		return
+	}
+	if chatBuffer == nil {
+		writeRESTError(w, "", errNoChat)
+		return
+	}
+	limit := p.Limit
+	if limit <= 0 || limit > 500 {
+		limit = 200
+	}
+	q := r.URL.Query()
+	var messages []*ChatMessage
+	switch {
+	case q.Has("before"):
+		messages = chatBuffer.GetMessagesBefore(p.Before, limit)
+	case q.Has("after"):
+		extendWriteDeadline(w, longPollWait(p.Wait))
+		waitFor(r.Context(), chatFeed, longPollWait(p.Wait), func() bool {
+			return chatBuffer.GetBufferInfo().MaxSeq > p.After
+		})
+		messages = chatBuffer.GetMessagesSince(p.After)
+	default:
+		messages = chatBuffer.GetLatestMessages(limit)
+	}
+	if messages == nil {
+		messages = []*ChatMessage{}
+	}
+	writeJSONStatus(w, http.StatusOK, &ChatMessagesMessage{Type: "chat_messages", Messages: messages, Buffer: chatBuffer.GetBufferInfo()})
+}
+
+func restChatSend(w http.ResponseWriter, r *http.Request) {
+	var p ChatSendParams
+	if err := decodeRESTParams(r, &p); err != nil {
+		writeRESTError(w, "send", err)
+		return
+	}
+	if p.Message == "" {
+		writeRESTError(w, "send", wsErrorf(wsErrInvalidParams, "message is empty"))
+		return
+	}
+	actor := requestActor(r)
+	if chatClient == nil {
+		actor.record(auditChatSend, p.Message, true, errNoChat)
+		writeRESTError(w, "send", errNoChat)
+		return
+	}
+	err := chatClient.SendMessage(p.Message)
+	actor.record(auditChatSend, p.Message, true, err)
+	if err != nil {
+		chatLog.Warnw("Failed to send chat message", "error", err)
+		writeRESTError(w, "send", wsErrorf(wsErrUnavailable, "failed to send message: %v", err))
+		return
+	}
+	writeJSONStatus(w, http.StatusOK, &AckMessage{Type: "ack", Cmd: "send"})
+}
+
+var errNoBBS = wsErrorf(wsErrUnavailable, "the BBS is not running")
+
+// bbsRESTMu keeps REST requests from talking over each other on the BBS
+// console, so that each gets its own answer.
+var bbsRESTMu = make(restLock, 1)
+
+func bbsStatusMessage() *BBSClientMessage {
+	return &BBSClientMessage{
+		Type:      "bbs_status",
+		Connected: bbsClient.IsConnected(),
+		InBBSMode: bbsClient.IsInBBSMode(),
+	}
+}
+
+func restBBSStatus(w http.ResponseWriter, r *http.Request) {
+	if bbsClient == nil {
+		writeRESTError(w, "status", errNoBBS)
+		return
+	}
+	writeJSONStatus(w, http.StatusOK, bbsStatusMessage())
+}
+
+func restBBSEnter(w http.ResponseWriter, r *http.Request) {
+	restBBSCommand(w, r, "enter", func() error { return bbsClient.EnterBBS() })
+}
+
+func restBBSExit(w http.ResponseWriter, r *http.Request) {
+	restBBSCommand(w, r, "exit", func() error { return bbsClient.ExitBBS() })
+}
+
+func restBBSDelete(w http.ResponseWriter, r *http.Request) {
+	var p BBSNumberParams
+	if err := decodeRESTParams(r, &p); err != nil {
+		writeRESTError(w, "delete", err)
+		return
+	}
+	err := restBBSCommand(w, r, "delete", func() error { return bbsClient.DeleteMessage(p.Number) })
+	requestActor(r).record(auditBBSDelete, strconv.Itoa(p.Number), false, err)
+}
+
+// restBBSCommand runs a BBS command that answers with nothing but a new
+// status, and replies with the status. It returns the error it replied
+// with, if any.
+func restBBSCommand(w http.ResponseWriter, r *http.Request, cmd string, run func() error) error {
+	if bbsClient == nil {
+		writeRESTError(w, cmd, errNoBBS)
+		return errNoBBS
+	}
+	if err := bbsRESTMu.lock(r.Context()); err != nil {
+		return err
+	}
+	extendWriteDeadline(w, restBBSTimeout)
+	err := run()
+	bbsRESTMu.unlock()
+	if err != nil {
+		werr := wsErrorf(wsErrUnavailable, "%v", err)
+		writeRESTError(w, cmd, werr)
+		return werr
+	}
+	writeJSONStatus(w, http.StatusOK, bbsStatusMessage())
+	return nil
+}
+
+func restBBSList(w http.ResponseWriter, r *http.Request) {
+	var p BBSListParams
+	if err := decodeRESTParams(r, &p); err != nil {
+		writeRESTError(w, "list", err)
+		return
+	}
+	restBBSAwait(w, r, "list", "bbs_list", func() error {
+		_, err := bbsClient.ListMessages(p.ListType)
+		return err
+	})
+}
+
+func restBBSRead(w http.ResponseWriter, r *http.Request) {
+	var p BBSNumberParams
+	if err := decodeRESTParams(r, &p); err != nil || p.Number <= 0 {
+		writeRESTError(w, "read", wsErrorf(wsErrInvalidParams, "number must be a message number"))
+		return
+	}
+	restBBSAwait(w, r, "read", "bbs_message", func() error {
+		_, err := bbsClient.ReadMessage(p.Number)
+		return err
+	})
+}
+
+func restBBSSend(w http.ResponseWriter, r *http.Request) {
+	var p BBSSendParams
+	if err := decodeRESTParams(r, &p); err != nil {
+		writeRESTError(w, "send", err)
+		return
+	}
+	if p.To == "" || p.Subject == "" {
+		writeRESTError(w, "send", wsErrorf(wsErrInvalidParams, "a message needs to and subject"))
+		return
+	}
+	err := restBBSAwait(w, r, "send", "bbs_sent", func() error {
+		_, err := bbsClient.SendMessage(p.To, p.Subject, p.Body, p.Bulletin)
+		return err
+	})
+	requestActor(r).record(auditBBSSend, bbsSendDetail(p.To, p.Subject, p.Body, p.Bulletin), true, err)
+}
+
+// restBBSAwait runs a BBS command whose answer Run() broadcasts, and
+// replies with the first broadcast of type want. It returns the error it
+// replied with, if any.
+func restBBSAwait(w http.ResponseWriter, r *http.Request, cmd, want string, run func() error) error {
+	if bbsClient == nil {
+		writeRESTError(w, cmd, errNoBBS)
+		return errNoBBS
+	}
+	if err := bbsRESTMu.lock(r.Context()); err != nil {
+		return err
+	}
+	defer bbsRESTMu.unlock()
+	extendWriteDeadline(w, restBBSTimeout)
+
+	sub := bbsFeed.Subscribe()
+	defer bbsFeed.Unsubscribe(sub)
+	if err := run(); err != nil {
+		werr := wsErrorf(wsErrUnavailable, "%v", err)
+		writeRESTError(w, cmd, werr)
+		return werr
+	}
+	timer := time.NewTimer(restBBSTimeout)
+	defer timer.Stop()
+	for {
+		select {
+		case m := <-sub.queue:
+			if messageType(m) == want {
+				writeJSONStatus(w, http.StatusOK, json.RawMessage(m))
+				return nil
+			}
+		case <-timer.C:
+			werr := wsErrorf(wsErrTimeout, "the BBS did not answer in %v", restBBSTimeout)
+			writeRESTError(w, cmd, werr)
+			return werr
+		case <-r.Context().Done():
+			return r.Context().Err()
+		}
+	}
+}
+
+var errNoNode = wsErrorf(wsErrUnavailable, "the node console is not running")
+
+// nodeExecMu runs console commands from REST and the web console one at a
+// time, so that each REST command collects only its own output.
+var nodeExecMu = make(restLock, 1)
+
+func restNodeStatus(w http.ResponseWriter, r *http.Request) {
+	if nodeClient == nil {
+		writeRESTError(w, "status", errNoNode)
+		return
+	}
+	writeJSONStatus(w, http.StatusOK, &NodeMessage{
+		Type:      "node_status",
+		Connected: nodeClient.IsConnected(),
+		Prompt:    nodeClient.GetPrompt(),
+	})
+}
+
+func restNodeExec(w http.ResponseWriter, r *http.Request) {
+	var p NodeExecParams
+	if err := decodeRESTParams(r, &p); err != nil {
+		writeRESTError(w, "exec", err)
+		return
+	}
+	if strings.TrimSpace(p.Command) == "" {
+		writeRESTError(w, "exec", wsErrorf(wsErrInvalidParams, "command is empty"))
+		return
+	}
+	actor := requestActor(r)
+	if nodeClient == nil {
+		actor.record(auditNodeExec, p.Command, true, errNoNode)
+		writeRESTError(w, "exec", errNoNode)
+		return
+	}
+	timeout := nodeExecTimeout
+	if p.Timeout > 0 {
+		timeout = min(time.Duration(p.Timeout)*time.Second, nodeExecTimeoutMax)
+	}
+
+	// Waiting behind another command, then for the output, can outlast
+	// the server's write timeout
+	if err := nodeExecMu.lock(r.Context()); err != nil {
+		return
+	}
+	defer nodeExecMu.unlock()
+	extendWriteDeadline(w, timeout)
+	sub := nodeFeed.Subscribe()
+	defer nodeFeed.Unsubscribe(sub)
+	err := nodeClient.SendCommand(p.Command)
+	actor.record(auditNodeExec, p.Command, true, err)
+	if err != nil {
+		writeRESTError(w, "exec", wsErrorf(wsErrUnavailable, "failed to send command: %v", err))
+		return
+	}
+	result := collectNodeOutput(r.Context(), sub, timeout, nodeExecQuiet)
+	result.Command = p.Command
+	writeJSONStatus(w, http.StatusOK, result)
+}
+
+// collectNodeOutput gathers console output from sub until the node prompts,
+// prints nothing more for quiet after its last line, or timeout passes.
+// The node does not always prompt, so quiet is what usually ends it.
+func collectNodeOutput(ctx context.Context, sub *eventSub, timeout, quiet time.Duration) *NodeExecMessage {
+	result := &NodeExecMessage{Type: "node_exec", Lines: []string{}, Ended: "timeout"}
+	defer func() { result.Truncated = sub.lost.Load() > 0 }()
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	// Until the first line, only the timeout applies
+	var idle *time.Timer
+	var idleC <-chan time.Time
+	defer func() {
+		if idle != nil {
+			idle.Stop()
+		}
+	}()
+	for {
+		select {
+		case m := <-sub.queue:
+			var msg NodeMessage
+			if err := json.Unmarshal([]byte(m), &msg); err != nil {
+				continue
+			}
+			switch msg.Type {
+			case "node_output":
+				result.Lines = append(result.Lines, msg.Lines...)
+				if idle == nil {
+					idle = time.NewTimer(quiet)
+					idleC = idle.C
+				} else {
+					idle.Reset(quiet)
+				}
+			case "node_prompt":
+				result.Prompt = msg.Prompt
+				result.Ended = "prompt"
+				return result
+			}
+		case <-idleC:
+			result.Ended = "quiet"
+			return result
+		case <-deadline.C:
+			return result
+		case <-ctx.Done():
+			return result
+		}
+	}
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRESTAPI(t *testing.T) {
+	oldBuffer, oldTracker := dataBuffer, sessionTrackerRef
+	t.Cleanup(func() { dataBuffer, sessionTrackerRef = oldBuffer, oldTracker })
+	dataBuffer = newCircularBuffer(10)
+	dataBuffer.add(1, `{"seq":1,"type":"log"}`)
+	dataBuffer.add(2, `{"seq":2,"type":"log"}`)
+	sessionTrackerRef = nil
+
+	mux := http.NewServeMux()
+	addRESTRoutes(mux)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if role := r.Header.Get("X-Test-Role"); role != "" {
+			r = r.WithContext(context.WithValue(r.Context(), webUserKey{}, &WebUser{Username: "test", Role: Role(role)}))
+		}
+		mux.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+
+	tests := []struct {
+		method, path, role, body string
+		code                     int
+		want                     string // JSON whose fields the response must have
+	}{
+		{"GET", "/api/v1/monitor/status", "", "", 200, `{"type":"status"}`},
+		{"GET", "/api/v1/monitor?limit=1", "", "", 200, `{"messages":[{"seq":2,"type":"log"}],"reply":{"type":"ack","cmd":"latest","count":1}}`},
+		{"GET", "/api/v1/monitor?after=1", "", "", 200, `{"messages":[{"seq":2,"type":"log"}]}`},
+		{"GET", "/api/v1/monitor?before=2", "", "", 200, `{"reply":{"type":"load_complete","beforeSeq":2,"count":1}}`},
+		{"GET", "/api/v1/monitor?limit=lots", "", "", 400, `{"type":"error","code":"invalid_params"}`},
+		{"GET", "/api/v1/sessions", "", "", 503, `{"type":"error","cmd":"get_sessions","code":"unavailable"}`},
+		{"GET", "/api/v1/features/fax", "", "", 400, `{"type":"error","code":"invalid_params"}`},
+		{"GET", "/api/v1/link-stats/two/history", "", "", 400, `{"type":"error","code":"invalid_params"}`},
+		{"GET", "/api/v1/settings", "viewer", "", 403, `{"type":"error","code":"permission_denied"}`},
+		{"PUT", "/api/v1/settings/chat", "viewer", `{"enabled":true}`, 403, `{"type":"error","code":"permission_denied"}`},
+		{"POST", "/api/v1/chat/messages", "viewer", `{"message":"hi"}`, 403, `{"type":"error","code":"permission_denied"}`},
+		{"POST", "/api/v1/node/exec", "operator", `{"command":" "}`, 400, `{"type":"error","cmd":"exec","code":"invalid_params"}`},
+		{"GET", "/api/v1/nope", "", "", 404, `{"type":"error","code":"not_found"}`},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest(tt.method, srv.URL+tt.path, strings.NewReader(tt.body))
+		if tt.role != "" {
+			req.Header.Set("X-Test-Role", tt.role)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s: %v", tt.method, tt.path, err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != tt.code {
+			t.Errorf("%s %s = %d %s, want %d", tt.method, tt.path, resp.StatusCode, body, tt.code)
+			continue
+		}
+		var got, want map[string]interface{}
+		if err := json.Unmarshal(body, &got); err != nil {
+			t.Fatalf("%s %s: reply %s: %v", tt.method, tt.path, body, err)
+		}
+		json.Unmarshal([]byte(tt.want), &want)
+		for k, v := range want {
+			if !jsonContains(got[k], v) {
+				t.Errorf("%s %s: reply %s, want %s = %v", tt.method, tt.path, body, k, v)
+			}
+		}
+	}
+
+	// A long poll returns once a new line is broadcast
+	done := make(chan string)
+	go func() {
+		resp, err := http.Get(srv.URL + "/api/v1/monitor?after=2&wait=10")
+		if err != nil {
+			done <- err.Error()
+			return
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		done <- string(body)
+	}()
+	time.Sleep(100 * time.Millisecond)
+	broadcast(3, `{"seq":3,"type":"log"}`)
+	select {
+	case body := <-done:
+		if !strings.Contains(body, `"seq":3`) {
+			t.Errorf("long poll = %s, want seq 3", body)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("long poll did not return after a broadcast")
+	}
+}
+
+// jsonContains reports whether got has every field of want, recursively;
+// arrays must match element by element.
+func jsonContains(got, want interface{}) bool {
+	switch w := want.(type) {
+	case map[string]interface{}:
+		g, ok := got.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		for k, v := range w {
+			if !jsonContains(g[k], v) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		g, ok := got.([]interface{})
+		if !ok || len(g) != len(w) {
+			return false
+		}
+		for i := range w {
+			if !jsonContains(g[i], w[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return reflect.DeepEqual(got, want)
+}
+
+func TestRESTParams(t *testing.T) {
+	mux := http.NewServeMux()
+	var got map[string]interface{}
+	mux.HandleFunc("PUT /settings/{feature}", func(w http.ResponseWriter, r *http.Request) {
+		got, _ = restParams(r, UpdateSettingsParams{}, "settings")
+	})
+	mux.HandleFunc("GET /query", func(w http.ResponseWriter, r *http.Request) {
+		got, _ = restParams(r, LinkStatsQueryParams{}, "")
+	})
+
+	req := httptest.NewRequest("PUT", "/settings/bbs?clearPassword", strings.NewReader(`{"enabled":true}`))
+	mux.ServeHTTP(httptest.NewRecorder(), req)
+	data, _ := json.Marshal(got)
+	if want := `{"clearPassword":true,"feature":"bbs","settings":{"enabled":true}}`; string(data) != want {
+		t.Errorf("update_settings params = %s, want %s", data, want)
+	}
+
+	mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/query?ports=1,2&metrics=frames:sum&hours=6", nil))
+	data, _ = json.Marshal(got)
+	if want := `{"hours":6,"metrics":["frames:sum"],"ports":[1,2]}`; string(data) != want {
+		t.Errorf("query_link_stats params = %s, want %s", data, want)
+	}
+}
+
+func TestCollectNodeOutput(t *testing.T) {
+	sub := nodeFeed.Subscribe()
+	defer nodeFeed.Unsubscribe(sub)
+	nodeFeed.Publish(`{"type":"node_output","lines":["Routes:"]}`)
+	nodeFeed.Publish(`{"type":"node_output","lines":["1 GB7RDG 192"]}`)
+	nodeFeed.Publish(`{"type":"node_prompt","prompt":"N0CALL de NODE>"}`)
+	got := collectNodeOutput(context.Background(), sub, time.Second, time.Second)
+	if got.Ended != "prompt" || got.Prompt != "N0CALL de NODE>" || len(got.Lines) != 2 {
+		t.Errorf("with a prompt: %+v", got)
+	}
+
+	nodeFeed.Publish(`{"type":"node_output","lines":["Nodes:"]}`)
+	got = collectNodeOutput(context.Background(), sub, 5*time.Second, 50*time.Millisecond)
+	if got.Ended != "quiet" || len(got.Lines) != 1 {
+		t.Errorf("without a prompt: %+v", got)
+	}
+
+	got = collectNodeOutput(context.Background(), sub, 50*time.Millisecond, time.Millisecond)
+	if got.Ended != "timeout" || len(got.Lines) != 0 || got.Truncated {
+		t.Errorf("without output: %+v", got)
+	}
+
+	// More output than the queue holds
+	for i := 0; i < eventFeedQueue+1; i++ {
+		nodeFeed.Publish(`{"type":"node_output","lines":["x"]}`)
+	}
+	got = collectNodeOutput(context.Background(), sub, 5*time.Second, 50*time.Millisecond)
+	if len(got.Lines) != eventFeedQueue || !got.Truncated {
+		t.Errorf("after overflowing: %d lines, truncated %v", len(got.Lines), got.Truncated)
+	}
+}
+
+func TestOpenAPIDocument(t *testing.T) {
+	data, err := json.Marshal(openAPIDocument())
+	if err != nil {
+		t.Fatalf("marshal document: %v", err)
+	}
+	var doc struct {
+		Paths map[string]map[string]struct {
+			Parameters []struct {
+				Name string `json:"name"`
+				In   string `json:"in"`
+			} `json:"parameters"`
+		} `json:"paths"`
+		Components struct {
+			Schemas map[string]interface{} `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatal(err)
+	}
+	for _, route := range restRoutes {
+		op, ok := doc.Paths[route.path][strings.ToLower(route.method)]
+		if !ok {
+			t.Errorf("%s %s is not in the document", route.method, route.path)
+			continue
+		}
+		for _, seg := range strings.Split(route.path, "/") {
+			if !strings.HasPrefix(seg, "{") {
+				continue
+			}
+			name := strings.Trim(seg, "{}")
+			found := false
+			for _, p := range op.Parameters {
+				found = found || (p.Name == name && p.In == "path")
+			}
+			if !found {
+				t.Errorf("%s %s does not declare path parameter %s", route.method, route.path, name)
+			}
+		}
+	}
+	for _, ref := range schemaRefs(string(data)) {
+		if _, ok := doc.Components.Schemas[strings.TrimPrefix(ref, "#/components/schemas/")]; !ok {
+			t.Errorf("dangling %s", ref)
+		}
+	}
+}
+
+// A request that waits longer than the server's write timeout still gets
+// its answer, and one queued at a console gives up when its client does.
+func TestRESTWaiting(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		extendWriteDeadline(w, 300*time.Millisecond)
+		time.Sleep(250 * time.Millisecond)
+		io.WriteString(w, "done")
+	}))
+	srv.Config.WriteTimeout = 100 * time.Millisecond
+	srv.Start()
+	t.Cleanup(srv.Close)
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "done" {
+		t.Errorf("body = %q, want the answer written after the write timeout", body)
+	}
+
+	l := make(restLock, 1)
+	if err := l.lock(context.Background()); err != nil {
+		t.Fatalf("lock: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := l.lock(ctx); err == nil {
+		t.Error("a second lock did not give up when its context ended")
+	}
+	l.unlock()
+	if err := l.lock(context.Background()); err != nil {
+		t.Errorf("lock after unlock: %v", err)
+	}
+}
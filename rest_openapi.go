@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+var openAPINonWord = regexp.MustCompile(`[^a-z0-9]+`)
+
+// openAPIDocument describes /api/v1 as OpenAPI 3.1, built from the route
+// table and the types the handlers send.
+func openAPIDocument() map[string]interface{} {
+	b := &jsonSchemaBuilder{defs: map[string]interface{}{}, refPrefix: "#/components/schemas/"}
+	errorResponse := map[string]interface{}{
+		"description": "The request failed; code says why.",
+		"content": map[string]interface{}{
+			"application/json": map[string]interface{}{"schema": b.schema(reflect.TypeOf(ErrorMessage{}))},
+		},
+	}
+
+	paths := map[string]interface{}{}
+	for _, route := range restRoutes {
+		route = route.resolved()
+		op := map[string]interface{}{
+			"operationId": strings.Trim(openAPINonWord.ReplaceAllString(strings.ToLower(route.method+" "+strings.TrimPrefix(route.path, "/api/v1")), "_"), "_"),
+			"summary":     route.summary,
+			"tags":        []string{route.tag},
+			"x-role":      route.role,
+		}
+		if route.cmd != "" {
+			op["x-ws-command"] = route.cmd
+		}
+		if params, body := openAPIParams(b, route); len(params) > 0 || body != nil {
+			if len(params) > 0 {
+				op["parameters"] = params
+			}
+			if body != nil {
+				op["requestBody"] = map[string]interface{}{
+					"required": true,
+					"content":  map[string]interface{}{"application/json": map[string]interface{}{"schema": body}},
+				}
+			}
+		}
+
+		var ok map[string]interface{}
+		if route.stream {
+			ok = map[string]interface{}{
+				"description": "Server-sent events, each a JSON message named by its type. Reconnect with Last-Event-ID to catch up where the stream can.",
+				"content": map[string]interface{}{
+					"text/event-stream": map[string]interface{}{"schema": map[string]interface{}{"type": "string"}},
+				},
+			}
+		} else {
+			ok = map[string]interface{}{
+				"description": "OK",
+				"content": map[string]interface{}{
+					"application/json": map[string]interface{}{"schema": openAPIReply(b, route)},
+				},
+			}
+		}
+		op["responses"] = map[string]interface{}{"200": ok, "default": errorResponse}
+
+		item, _ := paths[route.path].(map[string]interface{})
+		if item == nil {
+			item = map[string]interface{}{}
+			paths[route.path] = item
+		}
+		item[strings.ToLower(route.method)] = op
+	}
+
+	doc := map[string]interface{}{
+		"openapi": "3.1.0",
+		"info": map[string]interface{}{
+			"title":       "tarpn-mon REST API",
+			"version":     Version,
+			"description": "What the WebSocket protocols offer, for scripts. Monitor routes run the /ws command named in x-ws-command and answer with its reply; x-role is the least role a route needs when logins are on.",
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": b.defs,
+			"securitySchemes": map[string]interface{}{
+				"bearer":  map[string]interface{}{"type": "http", "scheme": "bearer"},
+				"session": map[string]interface{}{"type": "apiKey", "in": "cookie", "name": authCookieName},
+			},
+		},
+		"security": []interface{}{
+			map[string]interface{}{"bearer": []string{}},
+			map[string]interface{}{"session": []string{}},
+		},
+	}
+	if httpBasePath != "" {
+		doc["servers"] = []interface{}{map[string]interface{}{"url": httpBasePath}}
+	}
+	return doc
+}
+
+// openAPIParams returns a route's path and query parameters and its
+// request body schema, if it takes one.
+func openAPIParams(b *jsonSchemaBuilder, route restRoute) ([]interface{}, map[string]interface{}) {
+	if route.params == nil {
+		return nil, nil
+	}
+	hasBody := route.method == http.MethodPost || route.method == http.MethodPut
+	t := reflect.TypeOf(route.params)
+	var params []interface{}
+	var body map[string]interface{}
+	var bodyFields []string
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		switch {
+		case strings.Contains(route.path, "{"+name+"}"):
+			params = append(params, map[string]interface{}{"name": name, "in": "path", "required": true, "schema": b.schema(f.Type)})
+		case hasBody && route.body == name:
+			body = b.schema(f.Type)
+		case hasBody && route.body == "":
+			bodyFields = append(bodyFields, name)
+		default:
+			p := map[string]interface{}{"name": name, "in": "query", "schema": b.schema(f.Type)}
+			if f.Type.Kind() == reflect.Slice {
+				p["style"], p["explode"] = "form", false // comma-separated
+			}
+			params = append(params, p)
+		}
+	}
+	if len(bodyFields) > 0 {
+		body = b.object(t)
+		props := body["properties"].(map[string]interface{})
+		for name := range props {
+			if !slices.Contains(bodyFields, name) {
+				delete(props, name)
+			}
+		}
+		if required, ok := body["required"].([]string); ok {
+			body["required"] = slices.DeleteFunc(required, func(name string) bool { return !slices.Contains(bodyFields, name) })
+		}
+	}
+	return params, body
+}
+
+// openAPIReply returns the schema of a route's successful reply.
+func openAPIReply(b *jsonSchemaBuilder, route restRoute) map[string]interface{} {
+	if route.cmd == "" {
+		return b.schema(reflect.TypeOf(route.reply))
+	}
+	if route.list {
+		return b.schema(reflect.TypeOf(RestMessages{}))
+	}
+	var replies []interface{}
+	for _, name := range wsCommands[route.cmd].replies {
+		if name == "ack" && len(wsCommands[route.cmd].replies) > 1 {
+			continue // the ack ends a list
+		}
+		replies = append(replies, b.schema(reflect.TypeOf(wsMessageTypes[name])))
+	}
+	if len(replies) == 1 {
+		return replies[0].(map[string]interface{})
+	}
+	return map[string]interface{}{"oneOf": replies}
+}
+
+// openAPIHandler serves /api/v1/openapi.json.
+func openAPIHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(openAPIDocument())
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// secretKeyLen is the AES-256 key size held in a secret key file.
+const secretKeyLen = 32
+
+// SecretStore keeps credentials out of tarpn-mon.json, in a file of their
+// own readable only by its owner. With a key file the values are also
+// encrypted with AES-256-GCM, so a copy of the secrets file alone (a backup,
+// say) does not give them away.
+type SecretStore struct {
+	mu      sync.RWMutex
+	path    string
+	key     []byte // nil: values stored in plain text
+	secrets map[string]string
+}
+
+// secretsFile is the on-disk form. Encrypted values are base64 of the GCM
+// nonce followed by the sealed value, with the secret's name as additional
+// data so values cannot be swapped between names.
+type secretsFile struct {
+	Encrypted bool              `json:"encrypted"`
+	Secrets   map[string]string `json:"secrets"`
+}
+
+// NewSecretStore returns a store backed by path. Call Load to read it.
+func NewSecretStore(path string) *SecretStore {
+	return &SecretStore{path: path, secrets: make(map[string]string)}
+}
+
+// UseKeyFile encrypts the store with the key in path, creating a new random
+// key there if the file does not exist. Call it before Load.
+func (s *SecretStore) UseKeyFile(path string) error {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		key := make([]byte, secretKeyLen)
+		if _, err := rand.Read(key); err != nil {
+			return fmt.Errorf("failed to generate secret key: %w", err)
+		}
+		if err := writePrivateFile(path, []byte(hex.EncodeToString(key)+"\n")); err != nil {
+			return fmt.Errorf("failed to write secret key file: %w", err)
+		}
+		mainLog.Infow("Created secret key file", "path", path)
+		s.mu.Lock()
+		s.key = key
+		s.mu.Unlock()
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read secret key file: %w", err)
+	}
+	if err := enforcePrivateMode(path); err != nil {
+		return err
+	}
+	key, err := hex.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(key) != secretKeyLen {
+		return fmt.Errorf("secret key file %s does not hold a %d-byte hex key", path, secretKeyLen)
+	}
+	s.mu.Lock()
+	s.key = key
+	s.mu.Unlock()
+	return nil
+}
+
+// Load reads the secrets file. A missing file is not an error and leaves
+// the store empty. A plain-text file loaded with a key is encrypted in
+// place.
+func (s *SecretStore) Load() error {
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read secrets file: %w", err)
+	}
+	if err := enforcePrivateMode(s.path); err != nil {
+		return err
+	}
+	var file secretsFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("failed to parse secrets file: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if file.Encrypted && s.key == nil {
+		return fmt.Errorf("secrets file %s is encrypted; pass its key with -secret-key-file", s.path)
+	}
+	s.secrets = make(map[string]string, len(file.Secrets))
+	for name, value := range file.Secrets {
+		if file.Encrypted {
+			if value, err = s.openLocked(name, value); err != nil {
+				return err
+			}
+		}
+		s.secrets[name] = value
+	}
+	if s.key != nil && !file.Encrypted && len(s.secrets) > 0 {
+		return s.saveLocked()
+	}
+	return nil
+}
+
+// Get returns a secret, or "" if it is not set.
+func (s *SecretStore) Get(name string) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.secrets[name]
+}
+
+// Set stores a secret, or removes it if value is empty, and saves the file
+// if anything changed.
+func (s *SecretStore) Set(name, value string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.secrets[name] == value {
+		return nil
+	}
+	if value == "" {
+		delete(s.secrets, name)
+	} else {
+		s.secrets[name] = value
+	}
+	return s.saveLocked()
+}
+
+func (s *SecretStore) saveLocked() error {
+	file := secretsFile{Encrypted: s.key != nil, Secrets: make(map[string]string, len(s.secrets))}
+	for name, value := range s.secrets {
+		if s.key != nil {
+			var err error
+			if value, err = s.sealLocked(name, value); err != nil {
+				return err
+			}
+		}
+		file.Secrets[name] = value
+	}
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode secrets: %w", err)
+	}
+	if err := writePrivateFile(s.path, append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write secrets file: %w", err)
+	}
+	return nil
+}
+
+func (s *SecretStore) sealLocked(name, value string) (string, error) {
+	gcm, err := s.gcmLocked()
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(value), []byte(name))
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func (s *SecretStore) openLocked(name, value string) (string, error) {
+	gcm, err := s.gcmLocked()
+	if err != nil {
+		return "", err
+	}
+	sealed, err := base64.StdEncoding.DecodeString(value)
+	if err != nil || len(sealed) < gcm.NonceSize() {
+		return "", fmt.Errorf("secret %q is not valid ciphertext", name)
+	}
+	plain, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], []byte(name))
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt secret %q (wrong key file?)", name)
+	}
+	return string(plain), nil
+}
+
+func (s *SecretStore) gcmLocked() (cipher.AEAD, error) {
+	block, err := aes.NewCipher(s.key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	return gcm, nil
+}
+
+// enforcePrivateMode makes a file that holds secrets readable only by its
+// owner, if it was left open to others.
+func enforcePrivateMode(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("failed to stat %s: %w", path, err)
+	}
+	if info.Mode().Perm()&0077 == 0 {
+		return nil
+	}
+	mainLog.Warnw("File with secrets was readable by others; restricting it to its owner", "path", path, "mode", info.Mode().Perm())
+	if err := os.Chmod(path, 0600); err != nil {
+		return fmt.Errorf("failed to restrict permissions on %s: %w", path, err)
+	}
+	return nil
+}
+
+// writePrivateFile writes data to path with mode 0600, replacing any
+// existing file only once the new one is complete.
+func writePrivateFile(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSecretStoreEncrypted(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "secrets.json")
+	keyPath := filepath.Join(dir, "secret.key")
+
+	// A plain-text file, left readable by others
+	if err := os.WriteFile(path, []byte(`{"secrets":{"bbs.password":"hunter22"}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	store := NewSecretStore(path)
+	if err := store.UseKeyFile(keyPath); err != nil {
+		t.Fatalf("UseKeyFile: %v", err)
+	}
+	if err := store.Load(); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if got := store.Get("bbs.password"); got != "hunter22" {
+		t.Errorf("Get = %q", got)
+	}
+	for _, p := range []string{path, keyPath} {
+		if info, err := os.Stat(p); err != nil || info.Mode().Perm() != 0600 {
+			t.Errorf("%s mode = %v, %v, want 0600", filepath.Base(p), info.Mode().Perm(), err)
+		}
+	}
+	data, _ := os.ReadFile(path)
+	if strings.Contains(string(data), "hunter22") || !strings.Contains(string(data), `"encrypted": true`) {
+		t.Errorf("secrets file not encrypted on load:\n%s", data)
+	}
+
+	if err := store.Set("chat.password", "s3cret"); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	reloaded := NewSecretStore(path)
+	if err := reloaded.Load(); err == nil {
+		t.Error("encrypted file loaded without its key")
+	}
+	if err := reloaded.UseKeyFile(keyPath); err != nil {
+		t.Fatalf("UseKeyFile: %v", err)
+	}
+	if err := reloaded.Load(); err != nil || reloaded.Get("chat.password") != "s3cret" || reloaded.Get("bbs.password") != "hunter22" {
+		t.Errorf("reload = %q, %q, %v", reloaded.Get("chat.password"), reloaded.Get("bbs.password"), err)
+	}
+
+	// Another key cannot read it
+	other := NewSecretStore(path)
+	if err := other.UseKeyFile(filepath.Join(dir, "other.key")); err != nil {
+		t.Fatal(err)
+	}
+	if err := other.Load(); err == nil {
+		t.Error("loaded with the wrong key")
+	}
+}
+
+func TestAppSettingsPasswords(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "tarpn-mon.json")
+	secretsPath := filepath.Join(dir, "secrets.json")
+
+	// A settings file from before the secret store
+	legacy := `{"features":{"node":{"enabled":true,"host":"localhost","port":8010,"callsign":"WA2M","password":"nodepw"}}}`
+	if err := os.WriteFile(configPath, []byte(legacy), 0644); err != nil {
+		t.Fatal(err)
+	}
+	secrets := NewSecretStore(secretsPath)
+	settings := NewAppSettings(configPath, secrets)
+	if err := settings.Load(); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if got := settings.GetFeature("node").Password; got != "nodepw" {
+		t.Errorf("node password = %q after migration", got)
+	}
+	data, _ := os.ReadFile(configPath)
+	if strings.Contains(string(data), "nodepw") {
+		t.Errorf("settings file still holds the password:\n%s", data)
+	}
+	if secrets.Get("node.password") != "nodepw" {
+		t.Error("password not moved to the secret store")
+	}
+
+	// Clients see only whether a password is set
+	public := settings.GetPublicFeatures()
+	if public["node"].Password != "" || !public["node"].PasswordSet || public["bbs"].PasswordSet {
+		t.Errorf("public node = %+v, bbs = %+v", public["node"], public["bbs"])
+	}
+	msg, _ := json.Marshal(public)
+	if strings.Contains(string(msg), "nodepw") {
+		t.Errorf("password in client message: %s", msg)
+	}
+
+	// A restart finds the password in the secret store
+	restartedSecrets := NewSecretStore(secretsPath)
+	if err := restartedSecrets.Load(); err != nil {
+		t.Fatalf("Load secrets: %v", err)
+	}
+	restarted := NewAppSettings(configPath, restartedSecrets)
+	if err := restarted.Load(); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if got := restarted.GetFeature("node"); got.Password != "nodepw" || got.Callsign != "WA2M" {
+		t.Errorf("after restart node = %+v", got)
+	}
+
+	// A settings file that cannot be read still leaves the passwords, and
+	// saving the defaults over it keeps them in the store
+	if err := os.WriteFile(configPath, []byte("{not json"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	broken := NewAppSettings(configPath, restartedSecrets)
+	if err := broken.Load(); err == nil {
+		t.Error("loaded a broken settings file")
+	}
+	if got := broken.GetFeature("node").Password; got != "nodepw" {
+		t.Errorf("node password = %q after a failed load", got)
+	}
+	broken.Features["node"].Password = ""
+	if err := broken.Save(); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if restartedSecrets.Get("node.password") != "nodepw" {
+		t.Error("saving an empty password removed the stored one")
+	}
+}
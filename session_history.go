@@ -0,0 +1,427 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Session outcomes, from the LinkDownEvent reason.
+const (
+	SessionOutcomeNormal  = "normal"  // reason "Normal": a DISC/UA teardown
+	SessionOutcomeFailed  = "failed"  // any other reason, e.g. retried out
+	SessionOutcomeUnknown = "unknown" // no reason given
+)
+
+const (
+	// sessionHistoryLimit is how many sessions a query returns by default,
+	// and sessionHistoryMaxLimit the most it will return.
+	sessionHistoryLimit    = 100
+	sessionHistoryMaxLimit = 1000
+)
+
+// sessionOutcome classifies a LinkDownEvent reason.
+func sessionOutcome(reason string) string {
+	switch {
+	case strings.TrimSpace(reason) == "":
+		return SessionOutcomeUnknown
+	case strings.EqualFold(strings.TrimSpace(reason), "Normal"):
+		return SessionOutcomeNormal
+	default:
+		return SessionOutcomeFailed
+	}
+}
+
+// SessionRecord is a finished session as stored in the history table.
+type SessionRecord struct {
+	HistoryID    int64  `json:"historyId"`
+	DurationSecs int64  `json:"durationSecs"`
+	Outcome      string `json:"outcome"`
+	Session
+}
+
+// SessionHistoryFilter selects sessions from the history. Zero fields match
+// everything.
+type SessionHistoryFilter struct {
+	// Station matches either end of the session. Without an SSID it matches
+	// every SSID of the callsign.
+	Station string
+	Port    int
+	Since   time.Time // sessions that ended at or after Since
+	Until   time.Time // sessions that ended before Until
+	Outcome string
+	Limit   int
+}
+
+// where builds the SQL condition and arguments for the filter.
+func (f SessionHistoryFilter) where() (string, []interface{}) {
+	conds := []string{"1 = 1"}
+	var args []interface{}
+	if station := strings.ToUpper(strings.TrimSpace(f.Station)); station != "" {
+		if strings.Contains(station, "-") {
+			conds = append(conds, "(initiator = ? OR responder = ?)")
+			args = append(args, station, station)
+		} else {
+			conds = append(conds, "(initiator = ? OR initiator LIKE ? OR responder = ? OR responder LIKE ?)")
+			args = append(args, station, station+"-%", station, station+"-%")
+		}
+	}
+	if f.Port > 0 {
+		conds = append(conds, "port_num = ?")
+		args = append(args, f.Port)
+	}
+	if !f.Since.IsZero() {
+		conds = append(conds, "ended_at >= ?")
+		args = append(args, f.Since.UTC().Format(time.RFC3339))
+	}
+	if !f.Until.IsZero() {
+		conds = append(conds, "ended_at < ?")
+		args = append(args, f.Until.UTC().Format(time.RFC3339))
+	}
+	if f.Outcome != "" {
+		conds = append(conds, "outcome = ?")
+		args = append(args, f.Outcome)
+	}
+	return strings.Join(conds, " AND "), args
+}
+
+// SaveSessionHistory stores a finished session. A session that ends twice,
+// with a DM and then its link down event, replaces the earlier record of
+// the same connection, so that it is kept once with what the second knew.
+func (s *LinkStatsStorage) SaveSessionHistory(sess *Session) error {
+	ended := time.Now()
+	if sess.EndedAt != nil {
+		ended = *sess.EndedAt
+	}
+	var started interface{}
+	var duration int64
+	if sess.StartedAt != nil {
+		started = sess.StartedAt.UTC().Format(time.RFC3339)
+		duration = int64(ended.Sub(*sess.StartedAt).Seconds())
+	}
+	circuits, err := json.Marshal(sess.Circuits)
+	if err != nil {
+		return fmt.Errorf("failed to encode circuits: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to save session history: %w", err)
+	}
+	defer tx.Rollback()
+	if started != nil {
+		if _, err := tx.Exec(`DELETE FROM session_history WHERE session_key = ? AND started_at = ?`, sess.ID, started); err != nil {
+			return fmt.Errorf("failed to replace session history: %w", err)
+		}
+	}
+	_, err = tx.Exec(`
+		INSERT INTO session_history
+			(session_key, port_num, initiator, responder, started_at, ended_at, duration_secs,
+			 i_frames_sent, i_frames_rcvd, total_frames, retry_count, rej_count,
+			 timeout_retries, rej_retries, retry_rate, bytes_sent, bytes_rcvd, frames_resent,
+			 disconnect_reason, outcome, has_netrom, has_ip, has_text, circuits)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		sess.ID, sess.Port, strings.ToUpper(sess.Initiator), strings.ToUpper(sess.Responder),
+		started, ended.UTC().Format(time.RFC3339), duration,
+		sess.IFramesSent, sess.IFramesReceived, sess.TotalFrames, sess.RetryCount, sess.REJCount,
+		sess.TimeoutRetries, sess.REJRetries, sess.RetryRate, sess.BytesSent, sess.BytesReceived,
+		sess.FramesResent, sess.DisconnectReason, sessionOutcome(sess.DisconnectReason),
+		sess.HasNetROM, sess.HasIP, sess.HasText, string(circuits))
+	if err != nil {
+		return fmt.Errorf("failed to save session history: %w", err)
+	}
+	return tx.Commit()
+}
+
+// GetSessionHistory returns finished sessions matching f, most recently
+// ended first.
+func (s *LinkStatsStorage) GetSessionHistory(f SessionHistoryFilter) ([]SessionRecord, error) {
+	limit := f.Limit
+	if limit <= 0 {
+		limit = sessionHistoryLimit
+	}
+	if limit > sessionHistoryMaxLimit {
+		limit = sessionHistoryMaxLimit
+	}
+	where, args := f.where()
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rows, err := s.db.Query(`
+		SELECT id, session_key, port_num, initiator, responder, started_at, ended_at, duration_secs,
+		       i_frames_sent, i_frames_rcvd, total_frames, retry_count, rej_count,
+		       timeout_retries, rej_retries, retry_rate, bytes_sent, bytes_rcvd, frames_resent,
+		       disconnect_reason, outcome, has_netrom, has_ip, has_text, circuits
+		FROM session_history
+		WHERE `+where+`
+		ORDER BY ended_at DESC, id DESC
+		LIMIT ?`, append(args, limit)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query session history: %w", err)
+	}
+	defer rows.Close()
+
+	result := []SessionRecord{}
+	for rows.Next() {
+		var r SessionRecord
+		var started sql.NullString
+		var ended, circuits string
+		if err := rows.Scan(&r.HistoryID, &r.ID, &r.Port, &r.Initiator, &r.Responder, &started, &ended,
+			&r.DurationSecs, &r.IFramesSent, &r.IFramesReceived, &r.TotalFrames, &r.RetryCount,
+			&r.REJCount, &r.TimeoutRetries, &r.REJRetries, &r.RetryRate, &r.BytesSent,
+			&r.BytesReceived, &r.FramesResent, &r.DisconnectReason, &r.Outcome,
+			&r.HasNetROM, &r.HasIP, &r.HasText, &circuits); err != nil {
+			return nil, fmt.Errorf("failed to scan session history: %w", err)
+		}
+		if started.Valid {
+			t, _ := time.Parse(time.RFC3339, started.String)
+			r.StartedAt = &t
+		}
+		t, _ := time.Parse(time.RFC3339, ended)
+		r.EndedAt = &t
+		r.LastActivity = t
+		r.State = SessionDisconnected
+		if circuits != "" {
+			json.Unmarshal([]byte(circuits), &r.Circuits)
+		}
+		result = append(result, r)
+	}
+	return result, rows.Err()
+}
+
+// StationSessionStats summarises the finished sessions with one station.
+type StationSessionStats struct {
+	Callsign         string         `json:"callsign"`
+	Sessions         int            `json:"sessions"`
+	Failed           int            `json:"failed"`
+	MeanDurationSecs float64        `json:"meanDurationSecs"`
+	Bytes            int64          `json:"bytes"`
+	Retries          int            `json:"retries"`
+	LastEnded        time.Time      `json:"lastEnded"`
+	Reasons          map[string]int `json:"reasons"` // disconnect reason -> count
+}
+
+// GetStationSessionStats returns per-station totals over the sessions
+// matching f (ignoring its limit), busiest station first. Stations whose
+// base callsign is localCall are left out, as every session has the local
+// node at one end.
+func (s *LinkStatsStorage) GetStationSessionStats(f SessionHistoryFilter, localCall string) ([]StationSessionStats, error) {
+	where, args := f.where()
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rows, err := s.db.Query(`
+		SELECT initiator, responder, duration_secs, started_at IS NOT NULL,
+		       bytes_sent + bytes_rcvd, retry_count, disconnect_reason, outcome, ended_at
+		FROM session_history
+		WHERE `+where, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query session history: %w", err)
+	}
+	defer rows.Close()
+
+	local := baseCallsign(localCall)
+	byCall := make(map[string]*StationSessionStats)
+	timed := make(map[string]int) // sessions with a known duration
+	for rows.Next() {
+		var initiator, responder, reason, outcome, ended string
+		var duration, bytes int64
+		var retries int
+		var hasStart bool
+		if err := rows.Scan(&initiator, &responder, &duration, &hasStart, &bytes, &retries,
+			&reason, &outcome, &ended); err != nil {
+			return nil, fmt.Errorf("failed to scan session history: %w", err)
+		}
+		endedAt, _ := time.Parse(time.RFC3339, ended)
+		for _, call := range []string{initiator, responder} {
+			if call == "" || baseCallsign(call) == local {
+				continue
+			}
+			st, ok := byCall[call]
+			if !ok {
+				st = &StationSessionStats{Callsign: call, Reasons: make(map[string]int)}
+				byCall[call] = st
+			}
+			st.Sessions++
+			if outcome == SessionOutcomeFailed {
+				st.Failed++
+			}
+			if hasStart {
+				st.MeanDurationSecs += float64(duration)
+				timed[call]++
+			}
+			st.Bytes += bytes
+			st.Retries += retries
+			if endedAt.After(st.LastEnded) {
+				st.LastEnded = endedAt
+			}
+			if reason != "" {
+				st.Reasons[reason]++
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	result := make([]StationSessionStats, 0, len(byCall))
+	for call, st := range byCall {
+		if timed[call] > 0 {
+			st.MeanDurationSecs /= float64(timed[call])
+		}
+		result = append(result, *st)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Sessions != result[j].Sessions {
+			return result[i].Sessions > result[j].Sessions
+		}
+		return result[i].Callsign < result[j].Callsign
+	})
+	return result, nil
+}
+
+// PurgeOldSessionHistory drops sessions that ended before retention.
+func (s *LinkStatsStorage) PurgeOldSessionHistory(retention time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cutoff := time.Now().UTC().Add(-retention).Format(time.RFC3339)
+	if _, err := s.db.Exec(`DELETE FROM session_history WHERE ended_at < ?`, cutoff); err != nil {
+		return fmt.Errorf("failed to purge old session history: %w", err)
+	}
+	return nil
+}
+
+// runSessionHistoryPurge drops sessions older than retention once a day
+// until ctx is done.
+func runSessionHistoryPurge(ctx context.Context, storage *LinkStatsStorage, retention time.Duration) {
+	ticker := time.NewTicker(24 * time.Hour)
+	defer ticker.Stop()
+
+	for {
+		if err := storage.PurgeOldSessionHistory(retention); err != nil {
+			sessionLog.Errorw("Session history purge failed", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// sessionHistoryResponse is the payload of both the get_session_history
+// command and /api/sessions/history.
+type sessionHistoryResponse struct {
+	Sessions []SessionRecord       `json:"sessions"`
+	Stations []StationSessionStats `json:"stations"`
+}
+
+func querySessionHistory(storage *LinkStatsStorage, f SessionHistoryFilter) (*sessionHistoryResponse, error) {
+	sessions, err := storage.GetSessionHistory(f)
+	if err != nil {
+		return nil, err
+	}
+	stations, err := storage.GetStationSessionStats(f, reportCallsign())
+	if err != nil {
+		return nil, err
+	}
+	return &sessionHistoryResponse{Sessions: sessions, Stations: stations}, nil
+}
+
+// parseSessionHistoryFilter reads a filter from query parameters: station,
+// port, outcome, limit, and either hours (back from now) or since/until as
+// RFC 3339 times or local YYYY-MM-DD dates.
+func parseSessionHistoryFilter(q url.Values) (SessionHistoryFilter, error) {
+	f := SessionHistoryFilter{
+		Station: q.Get("station"),
+		Outcome: q.Get("outcome"),
+	}
+	switch f.Outcome {
+	case "", SessionOutcomeNormal, SessionOutcomeFailed, SessionOutcomeUnknown:
+	default:
+		return f, fmt.Errorf("outcome must be normal, failed or unknown")
+	}
+	for name, dst := range map[string]*int{"port": &f.Port, "limit": &f.Limit} {
+		if v := q.Get(name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return f, fmt.Errorf("%s must be a number", name)
+			}
+			*dst = n
+		}
+	}
+	if v := q.Get("hours"); v != "" {
+		hours, err := strconv.Atoi(v)
+		if err != nil || hours <= 0 {
+			return f, fmt.Errorf("hours must be a positive number")
+		}
+		f.Since = time.Now().Add(-time.Duration(hours) * time.Hour)
+	}
+	for name, dst := range map[string]*time.Time{"since": &f.Since, "until": &f.Until} {
+		v := q.Get(name)
+		if v == "" {
+			continue
+		}
+		t, err := parseTimeParam(name, v)
+		if err != nil {
+			return f, err
+		}
+		*dst = t
+	}
+	return f, nil
+}
+
+// parseTimeParam parses a since or until parameter: an RFC 3339 time, or
+// a local date meaning its midnight.
+func parseTimeParam(name, v string) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		t, err = time.ParseInLocation("2006-01-02", v, time.Local)
+	}
+	if err != nil {
+		return t, fmt.Errorf("%s must be an RFC 3339 time or YYYY-MM-DD", name)
+	}
+	return t, nil
+}
+
+// sessionHistoryHandler serves /api/sessions/history.
+func sessionHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	if neighborStorageRef == nil {
+		http.Error(w, "link stats storage not available", http.StatusServiceUnavailable)
+		return
+	}
+	f, err := parseSessionHistoryFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	resp, err := querySessionHistory(neighborStorageRef, f)
+	if err != nil {
+		wsLog.Warnw("Failed to query session history", "error", err)
+		http.Error(w, "failed to query session history", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// setupSessionHistoryRoutes adds the session history, user session and
+// link RTT APIs
+func setupSessionHistoryRoutes() {
+	http.HandleFunc("/api/sessions/history", sessionHistoryHandler)
+	http.HandleFunc("/api/sessions/users", userSessionsHandler)
+	http.HandleFunc("/api/rtt", linkRTTHandler)
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+// linkSession runs one session through the tracker, up then down.
+func linkSession(tracker *SessionTracker, port, remote, reason string, upFor int) {
+	tracker.HandleLinkUp(&LinkUpEvent{Direction: "outgoing", Port: port, Remote: remote, Local: "WA2M-2"})
+	tracker.HandleLinkDown(&LinkDownEvent{
+		Direction: "outgoing",
+		Port:      port,
+		Remote:    remote,
+		Local:     "WA2M-2",
+		BytesSent: 100,
+		BytesRcvd: 200,
+		Reason:    reason,
+		UpForSecs: upFor,
+	})
+}
+
+// Sessions ended through the tracker land in the history table, and can be
+// found again by station (with or without SSID), port and outcome.
+func TestSessionHistoryFromTracker(t *testing.T) {
+	s := newTestStorage(t)
+	tracker := NewSessionTracker(200, nil, testLogger())
+	tracker.SetEndFunc(func(sess *Session) {
+		if err := s.SaveSessionHistory(sess); err != nil {
+			t.Errorf("SaveSessionHistory: %v", err)
+		}
+	})
+
+	linkSession(tracker, "1", "N2XYZ-2", "Normal", 0)
+	linkSession(tracker, "1", "N2XYZ-7", "Retried Out", 0)
+	linkSession(tracker, "2", "N2XYZ-2", "Retried Out", 0)
+	linkSession(tracker, "2", "K1ABC-2", "Normal", 0)
+
+	all, err := s.GetSessionHistory(SessionHistoryFilter{})
+	if err != nil {
+		t.Fatalf("GetSessionHistory: %v", err)
+	}
+	if len(all) != 4 {
+		t.Fatalf("got %d sessions, want 4", len(all))
+	}
+	if all[0].Responder != "K1ABC-2" || all[0].State != SessionDisconnected || all[0].EndedAt == nil {
+		t.Errorf("newest = %+v, want the K1ABC-2 session, disconnected", all[0])
+	}
+
+	tests := []struct {
+		name   string
+		filter SessionHistoryFilter
+		want   int
+	}{
+		{"base call", SessionHistoryFilter{Station: "n2xyz"}, 3},
+		{"exact SSID", SessionHistoryFilter{Station: "N2XYZ-7"}, 1},
+		{"port", SessionHistoryFilter{Station: "N2XYZ", Port: 2}, 1},
+		{"failed", SessionHistoryFilter{Outcome: SessionOutcomeFailed}, 2},
+		{"normal", SessionHistoryFilter{Outcome: SessionOutcomeNormal}, 2},
+		{"limit", SessionHistoryFilter{Limit: 1}, 1},
+		{"future", SessionHistoryFilter{Since: time.Now().Add(time.Hour)}, 0},
+	}
+	for _, tt := range tests {
+		got, err := s.GetSessionHistory(tt.filter)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if len(got) != tt.want {
+			t.Errorf("%s: got %d sessions, want %d", tt.name, len(got), tt.want)
+		}
+	}
+}
+
+// Per-station stats leave out the local node, count failures and reasons,
+// and average durations over sessions with a known start.
+func TestStationSessionStats(t *testing.T) {
+	s := newTestStorage(t)
+	end := time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)
+	save := func(remote, reason string, dur time.Duration) {
+		t.Helper()
+		start, ended := end.Add(-dur), end
+		sess := &Session{ID: "k", Port: 1, Initiator: "WA2M-2", Responder: remote,
+			EndedAt: &ended, DisconnectReason: reason, BytesSent: 10, BytesReceived: 5}
+		if dur > 0 {
+			sess.StartedAt = &start
+		}
+		if err := s.SaveSessionHistory(sess); err != nil {
+			t.Fatalf("SaveSessionHistory: %v", err)
+		}
+	}
+	save("N2XYZ-2", "Normal", 10*time.Minute)
+	save("N2XYZ-2", "Retried Out", 20*time.Minute)
+	save("N2XYZ-2", "Retried Out", 0) // start unknown
+	save("K1ABC-2", "Normal", time.Minute)
+
+	stats, err := s.GetStationSessionStats(SessionHistoryFilter{}, "WA2M")
+	if err != nil {
+		t.Fatalf("GetStationSessionStats: %v", err)
+	}
+	if len(stats) != 2 {
+		t.Fatalf("got %+v, want N2XYZ-2 and K1ABC-2 only", stats)
+	}
+	n := stats[0]
+	if n.Callsign != "N2XYZ-2" || n.Sessions != 3 || n.Failed != 2 {
+		t.Errorf("stats[0] = %+v, want N2XYZ-2 with 3 sessions, 2 failed", n)
+	}
+	if n.MeanDurationSecs != 900 {
+		t.Errorf("MeanDurationSecs = %v, want 900", n.MeanDurationSecs)
+	}
+	if n.Reasons["Retried Out"] != 2 || n.Reasons["Normal"] != 1 {
+		t.Errorf("Reasons = %v", n.Reasons)
+	}
+	if n.Bytes != 45 || !n.LastEnded.Equal(end) {
+		t.Errorf("Bytes = %d, LastEnded = %v", n.Bytes, n.LastEnded)
+	}
+}
+
+// The tracker fills in a start time from upForSecs when it missed the link
+// coming up.
+func TestLinkDownStartFromUpForSecs(t *testing.T) {
+	tracker := NewSessionTracker(200, nil, testLogger())
+	var ended *Session
+	tracker.SetEndFunc(func(sess *Session) { ended = sess })
+
+	tracker.HandleLinkDown(&LinkDownEvent{Port: "1", Remote: "N2XYZ-2", Local: "WA2M-2", Reason: "Normal", UpForSecs: 90})
+	if ended == nil || ended.StartedAt == nil {
+		t.Fatalf("ended = %+v, want a start time", ended)
+	}
+	if d := ended.EndedAt.Sub(*ended.StartedAt); d != 90*time.Second {
+		t.Errorf("duration = %v, want 90s", d)
+	}
+}
+
+// Sessions that end with a DM or are closed by Reconcile are saved too,
+// and a DM followed by the link down event is saved once, with the reason.
+func TestSessionHistoryOtherEnds(t *testing.T) {
+	s := newTestStorage(t)
+	tracker := NewSessionTracker(200, nil, testLogger())
+	tracker.SetEndFunc(func(sess *Session) {
+		if err := s.SaveSessionHistory(sess); err != nil {
+			t.Errorf("SaveSessionHistory: %v", err)
+		}
+	})
+
+	for _, l2 := range []string{"C", "UA", "DM"} {
+		tracker.HandleL2Trace(&L2TraceEvent{Port: "1", Source: "WA2M-2", Dest: "N2XYZ-2", L2Type: l2, Direction: "sent"})
+	}
+	got, _ := s.GetSessionHistory(SessionHistoryFilter{Station: "N2XYZ-2"})
+	if len(got) != 1 {
+		t.Fatalf("after a DM: %d sessions saved, want 1", len(got))
+	}
+	tracker.HandleLinkDown(&LinkDownEvent{Direction: "outgoing", Port: "1", Remote: "N2XYZ-2", Local: "WA2M-2", Reason: "Retried Out"})
+	got, _ = s.GetSessionHistory(SessionHistoryFilter{Station: "N2XYZ-2"})
+	if len(got) != 1 || got[0].DisconnectReason != "Retried Out" {
+		t.Errorf("after the link down: %+v, want one session with its reason", got)
+	}
+
+	tracker.HandleLinkUp(&LinkUpEvent{Direction: "outgoing", Port: "2", Remote: "K1ABC-2", Local: "WA2M-2"})
+	tracker.Reconcile([]NodeLink{}, nil, time.Now())
+	got, _ = s.GetSessionHistory(SessionHistoryFilter{Station: "K1ABC-2"})
+	if len(got) != 1 || got[0].DisconnectReason != "Not up after restart" {
+		t.Errorf("after reconciling: %+v, want the closed session", got)
+	}
+}
+
+func TestParseSessionHistoryFilter(t *testing.T) {
+	f, err := parseSessionHistoryFilter(url.Values{
+		"station": {"N2XYZ"}, "port": {"2"}, "outcome": {"failed"},
+		"since": {"2025-03-01"}, "until": {"2025-03-08T00:00:00Z"}, "limit": {"50"},
+	})
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if f.Station != "N2XYZ" || f.Port != 2 || f.Outcome != "failed" || f.Limit != 50 {
+		t.Errorf("filter = %+v", f)
+	}
+	if want := time.Date(2025, 3, 1, 0, 0, 0, 0, time.Local); !f.Since.Equal(want) {
+		t.Errorf("Since = %v, want %v", f.Since, want)
+	}
+	if want := time.Date(2025, 3, 8, 0, 0, 0, 0, time.UTC); !f.Until.Equal(want) {
+		t.Errorf("Until = %v, want %v", f.Until, want)
+	}
+
+	for _, bad := range []url.Values{
+		{"outcome": {"dropped"}},
+		{"port": {"two"}},
+		{"hours": {"-1"}},
+		{"since": {"last week"}},
+	} {
+		if _, err := parseSessionHistoryFilter(bad); err == nil {
+			t.Errorf("parse(%v) succeeded, want error", bad)
+		}
+	}
+}
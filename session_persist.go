@@ -0,0 +1,316 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// trackerStateInterval is how often the session tracker is saved while
+// running, so that a crash loses at most this much.
+const trackerStateInterval = time.Minute
+
+// trackerState is the part of SessionTracker that is saved across restarts:
+// the sessions and circuits, and the N(S)/REJ history needed to keep
+// counting retries without a false one on the first frame.
+type trackerState struct {
+	SavedAt        time.Time            `json:"savedAt"`
+	Sessions       []*Session           `json:"sessions"`
+	Circuits       []Circuit            `json:"circuits"`
+	CircuitSession map[int]string       `json:"circuitSession"`
+	LastNS         map[string]int       `json:"lastNS"`
+	LastREJ        map[string]time.Time `json:"lastREJ"`
+}
+
+// State returns a copy of the tracker's state for saving.
+func (st *SessionTracker) State(now time.Time) *trackerState {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+
+	state := &trackerState{
+		SavedAt:        now,
+		Sessions:       make([]*Session, 0, len(st.ordered)),
+		CircuitSession: make(map[int]string, len(st.circuitSession)),
+		LastNS:         make(map[string]int, len(st.lastNS)),
+		LastREJ:        make(map[string]time.Time, len(st.lastREJ)),
+	}
+	for _, sess := range st.ordered {
+		cp := *sess
+		cp.Circuits = append([]Circuit(nil), sess.Circuits...)
+		state.Sessions = append(state.Sessions, &cp)
+	}
+	for _, c := range st.circuits {
+		state.Circuits = append(state.Circuits, *c)
+	}
+	for k, v := range st.circuitSession {
+		state.CircuitSession[k] = v
+	}
+	for k, v := range st.lastNS {
+		state.LastNS[k] = v
+	}
+	for k, v := range st.lastREJ {
+		state.LastREJ[k] = v
+	}
+	return state
+}
+
+// Restore loads saved state into an empty tracker. State saved more than
+// maxAge before now is ignored: links will have come and gone unseen, and
+// starting empty is better than showing them as up. It returns the number
+// of sessions restored.
+func (st *SessionTracker) Restore(state *trackerState, now time.Time, maxAge time.Duration) int {
+	if state == nil || now.Sub(state.SavedAt) > maxAge {
+		return 0
+	}
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	for _, sess := range state.Sessions {
+		st.sessions[sess.ID] = sess
+	}
+	for i := range state.Circuits {
+		c := state.Circuits[i]
+		st.circuits[c.ID] = &c
+		if c.State == "connected" {
+			if l4 := newL4State(&c, now); l4 != nil {
+				st.l4[c.ID] = l4
+			}
+		}
+	}
+	for k, v := range state.CircuitSession {
+		st.circuitSession[k] = v
+	}
+	for k, v := range state.LastNS {
+		st.lastNS[k] = v
+	}
+	for k, v := range state.LastREJ {
+		st.lastREJ[k] = v
+	}
+	st.pruneOldSessions()
+	st.rebuildOrdered()
+	return len(st.sessions)
+}
+
+// SaveTrackerState writes the tracker's state to path, replacing the file
+// only once the new one is complete.
+func SaveTrackerState(path string, st *SessionTracker) error {
+	data, err := json.Marshal(st.State(time.Now()))
+	if err != nil {
+		return fmt.Errorf("failed to encode session state: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to create session state file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write session state: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write session state: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace session state file: %w", err)
+	}
+	return nil
+}
+
+// LoadTrackerState reads state saved by SaveTrackerState. A missing file is
+// not an error and returns nil.
+func LoadTrackerState(path string) (*trackerState, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read session state: %w", err)
+	}
+	var state trackerState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("failed to parse session state: %w", err)
+	}
+	return &state, nil
+}
+
+// runTrackerPersist saves the tracker every trackerStateInterval until ctx
+// is done. The final save on shutdown is left to the caller, as ctx is
+// already cancelled by then and nothing should be racing it.
+func runTrackerPersist(ctx context.Context, st *SessionTracker, path string) {
+	ticker := time.NewTicker(trackerStateInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := SaveTrackerState(path, st); err != nil {
+				sessionLog.Warnw("Failed to save session state", "path", path, "error", err)
+			}
+		}
+	}
+}
+
+// NodeLink is one L2 link in the output of LinBPQ's LINKS command.
+type NodeLink struct {
+	Remote string
+	Local  string
+	Port   int
+	State  int // L2 state; 5 is information transfer (connected)
+}
+
+// linksRe matches a LINKS line: far call, our call, then S=state P=port.
+var linksRe = regexp.MustCompile(`^\s*(\S+)\s+(\S+)\s+S=\s*(\d+)\s+P=\s*(\d+)`)
+
+// ParseLinksOutput parses the output of the node's LINKS command.
+func ParseLinksOutput(lines []string) []NodeLink {
+	var links []NodeLink
+	for _, line := range lines {
+		m := linksRe.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		state, _ := strconv.Atoi(m[3])
+		port, _ := strconv.Atoi(m[4])
+		links = append(links, NodeLink{
+			Remote: strings.ToUpper(m[1]),
+			Local:  strings.ToUpper(m[2]),
+			Port:   port,
+			State:  state,
+		})
+	}
+	return links
+}
+
+// circuitsRe matches the "Circuit(CALL ALIAS)" entries of the CIRCUITS
+// command, one per L4 circuit end.
+var circuitsRe = regexp.MustCompile(`Circuit\(([^)]*)\)`)
+
+// ParseCircuitsOutput returns the base callsigns named in the L4 circuit
+// entries of the node's CIRCUITS command.
+func ParseCircuitsOutput(lines []string) map[string]bool {
+	calls := make(map[string]bool)
+	for _, line := range lines {
+		for _, m := range circuitsRe.FindAllStringSubmatch(line, -1) {
+			for _, f := range strings.Fields(m[1]) {
+				calls[baseCallsign(strings.TrimSuffix(f, ":"))] = true
+			}
+		}
+	}
+	return calls
+}
+
+// Reconcile corrects restored state against what the node reports. Links
+// the tracker has as up that the node does not list are closed, and links
+// the node lists that the tracker does not have are added as connected;
+// LINKS does not give the direction, so those show the local station as
+// initiator. Open circuits to nodes with no circuit in CIRCUITS are closed.
+// Nil links or circuitCalls mean the node's answer is unknown, and nothing
+// is closed for it. It returns the number of sessions and circuits changed.
+func (st *SessionTracker) Reconcile(links []NodeLink, circuitCalls map[string]bool, now time.Time) int {
+	defer st.flushEnded()
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	changed := 0
+	up := make(map[string]NodeLink)
+	for _, l := range links {
+		up[sessionKey(strconv.Itoa(l.Port), l.Remote, l.Local)] = l
+	}
+
+	for key, sess := range st.sessions {
+		if sess.State == SessionDisconnected {
+			continue
+		}
+		if l, ok := up[key]; ok {
+			// Links still being set up or torn down are left to the events
+			if l.State >= 5 && sess.State != SessionConnected {
+				sess.State = SessionConnected
+				changed++
+				st.notifyChangeLocked(sess, true)
+			}
+			continue
+		}
+		if links == nil {
+			continue
+		}
+		t := now
+		sess.State = SessionDisconnected
+		sess.EndedAt = &t
+		sess.DisconnectReason = "Not up after restart"
+		st.clearSessionNS(key)
+		changed++
+		st.notifyChangeLocked(sess, true)
+		st.endSessionLocked(sess)
+	}
+
+	for key, l := range up {
+		if _, ok := st.sessions[key]; ok || l.State < 5 {
+			continue
+		}
+		sess := &Session{
+			ID:           key,
+			Port:         l.Port,
+			Initiator:    l.Local,
+			Responder:    l.Remote,
+			State:        SessionConnected,
+			LastActivity: now,
+		}
+		st.sessions[key] = sess
+		changed++
+		st.notifyChangeLocked(sess, true)
+	}
+
+	if circuitCalls != nil {
+		for id, c := range st.circuits {
+			if c.State != "connected" || circuitCalls[baseCallsign(parseNetROMAddr(c.Remote).Node)] {
+				continue
+			}
+			c.State = "disconnected"
+			delete(st.l4, id)
+			if sess, ok := st.sessions[st.circuitSession[id]]; ok {
+				for i := range sess.Circuits {
+					if sess.Circuits[i].ID == id {
+						sess.Circuits[i].State = "disconnected"
+					}
+				}
+			}
+			changed++
+		}
+	}
+
+	st.rebuildOrdered()
+	return changed
+}
+
+// reconcileWithNode asks the node which links and circuits are up and
+// corrects the tracker to match.
+func reconcileWithNode(ctx context.Context, st *SessionTracker, collector *LinkStatsCollector) error {
+	linkLines, err := collector.NodeCommand(ctx, "LINKS")
+	if err != nil {
+		return fmt.Errorf("failed to list links: %w", err)
+	}
+	var circuitCalls map[string]bool
+	if cctLines, err := collector.NodeCommand(ctx, "CIRCUITS"); err != nil {
+		sessionLog.Warnw("Failed to list circuits; leaving restored circuits as they are", "error", err)
+	} else {
+		circuitCalls = ParseCircuitsOutput(cctLines)
+	}
+	// A reply with no link lines at all is more likely a banner, a cut-off
+	// read or a format the parser does not know than no links being up
+	links := ParseLinksOutput(linkLines)
+	if links == nil {
+		sessionLog.Warnw("No links recognised in LINKS; leaving restored sessions as they are", "lines", len(linkLines))
+	}
+	changed := st.Reconcile(links, circuitCalls, time.Now())
+	sessionLog.Infow("Reconciled sessions with node", "links", len(links), "changed", changed)
+	return nil
+}
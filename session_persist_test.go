@@ -0,0 +1,115 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// A tracker saved and restored keeps its sessions as they were, including
+// direction, and carries on counting retries from the saved N(S).
+func TestTrackerStateRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sessions.json")
+	tracker := NewSessionTracker(200, nil, testLogger())
+	tracker.HandleLinkUp(&LinkUpEvent{Direction: "incoming", Port: "1", Remote: "N3LLO-2", Local: "WA2M-2"})
+	tracker.HandleL2Trace(&L2TraceEvent{Direction: "rcvd", Port: "1", Source: "N3LLO-2", Dest: "WA2M-2", L2Type: "I", PID: 0xCF, TSeq: 3})
+	tracker.HandleCircuitUp(&CircuitUpEvent{ID: 5, Direction: "incoming", Remote: "N0USR@N3LLO-4:0a01", Local: "WA2M-4:0001"})
+	if err := SaveTrackerState(path, tracker); err != nil {
+		t.Fatalf("SaveTrackerState: %v", err)
+	}
+
+	state, err := LoadTrackerState(path)
+	if err != nil || state == nil {
+		t.Fatalf("LoadTrackerState: %v, %v", state, err)
+	}
+	stale := NewSessionTracker(200, nil, testLogger())
+	if n := stale.Restore(state, state.SavedAt.Add(time.Hour), 10*time.Minute); n != 0 {
+		t.Errorf("stale state restored %d sessions, want 0", n)
+	}
+
+	restored := NewSessionTracker(200, nil, testLogger())
+	if n := restored.Restore(state, state.SavedAt.Add(time.Minute), 10*time.Minute); n != 1 {
+		t.Fatalf("restored %d sessions, want 1", n)
+	}
+	sess := restored.FindSessionForFrame(1, "N3LLO-2", "WA2M-2")
+	if sess == nil || sess.State != SessionConnected || sess.Initiator != "N3LLO-2" || len(sess.Circuits) != 1 {
+		t.Fatalf("restored session = %+v", sess)
+	}
+	restored.HandleL2Trace(&L2TraceEvent{Direction: "rcvd", Port: "1", Source: "N3LLO-2", Dest: "WA2M-2", L2Type: "I", PID: 0xCF, TSeq: 3})
+	if sess.RetryCount != 1 {
+		t.Errorf("RetryCount = %d, want the repeated N(S) counted", sess.RetryCount)
+	}
+
+	if state, err := LoadTrackerState(filepath.Join(t.TempDir(), "missing.json")); state != nil || err != nil {
+		t.Errorf("missing file: %v, %v, want nil, nil", state, err)
+	}
+}
+
+func TestParseLinksAndCircuits(t *testing.T) {
+	links := ParseLinksOutput([]string{
+		"MIKE:WA2M-2} Links",
+		"N3LLO-2   WA2M-2    S=5 P=1 T=3 V=2 Q= 0",
+		"K1ABC-2   WA2M-2    S=1 P=3 T=3 V=2 Q= 0",
+	})
+	if len(links) != 2 || links[0] != (NodeLink{Remote: "N3LLO-2", Local: "WA2M-2", Port: 1, State: 5}) || links[1].State != 1 {
+		t.Errorf("ParseLinksOutput = %+v", links)
+	}
+
+	calls := ParseCircuitsOutput([]string{
+		"MIKE:WA2M-2} Circuits:",
+		"Circuit(N3LLO-4 LLO:)  <-->  Host(WA2M)",
+	})
+	if !calls["N3LLO"] || len(calls) != 2 {
+		t.Errorf("ParseCircuitsOutput = %v", calls)
+	}
+}
+
+// Reconciling closes links the node no longer has, adds ones it has that
+// the tracker missed, and closes circuits to nodes with no circuit.
+func TestTrackerReconcile(t *testing.T) {
+	tracker := NewSessionTracker(200, nil, testLogger())
+	tracker.HandleLinkUp(&LinkUpEvent{Direction: "outgoing", Port: "1", Remote: "N3LLO-2", Local: "WA2M-2"})
+	tracker.HandleLinkUp(&LinkUpEvent{Direction: "outgoing", Port: "2", Remote: "K9XYZ-2", Local: "WA2M-2"})
+	tracker.HandleCircuitUp(&CircuitUpEvent{ID: 5, Direction: "outgoing", Remote: "N3LLO-4:0a01", Local: "WA2M-4:0001"})
+
+	changed := tracker.Reconcile([]NodeLink{
+		{Remote: "N3LLO-2", Local: "WA2M-2", Port: 1, State: 5},
+		{Remote: "K1ABC-2", Local: "WA2M-2", Port: 3, State: 5},
+	}, map[string]bool{"WA2M": true}, time.Now())
+	if changed != 3 {
+		t.Errorf("changed = %d, want 3", changed)
+	}
+
+	if s := tracker.FindSessionForFrame(1, "N3LLO-2", "WA2M-2"); s.State != SessionConnected {
+		t.Errorf("N3LLO-2 state = %s, want connected", s.State)
+	}
+	if s := tracker.FindSessionForFrame(2, "K9XYZ-2", "WA2M-2"); s.State != SessionDisconnected || s.DisconnectReason == "" {
+		t.Errorf("K9XYZ-2 = %+v, want disconnected with a reason", s)
+	}
+	if s := tracker.FindSessionForFrame(3, "K1ABC-2", "WA2M-2"); s == nil || s.State != SessionConnected || s.Responder != "K1ABC-2" {
+		t.Errorf("K1ABC-2 = %+v, want a connected session", s)
+	}
+	tracker.mu.RLock()
+	defer tracker.mu.RUnlock()
+	if c := tracker.circuits[5]; c.State != "disconnected" {
+		t.Errorf("circuit state = %s, want disconnected", c.State)
+	}
+}
+
+// A LINKS reply with no link lines says nothing about which links are up,
+// so restored sessions are left open.
+func TestTrackerReconcileUnknownLinks(t *testing.T) {
+	tracker := NewSessionTracker(200, nil, testLogger())
+	tracker.HandleLinkUp(&LinkUpEvent{Direction: "outgoing", Port: "1", Remote: "N3LLO-2", Local: "WA2M-2"})
+
+	links := ParseLinksOutput([]string{"WA2M:KA2DEW-2} Links", "Something we do not parse"})
+	if links != nil {
+		t.Fatalf("ParseLinksOutput = %+v, want nil", links)
+	}
+	if changed := tracker.Reconcile(links, nil, time.Now()); changed != 0 {
+		t.Errorf("changed = %d, want 0", changed)
+	}
+	if s := tracker.FindSessionForFrame(1, "N3LLO-2", "WA2M-2"); s.State != SessionConnected {
+		t.Errorf("N3LLO-2 state = %s, want still connected", s.State)
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import "time"
+
+const (
+	// timelineBucket is the width of each session timeline bucket.
+	timelineBucket = 10 * time.Second
+	// timelineMaxBuckets bounds each session's timeline to the last hour.
+	timelineMaxBuckets = 360
+)
+
+// TimelineBucket is the traffic on a session in one timelineBucket, from
+// this node's side: sent is what we transmitted. Bytes count I-frame info
+// fields; frames count every frame, retries included.
+type TimelineBucket struct {
+	Start      time.Time `json:"start"`
+	FramesSent int       `json:"framesSent"`
+	FramesRcvd int       `json:"framesRcvd"`
+	BytesSent  int       `json:"bytesSent"`
+	BytesRcvd  int       `json:"bytesRcvd"`
+	Retries    int       `json:"retries"`
+}
+
+// sessionTimeline is a session's buckets, oldest first. Buckets with no
+// traffic between two busy ones are kept, so a stall shows as zeros.
+type sessionTimeline struct {
+	buckets []TimelineBucket
+}
+
+// bucket returns the bucket covering t, adding it (and any empty buckets
+// since the last one) if it is new. Frames reported late for a bucket that
+// has already been dropped return nil.
+func (tl *sessionTimeline) bucket(t time.Time) *TimelineBucket {
+	start := t.Truncate(timelineBucket)
+	if n := len(tl.buckets); n > 0 {
+		last := tl.buckets[n-1].Start
+		if !start.After(last) {
+			i := n - 1 - int(last.Sub(start)/timelineBucket)
+			if i < 0 {
+				return nil
+			}
+			return &tl.buckets[i]
+		}
+		gap := int(start.Sub(last)/timelineBucket) - 1
+		if gap >= timelineMaxBuckets {
+			tl.buckets = tl.buckets[:0]
+		} else {
+			for i := 1; i <= gap; i++ {
+				tl.buckets = append(tl.buckets, TimelineBucket{Start: last.Add(time.Duration(i) * timelineBucket)})
+			}
+		}
+	}
+	tl.buckets = append(tl.buckets, TimelineBucket{Start: start})
+	if excess := len(tl.buckets) - timelineMaxBuckets; excess > 0 {
+		tl.buckets = append(tl.buckets[:0], tl.buckets[excess:]...)
+	}
+	return &tl.buckets[len(tl.buckets)-1]
+}
+
+// trackTimelineLocked adds a frame to its session's timeline.
+func (st *SessionTracker) trackTimelineLocked(sess *Session, event *L2TraceEvent, l2Retry bool, now time.Time) {
+	tl, ok := st.timelines[sess.ID]
+	if !ok {
+		tl = &sessionTimeline{}
+		st.timelines[sess.ID] = tl
+	}
+	b := tl.bucket(traceTime(event, now))
+	if b == nil {
+		return
+	}
+	if event.Direction == "sent" {
+		b.FramesSent++
+		if event.L2Type == "I" {
+			b.BytesSent += event.ILen
+		}
+	} else {
+		b.FramesRcvd++
+		if event.L2Type == "I" {
+			b.BytesRcvd += event.ILen
+		}
+	}
+	if l2Retry {
+		b.Retries++
+	}
+}
+
+// GetSessionTimeline returns a copy of a session's timeline, at most limit
+// buckets (0 for all) ending with the newest. ok is false if the session is
+// not known.
+func (st *SessionTracker) GetSessionTimeline(id string, limit int) (buckets []TimelineBucket, ok bool) {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+
+	if _, exists := st.sessions[id]; !exists {
+		return nil, false
+	}
+	tl, exists := st.timelines[id]
+	if !exists {
+		return []TimelineBucket{}, true
+	}
+	src := tl.buckets
+	if limit > 0 && len(src) > limit {
+		src = src[len(src)-limit:]
+	}
+	return append([]TimelineBucket{}, src...), true
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// Frames land in 10-second buckets by the node's timestamp, with empty
+// buckets kept through a stall.
+func TestSessionTimeline(t *testing.T) {
+	tracker := NewSessionTracker(200, nil, testLogger())
+	tracker.HandleLinkUp(&LinkUpEvent{Direction: "outgoing", Port: "1", Remote: "N3LLO-2", Local: "WA2M-2"})
+
+	base := 1787067400.0 // a multiple of 10
+	frame := func(at float64, dirn, l2Type string, ns, ilen int) {
+		ev := &L2TraceEvent{Time: base + at, Direction: dirn, Port: "1", L2Type: l2Type, TSeq: ns, ILen: ilen}
+		if dirn == "sent" {
+			ev.Source, ev.Dest = "WA2M-2", "N3LLO-2"
+		} else {
+			ev.Source, ev.Dest = "N3LLO-2", "WA2M-2"
+		}
+		tracker.HandleL2Trace(ev)
+	}
+	frame(1, "sent", "I", 0, 200)
+	frame(2, "sent", "I", 1, 200)
+	frame(3, "rcvd", "RR", 0, 0)
+	frame(34, "sent", "I", 1, 200) // resent after 30s of nothing
+	frame(35, "rcvd", "I", 0, 50)
+	frame(9, "sent", "I", 2, 10) // reported late
+
+	id := sessionKey("1", "N3LLO-2", "WA2M-2")
+	buckets, ok := tracker.GetSessionTimeline(id, 0)
+	if !ok {
+		t.Fatal("session not found")
+	}
+	if len(buckets) != 4 {
+		t.Fatalf("got %d buckets, want 4: %+v", len(buckets), buckets)
+	}
+	first := buckets[0]
+	if !first.Start.Equal(time.Unix(int64(base), 0)) || first.FramesSent != 3 || first.BytesSent != 410 || first.FramesRcvd != 1 {
+		t.Errorf("first bucket = %+v", first)
+	}
+	if buckets[1].FramesSent+buckets[1].FramesRcvd+buckets[2].FramesSent+buckets[2].FramesRcvd != 0 {
+		t.Errorf("stall buckets not empty: %+v", buckets[1:3])
+	}
+	last := buckets[3]
+	if last.FramesSent != 1 || last.Retries != 1 || last.BytesRcvd != 50 {
+		t.Errorf("last bucket = %+v", last)
+	}
+
+	if got, _ := tracker.GetSessionTimeline(id, 2); len(got) != 2 || !got[1].Start.Equal(last.Start) {
+		t.Errorf("limit 2 = %+v, want the newest two", got)
+	}
+	if _, ok := tracker.GetSessionTimeline("9-NOONE", 0); ok {
+		t.Error("unknown session reported as found")
+	}
+}
+
+// The timeline keeps only the last timelineMaxBuckets buckets.
+func TestSessionTimelineBounded(t *testing.T) {
+	var tl sessionTimeline
+	start := time.Unix(1787067400, 0)
+	for i := 0; i < timelineMaxBuckets+5; i++ {
+		tl.bucket(start.Add(time.Duration(i)*timelineBucket)).FramesSent++
+	}
+	if len(tl.buckets) != timelineMaxBuckets || !tl.buckets[0].Start.Equal(start.Add(5*timelineBucket)) {
+		t.Errorf("len = %d, first = %v", len(tl.buckets), tl.buckets[0].Start)
+	}
+	if tl.bucket(start) != nil {
+		t.Error("bucket for a dropped interval should be nil")
+	}
+	tl.bucket(start.Add(3 * timelineMaxBuckets * timelineBucket))
+	if len(tl.buckets) != 1 {
+		t.Errorf("after a long gap len = %d, want 1", len(tl.buckets))
+	}
+}
@@ -44,6 +44,7 @@ type Session struct {
 	HasNetROM        bool         `json:"hasNetROM"`
 	HasIP            bool         `json:"hasIP"`
 	HasText          bool         `json:"hasText"`
+	RTT              *RTTStats    `json:"rtt,omitempty"`
 	Circuits         []Circuit    `json:"circuits,omitempty"`
 }
 
@@ -56,6 +57,21 @@ type Circuit struct {
 	SegsSent   int64  `json:"segsSent"`
 	SegsRcvd   int64  `json:"segsRcvd"`
 	SegsResent int64  `json:"segsResent"`
+	// Transport-level counters from NetROM frames in L2Trace. L4Resends
+	// excludes frames AX.25 retried on this hop, so it reflects end-to-end
+	// loss rather than a single bad link.
+	InfoSent       int64   `json:"infoSent"`
+	InfoRcvd       int64   `json:"infoRcvd"`
+	PayloadSent    int64   `json:"payloadSent"`
+	PayloadRcvd    int64   `json:"payloadRcvd"`
+	L4Resends      int64   `json:"l4Resends"`
+	L4DupsRcvd     int64   `json:"l4DupsRcvd"` // INFO the far end sent again
+	Chokes         int64   `json:"chokes"`
+	NAKs           int64   `json:"naks"`
+	Window         int     `json:"window,omitempty"`
+	MaxOutstanding int     `json:"maxOutstanding"`
+	WindowUtilPct  float64 `json:"windowUtilPct"`
+	ThroughputBps  float64 `json:"throughputBps"`
 }
 
 type SessionTracker struct {
@@ -63,9 +79,20 @@ type SessionTracker struct {
 	sessions       map[string]*Session
 	circuits       map[int]*Circuit
 	circuitSession map[int]string
+	l4             map[int]*l4State
+	rttPending     map[string]*rttPending
+	rttNeighbours  map[string]*rttNeighbour
+	timelines      map[string]*sessionTimeline
+	anomalies      map[string]*anomalyState
 	ordered        []*Session
 	maxSize        int
 	onChange       func(*Session)
+	onEnd          func(*Session)
+	ended          []Session // waiting for onEnd, outside the lock
+	onUserSession  func(*UserSession)
+	onAnomaly      func(*LinkAnomaly)
+	correlator     *CircuitCorrelator
+	anomalyLog     []LinkAnomaly
 	lastNS         map[string]int
 	lastREJ        map[string]time.Time
 	lastNotify     map[string]time.Time
@@ -77,6 +104,12 @@ func NewSessionTracker(maxSize int, onChange func(*Session), logger *zap.Sugared
 		sessions:       make(map[string]*Session),
 		circuits:       make(map[int]*Circuit),
 		circuitSession: make(map[int]string),
+		l4:             make(map[int]*l4State),
+		rttPending:     make(map[string]*rttPending),
+		rttNeighbours:  make(map[string]*rttNeighbour),
+		timelines:      make(map[string]*sessionTimeline),
+		anomalies:      make(map[string]*anomalyState),
+		correlator:     NewCircuitCorrelator(),
 		maxSize:        maxSize,
 		onChange:        onChange,
 		lastNS:         make(map[string]int),
@@ -86,6 +119,79 @@ func NewSessionTracker(maxSize int, onChange func(*Session), logger *zap.Sugared
 	}
 }
 
+// SetEndFunc sets a callback for sessions that have finished: with a
+// LinkDownEvent, a DM, or closed by Reconcile. It is called outside the
+// tracker's lock with a copy of the session, so it may block (e.g. to write
+// to the database).
+func (st *SessionTracker) SetEndFunc(fn func(*Session)) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.onEnd = fn
+}
+
+// endSessionLocked queues a copy of a session that has just finished for
+// onEnd, which flushEnded calls once the lock is released.
+func (st *SessionTracker) endSessionLocked(sess *Session) {
+	if st.onEnd == nil {
+		return
+	}
+	ended := *sess
+	ended.Circuits = append([]Circuit(nil), sess.Circuits...)
+	st.ended = append(st.ended, ended)
+}
+
+// flushEnded passes the finished sessions to onEnd. Callers defer it before
+// taking the lock, so that it runs after the lock is released.
+func (st *SessionTracker) flushEnded() {
+	st.mu.Lock()
+	ended, onEnd := st.ended, st.onEnd
+	st.ended = nil
+	st.mu.Unlock()
+	for i := range ended {
+		onEnd(&ended[i])
+	}
+}
+
+// SetUserSessionFunc sets a callback for changes to end-to-end user
+// sessions (see CircuitCorrelator). Like onChange it is called with the
+// tracker's lock held, and is passed a copy.
+func (st *SessionTracker) SetUserSessionFunc(fn func(*UserSession)) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.onUserSession = fn
+}
+
+// GetUserSessions returns the correlated user sessions, newest first.
+func (st *SessionTracker) GetUserSessions() []UserSession {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+	return st.correlator.Sessions(time.Now())
+}
+
+// notifyUserSessionLocked refreshes a user session's L2 counters and passes
+// a copy to onUserSession.
+func (st *SessionTracker) notifyUserSessionLocked(us *UserSession) {
+	if us == nil {
+		return
+	}
+	st.correlator.UpdateL2(us, st.sessions)
+	if st.onUserSession == nil {
+		return
+	}
+	cp := *us
+	cp.Hops = append([]UserSessionHop(nil), us.Hops...)
+	cp.Path = append([]string(nil), us.Path...)
+	st.onUserSession(&cp)
+}
+
+// expireCircuitsLocked closes the user sessions of circuits that have gone
+// quiet without a CircuitDown.
+func (st *SessionTracker) expireCircuitsLocked(now time.Time) {
+	for _, us := range st.correlator.Expire(st.sessions, now) {
+		st.notifyUserSessionLocked(us)
+	}
+}
+
 // sessionKey produces a normalized key from a port and two station callsigns.
 // It sorts the callsigns alphabetically so that A>B and B>A map to the same session.
 func sessionKey(port string, station1, station2 string) string {
@@ -151,9 +257,11 @@ func (st *SessionTracker) HandleLinkUp(event *LinkUpEvent) {
 	sess.HasIP = false
 	sess.HasText = false
 	sess.Circuits = nil
+	sess.RTT = nil
 
 	// Clear per-session tracking state
 	st.clearSessionNS(key)
+	delete(st.timelines, key)
 
 	st.rebuildOrdered()
 	st.logger.Debugw("Session connected", "id", key, "initiator", sess.Initiator, "responder", sess.Responder)
@@ -161,6 +269,7 @@ func (st *SessionTracker) HandleLinkUp(event *LinkUpEvent) {
 }
 
 func (st *SessionTracker) HandleLinkDown(event *LinkDownEvent) {
+	defer st.flushEnded()
 	st.mu.Lock()
 	defer st.mu.Unlock()
 
@@ -191,11 +300,17 @@ func (st *SessionTracker) HandleLinkDown(event *LinkDownEvent) {
 	sess.BytesReceived = event.BytesRcvd
 	sess.FramesResent = event.FrmsResent
 	sess.DisconnectReason = event.Reason
+	if sess.StartedAt == nil && event.UpForSecs > 0 {
+		// We missed the link coming up; LinBPQ tells us how long it was up
+		t := now.Add(-time.Duration(event.UpForSecs) * time.Second)
+		sess.StartedAt = &t
+	}
 
 	st.clearSessionNS(key)
 	st.rebuildOrdered()
 	st.logger.Debugw("Session disconnected", "id", key, "reason", event.Reason)
 	st.notifyChangeLocked(sess, true)
+	st.endSessionLocked(sess)
 	st.pruneOldSessions()
 }
 
@@ -206,6 +321,7 @@ func (st *SessionTracker) HandleL2Trace(event *L2TraceEvent) {
 		return
 	}
 
+	defer st.flushEnded()
 	st.mu.Lock()
 	defer st.mu.Unlock()
 
@@ -237,6 +353,8 @@ func (st *SessionTracker) HandleL2Trace(event *L2TraceEvent) {
 	sess.LastActivity = now
 	sess.TotalFrames++
 	stateChange := false
+	ended := false
+	l2Retry := false
 
 	// Handle connect request -> session connecting
 	// LinBPQ sends "C" for SABM (connect), "SABME" for extended connect
@@ -273,6 +391,7 @@ func (st *SessionTracker) HandleL2Trace(event *L2TraceEvent) {
 			t := now
 			sess.EndedAt = &t
 			stateChange = true
+			ended = true
 		}
 	}
 
@@ -298,6 +417,7 @@ func (st *SessionTracker) HandleL2Trace(event *L2TraceEvent) {
 		lastNS, tracked := st.lastNS[nsKey]
 		if tracked && event.TSeq == lastNS {
 			// Duplicate N(S) means a retry
+			l2Retry = true
 			sess.RetryCount++
 
 			// Classify: check if the other side sent a REJ within 5 seconds
@@ -321,15 +441,25 @@ func (st *SessionTracker) HandleL2Trace(event *L2TraceEvent) {
 		st.lastREJ[rejKey] = now
 	}
 
+	st.trackRTTLocked(sess, event, l2Retry, now)
+	st.trackTimelineLocked(sess, event, l2Retry, now)
+	st.trackAnomaliesLocked(sess, event, now)
+
 	// Protocol flags from PID
 	if event.PID == 0xCF {
 		sess.HasNetROM = true
+		if event.L4Type != "" {
+			st.trackL4Locked(event, l2Retry, now)
+		}
 	}
 	if event.PID == 0xF0 {
 		sess.HasText = true
 	}
 
 	st.notifyChangeLocked(sess, stateChange)
+	if ended {
+		st.endSessionLocked(sess)
+	}
 }
 
 func (st *SessionTracker) HandleCircuitUp(event *CircuitUpEvent) {
@@ -344,6 +474,9 @@ func (st *SessionTracker) HandleCircuitUp(event *CircuitUpEvent) {
 		State:     "connected",
 	}
 	st.circuits[event.ID] = circuit
+	if state := newL4State(circuit, time.Now()); state != nil {
+		st.l4[event.ID] = state
+	}
 
 	// Find the most recent connected session with NetROM
 	var bestSession *Session
@@ -357,14 +490,27 @@ func (st *SessionTracker) HandleCircuitUp(event *CircuitUpEvent) {
 		}
 	}
 
+	var sessionID string
+	var port int
 	if bestSession != nil {
 		bestSession.Circuits = append(bestSession.Circuits, *circuit)
 		st.circuitSession[event.ID] = bestSession.ID
+		sessionID, port = bestSession.ID, bestSession.Port
 		st.logger.Debugw("Circuit attached to session", "circuitID", event.ID, "sessionID", bestSession.ID)
 		st.notifyChangeLocked(bestSession, true)
 	} else {
 		st.logger.Debugw("Circuit up but no matching session found", "circuitID", event.ID)
 	}
+
+	// A reused circuit ID means the old circuit's down event was lost
+	now := time.Now()
+	st.notifyUserSessionLocked(st.correlator.Close(event.ID, now))
+	st.expireCircuitsLocked(now)
+	us := st.correlator.CircuitUp(circuit, sessionID, port, now)
+	if us.Transit {
+		st.logger.Debugw("Circuit paired into user session", "circuitID", event.ID, "userSession", us.ID, "path", us.Path)
+	}
+	st.notifyUserSessionLocked(us)
 }
 
 func (st *SessionTracker) HandleCircuitDown(event *CircuitDownEvent) {
@@ -381,6 +527,9 @@ func (st *SessionTracker) HandleCircuitDown(event *CircuitDownEvent) {
 	circuit.SegsSent = event.SegsSent
 	circuit.SegsRcvd = event.SegsRcvd
 	circuit.SegsResent = event.SegsResent
+	delete(st.l4, event.ID)
+	st.notifyUserSessionLocked(st.correlator.CircuitDown(event.ID, event.SegsSent, event.SegsRcvd, event.SegsResent, time.Now()))
+	st.expireCircuitsLocked(time.Now())
 
 	// Update the circuit in its parent session
 	sessID, hasSess := st.circuitSession[event.ID]
@@ -482,8 +631,9 @@ func (st *SessionTracker) rebuildOrdered() {
 	})
 }
 
-// clearSessionNS removes lastNS and lastREJ entries for a given session key.
+// clearSessionNS removes lastNS, lastREJ and RTT entries for a given session key.
 func (st *SessionTracker) clearSessionNS(sessionKey string) {
+	delete(st.rttPending, sessionKey)
 	prefix := sessionKey + "-"
 	for k := range st.lastNS {
 		if strings.HasPrefix(k, prefix) {
@@ -519,6 +669,8 @@ func (st *SessionTracker) pruneOldSessions() {
 		id := disconnected[i].ID
 		delete(st.sessions, id)
 		delete(st.lastNotify, id)
+		delete(st.timelines, id)
+		delete(st.anomalies, id)
 		st.clearSessionNS(id)
 		st.logger.Debugw("Pruned old session", "id", id)
 	}
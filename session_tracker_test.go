@@ -512,6 +512,62 @@ func TestCircuitTracking(t *testing.T) {
 	}
 }
 
+// NetROM frames are matched to their circuit by circuit number, and L4
+// resends are counted apart from AX.25 retries of the same frame.
+func TestCircuitL4Tracking(t *testing.T) {
+	tracker := NewSessionTracker(200, nil, testLogger())
+	tracker.HandleLinkUp(&LinkUpEvent{Direction: "outgoing", Port: "1", Remote: "N3LLO-2", Local: "WA2M-2"})
+	tracker.HandleL2Trace(&L2TraceEvent{Direction: "sent", Port: "1", Source: "WA2M-2", Dest: "N3LLO-2", L2Type: "I", PID: 0xCF})
+	tracker.HandleCircuitUp(&CircuitUpEvent{ID: 42, Direction: "outgoing", Remote: "N0USR@N3LLO-4:0a01", Local: "WA2M-4:0001"})
+
+	l2Seq := 0
+	frame := func(dirn, l4Type string, txSeq, rxSeq, payLen int, l2Retry bool) {
+		ev := &L2TraceEvent{Direction: dirn, Port: "1", L2Type: "I", PID: 0xCF,
+			L4Type: l4Type, TxSeq: txSeq, RxSeq: rxSeq, PayLen: payLen}
+		if dirn == "sent" {
+			ev.Source, ev.Dest, ev.L3Src, ev.L3Dst, ev.ToCct = "WA2M-2", "N3LLO-2", "WA2M-4", "N3LLO-4", 0x0a01
+		} else {
+			ev.Source, ev.Dest, ev.L3Src, ev.L3Dst, ev.ToCct = "N3LLO-2", "WA2M-2", "N3LLO-4", "WA2M-4", 0x0001
+		}
+		if !l2Retry {
+			l2Seq = (l2Seq + 1) % 8
+		}
+		ev.TSeq = l2Seq
+		tracker.HandleL2Trace(ev)
+	}
+
+	frame("sent", "INFO", 0, 0, 100, false)
+	frame("sent", "INFO", 1, 0, 100, false)
+	frame("sent", "INFO", 1, 0, 100, true) // AX.25 retry, not L4
+	frame("sent", "INFO", 2, 0, 100, false)
+	frame("sent", "INFO", 1, 0, 100, false) // L4 resend
+	frame("rcvd", "INFO ACK CHOKE", 0, 3, 0, false)
+	frame("rcvd", "INFO", 0, 3, 50, false)
+	frame("rcvd", "INFO", 0, 3, 50, false) // far end resent
+	// A frame for some other circuit routed through us
+	tracker.HandleL2Trace(&L2TraceEvent{Direction: "rcvd", Port: "1", Source: "N3LLO-2", Dest: "WA2M-2",
+		L2Type: "I", PID: 0xCF, L3Src: "N3LLO-4", L3Dst: "K1ABC-4", L4Type: "INFO", ToCct: 0x0202, TSeq: 7})
+
+	sess := tracker.FindSessionForFrame(1, "WA2M-2", "N3LLO-2")
+	if sess == nil || len(sess.Circuits) != 1 {
+		t.Fatalf("session = %+v, want one circuit", sess)
+	}
+	c := sess.Circuits[0]
+	if c.InfoSent != 4 || c.PayloadSent != 400 || c.L4Resends != 1 {
+		t.Errorf("sent: InfoSent = %d, PayloadSent = %d, L4Resends = %d, want 4, 400, 1", c.InfoSent, c.PayloadSent, c.L4Resends)
+	}
+	if c.InfoRcvd != 2 || c.PayloadRcvd != 100 || c.L4DupsRcvd != 1 {
+		t.Errorf("rcvd: InfoRcvd = %d, PayloadRcvd = %d, L4DupsRcvd = %d, want 2, 100, 1", c.InfoRcvd, c.PayloadRcvd, c.L4DupsRcvd)
+	}
+	if c.Chokes != 1 || c.NAKs != 0 {
+		t.Errorf("Chokes = %d, NAKs = %d, want 1, 0", c.Chokes, c.NAKs)
+	}
+	// Outstanding after each sent INFO: 1, 2, 3, 3 of a window of 4
+	if c.MaxOutstanding != 3 || c.WindowUtilPct != 56.25 {
+		t.Errorf("MaxOutstanding = %d, WindowUtilPct = %v, want 3, 56.25", c.MaxOutstanding, c.WindowUtilPct)
+	}
+}
+
 func TestGetSessionsSorting(t *testing.T) {
 	rec := &changeRecorder{}
 	tracker := NewSessionTracker(200, rec.record, testLogger())
@@ -861,3 +917,28 @@ func TestL2TraceIFramePromotesConnecting(t *testing.T) {
 		t.Error("Expected StartedAt to be set")
 	}
 }
+
+// A captured outgoing link carrying one NetROM circuit, replayed through the
+// listener, ends up as the tracker would have had it live: one L2 retry, the
+// circuit's L4 counters, and an RTT from the one unretried I-frame.
+func TestSessionTrackerCaptureReplay(t *testing.T) {
+	tracker := NewSessionTracker(200, nil, testLogger())
+	replayFixture(t, "netrom_circuit.ndjson", tracker)
+
+	sess := tracker.FindSessionForFrame(1, "N3LLO-2", "WA2M-2")
+	if sess == nil {
+		t.Fatal("no session after replay")
+	}
+	if sess.State != SessionDisconnected || sess.Initiator != "WA2M-2" || sess.RetryCount != 1 {
+		t.Errorf("session = %+v, want disconnected, initiated by WA2M-2, 1 retry", sess)
+	}
+	if len(sess.Circuits) != 1 {
+		t.Fatalf("circuits = %+v, want 1", sess.Circuits)
+	}
+	if c := sess.Circuits[0]; c.State != "disconnected" || c.InfoSent != 1 || c.InfoRcvd != 1 || c.L4Resends != 0 {
+		t.Errorf("circuit = %+v, want 1 INFO each way and no L4 resends", c)
+	}
+	if sess.RTT == nil || sess.RTT.Samples != 1 || sess.RTT.MedianMs != 800 {
+		t.Errorf("RTT = %+v, want one 800ms sample", sess.RTT)
+	}
+}
@@ -14,8 +14,36 @@ type FeatureSettings struct {
 	Host     string            `json:"host"`
 	Port     int               `json:"port"`
 	Callsign string            `json:"callsign"`
-	Password string            `json:"password"`
 	Options  map[string]string `json:"options,omitempty"`
+
+	// Password is write-only: it is kept in the SecretStore, never written
+	// to the settings file, and never sent to clients, who see PasswordSet
+	// instead. It is read from files and update_settings commands so that
+	// older settings files can be migrated and passwords can be replaced.
+	Password    string `json:"password,omitempty"`
+	PasswordSet bool   `json:"passwordSet,omitempty"`
+
+	// passwordCleared marks an empty Password as a request to remove the
+	// stored one, rather than one that was never loaded.
+	passwordCleared bool
+}
+
+// clone returns a deep copy of fs.
+func (fs *FeatureSettings) clone() *FeatureSettings {
+	cp := *fs
+	cp.Options = make(map[string]string)
+	for k, v := range fs.Options {
+		cp.Options[k] = v
+	}
+	return &cp
+}
+
+// redacted returns a copy of fs fit to send to clients.
+func (fs *FeatureSettings) redacted() *FeatureSettings {
+	cp := fs.clone()
+	cp.PasswordSet = fs.Password != ""
+	cp.Password = ""
+	return cp
 }
 
 // ToFeatureConfig converts FeatureSettings to the existing FeatureConfig type
@@ -34,16 +62,24 @@ func (fs *FeatureSettings) ToFeatureConfig() FeatureConfig {
 	}
 }
 
+// featureSecretName is the SecretStore name of a feature's password.
+func featureSecretName(feature string) string {
+	return feature + ".password"
+}
+
 // AppSettings manages persistent application settings stored in a JSON file.
+// Feature passwords are kept in a SecretStore beside it.
 type AppSettings struct {
 	Features map[string]*FeatureSettings `json:"features"`
 
 	mu       sync.RWMutex
 	filePath string
+	secrets  *SecretStore
 }
 
-// NewAppSettings creates AppSettings with empty feature defaults.
-func NewAppSettings(filePath string) *AppSettings {
+// NewAppSettings creates AppSettings with empty feature defaults, keeping
+// passwords in secrets.
+func NewAppSettings(filePath string, secrets *SecretStore) *AppSettings {
 	return &AppSettings{
 		Features: map[string]*FeatureSettings{
 			"chat": {Host: "localhost", Port: 8513, Options: map[string]string{}},
@@ -51,26 +87,52 @@ func NewAppSettings(filePath string) *AppSettings {
 			"node": {Host: "localhost", Port: 8010, Options: map[string]string{}},
 		},
 		filePath: filePath,
+		secrets:  secrets,
 	}
 }
 
-// Load reads settings from the JSON file. Missing file is not an error —
-// the in-memory defaults are kept.
+// Load reads settings from the JSON file and passwords from the secret
+// store. Missing file is not an error — the in-memory defaults are kept.
+// Passwords are read from the store even when the file cannot be, so that
+// saving the defaults does not lose them. Passwords found in the settings
+// file, as older versions wrote them, are moved to the secret store.
 func (s *AppSettings) Load() error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	migrate, err := s.loadFileLocked()
+	for name, fs := range s.Features {
+		if fs.Password == "" {
+			fs.Password = s.secrets.Get(featureSecretName(name))
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	if migrate {
+		if err := s.saveLocked(); err != nil {
+			return fmt.Errorf("move passwords to secret store: %w", err)
+		}
+		mainLog.Infow("Moved feature passwords from the settings file to the secret store", "path", s.filePath)
+	}
+	return nil
+}
+
+// loadFileLocked merges the settings file into s.Features, reporting
+// whether it held passwords. The caller holds s.mu.
+func (s *AppSettings) loadFileLocked() (migrate bool, err error) {
 	data, err := os.ReadFile(s.filePath)
 	if err != nil {
 		if os.IsNotExist(err) {
-			return nil // first run, no config file yet
+			return false, nil // first run, no config file yet
 		}
-		return fmt.Errorf("read settings file: %w", err)
+		return false, fmt.Errorf("read settings file: %w", err)
 	}
 
 	var loaded AppSettings
 	if err := json.Unmarshal(data, &loaded); err != nil {
-		return fmt.Errorf("parse settings file: %w", err)
+		return false, fmt.Errorf("parse settings file: %w", err)
 	}
 
 	// Merge loaded features into current (preserves defaults for missing features)
@@ -79,11 +141,14 @@ func (s *AppSettings) Load() error {
 			if fs.Options == nil {
 				fs.Options = map[string]string{}
 			}
+			if fs.Password != "" {
+				migrate = true
+			}
+			fs.PasswordSet = false
 			s.Features[name] = fs
 		}
 	}
-
-	return nil
+	return migrate, nil
 }
 
 // Save writes settings to the JSON file using atomic write (temp + rename).
@@ -95,8 +160,27 @@ func (s *AppSettings) Save() error {
 }
 
 // saveLocked writes to disk without acquiring the lock (caller must hold it).
+// Passwords go to the secret store first, so the settings file never holds
+// one the store does not. A stored password is only removed when it was
+// cleared, not merely left empty.
 func (s *AppSettings) saveLocked() error {
-	data, err := json.MarshalIndent(s, "", "  ")
+	file := struct {
+		Features map[string]*FeatureSettings `json:"features"`
+	}{Features: make(map[string]*FeatureSettings)}
+	for name, fs := range s.Features {
+		if fs.Password != "" || fs.passwordCleared {
+			if err := s.secrets.Set(featureSecretName(name), fs.Password); err != nil {
+				return fmt.Errorf("save %s password: %w", name, err)
+			}
+			fs.passwordCleared = false
+		}
+		cp := fs.clone()
+		cp.Password = ""
+		cp.PasswordSet = false
+		file.Features[name] = cp
+	}
+
+	data, err := json.MarshalIndent(file, "", "  ")
 	if err != nil {
 		return fmt.Errorf("marshal settings: %w", err)
 	}
@@ -137,19 +221,7 @@ func (s *AppSettings) GetFeature(name string) *FeatureSettings {
 		return nil
 	}
 
-	// Return a copy
-	opts := make(map[string]string)
-	for k, v := range fs.Options {
-		opts[k] = v
-	}
-	return &FeatureSettings{
-		Enabled:  fs.Enabled,
-		Host:     fs.Host,
-		Port:     fs.Port,
-		Callsign: fs.Callsign,
-		Password: fs.Password,
-		Options:  opts,
-	}
+	return fs.clone()
 }
 
 // SetFeature updates settings for a feature and saves to disk.
@@ -165,25 +237,15 @@ func (s *AppSettings) SetFeature(name string, fs *FeatureSettings) error {
 	return s.saveLocked()
 }
 
-// GetAllFeatures returns a copy of all feature settings.
-func (s *AppSettings) GetAllFeatures() map[string]*FeatureSettings {
+// GetPublicFeatures returns copies of all feature settings with passwords
+// replaced by PasswordSet, for sending to clients.
+func (s *AppSettings) GetPublicFeatures() map[string]*FeatureSettings {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
 	result := make(map[string]*FeatureSettings)
 	for name, fs := range s.Features {
-		opts := make(map[string]string)
-		for k, v := range fs.Options {
-			opts[k] = v
-		}
-		result[name] = &FeatureSettings{
-			Enabled:  fs.Enabled,
-			Host:     fs.Host,
-			Port:     fs.Port,
-			Callsign: fs.Callsign,
-			Password: fs.Password,
-			Options:  opts,
-		}
+		result[name] = fs.redacted()
 	}
 	return result
 }
@@ -0,0 +1,345 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// stationHistoryWindow is how far back a station profile looks in the
+	// database for neighbour broadcasts and finished sessions.
+	stationHistoryWindow = 7 * 24 * time.Hour
+
+	// stationHeardMax bounds the heard log; the least recently heard
+	// station is dropped to make room.
+	stationHeardMax = 1000
+
+	// stationRecentBBS is how many of a station's BBS messages a profile
+	// lists.
+	stationRecentBBS = 5
+)
+
+// stationCallRe is what get_station accepts: a callsign with an optional SSID.
+var stationCallRe = regexp.MustCompile(`^[A-Z0-9]{1,6}(-\d{1,2})?$`)
+
+// StationHeard is when and where one callsign (with SSID) has been heard
+// transmitting on the monitor stream since startup.
+type StationHeard struct {
+	Callsign   string    `json:"callsign"`
+	FirstHeard time.Time `json:"firstHeard"`
+	LastHeard  time.Time `json:"lastHeard"`
+	Frames     int       `json:"frames"`
+	Ports      []int     `json:"ports"`
+}
+
+// stationHeardLog records every source callsign heard, keyed by callsign
+// with SSID.
+type stationHeardLog struct {
+	mu    sync.RWMutex
+	calls map[string]*StationHeard
+}
+
+func newStationHeardLog() *stationHeardLog {
+	return &stationHeardLog{calls: make(map[string]*StationHeard)}
+}
+
+// stationsHeard is fed from received monitor frames.
+var stationsHeard = newStationHeardLog()
+
+// Record notes a frame from call heard on port.
+func (h *stationHeardLog) Record(call string, port int, now time.Time) {
+	call = strings.ToUpper(strings.TrimSpace(call))
+	if call == "" {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s, ok := h.calls[call]
+	if !ok {
+		if len(h.calls) >= stationHeardMax {
+			h.evictOldestLocked()
+		}
+		s = &StationHeard{Callsign: call, FirstHeard: now}
+		h.calls[call] = s
+	}
+	s.LastHeard = now
+	s.Frames++
+	if !containsInt(s.Ports, port) {
+		s.Ports = append(s.Ports, port)
+		sort.Ints(s.Ports)
+	}
+}
+
+func (h *stationHeardLog) evictOldestLocked() {
+	var oldest *StationHeard
+	for _, s := range h.calls {
+		if oldest == nil || s.LastHeard.Before(oldest.LastHeard) {
+			oldest = s
+		}
+	}
+	if oldest != nil {
+		delete(h.calls, oldest.Callsign)
+	}
+}
+
+// Get returns the heard entries matching call, as for stationMatches,
+// most recently heard first.
+func (h *stationHeardLog) Get(call string) []StationHeard {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	var result []StationHeard
+	for c, s := range h.calls {
+		if stationMatches(c, call) {
+			cp := *s
+			cp.Ports = append([]int(nil), s.Ports...)
+			result = append(result, cp)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].LastHeard.After(result[j].LastHeard) })
+	return result
+}
+
+// stationMatches reports whether have is the station asked for. A request
+// with an SSID matches only that SSID; one without matches them all.
+func stationMatches(have, want string) bool {
+	have = strings.ToUpper(strings.TrimSpace(have))
+	want = strings.ToUpper(strings.TrimSpace(want))
+	if strings.Contains(want, "-") {
+		return have == want
+	}
+	return baseCallsign(have) == want
+}
+
+func containsInt(list []int, v int) bool {
+	for _, x := range list {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
+
+// StationBBS summarises a station's messages in the last BBS listing.
+type StationBBS struct {
+	From     int          `json:"from"`
+	To       int          `json:"to"`
+	LastDate string       `json:"lastDate,omitempty"`
+	Recent   []BBSMessage `json:"recent"`
+}
+
+// StationProfile is everything known about one station. Live state
+// (heard log, tracker sessions, RTT, chat) covers this run; the neighbour
+// broadcasts and finished sessions come from the database over the last
+// stationHistoryWindow. Chat and BBS are matched on the base callsign, as
+// both are per operator rather than per SSID.
+type StationProfile struct {
+	Callsign     string                 `json:"callsign"`
+	Base         string                 `json:"base"`
+	Color        string                 `json:"color"`
+	FirstHeard   *time.Time             `json:"firstHeard,omitempty"`
+	LastHeard    *time.Time             `json:"lastHeard,omitempty"`
+	Ports        []int                  `json:"ports"`
+	Heard        []StationHeard         `json:"heard"`
+	Sessions     []*Session             `json:"sessions"`
+	SessionStats []StationSessionStats  `json:"sessionStats"`
+	RTT          []NeighbourRTT         `json:"rtt"`
+	NeighbourCQ  []NeighborCQSummary    `json:"neighbourCQ"`
+	TARPNStat    []TARPNStatLinkSummary `json:"tarpnStat"`
+	Chat         []ChatUser             `json:"chat"`
+	THVersion    string                 `json:"thVersion,omitempty"`
+	BBS          *StationBBS            `json:"bbs,omitempty"`
+}
+
+// stationSources are the places a profile is gathered from. Any may be
+// nil when that part of the program is not running.
+type stationSources struct {
+	Heard     *stationHeardLog
+	Tracker   *SessionTracker
+	Storage   *LinkStatsStorage
+	LocalCall string
+	ChatUsers []ChatUser
+	BBS       []BBSMessage
+}
+
+// currentStationSources returns the running program's sources.
+func currentStationSources() stationSources {
+	src := stationSources{
+		Heard:     stationsHeard,
+		Tracker:   sessionTrackerRef,
+		Storage:   neighborStorageRef,
+		LocalCall: reportCallsign(),
+	}
+	if chatClient != nil {
+		src.ChatUsers = chatClient.GetUsers()
+	}
+	if bbsClient != nil {
+		src.BBS = bbsClient.Messages()
+	}
+	return src
+}
+
+// buildStationProfile gathers the profile of call from src.
+func buildStationProfile(call string, now time.Time, src stationSources) (*StationProfile, error) {
+	call = strings.ToUpper(strings.TrimSpace(call))
+	if !stationCallRe.MatchString(call) {
+		return nil, fmt.Errorf("invalid callsign %q", call)
+	}
+	base := baseCallsign(call)
+	p := &StationProfile{
+		Callsign:     call,
+		Base:         base,
+		Color:        hashCallsign(base),
+		Ports:        []int{},
+		Heard:        []StationHeard{},
+		Sessions:     []*Session{},
+		SessionStats: []StationSessionStats{},
+		RTT:          []NeighbourRTT{},
+		NeighbourCQ:  []NeighborCQSummary{},
+		TARPNStat:    []TARPNStatLinkSummary{},
+		Chat:         []ChatUser{},
+	}
+	heard := func(t time.Time, port int) {
+		if t.IsZero() {
+			return
+		}
+		if p.FirstHeard == nil || t.Before(*p.FirstHeard) {
+			first := t
+			p.FirstHeard = &first
+		}
+		if p.LastHeard == nil || t.After(*p.LastHeard) {
+			last := t
+			p.LastHeard = &last
+		}
+		if port > 0 && !containsInt(p.Ports, port) {
+			p.Ports = append(p.Ports, port)
+		}
+	}
+
+	if src.Heard != nil {
+		if hs := src.Heard.Get(call); hs != nil {
+			p.Heard = hs
+		}
+		for _, h := range p.Heard {
+			heard(h.FirstHeard, 0)
+			heard(h.LastHeard, 0)
+			for _, port := range h.Ports {
+				heard(h.LastHeard, port)
+			}
+		}
+	}
+
+	if src.Tracker != nil {
+		for _, sess := range src.Tracker.GetSessions() {
+			if !stationMatches(sess.Initiator, call) && !stationMatches(sess.Responder, call) {
+				continue
+			}
+			p.Sessions = append(p.Sessions, sess)
+			if sess.StartedAt != nil {
+				heard(*sess.StartedAt, sess.Port)
+			}
+			heard(sess.LastActivity, sess.Port)
+		}
+		for _, rtt := range src.Tracker.GetNeighbourRTT() {
+			if stationMatches(rtt.Callsign, call) {
+				p.RTT = append(p.RTT, rtt)
+			}
+		}
+	}
+
+	if src.Storage != nil {
+		// Stored timestamps are to the second, so round up to include now
+		since, until := now.Add(-stationHistoryWindow), now.Truncate(time.Second).Add(time.Second)
+		stats, err := src.Storage.GetStationSessionStats(SessionHistoryFilter{Station: call, Since: since}, src.LocalCall)
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range stats {
+			if stationMatches(s.Callsign, call) {
+				p.SessionStats = append(p.SessionStats, s)
+			}
+		}
+		cq, err := src.Storage.GetNeighborCQSummary(since, until)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range cq {
+			if stationMatches(c.Callsign, call) {
+				p.NeighbourCQ = append(p.NeighbourCQ, c)
+				heard(c.LastSeen, c.RxPort)
+			}
+		}
+		ts, err := src.Storage.GetTARPNStatSummary(since, until)
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range ts {
+			if stationMatches(t.Callsign, call) {
+				p.TARPNStat = append(p.TARPNStat, t)
+			}
+		}
+	}
+
+	for _, u := range src.ChatUsers {
+		if baseCallsign(u.Call) != base {
+			continue
+		}
+		p.Chat = append(p.Chat, u)
+		if u.THVersion != "" {
+			p.THVersion = u.THVersion
+		}
+	}
+
+	for _, m := range src.BBS {
+		from := baseCallsign(m.From) == base
+		if !from && baseCallsign(m.To) != base {
+			continue
+		}
+		if p.BBS == nil {
+			p.BBS = &StationBBS{Recent: []BBSMessage{}}
+		}
+		if from {
+			p.BBS.From++
+			if p.BBS.LastDate == "" {
+				p.BBS.LastDate = m.Date
+			}
+		} else {
+			p.BBS.To++
+		}
+		if len(p.BBS.Recent) < stationRecentBBS {
+			p.BBS.Recent = append(p.BBS.Recent, m)
+		}
+	}
+
+	sort.Ints(p.Ports)
+	return p, nil
+}
+
+// stationHandler serves /api/station?call=N0CALL-2.
+func stationHandler(w http.ResponseWriter, r *http.Request) {
+	call := strings.ToUpper(strings.TrimSpace(r.URL.Query().Get("call")))
+	if !stationCallRe.MatchString(call) {
+		http.Error(w, "call must be a callsign, optionally with an SSID", http.StatusBadRequest)
+		return
+	}
+	p, err := buildStationProfile(call, time.Now(), currentStationSources())
+	if err != nil {
+		wsLog.Warnw("Failed to build station profile", "call", call, "error", err)
+		http.Error(w, "failed to build station profile", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(p)
+}
+
+// setupStationRoutes adds the station directory API
+func setupStationRoutes() {
+	http.HandleFunc("/api/station", stationHandler)
+}
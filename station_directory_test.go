@@ -0,0 +1,84 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// A profile merges the heard log, live sessions, neighbour broadcasts, chat
+// and BBS for the station, and an SSID narrows the per-SSID parts.
+func TestBuildStationProfile(t *testing.T) {
+	// The CQ is stored with the time it was saved, so it comes before now
+	storage := newTestStorage(t)
+	if err := storage.SaveNeighborCQ(4, &LinkStatCQMessage{Callsign: "N3LLO-2", PortNum: 1}); err != nil {
+		t.Fatalf("SaveNeighborCQ: %v", err)
+	}
+
+	now := time.Now()
+	heard := newStationHeardLog()
+	heard.Record("N3LLO-2", 1, now.Add(-time.Hour))
+	heard.Record("n3llo-2", 3, now.Add(-time.Minute))
+	heard.Record("N3LLO-7", 2, now.Add(-30*time.Minute))
+	heard.Record("K1ABC-2", 1, now)
+
+	tracker := NewSessionTracker(200, nil, testLogger())
+	tracker.HandleLinkUp(&LinkUpEvent{Direction: "incoming", Port: "1", Remote: "N3LLO-2", Local: "WA2M-2"})
+	tracker.HandleLinkUp(&LinkUpEvent{Direction: "incoming", Port: "2", Remote: "K1ABC-2", Local: "WA2M-2"})
+
+	src := stationSources{
+		Heard:     heard,
+		Tracker:   tracker,
+		Storage:   storage,
+		LocalCall: "WA2M",
+		ChatUsers: []ChatUser{{Call: "N3LLO", Node: "LLO", THVersion: "2.3.3"}, {Call: "K1ABC"}},
+		BBS: []BBSMessage{
+			{Number: 12, From: "N3LLO", To: "ALL", Date: "10-Mar", Subject: "Net tonight"},
+			{Number: 11, From: "K1ABC", To: "N3LLO", Date: "09-Mar"},
+			{Number: 10, From: "K1ABC", To: "ALL"},
+		},
+	}
+
+	p, err := buildStationProfile("n3llo", now, src)
+	if err != nil {
+		t.Fatalf("buildStationProfile: %v", err)
+	}
+	if p.Callsign != "N3LLO" || p.Base != "N3LLO" || p.Color != hashCallsign("N3LLO") {
+		t.Errorf("identity = %s %s %s", p.Callsign, p.Base, p.Color)
+	}
+	if len(p.Heard) != 2 || p.Heard[0].Callsign != "N3LLO-2" || p.Heard[0].Frames != 2 {
+		t.Errorf("heard = %+v, want both SSIDs, N3LLO-2 first with 2 frames", p.Heard)
+	}
+	if p.FirstHeard == nil || !p.FirstHeard.Equal(now.Add(-time.Hour)) {
+		t.Errorf("firstHeard = %v", p.FirstHeard)
+	}
+	if len(p.Ports) != 4 || p.Ports[0] != 1 || p.Ports[3] != 4 {
+		t.Errorf("ports = %v, want 1-4", p.Ports)
+	}
+	if len(p.Sessions) != 1 || p.Sessions[0].Responder != "N3LLO-2" && p.Sessions[0].Initiator != "N3LLO-2" {
+		t.Errorf("sessions = %+v", p.Sessions)
+	}
+	if len(p.NeighbourCQ) != 1 || p.NeighbourCQ[0].RxPort != 4 {
+		t.Errorf("neighbourCQ = %+v", p.NeighbourCQ)
+	}
+	if len(p.Chat) != 1 || p.THVersion != "2.3.3" {
+		t.Errorf("chat = %+v, thVersion = %q", p.Chat, p.THVersion)
+	}
+	if p.BBS == nil || p.BBS.From != 1 || p.BBS.To != 1 || p.BBS.LastDate != "10-Mar" || len(p.BBS.Recent) != 2 {
+		t.Errorf("bbs = %+v", p.BBS)
+	}
+
+	p, err = buildStationProfile("N3LLO-7", now, src)
+	if err != nil {
+		t.Fatalf("buildStationProfile: %v", err)
+	}
+	if len(p.Heard) != 1 || len(p.Sessions) != 0 || len(p.NeighbourCQ) != 0 || len(p.Ports) != 1 || p.Ports[0] != 2 {
+		t.Errorf("N3LLO-7 profile = %+v, want only its own heard entry", p)
+	}
+	if p.THVersion != "2.3.3" || p.BBS == nil {
+		t.Errorf("N3LLO-7 should share the operator's chat and BBS, got %q %+v", p.THVersion, p.BBS)
+	}
+
+	if _, err := buildStationProfile("not a call", now, src); err == nil {
+		t.Error("invalid callsign accepted")
+	}
+}
@@ -3,6 +3,7 @@ import { Platform } from 'react-native';
 import AsyncStorage from '@react-native-async-storage/async-storage';
 import { htmlDecode, parseAX25Message } from '../utils/ax25Utils';
 import { parseMessageTimestamp, getMinuteKey } from '../utils/timeUtils';
+import { serverWsUrl } from '../utils/serverUrl';
 import { DEFAULT_FILTER_STATE } from '../components/FilterBar';
 import {
   BATCH_INTERVAL_MS,
@@ -65,7 +66,7 @@ export const AppProvider = ({ children }) => {
   // Settings
   const [settings, setSettings] = useState({
       host: Platform.OS === 'android' ? '10.0.2.2' : (Platform.OS === 'web' ? window.location.hostname : 'localhost'),
-      port: Platform.OS === 'web' ? (window.location.port || '80') : '8212',
+      port: Platform.OS === 'web' ? (window.location.port || (window.location.protocol === 'https:' ? '443' : '80')) : '8212',
       hideUSBRoutes: false,
       autoScroll: true,
       compactLayout: false,
@@ -214,7 +215,7 @@ export const AppProvider = ({ children }) => {
     }
 
     const { host, port } = settings;
-    let wsUrl = `ws://${host}:${port}/ws`;
+    let wsUrl = serverWsUrl(host, port, '/ws');
     
     console.log(`Connecting to WebSocket: ${wsUrl}`);
     try {
@@ -224,6 +225,9 @@ export const AppProvider = ({ children }) => {
         ws.onopen = () => {
           console.log("WebSocket connected");
           setIsConnected(true);
+          // Ask for batched, compressed delivery before anything else, so
+          // that the history replies below come back as single frames
+          ws.send(JSON.stringify({ cmd: "hello", protocol: 1, batch: true, compress: true }));
           // Server will send 'init' message first with features and buffer info
           // Then we request initial data - use 'latest' for initial load, 'sync' for reconnect
           if (initialLoadDone.current && lastSeq.current > 0) {
@@ -237,9 +241,16 @@ export const AppProvider = ({ children }) => {
           ws.send(JSON.stringify({ cmd: "get_link_stats" }));
         };
 
-        ws.onmessage = (event) => {
-          try {
-            const data = JSON.parse(event.data);
+        const handleMessage = (data) => {
+            // Command failures; the rest of the app carries on without
+            // the reply
+            if (data.type === 'error') {
+                console.warn(`Server rejected ${data.cmd}: ${data.error}`);
+                return;
+            }
+            if (data.type === 'ack' || data.type === 'hello') {
+                return;
+            }
 
             // Handle init message from server
             if (data.type === 'init') {
@@ -381,6 +392,17 @@ export const AppProvider = ({ children }) => {
             } else if (data.type === 'tarpn_stat') {
                 incomingStatsQueue.current.push(data);
             }
+        };
+
+        ws.onmessage = (event) => {
+          try {
+            const data = JSON.parse(event.data);
+            // A batch carries several messages in one frame
+            if (data.type === 'batch') {
+                (data.messages || []).forEach(handleMessage);
+            } else {
+                handleMessage(data);
+            }
           } catch (e) {
             console.error("JSON Parse Error", e);
           }
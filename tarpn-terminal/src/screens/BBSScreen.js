@@ -16,6 +16,7 @@ import { FlashList } from '@shopify/flash-list';
 import { Ionicons } from '@expo/vector-icons';
 import { useSafeAreaInsets } from 'react-native-safe-area-context';
 import { AppContext } from '../context/AppContext';
+import { serverWsUrl } from '../utils/serverUrl';
 
 // Message type badge colors
 const TYPE_COLORS = {
@@ -318,7 +319,7 @@ export default function BBSScreen() {
         }
 
         const { host, port } = settings;
-        const wsUrl = `ws://${host}:${port}/ws/bbs`;
+        const wsUrl = serverWsUrl(host, port, '/ws/bbs');
 
         console.log(`Connecting to BBS WebSocket: ${wsUrl}`);
 
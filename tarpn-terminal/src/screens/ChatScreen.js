@@ -16,6 +16,7 @@ import { Ionicons } from '@expo/vector-icons';
 import { useSafeAreaInsets } from 'react-native-safe-area-context';
 // AsyncStorage no longer needed — credentials managed by backend
 import { AppContext } from '../context/AppContext';
+import { serverWsUrl } from '../utils/serverUrl';
 import { hashCallsign } from '../utils/colorUtils';
 
 // Feature credentials are now managed by the backend settings system
@@ -158,7 +159,7 @@ export default function ChatScreen() {
         }
 
         const { host, port } = settings;
-        const wsUrl = `ws://${host}:${port}/ws/chat`;
+        const wsUrl = serverWsUrl(host, port, '/ws/chat');
 
         console.log(`Connecting to Chat WebSocket: ${wsUrl}`);
 
@@ -12,6 +12,7 @@ import {
 import { Ionicons } from '@expo/vector-icons';
 import { useSafeAreaInsets } from 'react-native-safe-area-context';
 import { AppContext } from '../context/AppContext';
+import { serverWsUrl } from '../utils/serverUrl';
 
 // Quick action buttons for common node commands
 const QUICK_ACTIONS = [
@@ -64,7 +65,7 @@ export default function NodeScreen() {
         }
 
         const { host, port } = settings;
-        const wsUrl = `ws://${host}:${port}/ws/node`;
+        const wsUrl = serverWsUrl(host, port, '/ws/node');
 
         console.log(`Connecting to Node WebSocket: ${wsUrl}`);
 
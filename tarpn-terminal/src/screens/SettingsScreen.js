@@ -52,7 +52,8 @@ export default function SettingsScreen() {
             host: fs.host || settings.host || 'localhost',
             port: String(fs.port || (feature === 'chat' ? 8513 : 8010)),
             callsign: fs.callsign || '',
-            password: fs.password || '',
+            password: '',
+            passwordSet: !!fs.passwordSet,
             name: opts.name || '',
             node: opts.node || '',
         });
@@ -240,7 +241,7 @@ export default function SettingsScreen() {
                             value={connectionConfig.password}
                             onChangeText={(text) => setConnectionConfig({ ...connectionConfig, password: text })}
                             secureTextEntry
-                            placeholder="Password"
+                            placeholder={connectionConfig.passwordSet ? 'Password set (leave blank to keep)' : 'Password'}
                             placeholderTextColor="#555"
                         />
 
@@ -0,0 +1,15 @@
+import { Platform } from 'react-native';
+
+// Path prefix tarpn-mon is served under behind a reverse proxy (e.g. "/tarpn"),
+// which the server writes into index.html. Empty when served at the root.
+export function serverBasePath() {
+    if (Platform.OS !== 'web' || typeof window === 'undefined') return '';
+    return (window.__TARPN_BASE_PATH__ || '').replace(/\/$/, '');
+}
+
+// WebSocket URL for a server path such as '/ws/node'. On the web it follows the
+// page's scheme, so a page served over HTTPS connects with wss.
+export function serverWsUrl(host, port, path) {
+    const secure = Platform.OS === 'web' && typeof window !== 'undefined' && window.location.protocol === 'https:';
+    return `${secure ? 'wss' : 'ws'}://${host}:${port}${serverBasePath()}${path}`;
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"regexp"
 	"strconv"
 	"strings"
 )
@@ -95,3 +96,80 @@ func parseTARPNStat(content string) (*TARPNStat, error) {
 
 	return stat, nil
 }
+
+// RouteEntry is one line of the LinBPQ "R R" routes table. Only the fields
+// needed to build a TARPNstat broadcast are kept.
+type RouteEntry struct {
+	PortNum        int
+	Callsign       string
+	Quality        int
+	ChevronSet     bool // '>' prefix: the link is active
+	LockedRoutes   int  // number of '!' marks
+	InfoFramesSent int
+	RetriesSent    int
+	BuffersToSend  int
+}
+
+var (
+	routesHeaderRe = regexp.MustCompile(`:([A-Z0-9]+-?\d*)\}`)
+	// port callsign quality nodes[!|!!] infoframes retries [percent] m1 m2 time buffers m3
+	routeLineRe = regexp.MustCompile(`^\s*(\d+)\s+([A-Z0-9]+-?\d*)\s+(\d+)\s+(\d+)(!{0,2})\s*(\d+)\s+(\d+)\s+(?:\d+%?\s+)?\d+\s+\d+\s+\d+:\d+\s+(\d+)\s+\d+`)
+)
+
+// parseRoutesTable parses the response to "R R". It returns the node
+// callsign from the header line (e.g. "MIKE:WA2M-2} Routes") and the routes.
+// This is the same parsing send-routes-via-cq does.
+func parseRoutesTable(lines []string) (string, []RouteEntry) {
+	var nodeCall string
+	var routes []RouteEntry
+	for _, line := range lines {
+		if strings.Contains(line, "Routes") {
+			if m := routesHeaderRe.FindStringSubmatch(line); m != nil {
+				nodeCall = m[1]
+			}
+			continue
+		}
+
+		var r RouteEntry
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, ">") {
+			r.ChevronSet = true
+			line = line[1:]
+		}
+		m := routeLineRe.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		r.PortNum, _ = strconv.Atoi(m[1])
+		r.Callsign = m[2]
+		r.Quality, _ = strconv.Atoi(m[3])
+		r.LockedRoutes = len(m[5])
+		r.InfoFramesSent, _ = strconv.Atoi(m[6])
+		r.RetriesSent, _ = strconv.Atoi(m[7])
+		r.BuffersToSend, _ = strconv.Atoi(m[8])
+		routes = append(routes, r)
+	}
+	return nodeCall, routes
+}
+
+// tarpnStatRoute picks the route a TARPNstat broadcast on portNum reports:
+// the first locked route with a real (>1) quality, as send-routes-via-cq does.
+func tarpnStatRoute(routes []RouteEntry, portNum int) (RouteEntry, bool) {
+	for _, r := range routes {
+		if r.PortNum == portNum && r.LockedRoutes > 0 && r.Quality > 1 {
+			return r, true
+		}
+	}
+	return RouteEntry{}, false
+}
+
+// formatTARPNStat builds the CQ text for a TARPNstat V2 broadcast, the
+// inverse of parseTARPNStat.
+func formatTARPNStat(nodeCall string, r RouteEntry) string {
+	chevron := 'n'
+	if r.ChevronSet {
+		chevron = '>'
+	}
+	return fmt.Sprintf("[TARPNstat V2]~%s~%c~tx%d~ret%d~buf%d~",
+		nodeCall, chevron, r.InfoFramesSent, r.RetriesSent, r.BuffersToSend)
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// "R R" output in the two layouts send-routes-via-cq has to cope with.
+const routesResponse = `MIKE:WA2M-2} Routes
+2 N2IRZ-2   200   0!!   0    0      0 0 00:00  0 0
+> 3 NF4L-2    200   3!!  11    2  18% 0 0 15:03  0 200
+> 1 NZ2Z-2    200   2!!   9    2  22% 0 0 00:00  4 0
+> 4 KM4DLS-2    1  15  724  123  16% 0 0 19:33  18 156
+>32 WA2M-9    200   1!   0    0      0 0 00:00  0 0 41430`
+
+func TestParseRoutesTable(t *testing.T) {
+	nodeCall, routes := parseRoutesTable(strings.Split(routesResponse, "\n"))
+	if nodeCall != "WA2M-2" {
+		t.Errorf("nodeCall = %q, want WA2M-2", nodeCall)
+	}
+	if len(routes) != 5 {
+		t.Fatalf("got %d routes, want 5", len(routes))
+	}
+
+	r := routes[2]
+	if r.PortNum != 1 || r.Callsign != "NZ2Z-2" || !r.ChevronSet || r.LockedRoutes != 2 ||
+		r.InfoFramesSent != 9 || r.RetriesSent != 2 || r.BuffersToSend != 4 {
+		t.Errorf("route 2 = %+v", r)
+	}
+	if routes[0].ChevronSet {
+		t.Error("route 0 has no chevron")
+	}
+	if routes[4].PortNum != 32 {
+		t.Errorf("route 4 port = %d, want 32 (no space after chevron)", routes[4].PortNum)
+	}
+}
+
+// The TARPNstat we send must be readable by the same parser that handles
+// TARPNstat heard from stock nodes.
+func TestFormatTARPNStatRoundTrip(t *testing.T) {
+	nodeCall, routes := parseRoutesTable(strings.Split(routesResponse, "\n"))
+
+	if _, ok := tarpnStatRoute(routes, 4); ok {
+		t.Error("port 4 route is unlocked with quality 1; send-routes-via-cq would not report it")
+	}
+	route, ok := tarpnStatRoute(routes, 3)
+	if !ok {
+		t.Fatal("no TARPNstat route for port 3")
+	}
+
+	msg := formatTARPNStat(nodeCall, route)
+	if msg != "[TARPNstat V2]~WA2M-2~>~tx11~ret2~buf0~" {
+		t.Errorf("formatTARPNStat = %q", msg)
+	}
+	stat, err := parseTARPNStat(msg)
+	if err != nil {
+		t.Fatalf("parseTARPNStat: %v", err)
+	}
+	if stat.Callsign != "WA2M-2" || !stat.LinkUp || stat.Tx != 11 || stat.Ret != 2 {
+		t.Errorf("round trip = %+v", stat)
+	}
+}
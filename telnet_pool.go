@@ -0,0 +1,403 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SessionMode is what a pooled telnet session has been logged into.
+type SessionMode string
+
+const (
+	// SessionNode is a session sitting at the node command prompt.
+	SessionNode SessionMode = "node"
+	// SessionBBS is a session that has entered the BBS with the BBS command.
+	SessionBBS SessionMode = "bbs"
+)
+
+// SessionTarget identifies the kind of session wanted. Only idle sessions
+// with an identical target are handed out again.
+type SessionTarget struct {
+	Hostname string
+	Port     int
+	Callsign string
+	Password string
+	Mode     SessionMode
+}
+
+func (t SessionTarget) addr() string {
+	return net.JoinHostPort(t.Hostname, strconv.Itoa(t.Port))
+}
+
+// TelnetPoolConfig controls the telnet session pool.
+type TelnetPoolConfig struct {
+	// MaxSessions caps the number of open sessions, idle or in use. Every
+	// session holds a LinBPQ stream and shows in the node's user list.
+	MaxSessions int
+	// IdleTimeout closes sessions that have not been used for this long.
+	// It should be shorter than the node's L4 idle timeout, or LinBPQ will
+	// drop them first.
+	IdleTimeout time.Duration
+	// DialTimeout and LoginTimeout bound opening a new session.
+	DialTimeout  time.Duration
+	LoginTimeout time.Duration
+}
+
+// DefaultTelnetPoolConfig returns the pool settings used when no flags are
+// given.
+func DefaultTelnetPoolConfig() TelnetPoolConfig {
+	return TelnetPoolConfig{
+		MaxSessions:  4,
+		IdleTimeout:  5 * time.Minute,
+		DialTimeout:  10 * time.Second,
+		LoginTimeout: 10 * time.Second,
+	}
+}
+
+// ErrPoolClosed is returned by Acquire after Close.
+var ErrPoolClosed = errors.New("telnet pool closed")
+
+// PoolSession is an authenticated telnet session checked out of a
+// TelnetPool. The holder must call exactly one of Release, when the session
+// is back at its prompt and can be reused, or Discard, when its state is
+// unknown (an error, a timeout, or anything interactive).
+type PoolSession struct {
+	*TelnetConn
+
+	target   SessionTarget
+	pool     *TelnetPool
+	lastUsed time.Time
+	done     bool
+}
+
+// Mode returns what the session is logged into.
+func (s *PoolSession) Mode() SessionMode {
+	return s.target.Mode
+}
+
+// Release returns the session to the pool for reuse.
+func (s *PoolSession) Release() {
+	if s.done {
+		return
+	}
+	s.done = true
+	s.pool.put(s)
+}
+
+// Discard closes the session and frees its slot in the pool.
+func (s *PoolSession) Discard() {
+	if s.done {
+		return
+	}
+	s.done = true
+	s.Close()
+	s.pool.drop(s.target.Mode)
+}
+
+// alive is the health check for an idle session. It drains anything the
+// node sent while the session sat in the pool and reports whether the
+// connection is still open. It costs no traffic on the node.
+func (s *PoolSession) alive() bool {
+	s.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	defer s.SetReadDeadline(time.Time{})
+	for {
+		line, err := s.Reader().ReadString('\n')
+		if err != nil {
+			var netErr net.Error
+			return errors.As(err, &netErr) && netErr.Timeout()
+		}
+		telnetLog.Debugw("Telnet pool: discarding idle output", "line", strings.TrimRight(line, "\r\n"))
+	}
+}
+
+// TelnetPool hands out authenticated telnet sessions to LinBPQ and keeps
+// them open between uses, so that pollers, CQ broadcasts and bulletins do
+// not each log in afresh.
+type TelnetPool struct {
+	config TelnetPoolConfig
+
+	mu     sync.Mutex
+	idle   map[SessionTarget][]*PoolSession
+	open   int
+	inUse  map[SessionMode]int
+	wake   chan struct{} // closed and replaced whenever a slot or idle session frees up
+	closed bool
+}
+
+// NewTelnetPool creates an empty pool. Call Run to expire idle sessions.
+func NewTelnetPool(config TelnetPoolConfig) *TelnetPool {
+	def := DefaultTelnetPoolConfig()
+	if config.MaxSessions <= 0 {
+		config.MaxSessions = def.MaxSessions
+	}
+	if config.IdleTimeout <= 0 {
+		config.IdleTimeout = def.IdleTimeout
+	}
+	if config.DialTimeout <= 0 {
+		config.DialTimeout = def.DialTimeout
+	}
+	if config.LoginTimeout <= 0 {
+		config.LoginTimeout = def.LoginTimeout
+	}
+	return &TelnetPool{
+		config: config,
+		idle:   make(map[SessionTarget][]*PoolSession),
+		inUse:  make(map[SessionMode]int),
+		wake:   make(chan struct{}),
+	}
+}
+
+// Acquire returns a session for target, reusing an idle one if it passes the
+// health check. If the pool is full it closes the oldest idle session for a
+// different target, or failing that waits for one to be released until ctx
+// is done.
+func (p *TelnetPool) Acquire(ctx context.Context, target SessionTarget) (*PoolSession, error) {
+	for {
+		p.mu.Lock()
+		if p.closed {
+			p.mu.Unlock()
+			return nil, ErrPoolClosed
+		}
+
+		if s := p.popIdle(target); s != nil {
+			s.done = false
+			p.inUse[target.Mode]++
+			p.updateMetrics()
+			p.mu.Unlock()
+			if s.alive() {
+				return s, nil
+			}
+			telnetLog.Infow("Telnet pool: idle session closed by node", "mode", target.Mode)
+			s.Discard()
+			continue
+		}
+
+		var evicted *PoolSession
+		if p.open >= p.config.MaxSessions {
+			evicted = p.popOldestIdle()
+			if evicted == nil {
+				wake := p.wake
+				p.mu.Unlock()
+				select {
+				case <-ctx.Done():
+					return nil, fmt.Errorf("waiting for telnet session: %w", ctx.Err())
+				case <-wake:
+				}
+				continue
+			}
+			// The evicted session's slot passes straight to the new one.
+		} else {
+			p.open++
+		}
+		p.inUse[target.Mode]++
+		p.updateMetrics()
+		p.mu.Unlock()
+
+		if evicted != nil {
+			telnetLog.Debugw("Telnet pool: closing idle session to make room",
+				"mode", evicted.target.Mode, "for", target.Mode)
+			evicted.Close()
+		}
+
+		tc, err := p.login(ctx, target)
+		if err != nil {
+			telnetPoolLoginFailures.WithLabelValues(string(target.Mode)).Inc()
+			p.drop(target.Mode)
+			return nil, err
+		}
+		telnetPoolLogins.WithLabelValues(string(target.Mode)).Inc()
+		telnetLog.Debugw("Telnet pool: new session", "mode", target.Mode, "addr", target.addr())
+		return &PoolSession{TelnetConn: tc, target: target, pool: p}, nil
+	}
+}
+
+// popIdle removes and returns the most recently used idle session for
+// target. The caller holds p.mu.
+func (p *TelnetPool) popIdle(target SessionTarget) *PoolSession {
+	list := p.idle[target]
+	if len(list) == 0 {
+		return nil
+	}
+	s := list[len(list)-1]
+	p.idle[target] = list[:len(list)-1]
+	return s
+}
+
+// popOldestIdle removes and returns the least recently used idle session of
+// any target, or nil. The caller holds p.mu.
+func (p *TelnetPool) popOldestIdle() *PoolSession {
+	var oldestTarget SessionTarget
+	var oldest *PoolSession
+	for target, list := range p.idle {
+		if len(list) > 0 && (oldest == nil || list[0].lastUsed.Before(oldest.lastUsed)) {
+			oldest, oldestTarget = list[0], target
+		}
+	}
+	if oldest != nil {
+		p.idle[oldestTarget] = p.idle[oldestTarget][1:]
+	}
+	return oldest
+}
+
+// login dials LinBPQ's telnet port, authenticates, and for a BBS session
+// enters the BBS and waits for its prompt.
+func (p *TelnetPool) login(ctx context.Context, target SessionTarget) (*TelnetConn, error) {
+	dialer := net.Dialer{Timeout: p.config.DialTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", target.addr())
+	if err != nil {
+		return nil, fmt.Errorf("connect failed: %w", err)
+	}
+
+	tc, err := NewTelnetConn(conn, 2*time.Second, telnetLog)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("telnet negotiation failed: %w", err)
+	}
+
+	if _, err := tc.Authenticate(target.Callsign, target.Password, p.config.LoginTimeout); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("auth failed: %w", err)
+	}
+
+	if target.Mode == SessionBBS {
+		if err := tc.WriteString("BBS"); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to enter BBS: %w", err)
+		}
+		// Wait for BBS SID (e.g. "[LinBPQ-6.0.24.1-B2FHIM$]")
+		_, found, err := tc.ReadUntil(func(line string) bool {
+			return strings.Contains(line, "[") && strings.Contains(line, "]")
+		}, p.config.LoginTimeout)
+		if err != nil || !found {
+			conn.Close()
+			return nil, fmt.Errorf("BBS SID not received: %w", err)
+		}
+		// Let the BBS prompt arrive before the first command
+		tc.ReadUntil(promptPredicate, 5*time.Second)
+	}
+	return tc, nil
+}
+
+// put returns a session to the idle list.
+func (p *TelnetPool) put(s *PoolSession) {
+	s.lastUsed = time.Now()
+
+	p.mu.Lock()
+	p.inUse[s.target.Mode]--
+	if p.closed {
+		p.open--
+		p.updateMetrics()
+		p.mu.Unlock()
+		s.Close()
+		return
+	}
+	p.idle[s.target] = append(p.idle[s.target], s)
+	p.signal()
+	p.updateMetrics()
+	p.mu.Unlock()
+}
+
+// drop frees the slot of an in-use session that has been closed.
+func (p *TelnetPool) drop(mode SessionMode) {
+	p.mu.Lock()
+	p.inUse[mode]--
+	p.open--
+	p.signal()
+	p.updateMetrics()
+	p.mu.Unlock()
+}
+
+// signal wakes every Acquire waiting for a slot. The caller holds p.mu.
+func (p *TelnetPool) signal() {
+	close(p.wake)
+	p.wake = make(chan struct{})
+}
+
+// updateMetrics publishes the session counts. The caller holds p.mu.
+func (p *TelnetPool) updateMetrics() {
+	inUse := 0
+	for _, mode := range []SessionMode{SessionNode, SessionBBS} {
+		telnetPoolInUse.WithLabelValues(string(mode)).Set(float64(p.inUse[mode]))
+		inUse += p.inUse[mode]
+	}
+	telnetPoolIdle.Set(float64(p.open - inUse))
+}
+
+// Run closes idle sessions older than the idle timeout until ctx is done,
+// then closes the pool.
+func (p *TelnetPool) Run(ctx context.Context) {
+	interval := p.config.IdleTimeout / 4
+	if interval < time.Second {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			p.Close()
+			return
+		case <-ticker.C:
+			p.expireIdle(time.Now())
+		}
+	}
+}
+
+// expireIdle closes idle sessions not used since before now minus the idle
+// timeout.
+func (p *TelnetPool) expireIdle(now time.Time) {
+	var expired []*PoolSession
+	p.mu.Lock()
+	for target, list := range p.idle {
+		keep := list[:0]
+		for _, s := range list {
+			if now.Sub(s.lastUsed) >= p.config.IdleTimeout {
+				expired = append(expired, s)
+			} else {
+				keep = append(keep, s)
+			}
+		}
+		p.idle[target] = keep
+	}
+	p.open -= len(expired)
+	if len(expired) > 0 {
+		p.signal()
+	}
+	p.updateMetrics()
+	p.mu.Unlock()
+
+	for _, s := range expired {
+		telnetLog.Debugw("Telnet pool: closing idle session", "mode", s.target.Mode)
+		s.Close()
+	}
+}
+
+// Close closes all idle sessions and makes further Acquire calls fail.
+// Sessions in use are closed when they are released.
+func (p *TelnetPool) Close() {
+	p.mu.Lock()
+	var idle []*PoolSession
+	for _, list := range p.idle {
+		idle = append(idle, list...)
+	}
+	p.idle = make(map[SessionTarget][]*PoolSession)
+	p.open -= len(idle)
+	p.closed = true
+	p.signal()
+	p.updateMetrics()
+	p.mu.Unlock()
+
+	for _, s := range idle {
+		s.Close()
+	}
+}
+
+// telnetPool is the process-wide session pool, set up in main.
+var telnetPool = NewTelnetPool(DefaultTelnetPoolConfig())
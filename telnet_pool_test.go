@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeNode is a minimal LinBPQ telnet port: it prompts for callsign and
+// password, sends CTEXT, then answers "S" with a prompt. It counts logins.
+type fakeNode struct {
+	ln     net.Listener
+	logins int32
+	conns  chan net.Conn
+}
+
+func newFakeNode(t *testing.T) *fakeNode {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	f := &fakeNode{ln: ln, conns: make(chan net.Conn, 16)}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			f.conns <- conn
+			go f.serve(conn)
+		}
+	}()
+	return f
+}
+
+func (f *fakeNode) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	conn.Write([]byte("user:"))
+	if _, err := r.ReadString('\r'); err != nil {
+		return
+	}
+	conn.Write([]byte("password:"))
+	if _, err := r.ReadString('\r'); err != nil {
+		return
+	}
+	atomic.AddInt32(&f.logins, 1)
+	conn.Write([]byte("Connected to TEST's Telnet Server\r\n"))
+	for {
+		if _, err := r.ReadString('\r'); err != nil {
+			return
+		}
+		conn.Write([]byte("TEST:N0CALL-2}\r\n"))
+	}
+}
+
+func (f *fakeNode) target() SessionTarget {
+	addr := f.ln.Addr().(*net.TCPAddr)
+	return SessionTarget{
+		Hostname: "127.0.0.1",
+		Port:     addr.Port,
+		Callsign: "N0CALL",
+		Password: "p",
+		Mode:     SessionNode,
+	}
+}
+
+func newTestPool(max int) *TelnetPool {
+	return NewTelnetPool(TelnetPoolConfig{
+		MaxSessions:  max,
+		IdleTimeout:  time.Minute,
+		DialTimeout:  time.Second,
+		LoginTimeout: 2 * time.Second,
+	})
+}
+
+// A released session is handed out again without a second login.
+func TestTelnetPoolReusesSessions(t *testing.T) {
+	node := newFakeNode(t)
+	pool := newTestPool(2)
+	defer pool.Close()
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		s, err := pool.Acquire(ctx, node.target())
+		if err != nil {
+			t.Fatalf("Acquire %d: %v", i, err)
+		}
+		if err := s.WriteString("S"); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		if _, found, _ := s.ReadUntil(promptPredicate, 2*time.Second); !found {
+			t.Fatalf("no prompt on round %d", i)
+		}
+		s.Release()
+	}
+
+	if got := atomic.LoadInt32(&node.logins); got != 1 {
+		t.Errorf("logins = %d, want 1", got)
+	}
+}
+
+// With every slot in use, Acquire waits for a release rather than opening
+// another session, and gives up when its context ends.
+func TestTelnetPoolCapsSessions(t *testing.T) {
+	node := newFakeNode(t)
+	pool := newTestPool(1)
+	defer pool.Close()
+
+	first, err := pool.Acquire(context.Background(), node.target())
+	if err != nil {
+		t.Fatalf("Acquire: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, err := pool.Acquire(ctx, node.target()); err == nil {
+		t.Fatal("second Acquire succeeded with the pool full")
+	}
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		first.Release()
+	}()
+	second, err := pool.Acquire(context.Background(), node.target())
+	if err != nil {
+		t.Fatalf("Acquire after release: %v", err)
+	}
+	if second != first {
+		t.Error("expected the released session back")
+	}
+	second.Release()
+
+	if got := atomic.LoadInt32(&node.logins); got != 1 {
+		t.Errorf("logins = %d, want 1", got)
+	}
+}
+
+// An idle session the node has hung up on fails the health check and is
+// replaced by a fresh login.
+func TestTelnetPoolReplacesDeadSession(t *testing.T) {
+	node := newFakeNode(t)
+	pool := newTestPool(1)
+	defer pool.Close()
+	ctx := context.Background()
+
+	s, err := pool.Acquire(ctx, node.target())
+	if err != nil {
+		t.Fatalf("Acquire: %v", err)
+	}
+	s.Release()
+
+	// Drop the server side of the session.
+	(<-node.conns).Close()
+	time.Sleep(50 * time.Millisecond)
+
+	s, err = pool.Acquire(ctx, node.target())
+	if err != nil {
+		t.Fatalf("Acquire after hangup: %v", err)
+	}
+	defer s.Release()
+	if got := atomic.LoadInt32(&node.logins); got != 2 {
+		t.Errorf("logins = %d, want 2", got)
+	}
+}
+
+// Idle sessions past the idle timeout are closed, freeing their slot.
+func TestTelnetPoolExpiresIdle(t *testing.T) {
+	node := newFakeNode(t)
+	pool := newTestPool(1)
+	defer pool.Close()
+
+	s, err := pool.Acquire(context.Background(), node.target())
+	if err != nil {
+		t.Fatalf("Acquire: %v", err)
+	}
+	s.Release()
+
+	pool.expireIdle(time.Now().Add(2 * time.Minute))
+	if pool.open != 0 || len(pool.idle[node.target()]) != 0 {
+		t.Errorf("open = %d, idle = %d after expiry, want 0", pool.open, len(pool.idle[node.target()]))
+	}
+
+	// A different target can now be served at once.
+	other := node.target()
+	other.Callsign = "N0CALL-5"
+	s, err = pool.Acquire(context.Background(), other)
+	if err != nil {
+		t.Fatalf("Acquire other: %v", err)
+	}
+	s.Discard()
+}
@@ -0,0 +1,383 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// What a client's full queue does to make room.
+const (
+	// wsOverflowDropOldest drops the oldest queued stream message (monitor
+	// lines, chat messages and node output, which clients can re-sync by
+	// sequence number). Control messages are never dropped; a queue full of
+	// them disconnects the client.
+	wsOverflowDropOldest = "drop-oldest"
+	// wsOverflowDisconnect disconnects the client.
+	wsOverflowDisconnect = "disconnect"
+)
+
+// Outbound queue settings, set from flags in main.
+var (
+	wsQueueSize      = 1000
+	wsWriteTimeout   = 10 * time.Second
+	wsOverflowPolicy = wsOverflowDropOldest
+)
+
+// Batching defaults and limits for clients that ask for it with hello.
+const (
+	wsBatchWindow    = 100 * time.Millisecond
+	wsBatchMax       = 50
+	wsBatchWindowMin = 10 * time.Millisecond
+	wsBatchWindowMax = time.Second
+	wsBatchMaxLimit  = 500
+)
+
+var errWebsocketClosed = errors.New("websocket closed")
+
+// wsMessage is one queued outbound message.
+type wsMessage struct {
+	data      string
+	droppable bool
+	alone     bool // already a batch envelope; never coalesced
+	queued    time.Time
+}
+
+// websocketConn is a client socket with a bounded outbound queue drained by
+// its own writer goroutine, so that a slow client never blocks whoever is
+// sending to it: broadcasts enqueue and return, and a write that stalls
+// past wsWriteTimeout closes the connection.
+type websocketConn struct {
+	wc     *websocket.Conn
+	socket string // which endpoint: monitor, chat, bbs, node, oarc
+	remote string
+	user   string
+	role   Role
+	since  time.Time
+
+	// canCompress is whether permessage-deflate was negotiated in the
+	// handshake; it is only used once the client asks for it.
+	canCompress bool
+
+	mu          sync.Mutex
+	cond        *sync.Cond // signalled when the queue changes or the conn closes
+	queue       []wsMessage
+	closed      bool
+	sent        int64
+	dropped     int64
+	batchWindow time.Duration
+	batchMax    int // below 2: one message per frame
+	compress    bool
+}
+
+var (
+	wsConns   = make(map[*websocketConn]bool)
+	wsConnsMu sync.RWMutex
+)
+
+// newWebsocketConn wraps an upgraded connection and starts its writer.
+// socket names the endpoint in metrics and /api/websockets.
+func newWebsocketConn(conn *websocket.Conn, socket string, r *http.Request) *websocketConn {
+	w := registerWebsocketConn(conn, socket, r)
+	go w.writeLoop()
+	return w
+}
+
+// registerWebsocketConn is newWebsocketConn without starting the writer.
+func registerWebsocketConn(conn *websocket.Conn, socket string, r *http.Request) *websocketConn {
+	w := &websocketConn{
+		wc:     conn,
+		socket: socket,
+		remote: r.RemoteAddr,
+		role:   requestRole(r),
+		since:  time.Now(),
+
+		canCompress: strings.Contains(strings.ToLower(r.Header.Get("Sec-WebSocket-Extensions")), "permessage-deflate"),
+	}
+	if u := requestUser(r); u != nil {
+		w.user = u.Username
+	}
+	w.cond = sync.NewCond(&w.mu)
+
+	wsConnsMu.Lock()
+	wsConns[w] = true
+	wsConnsMu.Unlock()
+	return w
+}
+
+// write queues a control message: a reply, status or settings update that
+// must not be lost. It does not block.
+func (w *websocketConn) write(message string) error {
+	return w.enqueue(message, false)
+}
+
+// writeDroppable queues a live stream message that a client can recover by
+// re-syncing, so it may be dropped to make room under wsOverflowDropOldest.
+// It does not block.
+func (w *websocketConn) writeDroppable(message string) error {
+	return w.enqueue(message, true)
+}
+
+// writeWait queues a message, waiting while the queue is full. It is for
+// history a client asked for, sent from that client's own goroutine, so a
+// slow client only slows its own reply.
+func (w *websocketConn) writeWait(message string) error {
+	return w.enqueueWait(wsMessage{data: message})
+}
+
+// writeBatch sends a reply of many messages, such as the history for
+// sync, as one batch envelope if the client asked for batching, or one by
+// one with writeWait if not.
+func (w *websocketConn) writeBatch(messages []string) error {
+	w.mu.Lock()
+	batching := w.batchMax > 1
+	w.mu.Unlock()
+	if !batching {
+		for _, m := range messages {
+			if err := w.writeWait(m); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if len(messages) == 0 {
+		return nil
+	}
+	return w.enqueueWait(wsMessage{data: batchEnvelope(messages), alone: true})
+}
+
+// setBatching makes the writer coalesce messages queued within window of
+// each other, up to max, into one batch envelope. max below 2 turns it
+// off.
+func (w *websocketConn) setBatching(window time.Duration, max int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.batchWindow = window
+	w.batchMax = max
+}
+
+// setCompression turns on permessage-deflate for writes, if the handshake
+// negotiated it, and reports whether it is on.
+func (w *websocketConn) setCompression(on bool) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.compress = on && w.canCompress
+	return w.compress
+}
+
+// batchEnvelope wraps JSON messages in one {"type":"batch"} message.
+func batchEnvelope(messages []string) string {
+	var b strings.Builder
+	b.WriteString(`{"type":"batch","messages":[`)
+	for i, m := range messages {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(m)
+	}
+	b.WriteString("]}")
+	return b.String()
+}
+
+func (w *websocketConn) enqueueWait(m wsMessage) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for !w.closed && len(w.queue) >= wsQueueSize {
+		w.cond.Wait()
+	}
+	if w.closed {
+		return errWebsocketClosed
+	}
+	m.queued = time.Now()
+	w.queue = append(w.queue, m)
+	w.cond.Broadcast()
+	return nil
+}
+
+func (w *websocketConn) enqueue(message string, droppable bool) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return errWebsocketClosed
+	}
+	if len(w.queue) >= wsQueueSize && !w.makeRoomLocked() {
+		websocketEvictionsTotal.WithLabelValues(w.socket).Inc()
+		wsLog.Warnw("Disconnecting slow WebSocket client", "socket", w.socket, "remote", w.remote, "queued", len(w.queue),
+			"lag", time.Since(w.queue[0].queued).Round(time.Millisecond), "policy", wsOverflowPolicy)
+		w.closeLocked()
+		return fmt.Errorf("websocket queue full")
+	}
+	w.queue = append(w.queue, wsMessage{data: message, droppable: droppable, queued: time.Now()})
+	w.cond.Broadcast()
+	return nil
+}
+
+// makeRoomLocked drops the oldest droppable message if the policy allows,
+// reporting whether there is now room.
+func (w *websocketConn) makeRoomLocked() bool {
+	if wsOverflowPolicy != wsOverflowDropOldest {
+		return false
+	}
+	for i, m := range w.queue {
+		if m.droppable {
+			w.queue = append(w.queue[:i], w.queue[i+1:]...)
+			w.dropped++
+			websocketDroppedTotal.WithLabelValues(w.socket).Inc()
+			return true
+		}
+	}
+	return false
+}
+
+func (w *websocketConn) writeLoop() {
+	for {
+		w.mu.Lock()
+		for !w.closed && len(w.queue) == 0 {
+			w.cond.Wait()
+		}
+		if w.closed {
+			w.mu.Unlock()
+			return
+		}
+		batch := []wsMessage{w.popLocked()}
+		window, max, compress := w.batchWindow, w.batchMax, w.compress
+		if max > 1 && !batch[0].alone {
+			batch = w.fillBatchLocked(batch, max)
+		}
+		w.mu.Unlock()
+
+		// Give a batch until window after its first message to fill
+		if max > 1 && !batch[0].alone && len(batch) < max {
+			if wait := time.Until(batch[0].queued.Add(window)); wait > 0 {
+				time.Sleep(wait)
+				w.mu.Lock()
+				batch = w.fillBatchLocked(batch, max)
+				w.mu.Unlock()
+			}
+		}
+
+		now := time.Now()
+		data := make([]string, len(batch))
+		for i, m := range batch {
+			websocketQueueLagSeconds.WithLabelValues(w.socket).Observe(now.Sub(m.queued).Seconds())
+			data[i] = m.data
+		}
+		frame := data[0]
+		if len(data) > 1 {
+			frame = batchEnvelope(data)
+		}
+		w.wc.EnableWriteCompression(compress)
+		w.wc.SetWriteDeadline(now.Add(wsWriteTimeout))
+		if err := w.wc.WriteMessage(websocket.TextMessage, []byte(frame)); err != nil {
+			wsLog.Debugw("WebSocket write failed, closing connection", "socket", w.socket, "remote", w.remote, "error", err)
+			w.kill()
+			return
+		}
+		w.mu.Lock()
+		w.sent += int64(len(batch))
+		w.mu.Unlock()
+	}
+}
+
+// popLocked removes the message at the head of the queue.
+func (w *websocketConn) popLocked() wsMessage {
+	m := w.queue[0]
+	w.queue[0] = wsMessage{}
+	w.queue = w.queue[1:]
+	w.cond.Broadcast()
+	return m
+}
+
+// fillBatchLocked moves queued messages onto batch until it has max,
+// stopping at one that must go alone.
+func (w *websocketConn) fillBatchLocked(batch []wsMessage, max int) []wsMessage {
+	for len(batch) < max && len(w.queue) > 0 && !w.queue[0].alone {
+		batch = append(batch, w.popLocked())
+	}
+	return batch
+}
+
+// kill closes the connection, discarding anything still queued. The read
+// loop then fails and the handler unregisters the client.
+func (w *websocketConn) kill() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.closeLocked()
+}
+
+func (w *websocketConn) closeLocked() {
+	if w.closed {
+		return
+	}
+	w.closed = true
+	w.queue = nil
+	w.cond.Broadcast()
+	w.wc.Close()
+
+	wsConnsMu.Lock()
+	delete(wsConns, w)
+	wsConnsMu.Unlock()
+}
+
+// WebsocketClientInfo describes one connected client's outbound queue.
+type WebsocketClientInfo struct {
+	Socket     string    `json:"socket"`
+	Remote     string    `json:"remote"`
+	User       string    `json:"user,omitempty"`
+	Since      time.Time `json:"since"`
+	Queued     int       `json:"queued"`
+	LagSeconds float64   `json:"lagSeconds"` // age of the oldest queued message
+	Sent       int64     `json:"sent"`
+	Dropped    int64     `json:"dropped"`
+}
+
+// GetWebsocketClients returns every connected client's queue state, the
+// most lagged first.
+func GetWebsocketClients() []WebsocketClientInfo {
+	wsConnsMu.RLock()
+	conns := make([]*websocketConn, 0, len(wsConns))
+	for w := range wsConns {
+		conns = append(conns, w)
+	}
+	wsConnsMu.RUnlock()
+
+	now := time.Now()
+	list := make([]WebsocketClientInfo, 0, len(conns))
+	for _, w := range conns {
+		w.mu.Lock()
+		info := WebsocketClientInfo{
+			Socket:  w.socket,
+			Remote:  w.remote,
+			User:    w.user,
+			Since:   w.since,
+			Queued:  len(w.queue),
+			Sent:    w.sent,
+			Dropped: w.dropped,
+		}
+		if len(w.queue) > 0 {
+			info.LagSeconds = now.Sub(w.queue[0].queued).Seconds()
+		}
+		w.mu.Unlock()
+		list = append(list, info)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].LagSeconds != list[j].LagSeconds {
+			return list[i].LagSeconds > list[j].LagSeconds
+		}
+		return list[i].Since.Before(list[j].Since)
+	})
+	return list
+}
+
+// websocketClientsHandler serves /api/websockets: per-client queue state.
+func websocketClientsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(GetWebsocketClients())
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// websocketPair returns the server end of a WebSocket as a websocketConn,
+// with its writer not yet started so that tests can fill its queue, and
+// the client end to read from.
+func websocketPair(t *testing.T) (*websocketConn, *websocket.Conn) {
+	t.Helper()
+	serverConns := make(chan *websocketConn, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("upgrade: %v", err)
+			return
+		}
+		serverConns <- registerWebsocketConn(conn, "test", r)
+	}))
+	t.Cleanup(srv.Close)
+
+	client, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	wc := <-serverConns
+	t.Cleanup(wc.kill)
+	return wc, client
+}
+
+// setWebsocketQueue sets the queue size and overflow policy for the rest
+// of the test.
+func setWebsocketQueue(t *testing.T, size int, policy string) {
+	t.Helper()
+	oldSize, oldPolicy := wsQueueSize, wsOverflowPolicy
+	wsQueueSize, wsOverflowPolicy = size, policy
+	t.Cleanup(func() { wsQueueSize, wsOverflowPolicy = oldSize, oldPolicy })
+}
+
+func readMessages(t *testing.T, client *websocket.Conn, n int) string {
+	t.Helper()
+	client.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var got []string
+	for i := 0; i < n; i++ {
+		_, data, err := client.ReadMessage()
+		if err != nil {
+			t.Fatalf("read %d: %v", i, err)
+		}
+		got = append(got, string(data))
+	}
+	return strings.Join(got, " ")
+}
+
+func TestWebsocketQueueDropOldest(t *testing.T) {
+	setWebsocketQueue(t, 4, wsOverflowDropOldest)
+	wc, client := websocketPair(t)
+
+	// The client is not being written to, as if it had stopped reading
+	wc.writeDroppable("line1")
+	wc.write("status")
+	wc.writeDroppable("line2")
+	wc.writeDroppable("line3")
+	if err := wc.write("settings"); err != nil {
+		t.Fatalf("write to a full queue with lines to drop: %v", err)
+	}
+	if clients := GetWebsocketClients(); len(clients) != 1 || clients[0].Dropped != 1 || clients[0].Queued != 4 {
+		t.Errorf("GetWebsocketClients = %+v", clients)
+	}
+
+	go wc.writeLoop()
+	if got := readMessages(t, client, 4); got != "status line2 line3 settings" {
+		t.Errorf("received %q, want the oldest line dropped and control kept", got)
+	}
+}
+
+func TestWebsocketQueueEvicts(t *testing.T) {
+	setWebsocketQueue(t, 2, wsOverflowDropOldest)
+	wc, _ := websocketPair(t)
+
+	// With only control messages queued there is nothing to drop
+	wc.write("a")
+	wc.write("b")
+	if err := wc.writeDroppable("c"); err == nil {
+		t.Fatal("full queue of control messages did not evict")
+	}
+	if err := wc.write("d"); err != errWebsocketClosed {
+		t.Errorf("write after eviction = %v", err)
+	}
+	if clients := GetWebsocketClients(); len(clients) != 0 {
+		t.Errorf("evicted client still listed: %+v", clients)
+	}
+
+	// The disconnect policy does not drop lines
+	wsOverflowPolicy = wsOverflowDisconnect
+	wc, _ = websocketPair(t)
+	wc.writeDroppable("x")
+	wc.writeDroppable("y")
+	if err := wc.writeDroppable("z"); err == nil {
+		t.Error("full queue under the disconnect policy did not evict")
+	}
+}
+
+func TestWebsocketWriteWait(t *testing.T) {
+	setWebsocketQueue(t, 2, wsOverflowDisconnect)
+	wc, client := websocketPair(t)
+	go wc.writeLoop()
+
+	// History larger than the queue is sent in full, in order, without
+	// tripping the overflow policy
+	done := make(chan error, 1)
+	go func() {
+		for i := 0; i < 20; i++ {
+			if err := wc.writeWait(string(rune('a' + i))); err != nil {
+				done <- err
+				return
+			}
+		}
+		done <- nil
+	}()
+	got := readMessages(t, client, 20)
+	if err := <-done; err != nil {
+		t.Fatalf("writeWait: %v", err)
+	}
+	if got != "a b c d e f g h i j k l m n o p q r s t" {
+		t.Errorf("received %q", got)
+	}
+
+	// A writer waiting for room is released when the conn closes
+	stalled, _ := websocketPair(t)
+	stalled.write("1")
+	stalled.write("2")
+	waiting := make(chan error, 1)
+	go func() { waiting <- stalled.writeWait("3") }()
+	time.Sleep(20 * time.Millisecond)
+	stalled.kill()
+	select {
+	case err := <-waiting:
+		if err != errWebsocketClosed {
+			t.Errorf("writeWait after close = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("writeWait still blocked after close")
+	}
+}
+
+func TestWebsocketBatching(t *testing.T) {
+	setWebsocketQueue(t, 100, wsOverflowDropOldest)
+	wc, client := websocketPair(t)
+	wc.setBatching(50*time.Millisecond, 3)
+
+	// Lines queued together go out in envelopes of at most three, and a
+	// history reply goes out whole as its own envelope
+	for _, line := range []string{`1`, `2`, `3`, `4`} {
+		wc.writeDroppable(line)
+	}
+	if err := wc.writeBatch([]string{`"a"`, `"b"`, `"c"`, `"d"`}); err != nil {
+		t.Fatalf("writeBatch: %v", err)
+	}
+	wc.write(`5`)
+	go wc.writeLoop()
+	want := `{"type":"batch","messages":[1,2,3]} 4 {"type":"batch","messages":["a","b","c","d"]} 5`
+	if got := readMessages(t, client, 4); got != want {
+		t.Errorf("received %s\nwant %s", got, want)
+	}
+
+	// A line on its own waits out the window, then goes unwrapped
+	start := time.Now()
+	wc.writeDroppable(`6`)
+	if got := readMessages(t, client, 1); got != `6` {
+		t.Errorf("received %s", got)
+	}
+	if waited := time.Since(start); waited < 40*time.Millisecond {
+		t.Errorf("sent after %v, before the batching window", waited)
+	}
+}
+
+func TestWebsocketCompression(t *testing.T) {
+	wc, _ := websocketPair(t)
+	if wc.setCompression(true) {
+		t.Error("compression enabled without negotiating it in the handshake")
+	}
+	wc.canCompress = true
+	if !wc.setCompression(true) || wc.setCompression(false) {
+		t.Error("setCompression does not follow the client's request")
+	}
+}
+
+// Settings go to admin clients only, as get_settings does.
+func TestBroadcastSettingsAdminsOnly(t *testing.T) {
+	oldSettings := appSettings
+	appSettings = NewAppSettings(filepath.Join(t.TempDir(), "settings.json"), nil)
+	t.Cleanup(func() { appSettings = oldSettings })
+	admin, _ := websocketPair(t)
+	viewer, _ := websocketPair(t)
+	admin.role, viewer.role = RoleAdmin, RoleViewer
+	clientsMu.Lock()
+	clients[admin], clients[viewer] = true, true
+	clientsMu.Unlock()
+	t.Cleanup(func() {
+		clientsMu.Lock()
+		delete(clients, admin)
+		delete(clients, viewer)
+		clientsMu.Unlock()
+	})
+
+	broadcastSettings()
+	for _, c := range []struct {
+		wc   *websocketConn
+		want int
+	}{{admin, 1}, {viewer, 0}} {
+		c.wc.mu.Lock()
+		got := len(c.wc.queue)
+		c.wc.mu.Unlock()
+		if got != c.want {
+			t.Errorf("%s client has %d messages queued, want %d", c.wc.role, got, c.want)
+		}
+	}
+}
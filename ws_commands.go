@@ -0,0 +1,706 @@
+package main
+
+import (
+	"errors"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// HelloParams opens a session: the protocol the client speaks and how it
+// wants messages delivered. Batching and compression suit clients on slow
+// or metered links.
+type HelloParams struct {
+	Protocol int  `json:"protocol,omitempty"`  // 0 = the server's
+	Batch    bool `json:"batch,omitempty"`     // coalesce messages into {"type":"batch"} frames
+	BatchMs  int  `json:"batch_ms,omitempty"`  // batching window; 0 = default
+	BatchMax int  `json:"batch_max,omitempty"` // messages per batch; 0 = default
+	Compress bool `json:"compress,omitempty"`  // permessage-deflate, if negotiated
+}
+
+// SyncParams asks for the monitor messages after a sequence number, to
+// catch up after a reconnect.
+type SyncParams struct {
+	LastSeq int64 `json:"last_seq"`
+}
+
+// LatestParams asks for the last monitor messages, for the initial load.
+type LatestParams struct {
+	Limit int `json:"limit,omitempty"` // default 1000, at most 5000
+}
+
+// LoadBeforeParams asks for monitor messages before a sequence number, for
+// scrollback.
+type LoadBeforeParams struct {
+	BeforeSeq int64 `json:"before_seq"`
+	Limit     int   `json:"limit,omitempty"` // default 500, at most 2000
+}
+
+// SessionTimelineParams asks for one session's traffic in 10-second
+// buckets.
+type SessionTimelineParams struct {
+	SessionID string `json:"session_id"`
+	Limit     int    `json:"limit,omitempty"` // most recent buckets; 0 = all
+}
+
+// StationParams asks for everything known about a station.
+type StationParams struct {
+	Station string `json:"station"`
+}
+
+// LimitParams caps how many items a list command returns.
+type LimitParams struct {
+	Limit int `json:"limit,omitempty"`
+}
+
+// FeatureParams names a feature: "chat", "bbs" or "node".
+type FeatureParams struct {
+	Feature string `json:"feature"`
+}
+
+// OptionalFeatureParams names a feature, or none for all of them.
+type OptionalFeatureParams struct {
+	Feature string `json:"feature,omitempty"`
+}
+
+// SessionHistoryParams filters finished sessions from the database.
+type SessionHistoryParams struct {
+	Station string `json:"station,omitempty"` // either end of the link
+	Outcome string `json:"outcome,omitempty"` // normal, failed or unknown
+	Since   string `json:"since,omitempty"`   // RFC 3339 or YYYY-MM-DD
+	Until   string `json:"until,omitempty"`   // RFC 3339 or YYYY-MM-DD
+	PortNum int    `json:"port_num,omitempty"`
+	Hours   int    `json:"hours,omitempty"`
+	Limit   int    `json:"limit,omitempty"`
+}
+
+// LinkStatsHistoryParams asks for a port's hourly link stats.
+type LinkStatsHistoryParams struct {
+	PortNum int `json:"port_num"`
+	Hours   int `json:"hours,omitempty"` // default 24, at most 720
+}
+
+// LinkStatsQueryParams asks for link stats at any bucket size.
+type LinkStatsQueryParams struct {
+	Ports      []int    `json:"ports,omitempty"`   // empty = all
+	Metrics    []string `json:"metrics,omitempty"` // "name[:agg]"; empty = all
+	Hours      int      `json:"hours,omitempty"`   // default 24, at most a year
+	BucketMins int      `json:"bucket_mins,omitempty"`
+}
+
+// UpdateSettingsParams replaces one feature's settings.
+type UpdateSettingsParams struct {
+	Feature       string           `json:"feature"`
+	Settings      *FeatureSettings `json:"settings"`
+	ClearPassword bool             `json:"clearPassword,omitempty"` // an empty password otherwise keeps the stored one
+}
+
+func init() {
+	wsCommands = map[string]wsCommand{
+		"hello": {
+			doc:     "Declare the protocol version and delivery options; the reply lists the server's version, capabilities and the commands the user may run.",
+			params:  HelloParams{},
+			replies: []string{"hello"},
+			run:     wsHello,
+		},
+		"sync": {
+			doc:     "Send the buffered monitor messages after last_seq, then an ack.",
+			params:  SyncParams{},
+			replies: []string{"ack"},
+			run:     wsSync,
+		},
+		"latest": {
+			doc:     "Send the last monitor messages, then an ack.",
+			params:  LatestParams{},
+			replies: []string{"ack"},
+			run:     wsLatest,
+		},
+		"load_before": {
+			doc:     "Send monitor messages before before_seq, then load_complete.",
+			params:  LoadBeforeParams{},
+			replies: []string{"load_complete"},
+			run:     wsLoadBefore,
+		},
+		"status": {
+			doc:     "Return the monitor buffer's state.",
+			replies: []string{"status"},
+			run:     wsStatus,
+		},
+		"get_sessions": {
+			doc:     "Return the session table.",
+			replies: []string{"sessions"},
+			run:     wsGetSessions,
+		},
+		"get_session_timeline": {
+			doc:     "Return one session's traffic in 10-second buckets.",
+			params:  SessionTimelineParams{},
+			replies: []string{"session_timeline"},
+			run:     wsGetSessionTimeline,
+		},
+		"get_station": {
+			doc:     "Return everything known about one station.",
+			params:  StationParams{},
+			replies: []string{"station"},
+			run:     wsGetStation,
+		},
+		"get_link_anomalies": {
+			doc:     "Return recently detected L2 anomalies.",
+			params:  LimitParams{},
+			replies: []string{"link_anomalies"},
+			run:     wsGetLinkAnomalies,
+		},
+		"get_user_sessions": {
+			doc:     "Return end-to-end sessions built from paired circuits.",
+			replies: []string{"user_sessions"},
+			run:     wsGetUserSessions,
+		},
+		"feature_connect": {
+			doc:     "Enable a feature and connect it with its stored settings.",
+			role:    RoleOperator,
+			params:  FeatureParams{},
+			replies: []string{"feature_status"},
+			audit:   auditFeatureConnect,
+			run:     wsFeatureConnect,
+		},
+		"feature_disconnect": {
+			doc:     "Disconnect a feature and disable it.",
+			role:    RoleOperator,
+			params:  FeatureParams{},
+			replies: []string{"feature_status"},
+			audit:   auditFeatureDisconnect,
+			run:     wsFeatureDisconnect,
+		},
+		"feature_status": {
+			doc:     "Return one feature's status, or send every feature's and then an ack.",
+			params:  OptionalFeatureParams{},
+			replies: []string{"feature_status", "ack"},
+			run:     wsFeatureStatus,
+		},
+		"get_session_history": {
+			doc:     "Return finished sessions from the database, filtered, with per-station totals.",
+			params:  SessionHistoryParams{},
+			replies: []string{"session_history"},
+			run:     wsGetSessionHistory,
+		},
+		"get_link_stats": {
+			doc:     "Return the latest link stats snapshot.",
+			replies: []string{"link_stats"},
+			run:     wsGetLinkStats,
+		},
+		"get_link_stats_history": {
+			doc:     "Return a port's hourly link stats.",
+			params:  LinkStatsHistoryParams{},
+			replies: []string{"link_stats_history"},
+			run:     wsGetLinkStatsHistory,
+		},
+		"query_link_stats": {
+			doc:     "Return link stats at any bucket size, with empty buckets marked missing.",
+			params:  LinkStatsQueryParams{},
+			replies: []string{"link_stats_query"},
+			run:     wsQueryLinkStats,
+		},
+		"get_link_trends": {
+			doc:     "Return the ports currently degraded against their baseline.",
+			replies: []string{"link_trends"},
+			run:     wsGetLinkTrends,
+		},
+		"get_bulletin_queue": {
+			doc:     "Return recent outbound BBS messages and their delivery state.",
+			replies: []string{"bulletin_queue"},
+			run:     wsGetBulletinQueue,
+		},
+		"get_settings": {
+			doc:     "Return every feature's settings, without passwords.",
+			role:    RoleAdmin,
+			replies: []string{"settings"},
+			run:     wsGetSettings,
+		},
+		"update_settings": {
+			doc:     "Replace one feature's settings, connecting, disconnecting or reconnecting it to match; every admin client is sent the new settings.",
+			role:    RoleAdmin,
+			params:  UpdateSettingsParams{},
+			replies: []string{"ack"},
+			audit:   auditUpdateSettings,
+			run:     wsUpdateSettings,
+		},
+	}
+	for name, cmd := range wsCommands {
+		if cmd.role == "" {
+			cmd.role = RoleViewer
+			wsCommands[name] = cmd
+		}
+	}
+}
+
+func wsHello(s *wsSession, req *wsRequest) error {
+	var p HelloParams
+	if err := req.decode(&p); err != nil {
+		return err
+	}
+	if p.Protocol != 0 && (p.Protocol < wsProtocolMin || p.Protocol > wsProtocolVersion) {
+		return wsErrorf(wsErrUnsupportedProtocol, "protocol %d is not supported; this server speaks %d to %d", p.Protocol, wsProtocolMin, wsProtocolVersion)
+	}
+	batchMax := 0
+	window := wsBatchWindow
+	if p.Batch {
+		batchMax = wsBatchMax
+		if p.BatchMax > 0 {
+			batchMax = max(2, min(p.BatchMax, wsBatchMaxLimit))
+		}
+		if p.BatchMs > 0 {
+			window = max(wsBatchWindowMin, min(time.Duration(p.BatchMs)*time.Millisecond, wsBatchWindowMax))
+		}
+	}
+	wc, ok := s.out.(*websocketConn)
+	if !ok {
+		return wsErrorf(wsErrBadRequest, "hello is only for WebSocket clients")
+	}
+	wc.setBatching(window, batchMax)
+
+	msg := &HelloMessage{
+		Type:         "hello",
+		Protocol:     wsProtocolVersion,
+		MinProtocol:  wsProtocolMin,
+		Server:       Version,
+		Capabilities: []string{"batch", "schema"},
+		Commands:     s.commands(),
+		Compress:     wc.setCompression(p.Compress),
+	}
+	if wc.canCompress {
+		msg.Capabilities = append(msg.Capabilities, "compress")
+	}
+	if batchMax > 0 {
+		msg.Batch = &BatchSettings{WindowMs: window.Milliseconds(), Max: batchMax}
+	}
+	return s.reply(req, msg)
+}
+
+func wsSync(s *wsSession, req *wsRequest) error {
+	var p SyncParams
+	if err := req.decode(&p); err != nil {
+		return err
+	}
+	history := dataBuffer.getSince(p.LastSeq)
+	if err := s.out.writeBatch(history); err != nil {
+		return err
+	}
+	return s.reply(req, &AckMessage{Type: "ack", Cmd: req.Cmd, Count: len(history)})
+}
+
+func wsLatest(s *wsSession, req *wsRequest) error {
+	var p LatestParams
+	if err := req.decode(&p); err != nil {
+		return err
+	}
+	limit := p.Limit
+	if limit <= 0 {
+		limit = 1000 // default
+	}
+	if limit > 5000 {
+		limit = 5000 // max
+	}
+	messages := dataBuffer.getLatest(limit)
+	if err := s.out.writeBatch(messages); err != nil {
+		return err
+	}
+	return s.reply(req, &AckMessage{Type: "ack", Cmd: req.Cmd, Count: len(messages)})
+}
+
+func wsLoadBefore(s *wsSession, req *wsRequest) error {
+	var p LoadBeforeParams
+	if err := req.decode(&p); err != nil {
+		return err
+	}
+	limit := p.Limit
+	if limit <= 0 {
+		limit = 500 // default
+	}
+	if limit > 2000 {
+		limit = 2000 // max
+	}
+	messages := dataBuffer.getBefore(p.BeforeSeq, limit)
+	if err := s.out.writeBatch(messages); err != nil {
+		return err
+	}
+	// End marker so the client knows we're done
+	return s.reply(req, &LoadCompleteMessage{Type: "load_complete", BeforeSeq: p.BeforeSeq, Count: len(messages)})
+}
+
+func wsStatus(s *wsSession, req *wsRequest) error {
+	return s.reply(req, &BufferStatusMessage{Type: "status", Buffer: currentBufferInfo()})
+}
+
+// errNoSessionTracker is the error for session commands when the session
+// tracker is not running.
+var errNoSessionTracker = wsErrorf(wsErrUnavailable, "session tracking is not running")
+
+// errNoStatsStorage is the error for history commands when the stats
+// database is not open.
+var errNoStatsStorage = wsErrorf(wsErrUnavailable, "stats storage is not available")
+
+func wsGetSessions(s *wsSession, req *wsRequest) error {
+	if sessionTrackerRef == nil {
+		return errNoSessionTracker
+	}
+	return s.reply(req, &SessionsMessage{Type: "sessions", Sessions: sessionTrackerRef.GetSessions()})
+}
+
+func wsGetSessionTimeline(s *wsSession, req *wsRequest) error {
+	var p SessionTimelineParams
+	if err := req.decode(&p); err != nil {
+		return err
+	}
+	if sessionTrackerRef == nil {
+		return errNoSessionTracker
+	}
+	buckets, ok := sessionTrackerRef.GetSessionTimeline(p.SessionID, p.Limit)
+	if !ok {
+		return wsErrorf(wsErrNotFound, "unknown session %q", p.SessionID)
+	}
+	return s.reply(req, &SessionTimelineMessage{
+		Type:       "session_timeline",
+		SessionID:  p.SessionID,
+		BucketSecs: int(timelineBucket / time.Second),
+		Buckets:    buckets,
+	})
+}
+
+func wsGetStation(s *wsSession, req *wsRequest) error {
+	var p StationParams
+	if err := req.decode(&p); err != nil {
+		return err
+	}
+	profile, err := buildStationProfile(p.Station, time.Now(), currentStationSources())
+	if err != nil {
+		return wsErrorf(wsErrInvalidParams, "%v", err)
+	}
+	return s.reply(req, &StationMessage{Type: "station", Station: profile})
+}
+
+func wsGetLinkAnomalies(s *wsSession, req *wsRequest) error {
+	var p LimitParams
+	if err := req.decode(&p); err != nil {
+		return err
+	}
+	if sessionTrackerRef == nil {
+		return errNoSessionTracker
+	}
+	return s.reply(req, &LinkAnomaliesMessage{Type: "link_anomalies", Anomalies: sessionTrackerRef.GetLinkAnomalies(p.Limit)})
+}
+
+func wsGetUserSessions(s *wsSession, req *wsRequest) error {
+	if sessionTrackerRef == nil {
+		return errNoSessionTracker
+	}
+	return s.reply(req, &UserSessionsMessage{Type: "user_sessions", UserSessions: sessionTrackerRef.GetUserSessions()})
+}
+
+// featureStatusByName returns a feature's connection status.
+func featureStatusByName(feature string) (FeatureStatus, bool) {
+	var status FeatureStatus
+	switch feature {
+	case "chat":
+		status = GetChatStatus()
+	case "bbs":
+		status = GetBBSStatus()
+	case "node":
+		status = GetNodeStatus()
+	default:
+		return status, false
+	}
+	status.Type = "feature_status"
+	return status, true
+}
+
+func wsFeatureConnect(s *wsSession, req *wsRequest) (err error) {
+	var p FeatureParams
+	var connectErr error
+	defer func() { s.actor.record(auditFeatureConnect, p.Feature, false, errors.Join(err, connectErr)) }()
+	if err := req.decode(&p); err != nil {
+		return err
+	}
+	fs := appSettings.GetFeature(p.Feature)
+	if _, known := featureStatusByName(p.Feature); fs == nil || !known {
+		return wsErrorf(wsErrInvalidParams, "unknown feature %q", p.Feature)
+	}
+	config := fs.ToFeatureConfig()
+
+	// Mark as enabled and save
+	fs.Enabled = true
+	if err := appSettings.SetFeature(p.Feature, fs); err != nil {
+		wsLog.Warnw("Failed to save settings on connect", "feature", p.Feature, "error", err)
+	}
+
+	switch p.Feature {
+	case "chat":
+		connectErr = ConnectChat(config)
+	case "bbs":
+		connectErr = ConnectBBS(config)
+	case "node":
+		connectErr = ConnectNode(config)
+	}
+
+	// An already connected feature just reports its status
+	status, _ := featureStatusByName(p.Feature)
+	if errors.Is(connectErr, ErrAlreadyConnected) {
+		connectErr = nil
+	}
+	if connectErr != nil {
+		wsLog.Warnw("Feature connect failed", "feature", p.Feature, "error", connectErr)
+		status = FeatureStatus{
+			Type:    "feature_status",
+			Feature: p.Feature,
+			State:   StateError,
+			Error:   connectErr.Error(),
+		}
+	}
+	err = s.reply(req, &status)
+	// Broadcast updated settings to the admin clients
+	broadcastSettings()
+	return err
+}
+
+func wsFeatureDisconnect(s *wsSession, req *wsRequest) (err error) {
+	var p FeatureParams
+	defer func() { s.actor.record(auditFeatureDisconnect, p.Feature, false, err) }()
+	if err := req.decode(&p); err != nil {
+		return err
+	}
+	if _, known := featureStatusByName(p.Feature); !known {
+		return wsErrorf(wsErrInvalidParams, "unknown feature %q", p.Feature)
+	}
+	disconnectFeatureByName(p.Feature)
+
+	// Mark feature as disabled in settings
+	if fs := appSettings.GetFeature(p.Feature); fs != nil {
+		fs.Enabled = false
+		if err := appSettings.SetFeature(p.Feature, fs); err != nil {
+			wsLog.Warnw("Failed to save settings on disconnect", "feature", p.Feature, "error", err)
+		}
+		broadcastSettings()
+	}
+	status, _ := featureStatusByName(p.Feature)
+	return s.reply(req, &status)
+}
+
+func wsFeatureStatus(s *wsSession, req *wsRequest) error {
+	var p OptionalFeatureParams
+	if err := req.decode(&p); err != nil {
+		return err
+	}
+	if p.Feature != "" {
+		status, ok := featureStatusByName(p.Feature)
+		if !ok {
+			return wsErrorf(wsErrInvalidParams, "unknown feature %q", p.Feature)
+		}
+		return s.reply(req, &status)
+	}
+	statuses := GetAllFeatureStatuses()
+	for _, status := range statuses {
+		status.Type = "feature_status"
+		if err := s.send(status); err != nil {
+			return err
+		}
+	}
+	return s.reply(req, &AckMessage{Type: "ack", Cmd: req.Cmd, Count: len(statuses)})
+}
+
+func wsGetSessionHistory(s *wsSession, req *wsRequest) error {
+	var p SessionHistoryParams
+	if err := req.decode(&p); err != nil {
+		return err
+	}
+	if neighborStorageRef == nil {
+		return errNoStatsStorage
+	}
+	q := url.Values{}
+	q.Set("station", p.Station)
+	q.Set("outcome", p.Outcome)
+	q.Set("since", p.Since)
+	q.Set("until", p.Until)
+	if p.PortNum > 0 {
+		q.Set("port", strconv.Itoa(p.PortNum))
+	}
+	if p.Hours > 0 {
+		q.Set("hours", strconv.Itoa(p.Hours))
+	}
+	if p.Limit > 0 {
+		q.Set("limit", strconv.Itoa(p.Limit))
+	}
+	f, err := parseSessionHistoryFilter(q)
+	if err != nil {
+		return wsErrorf(wsErrInvalidParams, "%v", err)
+	}
+	resp, err := querySessionHistory(neighborStorageRef, f)
+	if err != nil {
+		return err
+	}
+	return s.reply(req, &SessionHistoryMessage{Type: "session_history", Data: resp})
+}
+
+func wsGetLinkStats(s *wsSession, req *wsRequest) error {
+	if linkStatsCollectorRef == nil {
+		return wsErrorf(wsErrUnavailable, "link stats are not being collected")
+	}
+	snap := linkStatsCollectorRef.GetLatestSnapshot()
+	if snap == nil {
+		return wsErrorf(wsErrUnavailable, "no link stats collected yet")
+	}
+	return s.reply(req, newLinkStatsMessage(snap))
+}
+
+func wsGetLinkStatsHistory(s *wsSession, req *wsRequest) error {
+	var p LinkStatsHistoryParams
+	if err := req.decode(&p); err != nil {
+		return err
+	}
+	if linkStatsCollectorRef == nil || linkStatsCollectorRef.storage == nil {
+		return errNoStatsStorage
+	}
+	hours := p.Hours
+	if hours <= 0 {
+		hours = 24
+	}
+	if hours > 720 { // max 30 days
+		hours = 720
+	}
+	since := time.Now().Add(-time.Duration(hours) * time.Hour)
+	summaries, err := linkStatsCollectorRef.storage.GetHourlySummary(p.PortNum, since)
+	if err != nil {
+		return err
+	}
+	resolution := "hourly"
+	if len(summaries) == 0 {
+		// Only whole elapsed hours are ever compacted, so a node that
+		// started recently has raw samples but nothing hourly, and the
+		// graph would sit empty for up to two hours after every restart.
+		// Fall back to five-minute buckets computed on the fly. Same field
+		// names, so the client renders them without knowing the difference.
+		if fine, ferr := linkStatsCollectorRef.storage.Get5MinSummary(p.PortNum, since); ferr == nil && len(fine) > 0 {
+			summaries = hourlyFrom5Min(fine)
+			resolution = "5min"
+		}
+	}
+	return s.reply(req, &LinkStatsHistoryMessage{
+		Type:       "link_stats_history",
+		PortNum:    p.PortNum,
+		Hours:      hours,
+		Resolution: resolution,
+		Data:       summaries,
+	})
+}
+
+func wsQueryLinkStats(s *wsSession, req *wsRequest) error {
+	var p LinkStatsQueryParams
+	if err := req.decode(&p); err != nil {
+		return err
+	}
+	if neighborStorageRef == nil {
+		return errNoStatsStorage
+	}
+	hours := p.Hours
+	if hours <= 0 {
+		hours = 24
+	}
+	if hours > 24*366 {
+		hours = 24 * 366
+	}
+	bucket := time.Duration(p.BucketMins) * time.Minute
+	if bucket <= 0 {
+		bucket = time.Hour
+	}
+	until := time.Now().Truncate(bucket).Add(bucket)
+	since := until.Add(-time.Duration(hours) * time.Hour)
+	res, err := neighborStorageRef.Query(p.Ports, p.Metrics, since, until, bucket)
+	if err != nil {
+		return wsErrorf(wsErrInvalidParams, "%v", err)
+	}
+	return s.reply(req, &LinkStatsQueryMessage{Type: "link_stats_query", Data: res})
+}
+
+func wsGetLinkTrends(s *wsSession, req *wsRequest) error {
+	if trendAnalyserRef == nil {
+		return wsErrorf(wsErrUnavailable, "trend analysis is not running")
+	}
+	return s.reply(req, &LinkTrendsMessage{Type: "link_trends", Data: trendAnalyserRef.Findings()})
+}
+
+func wsGetBulletinQueue(s *wsSession, req *wsRequest) error {
+	if neighborStorageRef == nil {
+		return errNoStatsStorage
+	}
+	msg, err := newBulletinQueueMessage(neighborStorageRef)
+	if err != nil {
+		return err
+	}
+	return s.reply(req, msg)
+}
+
+func wsGetSettings(s *wsSession, req *wsRequest) error {
+	return s.reply(req, &SettingsMessage{Type: "settings", Features: appSettings.GetPublicFeatures()})
+}
+
+func wsUpdateSettings(s *wsSession, req *wsRequest) (err error) {
+	var p UpdateSettingsParams
+	var detail string
+	defer func() { s.actor.record(auditUpdateSettings, detail, false, err) }()
+	if err := req.decode(&p); err != nil {
+		return err
+	}
+	detail = p.Feature
+	if p.Feature == "" || p.Settings == nil {
+		return wsErrorf(wsErrInvalidParams, "update_settings needs a feature and settings")
+	}
+	feature := p.Feature
+	newSettings := p.Settings
+
+	// Get current settings to detect changes
+	oldSettings := appSettings.GetFeature(feature)
+	if oldSettings == nil {
+		return wsErrorf(wsErrInvalidParams, "unknown feature %q", feature)
+	}
+
+	// Passwords are write-only, so clients send one only to replace it
+	if newSettings.Password == "" && !p.ClearPassword {
+		newSettings.Password = oldSettings.Password
+	}
+	newSettings.passwordCleared = p.ClearPassword
+	newSettings.PasswordSet = false
+	detail = settingsAuditDetail(feature, newSettings, newSettings.Password != oldSettings.Password && newSettings.Password != "", p.ClearPassword)
+
+	// Save the new settings
+	if err := appSettings.SetFeature(feature, newSettings); err != nil {
+		return err
+	}
+
+	// Determine what action to take based on changes
+	wasEnabled := oldSettings.Enabled
+	nowEnabled := newSettings.Enabled
+	credentialsChanged := oldSettings.Host != newSettings.Host ||
+		oldSettings.Port != newSettings.Port ||
+		oldSettings.Callsign != newSettings.Callsign ||
+		oldSettings.Password != newSettings.Password
+
+	switch {
+	case !wasEnabled && nowEnabled:
+		// Newly enabled — connect
+		config := newSettings.ToFeatureConfig()
+		connectFeatureByName(feature, config)
+	case wasEnabled && !nowEnabled:
+		// Disabled — disconnect
+		disconnectFeatureByName(feature)
+	case wasEnabled && nowEnabled && credentialsChanged:
+		// Credentials changed while connected — reconnect
+		disconnectFeatureByName(feature)
+		// Small delay to allow disconnect to complete
+		go func() {
+			time.Sleep(500 * time.Millisecond)
+			config := appSettings.GetFeature(feature).ToFeatureConfig()
+			connectFeatureByName(feature, config)
+		}()
+	}
+
+	// Broadcast updated settings to the admin clients, this one included
+	broadcastSettings()
+	return s.reply(req, &AckMessage{Type: "ack", Cmd: req.Cmd})
+}
@@ -0,0 +1,444 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// The /ws protocol version. A client may name the version it speaks in
+// hello; message shapes only change incompatibly with a new version.
+const (
+	wsProtocolVersion = 1
+	wsProtocolMin     = 1
+)
+
+// Error codes sent in {"type":"error"} replies.
+const (
+	wsErrBadRequest          = "bad_request"          // not a JSON object with a cmd
+	wsErrUnknownCommand      = "unknown_command"      // no such cmd
+	wsErrPermissionDenied    = "permission_denied"    // the user's role may not run it
+	wsErrInvalidParams       = "invalid_params"       // the cmd's parameters are wrong
+	wsErrNotFound            = "not_found"            // what it asked for does not exist
+	wsErrUnavailable         = "unavailable"          // the feature behind it is not running
+	wsErrUnsupportedProtocol = "unsupported_protocol" // hello asked for a version we do not speak
+	wsErrInternal            = "internal"             // the server failed
+)
+
+// RequestID is a client's id for a command, a string or a number, sent back
+// in the reply so that the client can match them up.
+type RequestID json.RawMessage
+
+func (id RequestID) MarshalJSON() ([]byte, error) {
+	if len(id) == 0 {
+		return []byte("null"), nil
+	}
+	return id, nil
+}
+
+func (id *RequestID) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	switch {
+	case string(data) == "null":
+		*id = nil
+	case len(data) > 0 && (data[0] == '"' || data[0] == '-' || (data[0] >= '0' && data[0] <= '9')):
+		*id = append((*id)[:0], data...)
+	default:
+		return fmt.Errorf("id must be a string or a number")
+	}
+	return nil
+}
+
+// wsRequest is one command from a /ws client. Its parameters sit alongside
+// cmd and id, and each command decodes its own.
+type wsRequest struct {
+	Cmd string    `json:"cmd"`
+	ID  RequestID `json:"id,omitempty"`
+	raw []byte
+}
+
+// decode reads the command's parameters into params.
+func (req *wsRequest) decode(params interface{}) error {
+	if err := json.Unmarshal(req.raw, params); err != nil {
+		return wsErrorf(wsErrInvalidParams, "invalid parameters for %s: %v", req.Cmd, err)
+	}
+	return nil
+}
+
+// wsError is a command failure sent to the client as an error reply.
+type wsError struct {
+	code    string
+	message string
+}
+
+func (e *wsError) Error() string { return e.message }
+
+func wsErrorf(code, format string, args ...interface{}) *wsError {
+	return &wsError{code: code, message: fmt.Sprintf(format, args...)}
+}
+
+// wsReply is embedded in every message that can be a reply to a command,
+// to carry the command's id back.
+type wsReply struct {
+	ID RequestID `json:"id,omitempty"`
+}
+
+func (r *wsReply) setID(id RequestID) { r.ID = id }
+
+type wsReplyMessage interface {
+	setID(RequestID)
+}
+
+// wsCommand describes one /ws command: who may run it, its parameters and
+// replies for the schema, and its handler.
+type wsCommand struct {
+	doc     string
+	role    Role        // least role that may run it
+	params  interface{} // zero value of its parameters struct; nil if none
+	replies []string    // message types of its final reply
+	audit   string      // audit action, for commands operators are held to
+	run     func(s *wsSession, req *wsRequest) error
+}
+
+// wsCommands is every /ws command, by name. It is filled in init, as hello
+// lists the commands.
+var wsCommands map[string]wsCommand
+
+// wsOutput is where a session's messages go: a /ws connection, or a REST
+// request collecting the reply.
+type wsOutput interface {
+	write(message string) error
+	writeBatch(messages []string) error
+}
+
+// wsSession is one /ws client, or one REST request: where its messages go
+// and what its user may do.
+type wsSession struct {
+	out   wsOutput
+	role  Role
+	actor auditActor
+}
+
+// handle runs one command and sends its reply. Every command gets a reply
+// carrying its id, or an error reply; commands that send history or
+// several statuses send those first, without the id.
+func (s *wsSession) handle(msg []byte) {
+	req := &wsRequest{raw: msg}
+	if err := json.Unmarshal(msg, req); err != nil || req.Cmd == "" {
+		wsLog.Warnw("Invalid JSON command", "raw", string(msg))
+		s.replyError(req, wsErrorf(wsErrBadRequest, "a command must be a JSON object with a cmd"))
+		return
+	}
+	cmd, ok := wsCommands[req.Cmd]
+	if !ok {
+		s.replyError(req, wsErrorf(wsErrUnknownCommand, "unknown command %q", req.Cmd))
+		return
+	}
+	if !s.role.Allows(cmd.role) {
+		if cmd.audit != "" {
+			s.actor.record(cmd.audit, "", false, errAuditDenied)
+		}
+		s.replyError(req, wsErrorf(wsErrPermissionDenied, "permission denied"))
+		return
+	}
+	err := cmd.run(s, req)
+	if err == nil || errors.Is(err, errWebsocketClosed) {
+		return
+	}
+	var werr *wsError
+	if !errors.As(err, &werr) {
+		wsLog.Warnw("WebSocket command failed", "cmd", req.Cmd, "error", err)
+		werr = wsErrorf(wsErrInternal, "%v", err)
+	}
+	s.replyError(req, werr)
+}
+
+// reply sends msg as the reply to req.
+func (s *wsSession) reply(req *wsRequest, msg wsReplyMessage) error {
+	msg.setID(req.ID)
+	return s.send(msg)
+}
+
+// send sends a message that is not the reply itself.
+func (s *wsSession) send(msg interface{}) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("failed to marshal message: %w", err)
+	}
+	return s.out.write(string(data))
+}
+
+func (s *wsSession) replyError(req *wsRequest, err *wsError) {
+	s.reply(req, &ErrorMessage{Type: "error", Cmd: req.Cmd, Code: err.code, Error: err.message})
+}
+
+// commands returns the commands the session's role may run.
+func (s *wsSession) commands() []string {
+	var names []string
+	for name, cmd := range wsCommands {
+		if s.role.Allows(cmd.role) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// InitMessage is sent to every client as it connects.
+type InitMessage struct {
+	Type            string                      `json:"type"`
+	Protocol        int                         `json:"protocol"`
+	Server          string                      `json:"server"`
+	Buffer          BufferInfo                  `json:"buffer"`
+	Features        map[string]bool             `json:"features"`
+	FeatureStatuses map[string]FeatureStatus    `json:"featureStatuses"`
+	FeatureEnabled  bool                        `json:"featureEnabled"` // dynamic feature connections are supported
+	FeatureSettings map[string]*FeatureSettings `json:"featureSettings,omitempty"` // admins only
+	Sessions        []*Session                  `json:"sessions,omitempty"`
+}
+
+// HelloMessage answers hello with the server's protocol, capabilities and
+// the delivery options in effect.
+type HelloMessage struct {
+	Type string `json:"type"`
+	wsReply
+	Protocol     int            `json:"protocol"`
+	MinProtocol  int            `json:"minProtocol"`
+	Server       string         `json:"server"`
+	Capabilities []string       `json:"capabilities"`
+	Commands     []string       `json:"commands"` // those the user's role may run
+	Batch        *BatchSettings `json:"batch,omitempty"`
+	Compress     bool           `json:"compress"`
+}
+
+// BatchSettings is the batching a client gets after hello.
+type BatchSettings struct {
+	WindowMs int64 `json:"windowMs"`
+	Max      int   `json:"max"`
+}
+
+// BatchMessage carries several messages in one frame, for clients that ask
+// for batching.
+type BatchMessage struct {
+	Type     string            `json:"type"`
+	Messages []json.RawMessage `json:"messages"`
+}
+
+// AckMessage is the reply to a command that has nothing else to return.
+type AckMessage struct {
+	Type string `json:"type"`
+	wsReply
+	Cmd   string `json:"cmd"`
+	Count int    `json:"count,omitempty"` // messages sent before it, for sync, latest and feature_status
+}
+
+// ErrorMessage is the reply to a command that failed.
+type ErrorMessage struct {
+	Type string `json:"type"`
+	wsReply
+	Cmd   string `json:"cmd"`
+	Code  string `json:"code"`
+	Error string `json:"error"`
+}
+
+// LoadCompleteMessage follows the history sent for load_before.
+type LoadCompleteMessage struct {
+	Type string `json:"type"`
+	wsReply
+	BeforeSeq int64 `json:"beforeSeq"`
+	Count     int   `json:"count"`
+}
+
+// BufferStatusMessage answers status.
+type BufferStatusMessage struct {
+	Type string `json:"type"`
+	wsReply
+	Buffer BufferInfo `json:"buffer"`
+}
+
+// SessionsMessage answers get_sessions.
+type SessionsMessage struct {
+	Type string `json:"type"`
+	wsReply
+	Sessions []*Session `json:"sessions"`
+}
+
+// SessionTimelineMessage answers get_session_timeline.
+type SessionTimelineMessage struct {
+	Type string `json:"type"`
+	wsReply
+	SessionID  string           `json:"sessionId"`
+	BucketSecs int              `json:"bucketSecs"`
+	Buckets    []TimelineBucket `json:"buckets"`
+}
+
+// StationMessage answers get_station.
+type StationMessage struct {
+	Type string `json:"type"`
+	wsReply
+	Station *StationProfile `json:"station"`
+}
+
+// LinkAnomaliesMessage answers get_link_anomalies.
+type LinkAnomaliesMessage struct {
+	Type string `json:"type"`
+	wsReply
+	Anomalies []LinkAnomaly `json:"anomalies"`
+}
+
+// UserSessionsMessage answers get_user_sessions.
+type UserSessionsMessage struct {
+	Type string `json:"type"`
+	wsReply
+	UserSessions []UserSession `json:"userSessions"`
+}
+
+// SessionHistoryMessage answers get_session_history.
+type SessionHistoryMessage struct {
+	Type string `json:"type"`
+	wsReply
+	Data *sessionHistoryResponse `json:"data"`
+}
+
+// LinkStatsMessage is a link stats snapshot, broadcast by the collector
+// and sent in answer to get_link_stats.
+type LinkStatsMessage struct {
+	Type string `json:"type"`
+	wsReply
+	Timestamp string             `json:"timestamp"`
+	System    SystemStats        `json:"system"`
+	Ports     map[int]*PortStats `json:"ports"`
+}
+
+// LinkStatsHistoryMessage answers get_link_stats_history.
+type LinkStatsHistoryMessage struct {
+	Type string `json:"type"`
+	wsReply
+	PortNum    int             `json:"portNum"`
+	Hours      int             `json:"hours"`
+	Resolution string          `json:"resolution"` // "hourly", or "5min" before the first hour is compacted
+	Data       []HourlySummary `json:"data"`
+}
+
+// LinkStatsQueryMessage answers query_link_stats.
+type LinkStatsQueryMessage struct {
+	Type string `json:"type"`
+	wsReply
+	Data *QueryResult `json:"data"`
+}
+
+// LinkTrendsMessage answers get_link_trends.
+type LinkTrendsMessage struct {
+	Type string `json:"type"`
+	wsReply
+	Data []TrendFinding `json:"data"`
+}
+
+// BulletinQueueMessage lists recent outbound BBS messages. It is broadcast
+// when the queue changes and sent in answer to get_bulletin_queue.
+type BulletinQueueMessage struct {
+	Type string `json:"type"`
+	wsReply
+	Items []QueuedBulletin `json:"items"`
+}
+
+// SettingsMessage holds every feature's settings, without passwords. It is
+// broadcast when they change and sent in answer to get_settings.
+type SettingsMessage struct {
+	Type string `json:"type"`
+	wsReply
+	Features map[string]*FeatureSettings `json:"features"`
+}
+
+// NeighborLinkStatsMessage is a neighbour's [LS1] CQ stats broadcast.
+type NeighborLinkStatsMessage struct {
+	Type          string `json:"type"`
+	Callsign      string `json:"callsign"`
+	ReportedPort  int    `json:"reportedPort"`
+	RxPort        int    `json:"rxPort"`
+	L2Rxed        int64  `json:"l2Rxed"`
+	L2Sent        int64  `json:"l2Sent"`
+	L2Timeouts    int64  `json:"l2Timeouts"`
+	REJRxed       int64  `json:"rejRxed"`
+	RXCRCErrors   int64  `json:"rxCrcErrors"`
+	Abandoned     int64  `json:"abandoned"`
+	ActiveTxPct   int    `json:"activeTxPct"`
+	ActiveBusyPct int    `json:"activeBusyPct"`
+	Timestamp     string `json:"timestamp"`
+}
+
+// SessionUpdateMessage is a changed session.
+type SessionUpdateMessage struct {
+	Type    string   `json:"type"`
+	Session *Session `json:"session"`
+}
+
+// UserSessionUpdateMessage is a changed end-to-end session.
+type UserSessionUpdateMessage struct {
+	Type        string       `json:"type"`
+	UserSession *UserSession `json:"userSession"`
+}
+
+// LinkAnomalyMessage is a newly detected L2 anomaly.
+type LinkAnomalyMessage struct {
+	Type    string       `json:"type"`
+	Anomaly *LinkAnomaly `json:"anomaly"`
+}
+
+// LinkTrendEventMessage is a port starting or ceasing to be degraded.
+type LinkTrendEventMessage struct {
+	Type  string     `json:"type"`
+	Event TrendEvent `json:"event"`
+}
+
+// wsMessageTypes maps each message type a /ws client can receive to its Go
+// type, for the schema.
+var wsMessageTypes = map[string]interface{}{
+	"init":                InitMessage{},
+	"hello":               HelloMessage{},
+	"batch":               BatchMessage{},
+	"ack":                 AckMessage{},
+	"error":               ErrorMessage{},
+	"log":                 LogMessageData{},
+	"tnc_data":            TNCDataMessage{},
+	"tarpn_stat":          TARPNStatMessage{},
+	"load_complete":       LoadCompleteMessage{},
+	"status":              BufferStatusMessage{},
+	"sessions":            SessionsMessage{},
+	"session_update":      SessionUpdateMessage{},
+	"session_timeline":    SessionTimelineMessage{},
+	"station":             StationMessage{},
+	"link_anomalies":      LinkAnomaliesMessage{},
+	"link_anomaly":        LinkAnomalyMessage{},
+	"user_sessions":       UserSessionsMessage{},
+	"user_session_update": UserSessionUpdateMessage{},
+	"feature_status":      FeatureStatus{},
+	"session_history":     SessionHistoryMessage{},
+	"link_stats":          LinkStatsMessage{},
+	"link_stats_history":  LinkStatsHistoryMessage{},
+	"link_stats_query":    LinkStatsQueryMessage{},
+	"link_trends":         LinkTrendsMessage{},
+	"link_trend_event":    LinkTrendEventMessage{},
+	"neighbor_link_stats": NeighborLinkStatsMessage{},
+	"bulletin_queue":      BulletinQueueMessage{},
+	"settings":            SettingsMessage{},
+}
+
+// currentBufferInfo describes the monitor buffer.
+func currentBufferInfo() BufferInfo {
+	minSeq, maxSeq, count := dataBuffer.getInfo()
+	return BufferInfo{MinSeq: minSeq, MaxSeq: maxSeq, Count: count, Capacity: bufferSize}
+}
+
+// newLinkStatsMessage builds the link_stats message for a snapshot.
+func newLinkStatsMessage(snap *LinkStatsSnapshot) *LinkStatsMessage {
+	return &LinkStatsMessage{
+		Type:      "link_stats",
+		Timestamp: snap.Timestamp.Format(time.RFC3339),
+		System:    snap.System,
+		Ports:     snap.Ports,
+	}
+}
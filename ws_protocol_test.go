@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWebsocketCommands(t *testing.T) {
+	oldBuffer, oldTracker := dataBuffer, sessionTrackerRef
+	t.Cleanup(func() { dataBuffer, sessionTrackerRef = oldBuffer, oldTracker })
+	dataBuffer = newCircularBuffer(10)
+	dataBuffer.add(1, `{"seq":1,"type":"log"}`)
+	dataBuffer.add(2, `{"seq":2,"type":"log"}`)
+	sessionTrackerRef = nil
+
+	wc, client := websocketPair(t)
+	go wc.writeLoop()
+	session := &wsSession{out: wc, role: RoleViewer}
+
+	tests := []struct {
+		cmd  string
+		want []string // messages in reply, as JSON to compare fields of
+	}{
+		{`{"cmd":"status","id":1}`, []string{`{"type":"status","id":1}`}},
+		{`{"cmd":"nope","id":"x"}`, []string{`{"type":"error","id":"x","cmd":"nope","code":"unknown_command"}`}},
+		{`not json`, []string{`{"type":"error","code":"bad_request"}`}},
+		{`{"cmd":"status","id":{}}`, []string{`{"type":"error","code":"bad_request"}`}},
+		{`{"cmd":"get_settings","id":2}`, []string{`{"type":"error","id":2,"code":"permission_denied"}`}},
+		{`{"cmd":"hello","id":3,"protocol":99}`, []string{`{"type":"error","id":3,"code":"unsupported_protocol"}`}},
+		{`{"cmd":"hello","id":4,"protocol":1}`, []string{`{"type":"hello","id":4,"protocol":1,"compress":false}`}},
+		{`{"cmd":"latest","id":5}`, []string{`{"seq":1}`, `{"seq":2}`, `{"type":"ack","id":5,"cmd":"latest","count":2}`}},
+		{`{"cmd":"latest","id":6,"limit":"all"}`, []string{`{"type":"error","id":6,"code":"invalid_params"}`}},
+		{`{"cmd":"get_sessions","id":7}`, []string{`{"type":"error","id":7,"code":"unavailable"}`}},
+		{`{"cmd":"feature_status","id":8,"feature":"fax"}`, []string{`{"type":"error","id":8,"code":"invalid_params"}`}},
+	}
+	for _, tt := range tests {
+		session.handle([]byte(tt.cmd))
+		for _, want := range tt.want {
+			client.SetReadDeadline(time.Now().Add(5 * time.Second))
+			_, got, err := client.ReadMessage()
+			if err != nil {
+				t.Fatalf("%s: read: %v", tt.cmd, err)
+			}
+			var gotMsg, wantMsg map[string]interface{}
+			if err := json.Unmarshal(got, &gotMsg); err != nil {
+				t.Fatalf("%s: reply %s: %v", tt.cmd, got, err)
+			}
+			json.Unmarshal([]byte(want), &wantMsg)
+			for k, v := range wantMsg {
+				if !reflect.DeepEqual(gotMsg[k], v) {
+					t.Errorf("%s: reply %s, want %s = %v", tt.cmd, got, k, v)
+				}
+			}
+			if gotMsg["type"] == "hello" && slices.Contains(gotMsg["commands"].([]interface{}), "get_settings") {
+				t.Errorf("hello lists commands a viewer may not run: %v", gotMsg["commands"])
+			}
+		}
+	}
+}
+
+func TestWebsocketSchema(t *testing.T) {
+	data, err := json.Marshal(wsSchema())
+	if err != nil {
+		t.Fatalf("marshal schema: %v", err)
+	}
+	var schema struct {
+		Commands map[string]struct {
+			Request struct {
+				Properties map[string]interface{} `json:"properties"`
+			} `json:"request"`
+			Replies []struct {
+				Ref string `json:"$ref"`
+			} `json:"replies"`
+		} `json:"commands"`
+		Messages map[string]struct {
+			Ref string `json:"$ref"`
+		} `json:"messages"`
+		Defs map[string]struct {
+			Properties map[string]interface{} `json:"properties"`
+		} `json:"$defs"`
+	}
+	if err := json.Unmarshal(data, &schema); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(schema.Commands) != len(wsCommands) {
+		t.Errorf("schema has %d commands, want %d", len(schema.Commands), len(wsCommands))
+	}
+	if props := schema.Commands["load_before"].Request.Properties; props["before_seq"] == nil || props["id"] == nil {
+		t.Errorf("load_before request properties = %v", props)
+	}
+	for name, cmd := range schema.Commands {
+		for _, r := range cmd.Replies {
+			if _, ok := schema.Messages[strings.TrimPrefix(r.Ref, "#/messages/")]; !ok {
+				t.Errorf("%s replies with %s, which is not in the schema", name, r.Ref)
+			}
+		}
+	}
+	for _, ref := range schemaRefs(string(data)) {
+		if _, ok := schema.Defs[strings.TrimPrefix(ref, "#/$defs/")]; !ok && strings.HasPrefix(ref, "#/$defs/") {
+			t.Errorf("dangling %s", ref)
+		}
+	}
+
+	// Every field a message marshals is in its schema
+	for name, v := range wsMessageTypes {
+		def := schema.Defs[strings.TrimPrefix(schema.Messages[name].Ref, "#/$defs/")]
+		var fields map[string]interface{}
+		data, _ := json.Marshal(v)
+		json.Unmarshal(data, &fields)
+		for k := range fields {
+			if _, ok := def.Properties[k]; !ok {
+				t.Errorf("%s message field %s is not in its schema", name, k)
+			}
+		}
+	}
+}
+
+// schemaRefs returns every "$ref" value in a JSON document.
+func schemaRefs(doc string) []string {
+	var refs []string
+	for _, part := range strings.Split(doc, `"$ref":"`)[1:] {
+		refs = append(refs, part[:strings.IndexByte(part, '"')])
+	}
+	return refs
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// jsonSchemaBuilder derives JSON Schemas from Go types the way
+// encoding/json marshals them, collecting named structs under $defs, or
+// wherever refPrefix points. The /ws schema and the OpenAPI document are
+// built from the types the server actually sends, so they cannot drift
+// from them.
+type jsonSchemaBuilder struct {
+	defs      map[string]interface{}
+	refPrefix string // "" = "#/$defs/"
+}
+
+var (
+	timeType      = reflect.TypeOf(time.Time{})
+	rawType       = reflect.TypeOf(json.RawMessage{})
+	requestIDType = reflect.TypeOf(RequestID{})
+)
+
+// schema returns the schema for t, a $ref for named structs.
+func (b *jsonSchemaBuilder) schema(t reflect.Type) map[string]interface{} {
+	switch t {
+	case timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case rawType:
+		return map[string]interface{}{}
+	case requestIDType:
+		return map[string]interface{}{"type": []string{"string", "number"}}
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		return b.schema(t.Elem())
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string", "contentEncoding": "base64"}
+		}
+		return map[string]interface{}{"type": "array", "items": b.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": b.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return b.object(t)
+		}
+		if _, ok := b.defs[t.Name()]; !ok {
+			b.defs[t.Name()] = nil // placeholder for recursive types
+			b.defs[t.Name()] = b.object(t)
+		}
+		prefix := b.refPrefix
+		if prefix == "" {
+			prefix = "#/$defs/"
+		}
+		return map[string]interface{}{"$ref": prefix + t.Name()}
+	}
+	// Interfaces and anything else: any value
+	return map[string]interface{}{}
+}
+
+// object returns the schema of a struct's fields. Fields that are not
+// omitempty are required, and nil slices, maps and pointers may be null.
+func (b *jsonSchemaBuilder) object(t reflect.Type) map[string]interface{} {
+	props := map[string]interface{}{}
+	var required []string
+	b.fields(t, props, &required)
+	s := map[string]interface{}{"type": "object", "properties": props}
+	if len(required) > 0 {
+		sort.Strings(required)
+		s["required"] = required
+	}
+	return s
+}
+
+func (b *jsonSchemaBuilder) fields(t reflect.Type, props map[string]interface{}, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				b.fields(ft, props, required)
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		if _, ok := props[name]; ok {
+			continue
+		}
+		omitempty := strings.Contains(opts, "omitempty")
+		var s map[string]interface{}
+		if strings.Contains(opts, "string") {
+			s = map[string]interface{}{"type": "string"}
+		} else {
+			s = b.schema(f.Type)
+		}
+		switch f.Type.Kind() {
+		case reflect.Pointer, reflect.Slice, reflect.Map:
+			if !omitempty && f.Type != rawType && f.Type != requestIDType {
+				s = map[string]interface{}{"anyOf": []interface{}{s, map[string]interface{}{"type": "null"}}}
+			}
+		}
+		props[name] = s
+		if !omitempty {
+			*required = append(*required, name)
+		}
+	}
+}
+
+// wsSchema returns the /ws protocol's schema: a request schema per command
+// and a schema per message type, with shared types under $defs.
+func wsSchema() map[string]interface{} {
+	b := &jsonSchemaBuilder{defs: map[string]interface{}{}}
+
+	commands := map[string]interface{}{}
+	for name, cmd := range wsCommands {
+		request := map[string]interface{}{"type": "object", "properties": map[string]interface{}{}}
+		var required []string
+		if cmd.params != nil {
+			request = b.object(reflect.TypeOf(cmd.params))
+			required, _ = request["required"].([]string)
+		}
+		props := request["properties"].(map[string]interface{})
+		props["cmd"] = map[string]interface{}{"const": name}
+		props["id"] = b.schema(requestIDType)
+		required = append([]string{"cmd"}, required...)
+		request["required"] = required
+
+		replies := make([]interface{}, len(cmd.replies))
+		for i, r := range cmd.replies {
+			replies[i] = map[string]interface{}{"$ref": "#/messages/" + r}
+		}
+		commands[name] = map[string]interface{}{
+			"description": cmd.doc,
+			"role":        cmd.role,
+			"request":     request,
+			"replies":     replies,
+		}
+	}
+
+	messages := map[string]interface{}{}
+	for name, v := range wsMessageTypes {
+		s := b.schema(reflect.TypeOf(v))
+		s["properties"] = map[string]interface{}{"type": map[string]interface{}{"const": name}}
+		s["required"] = []string{"type"}
+		messages[name] = s
+	}
+
+	return map[string]interface{}{
+		"$schema":     "https://json-schema.org/draft/2020-12/schema",
+		"title":       "tarpn-mon WebSocket protocol",
+		"description": "Commands sent to /ws and the messages it sends. Replies carry the command's id; an error message replaces the reply when a command fails.",
+		"protocol":    wsProtocolVersion,
+		"minProtocol": wsProtocolMin,
+		"server":      Version,
+		"commands":    commands,
+		"messages":    messages,
+		"$defs":       b.defs,
+	}
+}
+
+// schemaHandler serves /api/schema: JSON Schemas for the /ws protocol.
+func schemaHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/schema+json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(wsSchema())
+}